@@ -0,0 +1,343 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/grafana/xk6-dns/dnstest"
+	"github.com/miekg/dns"
+)
+
+// defaultServerAddress is the default address servers listen on, a port picked by
+// the kernel on the loopback interface.
+const defaultServerAddress = "127.0.0.1:0"
+
+// ServerOptions holds the options of a Server.
+type ServerOptions struct {
+	// Address holds the address the server listens on, in the ip[:port] format. It
+	// defaults to a port picked by the kernel on the loopback interface.
+	Address string `js:"address"`
+
+	// Transports holds the transport protocols the server listens on, TransportUDP
+	// and TransportTCP. It defaults to both.
+	Transports []Transport `js:"transports"`
+
+	// Zone holds the zone the server answers queries from, unless a handler is used.
+	Zone *ZoneOptions `js:"zone"`
+
+	// Latency holds the artificial latency added before responding to a query.
+	Latency time.Duration `js:"-"`
+
+	// Jitter holds the maximum random latency added on top of Latency.
+	Jitter time.Duration `js:"-"`
+
+	// Rcodes holds the response codes injected at random, in place of the answers,
+	// along with the rate of queries they are injected in.
+	Rcodes []RcodeInjection `js:"injectRcodes"`
+
+	// OnQuery is called with the outcome of every query the server answers, or drops.
+	OnQuery func(ServedQuery) `js:"-"`
+}
+
+// RcodeInjection holds a response code injected in a rate of a Server's responses.
+type RcodeInjection struct {
+	// Rcode holds the mnemonic of the response code, such as SERVFAIL, or its number.
+	Rcode string `js:"rcode"`
+
+	// Rate holds the rate of queries it is injected in, between 0 and 1.
+	Rate float64 `js:"rate"`
+}
+
+// ZoneOptions holds the content of a zone served by a Server.
+type ZoneOptions struct {
+	// Name holds the name of the zone's apex.
+	Name string `js:"name"`
+
+	// Records holds the records of the zone, in presentation format. Names relative
+	// to the zone's apex are accepted. Wildcard records, such as *.k6.test., are
+	// supported. A SOA record is expected for negative answers to hold one.
+	Records []string `js:"records"`
+}
+
+// ServedQuery holds the outcome of a query answered, or dropped, by a Server.
+type ServedQuery struct {
+	// Name holds the queried name.
+	Name string
+
+	// Type holds the mnemonic of the queried type.
+	Type string
+
+	// Transport holds the transport protocol the query was received over.
+	Transport Transport
+
+	// Rcode holds the mnemonic of the response's code, or is empty if the query
+	// was dropped.
+	Rcode string
+
+	// Injected is true if the response code was injected.
+	Injected bool
+
+	// Duration holds the time elapsed from receiving the query to responding to it,
+	// including the artificial latency.
+	Duration time.Duration
+}
+
+// ServerHandler answers a query received by a Server. Returning a nil response drops
+// the query, and returning an error answers it with a SERVFAIL response.
+type ServerHandler func(ctx context.Context, query *dns.Msg, transport Transport) (*dns.Msg, error)
+
+// Server is an in-process authoritative DNS server, answering the queries it receives
+// over UDP and TCP either from a zone, or using a handler.
+type Server struct {
+	options ServerOptions
+	handler ServerHandler
+	rcodes  []int
+
+	mu     sync.Mutex
+	server *dnstest.Server
+	addr   Nameserver
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewServer creates a new Server answering queries using the handler, or from the
+// options' zone if the handler is nil.
+func NewServer(options ServerOptions, handler ServerHandler) (*Server, error) {
+	if len(options.Transports) == 0 {
+		options.Transports = []Transport{TransportUDP, TransportTCP}
+	}
+
+	if options.Address == "" {
+		options.Address = defaultServerAddress
+	}
+
+	for _, transport := range options.Transports {
+		if transport != TransportUDP && transport != TransportTCP {
+			return nil, fmt.Errorf(
+				"invalid server transport %q; expected %q or %q",
+				transport, TransportUDP, TransportTCP,
+			)
+		}
+	}
+
+	if _, err := parseNameserverAddr(options.Address); err != nil {
+		return nil, fmt.Errorf("invalid server address: %w", err)
+	}
+
+	if options.Latency < 0 || options.Jitter < 0 {
+		return nil, errors.New("latency and jitter must not be negative")
+	}
+
+	switch {
+	case handler != nil && options.Zone != nil:
+		return nil, errors.New("either a zone or a handler must be provided, not both")
+	case handler == nil && options.Zone == nil:
+		return nil, errors.New("either a zone or a handler must be provided")
+	case handler == nil:
+		zone, err := dnstest.NewZone(options.Zone.Name, options.Zone.Records...)
+		if err != nil {
+			return nil, err
+		}
+
+		handler = func(_ context.Context, query *dns.Msg, _ Transport) (*dns.Msg, error) {
+			return zone.Answer(query), nil
+		}
+	}
+
+	server := &Server{options: options, handler: handler}
+
+	var total float64
+	for _, injection := range options.Rcodes {
+		rcode, err := parseCode(injection.Rcode, dns.StringToRcode)
+		if err != nil {
+			return nil, fmt.Errorf("invalid injected rcode: %w", err)
+		}
+
+		if injection.Rate < 0 || injection.Rate > 1 {
+			return nil, fmt.Errorf("the rate of injected rcode %s must be between 0 and 1", injection.Rcode)
+		}
+
+		total += injection.Rate
+		server.rcodes = append(server.rcodes, rcode)
+	}
+
+	if total > 1 {
+		return nil, errors.New("the rates of injected rcodes must not add up to more than 1")
+	}
+
+	return server, nil
+}
+
+// Start starts listening, and returns the address the server listens on.
+func (s *Server) Start() (Nameserver, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ctx != nil {
+		return Nameserver{}, errors.New("the server is already started")
+	}
+
+	addr, err := parseNameserverAddr(s.options.Address)
+	if err != nil {
+		return Nameserver{}, err
+	}
+
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+
+	networks := make([]string, 0, len(s.options.Transports))
+	for _, transport := range s.options.Transports {
+		networks = append(networks, string(transport))
+	}
+
+	// Every transport listens on the same port, the one picked by the first
+	// listener when none is requested.
+	listenAddr := (&net.TCPAddr{IP: addr.IP, Port: int(addr.Port)}).String()
+	if s.server, err = dnstest.Start(listenAddr, s.handle(), networks...); err != nil {
+		s.shutdown()
+		return Nameserver{}, err
+	}
+
+	if addr, err = parseNameserverAddr(s.server.Addr); err != nil {
+		s.shutdown()
+		return Nameserver{}, err
+	}
+
+	s.addr = addr
+
+	return addr, nil
+}
+
+// Addr returns the address the server listens on, once started.
+func (s *Server) Addr() Nameserver {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.addr
+}
+
+// Stop stops the server, and waits for the queries being answered to complete. The
+// server can be started again afterward.
+func (s *Server) Stop() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.shutdown()
+}
+
+// shutdown stops the server's listeners, and resets its state for it to be started
+// again. It expects the server's lock to be held.
+func (s *Server) shutdown() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+
+	if s.server != nil {
+		s.server.Close()
+	}
+
+	s.server = nil
+	s.addr = Nameserver{}
+	s.ctx, s.cancel = nil, nil
+}
+
+// handle returns the miekg/dns handler of the queries received by the server.
+func (s *Server) handle() dns.HandlerFunc {
+	ctx := s.ctx
+
+	return func(w dns.ResponseWriter, query *dns.Msg) {
+		start := time.Now()
+
+		transport := TransportTCP
+		if dnstest.IsUDP(w) {
+			transport = TransportUDP
+		}
+
+		served := ServedQuery{Transport: transport}
+		if len(query.Question) > 0 {
+			served.Name = query.Question[0].Name
+			served.Type = dns.Type(query.Question[0].Qtype).String()
+		}
+
+		response := s.inject(query)
+		served.Injected = response != nil
+
+		if response == nil {
+			var err error
+			if response, err = s.handler(ctx, query, transport); err != nil {
+				// Queries interrupted by the server stopping are dropped.
+				if ctx.Err() != nil {
+					return
+				}
+
+				response = new(dns.Msg)
+				response.SetRcode(query, dns.RcodeServerFailure)
+			}
+		}
+
+		if latency := s.latency(); latency > 0 {
+			select {
+			case <-time.After(latency):
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		if response != nil {
+			if transport == TransportUDP {
+				response.Truncate(dnstest.UDPSize(query))
+			}
+
+			if err := w.WriteMsg(response); err == nil {
+				served.Rcode = codeString(response.Rcode, dns.RcodeToString)
+			}
+		}
+
+		served.Duration = time.Since(start)
+
+		if s.options.OnQuery != nil {
+			s.options.OnQuery(served)
+		}
+	}
+}
+
+// inject returns a response holding one of the injected response codes, picked
+// according to their rates, or nil if none is to be injected.
+func (s *Server) inject(query *dns.Msg) *dns.Msg {
+	if len(s.rcodes) == 0 {
+		return nil
+	}
+
+	pick := rand.Float64() //nolint:gosec // injections don't need to be cryptographically random
+	for i, injection := range s.options.Rcodes {
+		if pick -= injection.Rate; pick >= 0 {
+			continue
+		}
+
+		response := new(dns.Msg)
+		response.SetRcode(query, s.rcodes[i])
+
+		// Extended response codes are carried by an OPT record.
+		if s.rcodes[i] > 0xF {
+			response.SetEdns0(dns.DefaultMsgSize, false)
+		}
+
+		return response
+	}
+
+	return nil
+}
+
+// latency returns the artificial latency to add before responding to a query.
+func (s *Server) latency() time.Duration {
+	latency := s.options.Latency
+	if s.options.Jitter > 0 {
+		latency += rand.N(s.options.Jitter) //nolint:gosec // jitter doesn't need to be cryptographically random
+	}
+
+	return latency
+}
@@ -0,0 +1,254 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServer(t *testing.T) {
+	t.Parallel()
+
+	testZone := &ZoneOptions{
+		Name: "k6.test",
+		Records: []string{
+			"@ 3600 IN SOA ns.k6.test. admin.k6.test. 7 3600 600 86400 300",
+			"www 60 IN A " + primaryTestIPv4,
+		},
+	}
+
+	t.Run("zones are served over UDP and TCP", func(t *testing.T) {
+		t.Parallel()
+
+		var mu sync.Mutex
+		var served []ServedQuery
+
+		server, err := NewServer(ServerOptions{Zone: testZone, OnQuery: func(query ServedQuery) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			served = append(served, query)
+		}}, nil)
+		require.NoError(t, err)
+
+		nameserver, err := server.Start()
+		require.NoError(t, err)
+		t.Cleanup(server.Stop)
+
+		assert.NotZero(t, nameserver.Port)
+		assert.Equal(t, nameserver, server.Addr())
+
+		for _, transport := range []Transport{TransportUDP, TransportTCP} {
+			options := NewDNSClient().Options()
+			options.Transport = transport
+
+			resolution, err := NewDNSClient().ResolveWithOptions(context.Background(), "www.k6.test", "A", nameserver, options)
+			require.NoError(t, err)
+			assert.Equal(t, []string{primaryTestIPv4}, resolution.IPs)
+		}
+
+		_, err = NewDNSClient().Resolve(context.Background(), "missing.k6.test", "A", nameserver)
+
+		var dnsErr *Error
+		require.ErrorAs(t, err, &dnsErr)
+		assert.Equal(t, NonExistingDomain, dnsErr.Kind)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		require.Len(t, served, 3)
+		assert.Equal(t, ServedQuery{
+			Name:      "www.k6.test.",
+			Type:      "A",
+			Transport: TransportTCP,
+			Rcode:     "NOERROR",
+			Duration:  served[1].Duration,
+		}, served[1])
+		assert.Equal(t, "NXDOMAIN", served[2].Rcode)
+	})
+
+	t.Run("handlers answer queries", func(t *testing.T) {
+		t.Parallel()
+
+		server, err := NewServer(ServerOptions{}, func(_ context.Context, query *dns.Msg, _ Transport) (*dns.Msg, error) {
+			if query.Question[0].Name == "drop.k6.test." {
+				return nil, nil
+			}
+
+			response := new(dns.Msg)
+			response.SetRcode(query, dns.RcodeNotAuth)
+
+			return response, nil
+		})
+		require.NoError(t, err)
+
+		nameserver, err := server.Start()
+		require.NoError(t, err)
+		t.Cleanup(server.Stop)
+
+		_, err = NewDNSClient().Resolve(context.Background(), "www.k6.test", "A", nameserver)
+
+		var dnsErr *Error
+		require.ErrorAs(t, err, &dnsErr)
+		assert.Equal(t, NotAuth, dnsErr.Kind)
+
+		query := new(dns.Msg)
+		query.SetQuestion("drop.k6.test.", dns.TypeA)
+
+		client := &dns.Client{Timeout: 50 * time.Millisecond}
+		_, _, err = client.Exchange(query, nameserver.Addr())
+		assert.Error(t, err)
+	})
+
+	t.Run("latency is added to responses", func(t *testing.T) {
+		t.Parallel()
+
+		server, err := NewServer(ServerOptions{Zone: testZone, Latency: 50 * time.Millisecond, Jitter: 10 * time.Millisecond}, nil)
+		require.NoError(t, err)
+
+		nameserver, err := server.Start()
+		require.NoError(t, err)
+		t.Cleanup(server.Stop)
+
+		start := time.Now()
+		_, err = NewDNSClient().Resolve(context.Background(), "www.k6.test", "A", nameserver)
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	})
+
+	t.Run("rcodes are injected at the requested rate", func(t *testing.T) {
+		t.Parallel()
+
+		var mu sync.Mutex
+		var injected int
+
+		server, err := NewServer(ServerOptions{
+			Zone:   testZone,
+			Rcodes: []RcodeInjection{{Rcode: "SERVFAIL", Rate: 1}},
+			OnQuery: func(query ServedQuery) {
+				mu.Lock()
+				defer mu.Unlock()
+
+				if query.Injected && query.Rcode == "SERVFAIL" {
+					injected++
+				}
+			},
+		}, nil)
+		require.NoError(t, err)
+
+		nameserver, err := server.Start()
+		require.NoError(t, err)
+		t.Cleanup(server.Stop)
+
+		for i := 0; i < 3; i++ {
+			_, err = NewDNSClient().Resolve(context.Background(), "www.k6.test", "A", nameserver)
+
+			var dnsErr *Error
+			require.ErrorAs(t, err, &dnsErr)
+			assert.Equal(t, ServerFailure, dnsErr.Kind)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		assert.Equal(t, 3, injected)
+	})
+
+	t.Run("large UDP responses are truncated", func(t *testing.T) {
+		t.Parallel()
+
+		records := []string{"@ 3600 IN SOA ns.k6.test. admin.k6.test. 7 3600 600 86400 300"}
+		for i := 0; i < 64; i++ {
+			records = append(records, "big 60 IN A 192.0.2."+strconv.Itoa(i))
+		}
+
+		server, err := NewServer(ServerOptions{Zone: &ZoneOptions{Name: "k6.test", Records: records}}, nil)
+		require.NoError(t, err)
+
+		nameserver, err := server.Start()
+		require.NoError(t, err)
+		t.Cleanup(server.Stop)
+
+		query := new(dns.Msg)
+		query.SetQuestion("big.k6.test.", dns.TypeA)
+
+		response, _, err := new(dns.Client).Exchange(query, nameserver.Addr())
+		require.NoError(t, err)
+		assert.True(t, response.Truncated)
+
+		response, _, err = (&dns.Client{Net: "tcp"}).Exchange(query, nameserver.Addr())
+		require.NoError(t, err)
+		assert.False(t, response.Truncated)
+		assert.Len(t, response.Answer, 64)
+	})
+
+	t.Run("stopped servers no longer answer", func(t *testing.T) {
+		t.Parallel()
+
+		server, err := NewServer(ServerOptions{Zone: testZone, Transports: []Transport{TransportTCP}}, nil)
+		require.NoError(t, err)
+
+		nameserver, err := server.Start()
+		require.NoError(t, err)
+
+		_, err = server.Start()
+		assert.Error(t, err)
+
+		server.Stop()
+
+		_, err = net.DialTimeout("tcp", nameserver.Addr(), time.Second)
+		assert.Error(t, err)
+	})
+
+	t.Run("stopped servers can be started again", func(t *testing.T) {
+		t.Parallel()
+
+		server, err := NewServer(ServerOptions{Zone: testZone}, nil)
+		require.NoError(t, err)
+
+		_, err = server.Start()
+		require.NoError(t, err)
+
+		server.Stop()
+		assert.Zero(t, server.Addr())
+
+		nameserver, err := server.Start()
+		require.NoError(t, err)
+		t.Cleanup(server.Stop)
+
+		resolution, err := NewDNSClient().ResolveWithOptions(
+			context.Background(), "www.k6.test", "A", nameserver, ClientOptions{},
+		)
+		require.NoError(t, err)
+		assert.Equal(t, []string{primaryTestIPv4}, resolution.IPs)
+	})
+
+	t.Run("invalid options are rejected", func(t *testing.T) {
+		t.Parallel()
+
+		handler := func(context.Context, *dns.Msg, Transport) (*dns.Msg, error) { return nil, nil }
+
+		for _, options := range []ServerOptions{
+			{},
+			{Zone: testZone, Transports: []Transport{TransportTLS}},
+			{Zone: testZone, Address: "localhost:53"},
+			{Zone: testZone, Latency: -time.Second},
+			{Zone: testZone, Rcodes: []RcodeInjection{{Rcode: "OOPS", Rate: 0.5}}},
+			{Zone: testZone, Rcodes: []RcodeInjection{{Rcode: "SERVFAIL", Rate: 0.6}, {Rcode: "REFUSED", Rate: 0.6}}},
+			{Zone: &ZoneOptions{}},
+		} {
+			_, err := NewServer(options, nil)
+			assert.Error(t, err, "%+v", options)
+		}
+
+		_, err := NewServer(ServerOptions{Zone: testZone}, handler)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,243 @@
+package dns
+
+import (
+	"cmp"
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// CacheMode represents the scope of the cache resolutions are served from.
+type CacheMode string
+
+const (
+	// CacheModeNone disables caching. It is the default.
+	CacheModeNone CacheMode = "none"
+
+	// CacheModeVU caches resolutions per Client. The k6 module creates a Client
+	// per VU, thus its name.
+	CacheModeVU CacheMode = "vu"
+
+	// CacheModeShared caches resolutions in a cache shared by every Client sharing
+	// the same resources. The k6 module shares its cache between all VUs.
+	CacheModeShared CacheMode = "shared"
+)
+
+// defaultCacheMaxEntries is the default maximum number of entries of a cache.
+const defaultCacheMaxEntries = 10000
+
+// CacheOptions holds the options controlling how resolutions are cached.
+type CacheOptions struct {
+	// Mode holds the scope of the cache. It defaults to CacheModeNone.
+	Mode CacheMode `js:"mode"`
+
+	// MaxEntries holds the maximum number of entries of the cache. Once reached, the
+	// least recently used entries are evicted. It defaults to 10000.
+	MaxEntries int `js:"maxEntries"`
+
+	// MinTTL holds the minimum time, in seconds, an entry is cached for, regardless
+	// of the TTL of the records it holds.
+	MinTTL uint32 `js:"minTTL"`
+
+	// MaxTTL holds the maximum time, in seconds, an entry is cached for, regardless
+	// of the TTL of the records it holds. Zero means no maximum.
+	MaxTTL uint32 `js:"maxTTL"`
+}
+
+// enabled returns true if the options require resolutions to be cached.
+func (o CacheOptions) enabled() bool {
+	return o.Mode == CacheModeVU || o.Mode == CacheModeShared
+}
+
+// ttl clamps the ttl to the range defined by the options.
+func (o CacheOptions) ttl(ttl uint32) time.Duration {
+	ttl = max(ttl, o.MinTTL)
+	if o.MaxTTL > 0 {
+		ttl = min(ttl, o.MaxTTL)
+	}
+
+	return time.Duration(ttl) * time.Second
+}
+
+// maxEntries returns the maximum number of entries defined by the options, or
+// its default value.
+func (o CacheOptions) maxEntries() int {
+	if o.MaxEntries <= 0 {
+		return defaultCacheMaxEntries
+	}
+
+	return o.MaxEntries
+}
+
+// resolutionCache is a TTL-aware cache of resolutions, emulating the cache of
+// a stub resolver.
+//
+// Positive resolutions are cached for the lowest TTL of their answer records, and
+// negative ones, NXDOMAIN and NODATA responses, for the negative TTL of the SOA
+// record of their authority section, as per [RFC2308]. The least recently used
+// entries are evicted once the cache is full.
+//
+// [RFC2308]: https://www.iana.org/go/rfc2308
+type resolutionCache struct {
+	mu      sync.Mutex
+	entries map[cacheKey]*list.Element
+	lru     *list.List
+}
+
+// cacheKey identifies a cached resolution.
+//
+// Besides the question and nameserver, it holds the options changing how the query is
+// exchanged, or whether its response is accepted, for a resolution not to be served a
+// response it would have received differently, or rejected.
+type cacheKey struct {
+	nameserver string
+	name       string
+	qtype      uint16
+
+	transport          Transport
+	tls                TLSOptions
+	localAddress       string
+	iface              string
+	randomizeCase      bool
+	responseValidation ResponseValidationMode
+	tsigKey            string
+}
+
+// cacheEntry holds a cached resolution.
+type cacheEntry struct {
+	key        cacheKey
+	resolution Resolution
+	err        error
+	expires    time.Time
+}
+
+// newResolutionCache creates a new, empty, resolutionCache.
+func newResolutionCache() *resolutionCache {
+	return &resolutionCache{
+		entries: make(map[cacheKey]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+// newCacheKey returns the key of the resolution of the given name and type against
+// the nameserver, using the options.
+func newCacheKey(name string, qtype uint16, nameserver Nameserver, options ClientOptions) cacheKey {
+	responseValidation := options.ResponseValidation
+	if !responseValidation.enabled() {
+		responseValidation = ResponseValidationNone
+	}
+
+	return cacheKey{
+		nameserver:         nameserver.Addr(),
+		name:               strings.ToLower(dns.Fqdn(name)),
+		qtype:              qtype,
+		transport:          cmp.Or(options.Transport, TransportUDP),
+		tls:                options.TLS,
+		localAddress:       options.LocalAddress,
+		iface:              options.Interface,
+		randomizeCase:      options.RandomizeCase,
+		responseValidation: responseValidation,
+		tsigKey:            options.TSIG.keyName(),
+	}
+}
+
+// get returns the cached resolution matching the key, and whether it was found.
+func (c *resolutionCache) get(key cacheKey, now time.Time) (cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[key]
+	if !ok {
+		return cacheEntry{}, false
+	}
+
+	entry := elem.Value.(*cacheEntry) //nolint:forcetypeassert
+	if !now.Before(entry.expires) {
+		c.lru.Remove(elem)
+		delete(c.entries, key)
+		return cacheEntry{}, false
+	}
+
+	c.lru.MoveToFront(elem)
+
+	found := *entry
+	found.resolution.IPs = append([]string(nil), entry.resolution.IPs...)
+	found.resolution.Records = append([]any(nil), entry.resolution.Records...)
+	found.resolution.answer = append([]string(nil), entry.resolution.answer...)
+
+	return found, true
+}
+
+// store caches the outcome of the resolution matching the key, as computed from the
+// nameserver's response. Responses that must not be cached, such as server failures,
+// or negative responses without a SOA record, are ignored.
+func (c *resolutionCache) store(
+	key cacheKey,
+	response *dns.Msg,
+	resolution Resolution,
+	options CacheOptions,
+	now time.Time,
+) {
+	ttl, cacheable := responseTTL(response)
+	if !cacheable {
+		return
+	}
+
+	entry := &cacheEntry{
+		key:        key,
+		resolution: Resolution{IPs: resolution.IPs, Records: resolution.Records, answer: resolution.answer},
+		expires:    now.Add(options.ttl(ttl)),
+	}
+	if response.Rcode != dns.RcodeSuccess {
+		entry.err = newDNSError(response.Rcode, "DNS query failed")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+	} else {
+		c.entries[key] = c.lru.PushFront(entry)
+	}
+
+	for c.lru.Len() > options.maxEntries() {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key) //nolint:forcetypeassert
+	}
+}
+
+// responseTTL returns for how long, in seconds, the response can be cached, and
+// whether it can be cached at all.
+func responseTTL(response *dns.Msg) (uint32, bool) {
+	isNegative := response.Rcode == dns.RcodeNameError ||
+		(response.Rcode == dns.RcodeSuccess && len(response.Answer) == 0)
+
+	if isNegative {
+		// Negative responses are cached for the minimum of the SOA record's TTL
+		// and MINIMUM field, and can't be cached without a SOA record.
+		for _, rr := range response.Ns {
+			if soa, ok := rr.(*dns.SOA); ok {
+				return min(soa.Hdr.Ttl, soa.Minttl), true
+			}
+		}
+
+		return 0, false
+	}
+
+	if response.Rcode != dns.RcodeSuccess {
+		return 0, false
+	}
+
+	ttl := response.Answer[0].Header().Ttl
+	for _, rr := range response.Answer[1:] {
+		ttl = min(ttl, rr.Header().Ttl)
+	}
+
+	return ttl, true
+}
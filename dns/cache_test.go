@@ -0,0 +1,201 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_responseTTL(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		rcode         int
+		answer        []string
+		authority     []string
+		wantTTL       uint32
+		wantCacheable bool
+	}{
+		{
+			name:          "positive response uses the lowest answer TTL",
+			rcode:         dns.RcodeSuccess,
+			answer:        []string{"k6.test. 300 IN A 203.0.113.1", "k6.test. 60 IN A 203.0.113.11"},
+			wantTTL:       60,
+			wantCacheable: true,
+		},
+		{
+			name:          "NXDOMAIN response uses the SOA minimum when lower than its TTL",
+			rcode:         dns.RcodeNameError,
+			authority:     []string{"test. 3600 IN SOA ns.test. admin.test. 1 7200 3600 1209600 30"},
+			wantTTL:       30,
+			wantCacheable: true,
+		},
+		{
+			name:          "NODATA response uses the SOA TTL when lower than its minimum",
+			rcode:         dns.RcodeSuccess,
+			authority:     []string{"test. 10 IN SOA ns.test. admin.test. 1 7200 3600 1209600 30"},
+			wantTTL:       10,
+			wantCacheable: true,
+		},
+		{
+			name:          "negative response without SOA is not cacheable",
+			rcode:         dns.RcodeNameError,
+			wantCacheable: false,
+		},
+		{
+			name:          "server failure is not cacheable",
+			rcode:         dns.RcodeServerFailure,
+			authority:     []string{"test. 10 IN SOA ns.test. admin.test. 1 7200 3600 1209600 30"},
+			wantCacheable: false,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			response := new(dns.Msg)
+			response.Rcode = tt.rcode
+			for _, rr := range tt.answer {
+				response.Answer = append(response.Answer, mustNewRR(t, rr))
+			}
+			for _, rr := range tt.authority {
+				response.Ns = append(response.Ns, mustNewRR(t, rr))
+			}
+
+			gotTTL, gotCacheable := responseTTL(response)
+			assert.Equal(t, tt.wantCacheable, gotCacheable)
+			assert.Equal(t, tt.wantTTL, gotTTL)
+		})
+	}
+}
+
+func Test_resolutionCache(t *testing.T) {
+	t.Parallel()
+
+	response := new(dns.Msg)
+	response.Answer = []dns.RR{mustNewRR(t, "k6.test. 60 IN A 203.0.113.1")}
+	nameserver := Nameserver{IP: []byte{127, 0, 0, 1}, Port: 53}
+	now := time.Now()
+
+	t.Run("entries expire after their TTL clamped to the configured range", func(t *testing.T) {
+		t.Parallel()
+
+		cache := newResolutionCache()
+		key := newCacheKey("K6.test", dns.TypeA, nameserver, ClientOptions{})
+		cache.store(key, response, Resolution{IPs: []string{primaryTestIPv4}}, CacheOptions{MaxTTL: 10}, now)
+
+		entry, found := cache.get(newCacheKey("k6.test.", dns.TypeA, nameserver, ClientOptions{}), now.Add(9*time.Second))
+		require.True(t, found)
+		assert.Equal(t, []string{primaryTestIPv4}, entry.resolution.IPs)
+
+		_, found = cache.get(key, now.Add(10*time.Second))
+		assert.False(t, found)
+	})
+
+	t.Run("least recently used entries are evicted once full", func(t *testing.T) {
+		t.Parallel()
+
+		cache := newResolutionCache()
+		options := CacheOptions{MaxEntries: 2}
+		first := newCacheKey("first.test", dns.TypeA, nameserver, ClientOptions{})
+		second := newCacheKey("second.test", dns.TypeA, nameserver, ClientOptions{})
+		third := newCacheKey("third.test", dns.TypeA, nameserver, ClientOptions{})
+
+		cache.store(first, response, Resolution{}, options, now)
+		cache.store(second, response, Resolution{}, options, now)
+		_, _ = cache.get(first, now)
+		cache.store(third, response, Resolution{}, options, now)
+
+		_, found := cache.get(second, now)
+		assert.False(t, found)
+
+		_, found = cache.get(first, now)
+		assert.True(t, found)
+	})
+}
+
+func TestClient_ResolveWithCache(t *testing.T) {
+	t.Parallel()
+
+	var queries atomic.Int32
+	nameserver := startTestNameserver(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		queries.Add(1)
+
+		if r.Question[0].Name == "missing.test." {
+			response := new(dns.Msg)
+			response.SetRcode(r, dns.RcodeNameError)
+			response.Ns = []dns.RR{mustNewRR(t, "test. 60 IN SOA ns.test. admin.test. 1 7200 3600 1209600 60")}
+			assert.NoError(t, w.WriteMsg(response))
+
+			return
+		}
+
+		writeTestAnswer(t, w, r)
+	})
+
+	client := NewDNSClientWithOptions(ClientOptions{Cache: CacheOptions{Mode: CacheModeVU}})
+
+	for i := 0; i < 3; i++ {
+		resolution, err := client.ResolveWithOptions(context.Background(), testDomain, "A", nameserver, client.Options())
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{primaryTestIPv4}, resolution.IPs)
+		assert.True(t, resolution.CacheUsed)
+		assert.Equal(t, i > 0, resolution.CacheHit)
+
+		resolution, err = client.ResolveWithOptions(context.Background(), "missing.test", "A", nameserver, client.Options())
+
+		var dnsErr *Error
+		require.True(t, errors.As(err, &dnsErr))
+		assert.Equal(t, NonExistingDomain, dnsErr.Kind)
+		assert.Equal(t, i > 0, resolution.CacheHit)
+	}
+
+	assert.Equal(t, int32(2), queries.Load())
+}
+
+func TestClient_ResolveWithCacheAcrossOptions(t *testing.T) {
+	t.Parallel()
+
+	// The nameserver answers with a response failing validation.
+	var queries atomic.Int32
+	nameserver := startTestNameserver(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		queries.Add(1)
+
+		r.Question[0].Qtype = dns.TypeAAAA
+		writeTestAnswer(t, w, r)
+	})
+
+	client := NewDNSClient()
+	cache := CacheOptions{Mode: CacheModeVU}
+
+	lenient := ClientOptions{Cache: cache, ResponseValidation: ResponseValidationLenient}
+	resolution, err := client.ResolveWithOptions(context.Background(), testDomain, "A", nameserver, lenient)
+	require.NoError(t, err)
+	assert.False(t, resolution.CacheHit)
+
+	// A strict resolution isn't served the response only accepted in lenient mode.
+	strict := ClientOptions{Cache: cache, ResponseValidation: ResponseValidationStrict}
+	resolution, err = client.ResolveWithOptions(context.Background(), testDomain, "A", nameserver, strict)
+
+	var dnsErr *Error
+	require.ErrorAs(t, err, &dnsErr)
+	assert.Equal(t, MalformedResponse, dnsErr.Kind)
+	assert.False(t, resolution.CacheHit)
+
+	resolution, err = client.ResolveWithOptions(context.Background(), testDomain, "A", nameserver, lenient)
+	require.NoError(t, err)
+	assert.True(t, resolution.CacheHit)
+
+	assert.Equal(t, int32(2), queries.Load())
+}
@@ -0,0 +1,279 @@
+package dns
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// CaptureOptions controls which packets of a capture ParseCapture reads queries from.
+type CaptureOptions struct {
+	// Port holds the port of the nameservers queries are sent to. It defaults to 53.
+	Port uint16 `js:"port"`
+}
+
+// defaultCapturePort holds the port queries are read from by default.
+const defaultCapturePort = 53
+
+// Capture holds the DNS queries of a pcap or pcapng capture, along with their timing
+// and the replies captured for them. It is read-only once parsed, and safe to share
+// between VUs.
+type Capture struct {
+	queries []CapturedQuery
+
+	// duration holds the time elapsed between the first and the last query.
+	duration time.Duration
+}
+
+// CapturedQuery holds a DNS query read from a capture.
+type CapturedQuery struct {
+	// Packed holds the query in wire format, as captured.
+	Packed []byte
+
+	// Message holds the parsed query.
+	Message Message
+
+	// Transport holds the transport the query was sent over, either UDP or TCP.
+	Transport Transport
+
+	// Client and Server hold the addresses the query was sent from, and to.
+	Client, Server netip.AddrPort
+
+	// Offset holds the time elapsed between the first query of the capture and this one.
+	Offset time.Duration
+
+	// Delay holds the time elapsed between the previous query of the capture and this
+	// one, its inter-arrival time.
+	Delay time.Duration
+
+	// Reply holds the reply captured for the query, if any.
+	Reply *Message
+
+	// RTT holds the time elapsed between the query and its captured reply.
+	RTT time.Duration
+}
+
+// ParseCapture reads the DNS queries of a pcap or pcapng capture, in the order they
+// were captured, and matches them with the replies captured for them.
+//
+// Queries are read from UDP datagrams and TCP segments sent to the port of the options,
+// over Ethernet, Linux cooked, loopback or raw IP links. IP fragments are ignored, and
+// TCP streams are not reassembled, thus only the messages held whole by a single TCP
+// segment are read.
+func ParseCapture(r io.Reader, options CaptureOptions) (*Capture, error) {
+	packets, err := readCapturedPackets(r)
+	if err != nil {
+		return nil, err
+	}
+
+	port := options.Port
+	if port == 0 {
+		port = defaultCapturePort
+	}
+
+	capture := &Capture{}
+
+	// pending holds the index of the queries awaiting a reply.
+	pending := make(map[captureFlow]int)
+
+	var first, previous time.Time
+	for _, packet := range packets {
+		seg, ok := decodePacket(packet.linkType, packet.data)
+		if !ok || (seg.dst.Port() != port && seg.src.Port() != port) {
+			continue
+		}
+
+		for _, packed := range segmentMessages(seg) {
+			msg := new(dns.Msg)
+			if msg.Unpack(packed) != nil || len(msg.Question) == 0 {
+				continue
+			}
+
+			if msg.Response {
+				if seg.src.Port() != port {
+					continue
+				}
+
+				flow := newCaptureFlow(seg.dst, seg.src, seg.transport, msg)
+
+				i, ok := pending[flow]
+				if !ok {
+					continue
+				}
+
+				delete(pending, flow)
+
+				reply, err := newMessage(msg)
+				if err != nil {
+					continue
+				}
+
+				capture.queries[i].Reply = &reply
+				capture.queries[i].RTT = packet.time.Sub(first) - capture.queries[i].Offset
+
+				continue
+			}
+
+			if seg.dst.Port() != port {
+				continue
+			}
+
+			message, err := newMessage(msg)
+			if err != nil {
+				continue
+			}
+
+			if len(capture.queries) == 0 {
+				first, previous = packet.time, packet.time
+			}
+
+			pending[newCaptureFlow(seg.src, seg.dst, seg.transport, msg)] = len(capture.queries)
+
+			capture.queries = append(capture.queries, CapturedQuery{
+				Packed:    slices.Clone(packed),
+				Message:   message,
+				Transport: seg.transport,
+				Client:    seg.src,
+				Server:    seg.dst,
+				Offset:    packet.time.Sub(first),
+				Delay:     packet.time.Sub(previous),
+			})
+
+			previous = packet.time
+		}
+	}
+
+	if len(capture.queries) == 0 {
+		return nil, fmt.Errorf("the capture holds no DNS queries sent to port %d", port)
+	}
+
+	capture.duration = capture.queries[len(capture.queries)-1].Offset
+
+	return capture, nil
+}
+
+// captureFlow identifies a query, for its reply to be matched with it.
+type captureFlow struct {
+	client, server netip.AddrPort
+	transport      Transport
+	id             uint16
+	question       dns.Question
+}
+
+// newCaptureFlow returns the flow of a message exchanged between the client and server.
+func newCaptureFlow(client, server netip.AddrPort, transport Transport, msg *dns.Msg) captureFlow {
+	question := msg.Question[0]
+	question.Name = strings.ToLower(question.Name)
+
+	return captureFlow{client: client, server: server, transport: transport, id: msg.Id, question: question}
+}
+
+// segmentMessages returns the DNS messages held by a segment. UDP datagrams hold a
+// single message, while TCP segments hold messages prefixed by their length, of which
+// only the ones held whole are returned.
+func segmentMessages(seg segment) [][]byte {
+	if seg.transport == TransportUDP {
+		return [][]byte{seg.payload}
+	}
+
+	var messages [][]byte
+	for payload := seg.payload; len(payload) >= 2; {
+		length := int(binary.BigEndian.Uint16(payload))
+		if length == 0 || length > len(payload)-2 {
+			break
+		}
+
+		messages = append(messages, payload[2:2+length])
+		payload = payload[2+length:]
+	}
+
+	return messages
+}
+
+// Len returns the number of queries of the capture.
+func (c *Capture) Len() int {
+	return len(c.queries)
+}
+
+// Query returns the i-th query of the capture.
+func (c *Capture) Query(i int) CapturedQuery {
+	return c.queries[i]
+}
+
+// Duration returns the time elapsed between the first and the last query of the capture.
+func (c *Capture) Duration() time.Duration {
+	return c.duration
+}
+
+// errNoCapturedReply is returned when verifying a response against a query no reply
+// was captured for.
+var errNoCapturedReply = errors.New("no reply was captured for the query")
+
+// Verify compares the response to the reply captured for the query, and returns the
+// differences found, if any. The response code and the answer records are compared,
+// ignoring the order and TTL of the records, and the case of their owner name.
+func (q CapturedQuery) Verify(response Message) ([]string, error) {
+	if q.Reply == nil {
+		return nil, errNoCapturedReply
+	}
+
+	differences := []string{}
+
+	if !strings.EqualFold(q.Reply.Rcode, response.Rcode) {
+		differences = append(differences, fmt.Sprintf("expected rcode %s, got %s", q.Reply.Rcode, response.Rcode))
+	}
+
+	expected, err := comparableRecords(q.Reply.Answer)
+	if err != nil {
+		return nil, fmt.Errorf("invalid captured reply: %w", err)
+	}
+
+	actual, err := comparableRecords(response.Answer)
+	if err != nil {
+		return nil, fmt.Errorf("invalid response: %w", err)
+	}
+
+	for record := range expected {
+		if _, ok := actual[record]; !ok {
+			differences = append(differences, "missing answer record "+record)
+		}
+	}
+
+	for record := range actual {
+		if _, ok := expected[record]; !ok {
+			differences = append(differences, "unexpected answer record "+record)
+		}
+	}
+
+	// Map iteration order is random, thus differences are sorted for them to be
+	// reported consistently.
+	slices.Sort(differences)
+
+	return differences, nil
+}
+
+// comparableRecords returns the records, in presentation format, without their TTL
+// and with their owner name in lower case, as a set.
+func comparableRecords(records []string) (map[string]struct{}, error) {
+	comparable := make(map[string]struct{}, len(records))
+	for _, record := range records {
+		rr, err := dns.NewRR(record)
+		if err != nil || rr == nil {
+			return nil, fmt.Errorf("invalid record %q", record)
+		}
+
+		rr.Header().Ttl = 0
+		rr.Header().Name = strings.ToLower(rr.Header().Name)
+
+		comparable[rr.String()] = struct{}{}
+	}
+
+	return comparable, nil
+}
@@ -0,0 +1,313 @@
+package dns
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCapturedPacket holds a packet written to a test capture.
+type testCapturedPacket struct {
+	time time.Time
+	data []byte
+}
+
+// newTestPcap returns a pcap capture of the Ethernet frames, with microsecond
+// timestamps, written in the byte order.
+func newTestPcap(order binary.ByteOrder, packets ...testCapturedPacket) []byte {
+	var buf bytes.Buffer
+
+	header := make([]byte, 24)
+	order.PutUint32(header, pcapMagicMicros)
+	order.PutUint16(header[4:], 2)
+	order.PutUint16(header[6:], 4)
+	order.PutUint32(header[16:], 65535)
+	order.PutUint32(header[20:], linkTypeEthernet)
+	buf.Write(header)
+
+	for _, packet := range packets {
+		record := make([]byte, 16)
+		order.PutUint32(record, uint32(packet.time.Unix()))
+		order.PutUint32(record[4:], uint32(packet.time.Nanosecond()/1000))
+		order.PutUint32(record[8:], uint32(len(packet.data)))
+		order.PutUint32(record[12:], uint32(len(packet.data)))
+		buf.Write(record)
+		buf.Write(packet.data)
+	}
+
+	return buf.Bytes()
+}
+
+// newTestPcapng returns a little endian pcapng capture of the raw IP packets, with
+// nanosecond timestamps.
+func newTestPcapng(packets ...testCapturedPacket) []byte {
+	var buf bytes.Buffer
+
+	writeBlock := func(blockType uint32, body []byte) {
+		padded := (len(body) + 3) &^ 3
+		length := uint32(12 + padded)
+
+		block := make([]byte, length)
+		binary.LittleEndian.PutUint32(block, blockType)
+		binary.LittleEndian.PutUint32(block[4:], length)
+		copy(block[8:], body)
+		binary.LittleEndian.PutUint32(block[length-4:], length)
+		buf.Write(block)
+	}
+
+	section := make([]byte, 16)
+	binary.LittleEndian.PutUint32(section, pcapngByteOrderMagic)
+	binary.LittleEndian.PutUint16(section[4:], 1)
+	binary.LittleEndian.PutUint64(section[8:], ^uint64(0))
+	writeBlock(pcapngSectionHeaderType, section)
+
+	// The interface holds a timestamp resolution option of 10^-9 seconds, followed by
+	// the end of options.
+	iface := make([]byte, 8, 20)
+	binary.LittleEndian.PutUint16(iface, linkTypeRaw)
+	iface = append(iface, 9, 0, 1, 0, 9, 0, 0, 0, 0, 0, 0, 0)
+	writeBlock(pcapngInterfaceDescriptionType, iface)
+
+	for _, packet := range packets {
+		timestamp := uint64(packet.time.UnixNano())
+
+		body := make([]byte, 20, 20+len(packet.data))
+		binary.LittleEndian.PutUint32(body[4:], uint32(timestamp>>32))
+		binary.LittleEndian.PutUint32(body[8:], uint32(timestamp))
+		binary.LittleEndian.PutUint32(body[12:], uint32(len(packet.data)))
+		binary.LittleEndian.PutUint32(body[16:], uint32(len(packet.data)))
+		writeBlock(pcapngEnhancedPacketType, append(body, packet.data...))
+	}
+
+	return buf.Bytes()
+}
+
+// newTestEthernetFrame returns an Ethernet frame, tagged with a VLAN, holding the IP
+// packet.
+func newTestEthernetFrame(packet []byte) []byte {
+	frame := make([]byte, 18, 18+len(packet))
+	binary.BigEndian.PutUint16(frame[12:], etherTypeVLAN)
+	binary.BigEndian.PutUint16(frame[14:], 42)
+	binary.BigEndian.PutUint16(frame[16:], etherTypeIPv4)
+
+	return append(frame, packet...)
+}
+
+// newTestCapturedExchange returns a query for the name and type, and its reply
+// answering it with the IPv4 address, in wire format.
+func newTestCapturedExchange(t *testing.T, name string, qtype uint16, ip string) ([]byte, []byte) {
+	t.Helper()
+
+	query := new(dns.Msg)
+	query.SetQuestion(dns.Fqdn(name), qtype)
+	query.SetEdns0(1232, true)
+
+	reply := new(dns.Msg)
+	reply.SetReply(query)
+	reply.Answer = append(reply.Answer, &dns.A{
+		Hdr: dns.RR_Header{Name: query.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+		A:   net.ParseIP(ip),
+	})
+
+	packedQuery, err := query.Pack()
+	require.NoError(t, err)
+
+	packedReply, err := reply.Pack()
+	require.NoError(t, err)
+
+	return packedQuery, packedReply
+}
+
+func TestParseCapture(t *testing.T) {
+	t.Parallel()
+
+	client := netip.MustParseAddrPort("192.0.2.10:41000")
+	server := netip.MustParseAddrPort("192.0.2.53:53")
+	start := time.Unix(1700000000, 0)
+
+	query, reply := newTestCapturedExchange(t, testDomain, dns.TypeA, primaryTestIPv4)
+	otherQuery, _ := newTestCapturedExchange(t, "www."+testDomain, dns.TypeAAAA, primaryTestIPv4)
+
+	t.Run("queries are read from pcap captures of either byte order", func(t *testing.T) {
+		t.Parallel()
+
+		for _, order := range []binary.ByteOrder{binary.BigEndian, binary.LittleEndian} {
+			data := newTestPcap(order,
+				testCapturedPacket{time: start, data: newTestEthernetFrame(encodeIPPacket(TransportUDP, client, server, query))},
+				testCapturedPacket{
+					time: start.Add(5 * time.Millisecond),
+					data: newTestEthernetFrame(encodeIPPacket(TransportUDP, server, client, reply)),
+				},
+				testCapturedPacket{
+					time: start.Add(10 * time.Millisecond),
+					data: newTestEthernetFrame(encodeIPPacket(TransportUDP, client, netip.MustParseAddrPort("192.0.2.80:80"), query)),
+				},
+				testCapturedPacket{
+					time: start.Add(20 * time.Millisecond),
+					data: newTestEthernetFrame(encodeIPPacket(TransportUDP, client, server, otherQuery)),
+				},
+			)
+
+			capture, err := ParseCapture(bytes.NewReader(data), CaptureOptions{})
+			require.NoError(t, err, order)
+			require.Equal(t, 2, capture.Len(), order)
+			assert.Equal(t, 20*time.Millisecond, capture.Duration(), order)
+
+			first := capture.Query(0)
+			assert.Equal(t, query, first.Packed, order)
+			assert.Equal(t, TransportUDP, first.Transport, order)
+			assert.Equal(t, client, first.Client, order)
+			assert.Equal(t, server, first.Server, order)
+			assert.Equal(t, []Question{{Name: testDomain + ".", Type: "A", Class: "IN"}}, first.Message.Questions, order)
+			require.NotNil(t, first.Message.EDNS, order)
+			assert.True(t, first.Message.EDNS.DNSSECOK, order)
+			require.NotNil(t, first.Reply, order)
+			assert.Len(t, first.Reply.Answer, 1, order)
+			assert.Equal(t, 5*time.Millisecond, first.RTT, order)
+
+			second := capture.Query(1)
+			assert.Equal(t, 20*time.Millisecond, second.Offset, order)
+			assert.Equal(t, 20*time.Millisecond, second.Delay, order)
+			assert.Nil(t, second.Reply, order)
+		}
+	})
+
+	t.Run("queries are read from whole messages of pcapng TCP segments", func(t *testing.T) {
+		t.Parallel()
+
+		client := netip.MustParseAddrPort("[2001:db8::10]:41000")
+		server := netip.MustParseAddrPort("[2001:db8::53]:5353")
+
+		// The segment holds two length prefixed queries, followed by a partial one.
+		var stream []byte
+		for _, message := range [][]byte{query, otherQuery} {
+			stream = binary.BigEndian.AppendUint16(stream, uint16(len(message)))
+			stream = append(stream, message...)
+		}
+
+		stream = binary.BigEndian.AppendUint16(stream, uint16(len(query)))
+		stream = append(stream, query[:4]...)
+
+		// The reply is split across segments, thus it is not matched with its query.
+		data := newTestPcapng(
+			testCapturedPacket{time: start.Add(3 * time.Nanosecond), data: encodeIPPacket(TransportTCP, client, server, stream)},
+			testCapturedPacket{
+				time: start.Add(time.Second),
+				data: encodeIPPacket(TransportTCP, server, client, binary.BigEndian.AppendUint16(nil, uint16(len(reply)))),
+			},
+		)
+
+		capture, err := ParseCapture(bytes.NewReader(data), CaptureOptions{Port: 5353})
+		require.NoError(t, err)
+		require.Equal(t, 2, capture.Len())
+
+		assert.Equal(t, TransportTCP, capture.Query(0).Transport)
+		assert.Equal(t, client, capture.Query(0).Client)
+		assert.Equal(t, "AAAA", capture.Query(1).Message.Questions[0].Type)
+		assert.Zero(t, capture.Query(1).Delay)
+		assert.Nil(t, capture.Query(0).Reply)
+	})
+
+	t.Run("invalid captures are rejected", func(t *testing.T) {
+		t.Parallel()
+
+		valid := newTestPcap(binary.BigEndian, testCapturedPacket{
+			time: start,
+			data: newTestEthernetFrame(encodeIPPacket(TransportUDP, client, server, query)),
+		})
+
+		for name, data := range map[string][]byte{
+			"not a capture":     []byte("www.k6.test A\n"),
+			"truncated record":  valid[:len(valid)-1],
+			"no DNS queries":    newTestPcap(binary.BigEndian),
+			"other port":        valid,
+			"truncated pcapng":  newTestPcapng()[:10],
+			"no pcapng packets": newTestPcapng(testCapturedPacket{time: start})[:28],
+			"invalid pcapng":    append([]byte{0x0a, 0x0d, 0x0d, 0x0a}, make([]byte, 12)...),
+			"empty":             nil,
+			"single magic byte": {0xa1},
+		} {
+			options := CaptureOptions{}
+			if name == "other port" {
+				options.Port = 853
+			}
+
+			_, err := ParseCapture(bytes.NewReader(data), options)
+			assert.Error(t, err, name)
+		}
+	})
+}
+
+func TestEncodeIPPacket(t *testing.T) {
+	t.Parallel()
+
+	for _, addrs := range [][2]string{
+		{"192.0.2.10:41000", "192.0.2.53:53"},
+		{"[2001:db8::10]:41000", "[2001:db8::53]:53"},
+	} {
+		src, dst := netip.MustParseAddrPort(addrs[0]), netip.MustParseAddrPort(addrs[1])
+
+		for _, transport := range []Transport{TransportUDP, TransportTCP} {
+			packet := encodeIPPacket(transport, src, dst, []byte("odd payload"))
+
+			seg, ok := decodePacket(linkTypeRaw, packet)
+			require.True(t, ok, transport, src)
+			assert.Equal(t, []byte("odd payload"), seg.payload, transport, src)
+
+			// Valid checksums sum up, along with the data they cover, to zero.
+			protocol := uint8(ipProtocolUDP)
+			if transport == TransportTCP {
+				protocol = ipProtocolTCP
+			}
+
+			headerLen := 40
+			if src.Addr().Is4() {
+				headerLen = 20
+				assert.Zero(t, internetChecksum(packet[:headerLen]), "IPv4 header", src)
+			}
+
+			segment := packet[headerLen:]
+			pseudoHeader := append(src.Addr().AsSlice(), dst.Addr().AsSlice()...)
+			pseudoHeader = append(pseudoHeader, 0, protocol)
+			pseudoHeader = binary.BigEndian.AppendUint16(pseudoHeader, uint16(len(segment)))
+			assert.Zero(t, internetChecksum(pseudoHeader, segment), transport, src)
+		}
+	}
+}
+
+func TestCapturedQuery_Verify(t *testing.T) {
+	t.Parallel()
+
+	query := CapturedQuery{Reply: &Message{
+		Rcode:  "NOERROR",
+		Answer: []string{"k6.test.\t60\tIN\tA\t203.0.113.1", "k6.test.\t60\tIN\tA\t203.0.113.2"},
+	}}
+
+	differences, err := query.Verify(Message{
+		Rcode:  "NOERROR",
+		Answer: []string{"K6.test. 300 IN A 203.0.113.2", "k6.test. 10 IN A 203.0.113.1"},
+	})
+	require.NoError(t, err)
+	assert.Empty(t, differences)
+
+	differences, err = query.Verify(Message{
+		Rcode:  "SERVFAIL",
+		Answer: []string{"k6.test. 60 IN A 203.0.113.1", "k6.test. 60 IN A 203.0.113.3"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"expected rcode NOERROR, got SERVFAIL",
+		"missing answer record k6.test.\t0\tIN\tA\t203.0.113.2",
+		"unexpected answer record k6.test.\t0\tIN\tA\t203.0.113.3",
+	}, differences)
+
+	_, err = CapturedQuery{}.Verify(Message{})
+	assert.ErrorIs(t, err, errNoCapturedReply)
+}
@@ -0,0 +1,242 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// ErrQueryDropped is an error that is returned when a query is dropped by the Client's
+// fault injection, before being sent.
+var ErrQueryDropped = errors.New("query dropped")
+
+// Fault represents a fault injected in a resolution by the Client.
+type Fault string
+
+const (
+	// FaultDrop means the query was dropped before being sent.
+	FaultDrop Fault = "drop"
+
+	// FaultLatency means latency was added before sending the query.
+	FaultLatency Fault = "latency"
+
+	// FaultTruncate means the response was truncated.
+	FaultTruncate Fault = "truncate"
+
+	// FaultTimeout means the response was discarded, and the resolution timed out.
+	FaultTimeout Fault = "timeout"
+)
+
+// LatencyDistribution represents the distribution of the latency added to queries.
+type LatencyDistribution string
+
+const (
+	// LatencyConstant adds the same latency, the mean, to every query.
+	LatencyConstant LatencyDistribution = "constant"
+
+	// LatencyUniform adds a latency picked uniformly between the minimum and the maximum.
+	LatencyUniform LatencyDistribution = "uniform"
+
+	// LatencyNormal adds a normally distributed latency, of the given mean and standard
+	// deviation.
+	LatencyNormal LatencyDistribution = "normal"
+
+	// LatencyExponential adds the minimum latency, plus an exponentially distributed
+	// latency of the given mean, modelling long tails.
+	LatencyExponential LatencyDistribution = "exponential"
+)
+
+// ChaosOptions controls the faults the Client injects in its resolutions, to exercise
+// how applications cope with failing nameservers.
+//
+// Faults are injected before sending the query, by dropping it or delaying it, and after
+// receiving its response, by truncating it or discarding it. The zero value injects none.
+type ChaosOptions struct {
+	// DropRate holds the rate of queries dropped before being sent, between 0 and 1.
+	// Their resolution fails immediately with ErrQueryDropped.
+	DropRate float64 `js:"dropRate"`
+
+	// Latency controls the latency added before sending queries.
+	Latency LatencyOptions `js:"latency"`
+
+	// TruncateRate holds the rate of responses truncated, between 0 and 1. Truncated
+	// responses have their TC bit set, and their records stripped.
+	TruncateRate float64 `js:"truncateRate"`
+
+	// TimeoutRate holds the rate of responses discarded, between 0 and 1. Their
+	// resolution fails with ErrQueryTimeout once Timeout has elapsed since the query
+	// was sent.
+	TimeoutRate float64 `js:"timeoutRate"`
+
+	// Timeout holds the time forced timeouts take to fail. It defaults to 2 seconds.
+	Timeout time.Duration `js:"-"`
+}
+
+// LatencyOptions controls the latency the Client adds before sending queries.
+type LatencyOptions struct {
+	// Distribution holds the distribution of the added latency. No latency is added
+	// unless it is set.
+	Distribution LatencyDistribution `js:"distribution"`
+
+	// Rate holds the rate of queries latency is added to, between 0 and 1. It defaults
+	// to 1, delaying every query.
+	Rate float64 `js:"rate"`
+
+	// Mean holds the latency added by the constant distribution, and the mean of the
+	// normal and exponential distributions.
+	Mean time.Duration `js:"-"`
+
+	// StdDev holds the standard deviation of the normal distribution.
+	StdDev time.Duration `js:"-"`
+
+	// Min and Max hold the bounds of the uniform distribution, and the bounds the
+	// latency of the other distributions is clamped to. A zero Max leaves it unbounded.
+	Min, Max time.Duration `js:"-"`
+}
+
+// Enabled returns true if the options inject any fault.
+func (o ChaosOptions) Enabled() bool {
+	return o.DropRate > 0 || o.TruncateRate > 0 || o.TimeoutRate > 0 || o.Latency.Distribution != ""
+}
+
+// Validate checks that the options are consistent, and returns an error describing
+// the first problem found otherwise.
+func (o ChaosOptions) Validate() error {
+	for name, rate := range map[string]float64{
+		"drop":     o.DropRate,
+		"truncate": o.TruncateRate,
+		"timeout":  o.TimeoutRate,
+		"latency":  o.Latency.Rate,
+	} {
+		if rate < 0 || rate > 1 {
+			return fmt.Errorf("the %s rate must be between 0 and 1; got %v", name, rate)
+		}
+	}
+
+	if o.TruncateRate+o.TimeoutRate > 1 {
+		return errors.New("the truncate and timeout rates must not add up to more than 1")
+	}
+
+	latency := o.Latency
+	if o.Timeout < 0 || latency.Mean < 0 || latency.StdDev < 0 || latency.Min < 0 || latency.Max < 0 {
+		return errors.New("timeout and latency durations must not be negative")
+	}
+
+	if latency.Max > 0 && latency.Max < latency.Min {
+		return fmt.Errorf("invalid latency range; max latency %s is lower than min latency %s", latency.Max, latency.Min)
+	}
+
+	switch latency.Distribution {
+	case "", LatencyConstant, LatencyNormal, LatencyExponential:
+	case LatencyUniform:
+		if latency.Max == 0 {
+			return errors.New("the uniform latency distribution requires a max latency")
+		}
+	default:
+		return fmt.Errorf(
+			"invalid latency distribution %q; expected one of %q, %q, %q or %q",
+			latency.Distribution, LatencyConstant, LatencyUniform, LatencyNormal, LatencyExponential,
+		)
+	}
+
+	return nil
+}
+
+// sample returns a latency picked from the distribution.
+//
+//nolint:gosec // injected latency doesn't need to be cryptographically random
+func (o LatencyOptions) sample() time.Duration {
+	var latency time.Duration
+	switch o.Distribution {
+	case LatencyUniform:
+		latency = o.Min + rand.N(o.Max-o.Min+1)
+	case LatencyNormal:
+		latency = o.Mean + time.Duration(rand.NormFloat64()*float64(o.StdDev))
+	case LatencyExponential:
+		latency = o.Min + time.Duration(rand.ExpFloat64()*float64(o.Mean))
+	default:
+		latency = o.Mean
+	}
+
+	latency = max(latency, o.Min)
+	if o.Max > 0 {
+		latency = min(latency, o.Max)
+	}
+
+	return latency
+}
+
+// injectBeforeExchange injects the faults applied before sending a query, delaying it,
+// or dropping it, in which case it returns ErrQueryDropped. It returns the faults
+// injected.
+func (o ChaosOptions) injectBeforeExchange(ctx context.Context) ([]Fault, error) {
+	var faults []Fault
+
+	//nolint:gosec // injected faults don't need to be cryptographically random
+	if rate := o.Latency.Rate; o.Latency.Distribution != "" && (rate == 0 || rand.Float64() < rate) {
+		faults = append(faults, FaultLatency)
+
+		timer := time.NewTimer(o.Latency.sample())
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return faults, ctx.Err()
+		}
+	}
+
+	if rand.Float64() < o.DropRate { //nolint:gosec // injected faults don't need to be cryptographically random
+		return append(faults, FaultDrop), ErrQueryDropped
+	}
+
+	return faults, nil
+}
+
+// injectAfterExchange injects the faults applied to the response of a query sent at
+// start, truncating it, or discarding it, in which case it waits for the timeout to
+// elapse, and returns ErrQueryTimeout. It returns the fault injected, if any.
+func (o ChaosOptions) injectAfterExchange(ctx context.Context, response *dns.Msg, start time.Time) (Fault, error) {
+	pick := rand.Float64() //nolint:gosec // injected faults don't need to be cryptographically random
+
+	switch {
+	case pick < o.TruncateRate:
+		response.Truncated = true
+		response.Answer, response.Ns, response.Extra = nil, nil, nil
+
+		return FaultTruncate, nil
+	case pick < o.TruncateRate+o.TimeoutRate:
+		timeout := o.Timeout
+		if timeout == 0 {
+			timeout = defaultExchangeTimeout
+		}
+
+		timer := time.NewTimer(time.Until(start.Add(timeout)))
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return FaultTimeout, ctx.Err()
+		}
+
+		return FaultTimeout, fmt.Errorf("%w after %s", ErrQueryTimeout, timeout)
+	default:
+		return "", nil
+	}
+}
+
+// faultsTag returns the value of the tag naming the faults, joined by a plus sign.
+func faultsTag(faults []Fault) string {
+	names := make([]string, 0, len(faults))
+	for _, fault := range faults {
+		names = append(names, string(fault))
+	}
+
+	return strings.Join(names, "+")
+}
@@ -0,0 +1,120 @@
+package dns
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_Chaos(t *testing.T) {
+	t.Parallel()
+
+	var queries atomic.Int64
+	nameserver := startTestNameserver(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		queries.Add(1)
+		writeTestAnswer(t, w, r)
+	})
+
+	resolve := func(t *testing.T, chaos ChaosOptions) (Resolution, error) {
+		t.Helper()
+
+		options := ClientOptions{Chaos: chaos}
+		require.NoError(t, options.Validate())
+
+		return NewDNSClient().ResolveWithOptions(context.Background(), testDomain, "A", nameserver, options)
+	}
+
+	t.Run("dropped queries are not sent", func(t *testing.T) {
+		t.Parallel()
+
+		before := queries.Load()
+
+		resolution, err := resolve(t, ChaosOptions{DropRate: 1})
+		require.ErrorIs(t, err, ErrQueryDropped)
+
+		assert.Equal(t, []Fault{FaultDrop}, resolution.Faults)
+		assert.Equal(t, before, queries.Load())
+	})
+
+	t.Run("latency is added before sending queries", func(t *testing.T) {
+		t.Parallel()
+
+		start := time.Now()
+		resolution, err := resolve(t, ChaosOptions{
+			Latency: LatencyOptions{Distribution: LatencyUniform, Min: 50 * time.Millisecond, Max: 60 * time.Millisecond},
+		})
+		require.NoError(t, err)
+
+		assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+		assert.Equal(t, []Fault{FaultLatency}, resolution.Faults)
+		assert.Equal(t, []string{primaryTestIPv4}, resolution.IPs)
+	})
+
+	t.Run("truncated responses hold no records", func(t *testing.T) {
+		t.Parallel()
+
+		resolution, err := resolve(t, ChaosOptions{TruncateRate: 1})
+		require.NoError(t, err)
+
+		assert.Equal(t, []Fault{FaultTruncate}, resolution.Faults)
+		assert.Empty(t, resolution.IPs)
+	})
+
+	t.Run("timed out responses fail once the timeout elapsed", func(t *testing.T) {
+		t.Parallel()
+
+		start := time.Now()
+		resolution, err := resolve(t, ChaosOptions{TimeoutRate: 1, Timeout: 100 * time.Millisecond})
+		require.ErrorIs(t, err, ErrQueryTimeout)
+
+		assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+		assert.Equal(t, []Fault{FaultTimeout}, resolution.Faults)
+	})
+
+	t.Run("no faults are injected by default", func(t *testing.T) {
+		t.Parallel()
+
+		resolution, err := resolve(t, ChaosOptions{})
+		require.NoError(t, err)
+
+		assert.False(t, resolution.ChaosUsed)
+		assert.Empty(t, resolution.Faults)
+	})
+
+	t.Run("invalid options are rejected", func(t *testing.T) {
+		t.Parallel()
+
+		for _, chaos := range []ChaosOptions{
+			{DropRate: 1.5},
+			{TruncateRate: 0.6, TimeoutRate: 0.6},
+			{Latency: LatencyOptions{Distribution: "pareto"}},
+			{Latency: LatencyOptions{Distribution: LatencyUniform, Min: time.Second}},
+			{Latency: LatencyOptions{Distribution: LatencyConstant, Mean: -time.Second}},
+		} {
+			assert.Error(t, chaos.Validate())
+		}
+	})
+}
+
+func TestLatencyOptions_Sample(t *testing.T) {
+	t.Parallel()
+
+	for _, options := range []LatencyOptions{
+		{Distribution: LatencyConstant, Mean: 10 * time.Millisecond, Min: 10 * time.Millisecond, Max: 10 * time.Millisecond},
+		{Distribution: LatencyUniform, Min: 5 * time.Millisecond, Max: 15 * time.Millisecond},
+		{Distribution: LatencyNormal, Mean: 10 * time.Millisecond, StdDev: 5 * time.Millisecond, Max: 20 * time.Millisecond},
+		{Distribution: LatencyExponential, Mean: 10 * time.Millisecond, Min: time.Millisecond, Max: time.Second},
+	} {
+		for i := 0; i < 1000; i++ {
+			latency := options.sample()
+
+			assert.GreaterOrEqual(t, latency, options.Min, options.Distribution)
+			assert.LessOrEqual(t, latency, options.Max, options.Distribution)
+		}
+	}
+}
@@ -2,8 +2,12 @@ package dns
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math/rand/v2"
 	"net"
+	"sync/atomic"
+	"time"
 
 	"github.com/miekg/dns"
 )
@@ -33,6 +37,59 @@ type Lookuper interface {
 type Client struct {
 	// client is the DNS client used to resolve queries.
 	client dns.Client
+
+	// options holds the default options used when resolving queries.
+	options ClientOptions
+
+	// sentQueries counts the queries sent by the client, and is used
+	// to generate sequential query IDs.
+	sentQueries atomic.Uint32
+
+	// pool holds the connections reused across the client's queries.
+	pool *connPool
+
+	// cache holds the resolutions cached by the client.
+	cache *resolutionCache
+
+	// zoneKeys holds the DNSKEY records authenticated by the client's DNSSEC
+	// validations, until their TTL runs out.
+	zoneKeys *zoneKeysCache
+
+	// recorders holds the recorders the client records its exchanges to.
+	recorders *recorderSet
+
+	// sig0Keys holds the SIG(0) keys parsed by the client.
+	sig0Keys *sig0KeyCache
+
+	// shared holds the resources the client shares with other clients. It is
+	// nil if the client doesn't share any.
+	shared *sharedResources
+}
+
+// sharedResources holds the resources clients can share with each other.
+type sharedResources struct {
+	// pool holds the connections reused across the queries of the clients
+	// using ConnectionReuseShared.
+	pool *connPool
+
+	// cache holds the resolutions cached by the clients using CacheModeShared.
+	cache *resolutionCache
+
+	// recorders holds the recorders the clients record their exchanges to.
+	recorders *recorderSet
+
+	// sig0Keys holds the SIG(0) keys parsed by the clients.
+	sig0Keys *sig0KeyCache
+}
+
+// newSharedResources creates a new set of resources clients can share.
+func newSharedResources() *sharedResources {
+	return &sharedResources{
+		pool:      newConnPool(),
+		cache:     newResolutionCache(),
+		recorders: newRecorderSet(),
+		sig0Keys:  newSIG0KeyCache(),
+	}
 }
 
 // Ensure our Client implements the Resolver interface
@@ -43,55 +100,356 @@ var _ Lookuper = &Client{}
 
 // NewDNSClient creates a new Client.
 func NewDNSClient() *Client {
+	return NewDNSClientWithOptions(ClientOptions{})
+}
+
+// NewDNSClientWithOptions creates a new Client using the provided options
+// as its default options.
+func NewDNSClientWithOptions(options ClientOptions) *Client {
+	return newClient(options, nil)
+}
+
+// newClient creates a new Client using the provided options as its default options,
+// and sharing the provided resources with other clients.
+func newClient(options ClientOptions, shared *sharedResources) *Client {
 	return &Client{
-		client: dns.Client{},
+		client:    dns.Client{},
+		options:   options,
+		pool:      newConnPool(),
+		cache:     newResolutionCache(),
+		zoneKeys:  newZoneKeysCache(),
+		recorders: newRecorderSet(),
+		sig0Keys:  newSIG0KeyCache(),
+		shared:    shared,
 	}
 }
 
+// CloseConnections closes the connections the client keeps open for reuse.
+//
+// It doesn't close the connections of a pool shared with other clients. The
+// client remains usable, and dials new connections as needed.
+func (r *Client) CloseConnections() {
+	r.pool.close()
+}
+
+// CloseRecordings closes the files and sockets the client records its exchanges to.
+//
+// It doesn't close the recordings shared with other clients. The client remains
+// usable, and reopens the recordings as needed, truncating their files.
+func (r *Client) CloseRecordings() error {
+	return r.recorders.close()
+}
+
+// connPool returns the pool of connections to use for the given connection
+// reuse mode, or nil if connections should not be reused.
+func (r *Client) connPool(mode ConnectionReuseMode) *connPool {
+	switch mode {
+	case ConnectionReuseVU:
+		return r.pool
+	case ConnectionReuseShared:
+		if r.shared != nil {
+			return r.shared.pool
+		}
+
+		return r.pool
+	default:
+		return nil
+	}
+}
+
+// resolutionCache returns the cache to use for the given cache mode, or nil
+// if resolutions should not be cached.
+func (r *Client) resolutionCache(mode CacheMode) *resolutionCache {
+	switch mode {
+	case CacheModeVU:
+		return r.cache
+	case CacheModeShared:
+		if r.shared != nil {
+			return r.shared.cache
+		}
+
+		return r.cache
+	default:
+		return nil
+	}
+}
+
+// exchangeRecorders returns the recorders the client records its exchanges to, shared
+// with other clients if possible.
+func (r *Client) exchangeRecorders() *recorderSet {
+	if r.shared != nil {
+		return r.shared.recorders
+	}
+
+	return r.recorders
+}
+
+// sig0Key returns the parsed SIG(0) key of the options, from the keys cached by the
+// client, shared with other clients if possible.
+func (r *Client) sig0Key(options SIG0Options) (*sig0Key, error) {
+	if r.shared != nil {
+		return r.shared.sig0Keys.get(options)
+	}
+
+	return r.sig0Keys.get(options)
+}
+
+// Options returns the default options used by the client.
+func (r *Client) Options() ClientOptions {
+	return r.options
+}
+
+// Resolution holds the outcome of a successful resolution.
+type Resolution struct {
+	// IPs holds the resolved IP addresses as strings, when resolving address records.
+	IPs []string
+
+	// Records holds the resolved records, when resolving DNSSEC records. Each record
+	// is one of the *DNSKEYRecord, *DSRecord, *RRSIGRecord, *NSECRecord, *NSEC3Record
+	// or *NSEC3PARAMRecord types.
+	Records []any
+
+	// answer holds the resolved records, in presentation format.
+	answer []string
+
+	// Validated is true if the response was validated against the query.
+	Validated bool
+
+	// Violations holds the description of each validation violation found in
+	// the response when using lenient response validation.
+	Violations []string
+
+	// CacheUsed is true if the resolution was looked up in a cache.
+	CacheUsed bool
+
+	// CacheHit is true if the resolution was served from a cache.
+	CacheHit bool
+
+	// DNSSEC holds the outcome of the DNSSEC validation of the response, when
+	// DNSSEC validation is enabled.
+	DNSSEC *DNSSECResult
+
+	// ChaosUsed is true if faults could be injected in the resolution.
+	ChaosUsed bool
+
+	// Faults holds the faults injected in the resolution, in order.
+	Faults []Fault
+
+	// Mismatches holds the number of responses received whose ID didn't match the
+	// query's, and which were skipped while waiting for the query's response.
+	Mismatches int
+
+	// RecordingErr holds the error opening the recording, or recording the resolution's
+	// exchanges to it, failed with, when recording exchanges. It doesn't fail the
+	// resolution.
+	RecordingErr error
+}
+
 // Resolve resolves a domain name to a slice of IP addresses using the given nameserver.
-// It returns a slice of IP addresses as strings.
+// It returns a slice of IP addresses as strings, or, when resolving DNSSEC records, a
+// slice of records in presentation format.
 func (r *Client) Resolve(
 	ctx context.Context,
 	query, recordType string,
 	nameserver Nameserver,
 ) ([]string, error) {
+	resolution, err := r.ResolveWithOptions(ctx, query, recordType, nameserver, r.options)
+	if err != nil {
+		return nil, err
+	}
+
+	if concreteType, _ := RecordTypeString(recordType); !concreteType.isAddress() {
+		return resolution.answer, nil
+	}
+
+	return resolution.IPs, nil
+}
+
+// ResolveWithOptions resolves a domain name to a slice of IP addresses using the given
+// nameserver, and the provided options instead of the client's default ones.
+//
+// When the resolution fails, the returned Resolution still holds the outcome of the
+// response's validation, and of the cache lookup.
+func (r *Client) ResolveWithOptions(
+	ctx context.Context,
+	query, recordType string,
+	nameserver Nameserver,
+	options ClientOptions,
+) (Resolution, error) {
+	if err := options.Validate(); err != nil {
+		return Resolution{}, fmt.Errorf("resolve operation failed, invalid options: %w", err)
+	}
+
+	// Failing to record the exchanges doesn't fail the resolution, which reports the
+	// failure. Resolutions served from the cache, or whose query was dropped or couldn't
+	// be sent, exchange nothing with the nameserver, and record nothing.
+	var log exchangeLog
+
+	resolution, err := r.resolve(ctx, query, recordType, nameserver, options, &log)
+	resolution.RecordingErr = r.recordExchanges(&log, options.Record, err != nil)
+
+	return resolution, err
+}
+
+// resolve resolves a domain name using the provided, valid, options. The exchanges of
+// the resolution, including those validating its DNSSEC signatures, are added to the log.
+func (r *Client) resolve(
+	ctx context.Context,
+	query, recordType string,
+	nameserver Nameserver,
+	options ClientOptions,
+	log *exchangeLog,
+) (Resolution, error) {
 	concreteType, err := RecordTypeString(recordType)
 	if err != nil {
-		return nil, fmt.Errorf(
+		return Resolution{}, fmt.Errorf(
 			"resolve operation failed with %w, %s is an invalid DNS record type",
 			ErrUnsupportedRecordType,
 			recordType,
 		)
 	}
 
+	// Serve the resolution from the cache, if possible. As the cache doesn't hold
+	// DNSSEC records, resolutions validating them bypass it.
+	cache := r.resolutionCache(options.Cache.Mode)
+	if options.ValidateDNSSEC {
+		cache = nil
+	}
+
+	cacheKey := newCacheKey(query, uint16(concreteType), nameserver, options)
+	if cache != nil {
+		if entry, found := cache.get(cacheKey, time.Now()); found {
+			resolution := entry.resolution
+			resolution.CacheUsed = true
+			resolution.CacheHit = true
+			resolution.ChaosUsed = options.Chaos.Enabled()
+			resolution.Faults = nil
+			resolution.Mismatches = 0
+
+			return resolution, entry.err
+		}
+	}
+
 	// Prepare the DNS query message
 	//
 	// Because the dns package [dns.SetQuestion] function expects specific
 	// uint16 values for the record type, and we don't want to leak that
 	// to our public API, we need to convert our RecordType to the
 	// corresponding uint16 value.
+	questionName := query + "."
+	if options.RandomizeCase {
+		questionName = randomizeCase(questionName)
+	}
+
 	message := dns.Msg{}
-	message.SetQuestion(query+".", uint16(concreteType))
+	message.SetQuestion(questionName, uint16(concreteType))
+	message.Id = r.nextQueryID(options.QueryID)
+	if options.ValidateDNSSEC {
+		setDNSSECOK(&message)
+	}
+
+	// Query the nameserver, injecting the configured faults before and after the exchange
+	resolution := Resolution{CacheUsed: cache != nil, ChaosUsed: options.Chaos.Enabled()}
+	if resolution.ChaosUsed {
+		resolution.Faults, err = options.Chaos.injectBeforeExchange(ctx)
+		if err != nil {
+			return resolution, fmt.Errorf("querying the DNS nameserver failed: %w", err)
+		}
+	}
+
+	var trace exchangeTrace
+
+	response, err := r.tracedExchange(ctx, &message, nameserver, options, &trace)
+	resolution.Mismatches = trace.mismatches
+	log.add(trace, nameserver, options)
+	if err == nil && resolution.ChaosUsed {
+		var fault Fault
+		if fault, err = options.Chaos.injectAfterExchange(ctx, response, trace.start); fault != "" {
+			resolution.Faults = append(resolution.Faults, fault)
+		}
+
+		// Injected truncations don't reflect the nameserver's answer, and aren't cached.
+		if fault == FaultTruncate {
+			cache = nil
+		}
+	}
 
-	// Query the nameserver
-	response, _, err := r.client.ExchangeContext(ctx, &message, nameserver.Addr())
 	if err != nil {
-		return nil, fmt.Errorf("querying the DNS nameserver failed: %w", err)
+		if errors.Is(err, dns.ErrId) {
+			return resolution, fmt.Errorf("%w: response ID does not match query ID %d", ErrResponseMismatch, message.Id)
+		}
+
+		// TSIG verification failures are reported as is, for their kind to
+		// be exposed to scripts.
+		var tsigErr *Error
+		if errors.As(err, &tsigErr) {
+			return resolution, tsigErr
+		}
+
+		return resolution, fmt.Errorf("querying the DNS nameserver failed: %w", err)
+	}
+
+	// When using 0x20 case randomization, the nameserver is expected to
+	// echo the question name exactly as it was sent.
+	if options.RandomizeCase {
+		if len(response.Question) == 0 || response.Question[0].Name != questionName {
+			return resolution, fmt.Errorf(
+				"%w: response question does not echo the case of query %s",
+				ErrResponseMismatch,
+				questionName,
+			)
+		}
+	}
+
+	if options.ResponseValidation.enabled() {
+		resolution.Validated = true
+		resolution.Violations = validateResponse(&message, response, trace.response)
+
+		if len(resolution.Violations) > 0 && options.ResponseValidation == ResponseValidationStrict {
+			return resolution, newMalformedResponseError(resolution.Violations)
+		}
+	}
+
+	// Negative responses are validated too, as their authority
+	// section is signed in signed zones.
+	if options.ValidateDNSSEC && (response.Rcode == dns.RcodeSuccess || response.Rcode == dns.RcodeNameError) {
+		validator, err := newDNSSECValidator(r, nameserver, options, log)
+		if err != nil {
+			return resolution, fmt.Errorf("resolve operation failed: %w", err)
+		}
+
+		result := validator.validate(ctx, questionName, response)
+		resolution.DNSSEC = &result
 	}
 
 	if response.Rcode != dns.RcodeSuccess {
-		return nil, newDNSError(response.Rcode, "DNS query failed")
+		if cache != nil {
+			cache.store(cacheKey, response, Resolution{}, options.Cache, time.Now())
+		}
+
+		return resolution, newDNSError(response.Rcode, "DNS query failed")
 	}
 
-	var ips []string
 	for _, a := range response.Answer {
 		switch t := a.(type) {
 		case *dns.A:
-			ips = append(ips, t.A.String())
+			resolution.IPs = append(resolution.IPs, t.A.String())
 		case *dns.AAAA:
-			ips = append(ips, t.AAAA.String())
+			resolution.IPs = append(resolution.IPs, t.AAAA.String())
+		case *dns.RRSIG:
+			// Signatures are returned alongside the records they sign when
+			// DNSSEC validation is enabled, and are only resolved on demand.
+			if concreteType == RecordTypeRRSIG {
+				resolution.Records = append(resolution.Records, newRecord(a))
+				resolution.answer = append(resolution.answer, a.String())
+			}
+		case *dns.DNSKEY, *dns.DS, *dns.NSEC, *dns.NSEC3, *dns.NSEC3PARAM, *dns.CDS, *dns.CDNSKEY:
+			resolution.Records = append(resolution.Records, newRecord(a))
+			resolution.answer = append(resolution.answer, a.String())
 		default:
-			return nil, fmt.Errorf(
+			resolution.IPs, resolution.Records, resolution.answer = nil, nil, nil
+
+			return resolution, fmt.Errorf(
 				"resolve operation failed with %w: unhandled DNS answer type %T",
 				ErrUnsupportedRecordType,
 				a,
@@ -99,7 +457,63 @@ func (r *Client) Resolve(
 		}
 	}
 
-	return ips, nil
+	if cache != nil {
+		cache.store(cacheKey, response, resolution, options.Cache, time.Now())
+	}
+
+	return resolution, nil
+}
+
+// recordExchanges records the exchanges of the log, those of an operation which failed
+// if failed is true, to the recording of the options, if the operation is sampled. It
+// returns the error opening the recording, or recording the exchanges, failed with.
+func (r *Client) recordExchanges(log *exchangeLog, options RecordOptions, failed bool) error {
+	if len(log.exchanges) == 0 || !options.sampled(failed) {
+		return nil
+	}
+
+	recorder, err := r.exchangeRecorders().get(options)
+	if err != nil {
+		return fmt.Errorf("opening the recording failed: %w", err)
+	}
+
+	for _, exchange := range log.exchanges {
+		if err := recorder.record(exchange); err != nil {
+			return fmt.Errorf("recording the exchange failed: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// nextQueryID returns the ID to use for the next query, according to the
+// provided options.
+func (r *Client) nextQueryID(options QueryIDOptions) uint16 {
+	switch options.Mode {
+	case QueryIDModeFixed:
+		return options.Value
+	case QueryIDModeSequential:
+		return options.Value + uint16(r.sentQueries.Add(1)-1) //nolint:gosec // wrapping around is intended
+	default:
+		return dns.Id()
+	}
+}
+
+// randomizeCase randomizes the case of each letter of name, as per
+// the DNS 0x20 [draft].
+//
+// [draft]: https://datatracker.ietf.org/doc/html/draft-vixie-dnsext-dns0x20-00
+func randomizeCase(name string) string {
+	randomized := []byte(name)
+	for i, c := range randomized {
+		if ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') {
+			if rand.IntN(2) == 0 { //nolint:gosec // the case doesn't need to be cryptographically random
+				randomized[i] = c ^ 0x20
+			}
+		}
+	}
+
+	return string(randomized)
 }
 
 // Lookup resolves a domain name to a slice of IP addresses using the system's
@@ -0,0 +1,289 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_ResolveWithOptions(t *testing.T) {
+	t.Parallel()
+
+	t.Run("sequential query IDs increment from the configured value", func(t *testing.T) {
+		t.Parallel()
+
+		var mu sync.Mutex
+		var gotIDs []uint16
+		nameserver := startTestNameserver(t, func(w dns.ResponseWriter, r *dns.Msg) {
+			mu.Lock()
+			gotIDs = append(gotIDs, r.Id)
+			mu.Unlock()
+
+			writeTestAnswer(t, w, r)
+		})
+
+		client := NewDNSClientWithOptions(ClientOptions{
+			QueryID: QueryIDOptions{Mode: QueryIDModeSequential, Value: 65534},
+		})
+
+		for i := 0; i < 3; i++ {
+			_, err := client.Resolve(context.Background(), testDomain, "A", nameserver)
+			require.NoError(t, err)
+		}
+
+		assert.Equal(t, []uint16{65534, 65535, 0}, gotIDs)
+	})
+
+	t.Run("fixed query ID is used for every query", func(t *testing.T) {
+		t.Parallel()
+
+		var mu sync.Mutex
+		var gotIDs []uint16
+		nameserver := startTestNameserver(t, func(w dns.ResponseWriter, r *dns.Msg) {
+			mu.Lock()
+			gotIDs = append(gotIDs, r.Id)
+			mu.Unlock()
+
+			writeTestAnswer(t, w, r)
+		})
+
+		options := ClientOptions{QueryID: QueryIDOptions{Mode: QueryIDModeFixed, Value: 4242}}
+		for i := 0; i < 2; i++ {
+			_, err := NewDNSClient().ResolveWithOptions(context.Background(), testDomain, "A", nameserver, options)
+			require.NoError(t, err)
+		}
+
+		assert.Equal(t, []uint16{4242, 4242}, gotIDs)
+	})
+
+	t.Run("queries are sent from the configured source port range", func(t *testing.T) {
+		t.Parallel()
+
+		var gotPort int
+		nameserver := startTestNameserver(t, func(w dns.ResponseWriter, r *dns.Msg) {
+			gotPort = w.RemoteAddr().(*net.UDPAddr).Port //nolint:forcetypeassert
+			writeTestAnswer(t, w, r)
+		})
+
+		options := ClientOptions{SourcePort: PortRange{Min: 45100, Max: 45110}}
+		_, err := NewDNSClient().ResolveWithOptions(context.Background(), testDomain, "A", nameserver, options)
+		require.NoError(t, err)
+
+		assert.GreaterOrEqual(t, gotPort, 45100)
+		assert.LessOrEqual(t, gotPort, 45110)
+	})
+
+	t.Run("queries are sent from the configured local address over each transport", func(t *testing.T) {
+		t.Parallel()
+
+		var mu sync.Mutex
+		var gotAddrs []string
+		nameserver := startTestNameserver(t, func(w dns.ResponseWriter, r *dns.Msg) {
+			host, _, err := net.SplitHostPort(w.RemoteAddr().String())
+			assert.NoError(t, err)
+
+			mu.Lock()
+			gotAddrs = append(gotAddrs, w.RemoteAddr().Network()+"/"+host)
+			mu.Unlock()
+
+			writeTestAnswer(t, w, r)
+		})
+
+		for _, transport := range []Transport{TransportUDP, TransportTCP} {
+			options := ClientOptions{Transport: transport, LocalAddress: "127.0.0.2"}
+			_, err := NewDNSClient().ResolveWithOptions(context.Background(), testDomain, "A", nameserver, options)
+			require.NoError(t, err)
+		}
+
+		assert.Equal(t, []string{"udp/127.0.0.2", "tcp/127.0.0.2"}, gotAddrs)
+	})
+
+	t.Run("queries are sent from the configured interface address", func(t *testing.T) {
+		t.Parallel()
+
+		nameserver := startTestNameserver(t, writeTestAnswerHandler(t))
+		loopback := loopbackInterfaceName(t)
+
+		options := ClientOptions{Interface: loopback, SourcePort: PortRange{Min: 45200, Max: 45210}}
+		_, err := NewDNSClient().ResolveWithOptions(context.Background(), testDomain, "A", nameserver, options)
+		assert.NoError(t, err)
+	})
+
+	t.Run("case randomized queries succeed when the response echoes the query case", func(t *testing.T) {
+		t.Parallel()
+
+		var gotName string
+		nameserver := startTestNameserver(t, func(w dns.ResponseWriter, r *dns.Msg) {
+			gotName = r.Question[0].Name
+			writeTestAnswer(t, w, r)
+		})
+
+		options := ClientOptions{RandomizeCase: true}
+		resolution, err := NewDNSClient().ResolveWithOptions(
+			context.Background(), "a-much-longer-name."+testDomain, "A", nameserver, options,
+		)
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{primaryTestIPv4}, resolution.IPs)
+		assert.True(t, strings.EqualFold("a-much-longer-name."+testDomain+".", gotName))
+	})
+
+	t.Run("case randomized queries fail when the response does not echo the query case", func(t *testing.T) {
+		t.Parallel()
+
+		nameserver := startTestNameserver(t, func(w dns.ResponseWriter, r *dns.Msg) {
+			r.Question[0].Name = strings.ToUpper(r.Question[0].Name)
+			writeTestAnswer(t, w, r)
+		})
+
+		options := ClientOptions{RandomizeCase: true}
+		_, err := NewDNSClient().ResolveWithOptions(
+			context.Background(), "a-much-longer-name."+testDomain, "A", nameserver, options,
+		)
+
+		assert.ErrorIs(t, err, ErrResponseMismatch)
+	})
+
+	t.Run("responses with a mismatched ID are counted over UDP", func(t *testing.T) {
+		t.Parallel()
+
+		// The nameserver answers every query with a mismatched ID first, then with
+		// the query's ID.
+		nameserver := startTestNameserver(t, func(w dns.ResponseWriter, r *dns.Msg) {
+			mismatched := r.Copy()
+			mismatched.Id = r.Id + 1
+			writeTestAnswer(t, w, mismatched)
+			writeTestAnswer(t, w, r)
+		})
+
+		for _, mode := range []ConnectionReuseMode{ConnectionReuseNone, ConnectionReuseVU} {
+			options := ClientOptions{ConnectionReuse: mode}
+			resolution, err := NewDNSClient().ResolveWithOptions(context.Background(), testDomain, "A", nameserver, options)
+			require.NoError(t, err, mode)
+
+			assert.Equal(t, []string{primaryTestIPv4}, resolution.IPs, mode)
+			assert.Equal(t, 1, resolution.Mismatches, mode)
+		}
+	})
+
+	t.Run("responses with a mismatched ID fail queries over TCP", func(t *testing.T) {
+		t.Parallel()
+
+		nameserver := startTestNameserver(t, func(w dns.ResponseWriter, r *dns.Msg) {
+			r.Id++
+			writeTestAnswer(t, w, r)
+		})
+
+		options := ClientOptions{Transport: TransportTCP}
+		_, err := NewDNSClient().ResolveWithOptions(context.Background(), testDomain, "A", nameserver, options)
+
+		assert.ErrorIs(t, err, ErrResponseMismatch)
+	})
+
+	t.Run("invalid options are rejected", func(t *testing.T) {
+		t.Parallel()
+
+		for _, options := range []ClientOptions{
+			{SourcePort: PortRange{Min: 2000, Max: 1000}},
+			{Transport: "quic"},
+			{LocalAddress: "not-an-ip"},
+			{LocalAddress: "127.0.0.1", Interface: "lo"},
+		} {
+			_, err := NewDNSClient().ResolveWithOptions(
+				context.Background(), testDomain, "A", Nameserver{IP: net.IPv4(127, 0, 0, 1), Port: 53}, options,
+			)
+
+			assert.Error(t, err)
+		}
+	})
+}
+
+// startTestNameserver starts an in-process UDP and TCP nameserver on the loopback interface, serving
+// queries using the provided handler. The nameserver is shut down when the test completes.
+func startTestNameserver(t *testing.T, handler dns.HandlerFunc) Nameserver {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	return serveTestNameserver(t, listener, handler)
+}
+
+// serveTestNameserver serves the handler over TCP using the listener, and over UDP
+// on the same address, until the test completes.
+func serveTestNameserver(t *testing.T, listener net.Listener, handler dns.HandlerFunc) Nameserver {
+	t.Helper()
+
+	addr := listener.Addr().(*net.TCPAddr) //nolint:forcetypeassert
+	conn, err := net.ListenPacket("udp", addr.String())
+	require.NoError(t, err)
+
+	for _, server := range []*dns.Server{
+		{PacketConn: conn, Handler: handler, MsgAcceptFunc: acceptTestMessage},
+		{Listener: listener, Handler: handler, MsgAcceptFunc: acceptTestMessage},
+	} {
+		started := make(chan struct{})
+		server.NotifyStartedFunc = func() { close(started) }
+
+		go func() { _ = server.ActivateAndServe() }()
+		<-started
+
+		t.Cleanup(func() { _ = server.Shutdown() })
+	}
+
+	return Nameserver{IP: addr.IP, Port: uint16(addr.Port)} //nolint:gosec
+}
+
+// acceptTestMessage accepts every message the test nameservers receive, whatever their
+// opcode, for the handlers to answer UPDATE messages too.
+func acceptTestMessage(dns.Header) dns.MsgAcceptAction {
+	return dns.MsgAccept
+}
+
+// writeTestAnswer answers the query r with a single A record pointing to primaryTestIPv4.
+func writeTestAnswer(t *testing.T, w dns.ResponseWriter, r *dns.Msg) {
+	t.Helper()
+
+	response := new(dns.Msg)
+	response.SetReply(r)
+	response.Answer = append(response.Answer, &dns.A{
+		Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+		A:   net.ParseIP(primaryTestIPv4),
+	})
+
+	assert.NoError(t, w.WriteMsg(response))
+}
+
+// writeTestAnswerHandler returns a handler answering every query using writeTestAnswer.
+func writeTestAnswerHandler(t *testing.T) dns.HandlerFunc {
+	t.Helper()
+
+	return func(w dns.ResponseWriter, r *dns.Msg) {
+		writeTestAnswer(t, w, r)
+	}
+}
+
+// loopbackInterfaceName returns the name of the loopback network interface, and skips
+// the test if none could be found.
+func loopbackInterfaceName(t *testing.T) string {
+	t.Helper()
+
+	interfaces, err := net.Interfaces()
+	require.NoError(t, err)
+
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagLoopback != 0 {
+			return iface.Name
+		}
+	}
+
+	t.Skip("no loopback network interface found")
+
+	return ""
+}
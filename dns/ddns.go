@@ -0,0 +1,382 @@
+package dns
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Prerequisite conditions of dynamic updates, as per [RFC2136].
+//
+// [RFC2136]: https://www.iana.org/go/rfc2136#section-2.4
+const (
+	// PrerequisiteNameInUse requires the name to own at least one record.
+	PrerequisiteNameInUse = "yxdomain"
+
+	// PrerequisiteNameNotInUse requires the name not to own any record.
+	PrerequisiteNameNotInUse = "nxdomain"
+
+	// PrerequisiteRRsetExists requires the name to own records of the type, holding
+	// the provided data, if any.
+	PrerequisiteRRsetExists = "yxrrset"
+
+	// PrerequisiteRRsetDoesNotExist requires the name not to own records of the type.
+	PrerequisiteRRsetDoesNotExist = "nxrrset"
+)
+
+// UpdateOptions holds the changes, and options, of a dynamic update.
+type UpdateOptions struct {
+	// Add holds the records to add to the zone, in presentation format.
+	Add []string `js:"add"`
+
+	// Remove holds the records to remove from the zone, in presentation format. Records
+	// holding data are removed individually, records without data, such as
+	// `www.example.com. A`, remove every record of their name and type, and records of
+	// type ANY remove every record of their name.
+	Remove []string `js:"remove"`
+
+	// Prerequisites holds the conditions the zone must meet for the update to be applied,
+	// in the `condition name [type [data]]` format of nsupdate, where condition is one
+	// of yxdomain, nxdomain, yxrrset or nxrrset.
+	Prerequisites []string `js:"prerequisites"`
+
+	// TSIG holds the key the update is signed with, if any. The response is then
+	// verified using the same key. It defaults to the TSIG key of the Client's options,
+	// set in scripts with configure.
+	TSIG TSIGOptions `js:"tsig"`
+
+	// SIG0 holds the key the update is signed with using SIG(0), if any, as an
+	// alternative to TSIG. The response is then verified using the server key, if any.
+	SIG0 SIG0Options `js:"sig0"`
+
+	// Transport holds the transport protocol the update is sent over. It defaults
+	// to TransportUDP.
+	Transport Transport `js:"transport"`
+
+	// TLS holds the options used when Transport is TransportTLS.
+	TLS TLSOptions `js:"tls"`
+
+	// ConnectionReuse controls whether, and across which messages, connections to
+	// nameservers are reused. It defaults to the Client's mode. Updates signed with
+	// SIG(0) are sent over a dedicated connection, regardless of it.
+	ConnectionReuse ConnectionReuseMode `js:"connectionReuse"`
+}
+
+// Validate checks that the options are consistent, and returns an error describing
+// the first problem found otherwise.
+func (o UpdateOptions) Validate() error {
+	switch o.Transport {
+	case "", TransportUDP, TransportTCP, TransportTLS:
+	default:
+		return fmt.Errorf(
+			"invalid update transport %q; expected one of %q, %q or %q",
+			o.Transport, TransportUDP, TransportTCP, TransportTLS,
+		)
+	}
+
+	switch o.ConnectionReuse {
+	case "", ConnectionReuseNone, ConnectionReuseVU, ConnectionReuseShared:
+	default:
+		return fmt.Errorf(
+			"invalid connection reuse mode %q; expected one of %q, %q or %q",
+			o.ConnectionReuse, ConnectionReuseNone, ConnectionReuseVU, ConnectionReuseShared,
+		)
+	}
+
+	if err := o.TSIG.Validate(); err != nil {
+		return fmt.Errorf("invalid tsig key: %w", err)
+	}
+
+	if err := o.SIG0.Validate(); err != nil {
+		return err
+	}
+
+	if !o.TSIG.IsZero() && !o.SIG0.IsZero() {
+		return errors.New("tsig and sig0 keys are mutually exclusive")
+	}
+
+	return nil
+}
+
+// UpdateSummary holds the outcome of a dynamic update.
+type UpdateSummary struct {
+	// Added holds the number of records the update added.
+	Added int
+
+	// Removed holds the number of records, or sets of records, the update removed.
+	Removed int
+
+	// Prerequisites holds the number of prerequisites the update was conditioned on.
+	Prerequisites int
+
+	// Duration holds the time elapsed from sending the update to receiving the
+	// nameserver's response.
+	Duration time.Duration
+
+	// RecordingErr holds the error opening the recording, or recording the update's
+	// exchange to it, failed with, when recording exchanges. It doesn't fail the update.
+	RecordingErr error
+}
+
+// Update sends a dynamic update of the zone to the nameserver, as per [RFC2136], and
+// waits for the nameserver to acknowledge it.
+//
+// Updates rejected by the nameserver, such as those whose prerequisites aren't met,
+// return an *Error of the kind matching the response code, such as YXDomain, YXRrset,
+// NXRrset, NotAuth or NotZone.
+//
+// [RFC2136]: https://www.iana.org/go/rfc2136
+func (r *Client) Update(
+	ctx context.Context,
+	zone string,
+	nameserver Nameserver,
+	options UpdateOptions,
+) (UpdateSummary, error) {
+	var summary UpdateSummary
+	if err := options.Validate(); err != nil {
+		return summary, err
+	}
+
+	var sig0 *sig0Key
+	if !options.SIG0.IsZero() {
+		key, err := r.sig0Key(options.SIG0)
+		if err != nil {
+			return summary, err
+		}
+
+		sig0 = key
+	}
+
+	zone = dns.Fqdn(zone)
+
+	message, err := newUpdateMessage(zone, options)
+	if err != nil {
+		return summary, fmt.Errorf("update of zone %s failed: %w", zone, err)
+	}
+
+	message.Id = r.nextQueryID(r.options.QueryID)
+	summary.Added = len(options.Add)
+	summary.Removed = len(options.Remove)
+	summary.Prerequisites = len(options.Prerequisites)
+
+	exchangeOptions := r.sourceOptions(options.Transport)
+	exchangeOptions.TLS = options.TLS
+	exchangeOptions.ConnectionReuse = cmp.Or(options.ConnectionReuse, r.options.ConnectionReuse)
+	exchangeOptions.TSIG = options.TSIG.or(r.options.TSIG)
+	exchangeOptions.Record = r.options.Record
+
+	var log exchangeLog
+
+	start := time.Now()
+	response, err := r.exchangeUpdate(ctx, message, nameserver, sig0, exchangeOptions, &log)
+	summary.Duration = time.Since(start)
+
+	err = updateError(zone, message, response, err)
+	summary.RecordingErr = r.recordExchanges(&log, exchangeOptions.Record, err != nil)
+
+	return summary, err
+}
+
+// updateError returns the error the update of the zone failed with, given the
+// nameserver's response to its message, or the error exchanging it failed with.
+func updateError(zone string, message, response *dns.Msg, err error) error {
+	// Signature verification failures are reported as is, for their kind to
+	// be exposed to scripts.
+	var signatureErr *Error
+	if errors.As(err, &signatureErr) {
+		return signatureErr
+	}
+
+	if err != nil {
+		if errors.Is(err, dns.ErrId) {
+			return fmt.Errorf("%w: response ID does not match update ID %d", ErrResponseMismatch, message.Id)
+		}
+
+		return fmt.Errorf("sending the update of zone %s failed: %w", zone, err)
+	}
+
+	if response.Rcode != dns.RcodeSuccess {
+		return newDNSError(response.Rcode, "update of zone "+zone+" rejected")
+	}
+
+	return nil
+}
+
+// exchangeUpdate sends the update message to the nameserver, signed with the SIG(0)
+// key, if any, or with the exchange options' TSIG key, if any, and returns the verified
+// response. The exchange is added to the log.
+func (r *Client) exchangeUpdate(
+	ctx context.Context,
+	message *dns.Msg,
+	nameserver Nameserver,
+	sig0 *sig0Key,
+	options ClientOptions,
+	log *exchangeLog,
+) (*dns.Msg, error) {
+	if sig0 == nil {
+		return r.exchange(ctx, message, nameserver, options, log)
+	}
+
+	client := r.client
+	client.Net = options.Transport.network()
+	if options.Transport == TransportTLS {
+		client.TLSConfig = options.TLS.config()
+	}
+
+	localIP, err := options.localIP(nameserver)
+	if err != nil {
+		return nil, err
+	}
+
+	if localIP != nil {
+		client.Dialer = options.dialer(localIP, 0)
+	}
+
+	trace := exchangeTrace{start: time.Now()}
+	response, err := exchangeSIG0(ctx, client, message, nameserver, sig0, &trace)
+	log.add(trace, nameserver, options)
+
+	return response, err
+}
+
+// newUpdateMessage returns the UPDATE message applying the options' changes to the zone.
+func newUpdateMessage(zone string, options UpdateOptions) (*dns.Msg, error) {
+	message := new(dns.Msg)
+	message.SetUpdate(zone)
+
+	for _, prerequisite := range options.Prerequisites {
+		if err := addPrerequisite(message, prerequisite); err != nil {
+			return nil, fmt.Errorf("invalid prerequisite %q: %w", prerequisite, err)
+		}
+	}
+
+	for _, record := range options.Remove {
+		rr, err := parseUpdateRecord(record)
+		if err != nil {
+			return nil, fmt.Errorf("invalid record to remove %q: %w", record, err)
+		}
+
+		switch {
+		case rr.Header().Rrtype == dns.TypeANY:
+			message.RemoveName([]dns.RR{rr})
+		case !hasRdata(record):
+			message.RemoveRRset([]dns.RR{rr})
+		default:
+			message.Remove([]dns.RR{rr})
+		}
+	}
+
+	for _, record := range options.Add {
+		rr, err := parseUpdateRecord(record)
+		if err != nil {
+			return nil, fmt.Errorf("invalid record to add %q: %w", record, err)
+		}
+
+		if !hasRdata(record) {
+			return nil, fmt.Errorf("invalid record to add %q: the record holds no data", record)
+		}
+
+		message.Insert([]dns.RR{rr})
+	}
+
+	return message, nil
+}
+
+// parseUpdateRecord parses a record to add or remove, in presentation format.
+func parseUpdateRecord(record string) (dns.RR, error) {
+	rr, err := dns.NewRR(record)
+	if err != nil {
+		return nil, err
+	}
+
+	if rr == nil {
+		return nil, errors.New("the record is empty")
+	}
+
+	return rr, nil
+}
+
+// addPrerequisite adds the prerequisite, in the `condition name [type [data]]` format,
+// to the message.
+func addPrerequisite(message *dns.Msg, prerequisite string) error {
+	condition, record, _ := strings.Cut(strings.TrimSpace(prerequisite), " ")
+	record = strings.TrimSpace(record)
+
+	switch strings.ToLower(condition) {
+	case PrerequisiteNameInUse, PrerequisiteNameNotInUse:
+		if _, ok := dns.IsDomainName(record); !ok || strings.ContainsAny(record, " \t") {
+			return errors.New("expected a single domain name")
+		}
+
+		rr := &dns.ANY{Hdr: dns.RR_Header{Name: dns.Fqdn(record)}}
+		if strings.EqualFold(condition, PrerequisiteNameInUse) {
+			message.NameUsed([]dns.RR{rr})
+		} else {
+			message.NameNotUsed([]dns.RR{rr})
+		}
+
+		return nil
+	case PrerequisiteRRsetExists, PrerequisiteRRsetDoesNotExist:
+		rr, err := parseUpdateRecord(record)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case strings.EqualFold(condition, PrerequisiteRRsetDoesNotExist):
+			if hasRdata(record) {
+				return errors.New("nxrrset prerequisites can not hold record data")
+			}
+
+			message.RRsetNotUsed([]dns.RR{rr})
+		case hasRdata(record):
+			message.Used([]dns.RR{rr})
+		default:
+			message.RRsetUsed([]dns.RR{rr})
+		}
+
+		return nil
+	default:
+		return fmt.Errorf(
+			"unknown condition %q; expected one of %s, %s, %s or %s",
+			condition,
+			PrerequisiteNameInUse, PrerequisiteNameNotInUse, PrerequisiteRRsetExists, PrerequisiteRRsetDoesNotExist,
+		)
+	}
+}
+
+// hasRdata returns true if the record, in presentation format, holds data following
+// its type. The owner name is followed by an optional TTL and class, then the type.
+func hasRdata(record string) bool {
+	fields := strings.Fields(record)
+	if len(fields) < 2 {
+		return false
+	}
+
+	for i := 1; i < len(fields); i++ {
+		field := strings.ToUpper(fields[i])
+		last := i == len(fields)-1
+
+		if _, err := strconv.ParseUint(field, 10, 32); err == nil && !last {
+			continue
+		}
+
+		if _, isClass := dns.StringToClass[field]; isClass && !last {
+			// Classes are told apart from types sharing their name, such as
+			// ANY, by the type following them.
+			if _, nextIsType := dns.StringToType[strings.ToUpper(fields[i+1])]; nextIsType {
+				continue
+			}
+		}
+
+		return !last
+	}
+
+	return false
+}
@@ -0,0 +1,241 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_DynamicUpdate(t *testing.T) {
+	t.Parallel()
+
+	t.Run("updates hold the zone, prerequisites and changes", func(t *testing.T) {
+		t.Parallel()
+
+		var (
+			mu       sync.Mutex
+			received *dns.Msg
+		)
+
+		nameserver := startTestNameserver(t, func(w dns.ResponseWriter, r *dns.Msg) {
+			mu.Lock()
+			received = r
+			mu.Unlock()
+
+			response := new(dns.Msg)
+			response.SetReply(r)
+			assert.NoError(t, w.WriteMsg(response))
+		})
+
+		summary, err := NewDNSClient().Update(context.Background(), "k6.test", nameserver, UpdateOptions{
+			Prerequisites: []string{
+				"yxdomain k6.test.",
+				"nxdomain new.k6.test",
+				"yxrrset www.k6.test. A",
+				"yxrrset www.k6.test. A " + primaryTestIPv4,
+				"nxrrset www.k6.test. AAAA",
+			},
+			Remove: []string{
+				"old.k6.test. ANY",
+				"www.k6.test. TXT",
+				"www.k6.test. A " + primaryTestIPv4,
+			},
+			Add: []string{"new.k6.test. 300 IN A " + primaryTestIPv4},
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, 1, summary.Added)
+		assert.Equal(t, 3, summary.Removed)
+		assert.Equal(t, 5, summary.Prerequisites)
+		assert.Positive(t, summary.Duration)
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		require.NotNil(t, received)
+		assert.Equal(t, dns.OpcodeUpdate, received.Opcode)
+		require.Len(t, received.Question, 1)
+		assert.Equal(t, "k6.test.", received.Question[0].Name)
+		assert.Equal(t, dns.TypeSOA, received.Question[0].Qtype)
+
+		type section struct {
+			name  string
+			class uint16
+			rtype uint16
+		}
+
+		sections := func(rrs []dns.RR) []section {
+			got := make([]section, 0, len(rrs))
+			for _, rr := range rrs {
+				got = append(got, section{rr.Header().Name, rr.Header().Class, rr.Header().Rrtype})
+			}
+
+			return got
+		}
+
+		assert.Equal(t, []section{
+			{"k6.test.", dns.ClassANY, dns.TypeANY},
+			{"new.k6.test.", dns.ClassNONE, dns.TypeANY},
+			{"www.k6.test.", dns.ClassANY, dns.TypeA},
+			{"www.k6.test.", dns.ClassINET, dns.TypeA},
+			{"www.k6.test.", dns.ClassNONE, dns.TypeAAAA},
+		}, sections(received.Answer))
+
+		assert.Equal(t, []section{
+			{"old.k6.test.", dns.ClassANY, dns.TypeANY},
+			{"www.k6.test.", dns.ClassANY, dns.TypeTXT},
+			{"www.k6.test.", dns.ClassNONE, dns.TypeA},
+			{"new.k6.test.", dns.ClassINET, dns.TypeA},
+		}, sections(received.Ns))
+	})
+
+	t.Run("rejected updates fail with the matching error kind", func(t *testing.T) {
+		t.Parallel()
+
+		for _, kind := range []errorKind{YXDomain, YXRrset, NXRrset, NotAuth, NotZone, Refused} {
+			nameserver := startTestNameserver(t, func(w dns.ResponseWriter, r *dns.Msg) {
+				response := new(dns.Msg)
+				response.SetRcode(r, int(kind))
+				assert.NoError(t, w.WriteMsg(response))
+			})
+
+			_, err := NewDNSClient().Update(context.Background(), "k6.test", nameserver, UpdateOptions{
+				Add: []string{"www.k6.test. 60 IN A " + primaryTestIPv4},
+			})
+
+			var dnsErr *Error
+			require.ErrorAs(t, err, &dnsErr)
+			assert.Equal(t, kind, dnsErr.Kind)
+		}
+	})
+
+	t.Run("TSIG signed updates are verified", func(t *testing.T) {
+		t.Parallel()
+
+		nameserver := startTestTransferServer(t, nil, func(w dns.ResponseWriter, r *dns.Msg) {
+			response := new(dns.Msg)
+			if r.IsTsig() == nil || w.TsigStatus() != nil {
+				response.SetRcode(r, dns.RcodeNotAuth)
+			} else {
+				response.SetReply(r)
+				response.SetTsig(r.IsTsig().Hdr.Name, r.IsTsig().Algorithm, tsigFudge, time.Now().Unix())
+			}
+
+			assert.NoError(t, w.WriteMsg(response))
+		})
+
+		options := UpdateOptions{
+			Add:       []string{"www.k6.test. 60 IN A " + primaryTestIPv4},
+			Transport: TransportTCP,
+			TSIG:      TSIGOptions{Name: "transfer.k6.test", Secret: testTSIGSecret},
+		}
+
+		_, err := NewDNSClient().Update(context.Background(), "k6.test", nameserver, options)
+		require.NoError(t, err)
+
+		options.TSIG = TSIGOptions{}
+		_, err = NewDNSClient().Update(context.Background(), "k6.test", nameserver, options)
+
+		var dnsErr *Error
+		require.ErrorAs(t, err, &dnsErr)
+		assert.Equal(t, NotAuth, dnsErr.Kind)
+	})
+
+	t.Run("updates are sent from the client's local address, and recorded", func(t *testing.T) {
+		t.Parallel()
+
+		var (
+			mu      sync.Mutex
+			gotAddr string
+		)
+
+		nameserver := startTestNameserver(t, func(w dns.ResponseWriter, r *dns.Msg) {
+			mu.Lock()
+			gotAddr, _, _ = net.SplitHostPort(w.RemoteAddr().String())
+			mu.Unlock()
+
+			response := new(dns.Msg)
+			response.SetReply(r)
+			assert.NoError(t, w.WriteMsg(response))
+		})
+
+		path := filepath.Join(t.TempDir(), "updates.pcap")
+		client := NewDNSClientWithOptions(ClientOptions{
+			LocalAddress:    "127.0.0.2",
+			ConnectionReuse: ConnectionReuseVU,
+			Record:          RecordOptions{Path: path},
+		})
+		defer client.CloseConnections()
+
+		options := UpdateOptions{Add: []string{"www.k6.test. 60 IN A " + primaryTestIPv4}}
+		summary, err := client.Update(context.Background(), "k6.test", nameserver, options)
+		require.NoError(t, err)
+		require.NoError(t, summary.RecordingErr)
+		require.NoError(t, client.CloseRecordings())
+
+		mu.Lock()
+		assert.Equal(t, "127.0.0.2", gotAddr)
+		mu.Unlock()
+
+		recording, err := os.ReadFile(path)
+		require.NoError(t, err)
+
+		capture, err := ParseCapture(bytes.NewReader(recording), CaptureOptions{Port: nameserver.Port})
+		require.NoError(t, err)
+		require.Equal(t, 1, capture.Len())
+		assert.Equal(t, "UPDATE", capture.Query(0).Message.Opcode)
+		assert.Equal(t, "127.0.0.2", capture.Query(0).Client.Addr().String())
+	})
+
+	t.Run("invalid updates are rejected", func(t *testing.T) {
+		t.Parallel()
+
+		for _, options := range []UpdateOptions{
+			{Transport: "quic"},
+			{ConnectionReuse: "always"},
+			{TSIG: TSIGOptions{Name: "update.k6.test", Secret: "not base64!"}},
+			{Add: []string{"www.k6.test. A"}},
+			{Add: []string{"www.k6.test. 60 IN A not-an-ip"}},
+			{Remove: []string{""}},
+			{Prerequisites: []string{"exists www.k6.test."}},
+			{Prerequisites: []string{"yxdomain www.k6.test. A"}},
+			{Prerequisites: []string{"nxrrset www.k6.test. A " + primaryTestIPv4}},
+		} {
+			_, err := NewDNSClient().Update(
+				context.Background(), "k6.test", Nameserver{IP: net.IPv4(127, 0, 0, 1), Port: 53}, options,
+			)
+
+			assert.Error(t, err, "%+v", options)
+		}
+	})
+}
+
+func Test_hasRdata(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]bool{
+		"www.k6.test. A":                 false,
+		"www.k6.test. IN A":              false,
+		"www.k6.test. 60 IN A":           false,
+		"www.k6.test. ANY":               false,
+		"www.k6.test. ANY A":             false,
+		"www.k6.test. MX":                false,
+		"www.k6.test. A 192.0.2.1":       true,
+		"www.k6.test. 60 IN A 192.0.2.1": true,
+		"www.k6.test. ANY A 192.0.2.1":   true,
+		"www.k6.test. MX 10 mx.k6.test.": true,
+	}
+
+	for record, want := range tests {
+		assert.Equal(t, want, hasRdata(record), record)
+	}
+}
@@ -0,0 +1,369 @@
+package dns
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// DenialNXDomain denotes the denial of the existence of a name.
+	DenialNXDomain = "nxdomain"
+
+	// DenialNoData denotes the denial of the existence of a type at an existing name.
+	DenialNoData = "nodata"
+)
+
+// DenialProof holds the outcome of the verification of the NSEC, or NSEC3, records
+// proving a negative response, as defined by [RFC4035] and [RFC5155].
+//
+// [RFC4035]: https://www.iana.org/go/rfc4035
+// [RFC5155]: https://www.iana.org/go/rfc5155
+type DenialProof struct {
+	// Denial holds what the response denies, either DenialNXDomain or DenialNoData.
+	Denial string `js:"denial"`
+
+	// Type holds the type of the records making the proof, either NSEC or NSEC3, or
+	// an empty string if the response holds none.
+	Type string `js:"type"`
+
+	// Covered is true if the records prove the denial of the queried name and type.
+	Covered bool `js:"covered"`
+
+	// HashAlgorithm holds the number of the hash algorithm of NSEC3 records.
+	HashAlgorithm uint8 `js:"hashAlgorithm"`
+
+	// Iterations holds the number of additional hash iterations of NSEC3 records.
+	Iterations uint16 `js:"iterations"`
+
+	// Salt holds the hex encoded salt of NSEC3 records, or an empty string if there is none.
+	Salt string `js:"salt"`
+
+	// OptOut is true if the NSEC3 record covering the queried name has the opt-out
+	// flag set, meaning that unsigned delegations may exist in the covered span.
+	OptOut bool `js:"optOut"`
+
+	// Reason holds why the records don't prove the denial, if so.
+	Reason string `js:"reason"`
+}
+
+// verifyDenial verifies that the NSEC, or NSEC3, records of the negative response's
+// authority section prove the denial of the name and type. The records' signatures
+// are expected to have been verified beforehand.
+func verifyDenial(name string, qtype uint16, response *dns.Msg) DenialProof {
+	name = strings.ToLower(dns.Fqdn(name))
+	nxdomain := response.Rcode == dns.RcodeNameError
+
+	proof := DenialProof{Denial: DenialNoData}
+	if nxdomain {
+		proof.Denial = DenialNXDomain
+	}
+
+	var nsecRecords []*dns.NSEC
+	var nsec3Records []*dns.NSEC3
+	for _, rr := range response.Ns {
+		switch t := rr.(type) {
+		case *dns.NSEC:
+			nsecRecords = append(nsecRecords, t)
+		case *dns.NSEC3:
+			nsec3Records = append(nsec3Records, t)
+		}
+	}
+
+	var err error
+	switch {
+	case len(nsec3Records) > 0:
+		proof.Type = dns.TypeToString[dns.TypeNSEC3]
+		err = proof.verifyNSEC3(name, qtype, nxdomain, nsec3Records)
+	case len(nsecRecords) > 0:
+		proof.Type = dns.TypeToString[dns.TypeNSEC]
+		err = verifyNSEC(name, qtype, nxdomain, nsecRecords)
+	default:
+		err = errors.New("the response holds no NSEC or NSEC3 records")
+	}
+
+	if err != nil {
+		proof.Reason = fmt.Sprintf("the %s proof for %s %s is invalid: %s", proof.Denial, name, dns.TypeToString[qtype], err)
+		return proof
+	}
+
+	proof.Covered = true
+
+	return proof
+}
+
+// verifyWildcardExpansion verifies that the NSEC, or NSEC3, records prove that no closer
+// match than the wildcard expanded into name exists, labels being the number of labels
+// of the wildcard's closest encloser. The records' signatures are expected to have been
+// verified beforehand.
+//
+// An NSEC record must cover name, as per [RFC4035], or an NSEC3 record must cover the
+// next closer name, the child of the closest encloser on the way to name, as per
+// [RFC5155].
+//
+// [RFC4035]: https://www.iana.org/go/rfc4035#section-5.3.4
+// [RFC5155]: https://www.iana.org/go/rfc5155#section-8.8
+func verifyWildcardExpansion(name string, labels int, records []dns.RR) error {
+	name = strings.ToLower(dns.Fqdn(name))
+
+	indexes := dns.Split(name)
+	if labels >= len(indexes) {
+		return fmt.Errorf("%s is not expanded from a wildcard of %d labels", name, labels)
+	}
+
+	nextCloser := name[indexes[len(indexes)-labels-1]:]
+
+	var nsecRecords []*dns.NSEC
+	var nsec3Records []*dns.NSEC3
+	for _, rr := range records {
+		switch t := rr.(type) {
+		case *dns.NSEC:
+			nsecRecords = append(nsecRecords, t)
+		case *dns.NSEC3:
+			if t.Hash == dns.SHA1 {
+				nsec3Records = append(nsec3Records, t)
+			}
+		}
+	}
+
+	switch {
+	case len(nsec3Records) > 0:
+		if coveringNSEC3(nsec3Records, nextCloser) == nil {
+			return fmt.Errorf("no NSEC3 record covers the next closer name %s", nextCloser)
+		}
+	case len(nsecRecords) > 0:
+		if coveringNSEC(nsecRecords, name) == nil {
+			return fmt.Errorf("no NSEC record covers %s", name)
+		}
+	default:
+		return errors.New("the response holds no NSEC or NSEC3 records")
+	}
+
+	return nil
+}
+
+// verifyNSEC verifies the NSEC records prove the denial of the name and type.
+//
+// A NODATA response must hold an NSEC record owned by the name, whose type bit map
+// doesn't hold the type. Otherwise, an NSEC record must cover the name, proving it
+// doesn't exist, and the wildcard at its closest encloser must either not exist
+// either, or, for NODATA responses, not hold the type.
+func verifyNSEC(name string, qtype uint16, nxdomain bool, records []*dns.NSEC) error {
+	if !nxdomain {
+		if nsec := matchingNSEC(records, name); nsec != nil {
+			return typeAbsent(nsec.TypeBitMap, qtype)
+		}
+	}
+
+	covering := coveringNSEC(records, name)
+	if covering == nil {
+		return fmt.Errorf("no NSEC record covers %s", name)
+	}
+
+	encloser := nsecClosestEncloser(name, covering)
+	wildcard := dns.Fqdn("*." + strings.TrimSuffix(encloser, "."))
+
+	if nxdomain {
+		if coveringNSEC(records, wildcard) == nil {
+			return fmt.Errorf("no NSEC record covers the wildcard %s", wildcard)
+		}
+
+		return nil
+	}
+
+	nsec := matchingNSEC(records, wildcard)
+	if nsec == nil {
+		return fmt.Errorf("no NSEC record matches %s, or the wildcard %s", name, wildcard)
+	}
+
+	return typeAbsent(nsec.TypeBitMap, qtype)
+}
+
+// verifyNSEC3 verifies the NSEC3 records prove the denial of the name and type, and
+// records their hash parameters in the proof.
+//
+// A NODATA response must hold an NSEC3 record matching the name, whose type bit map
+// doesn't hold the type. Otherwise, the closest encloser of the name must be proven,
+// along with the absence of the wildcard at the closest encloser for NXDOMAIN
+// responses, or its lack of the type for NODATA ones. DS NODATA responses may
+// instead prove that the name is covered by an opt-out NSEC3 record.
+func (p *DenialProof) verifyNSEC3(name string, qtype uint16, nxdomain bool, records []*dns.NSEC3) error {
+	// Records using other hash parameters than the first one's can't be
+	// part of the proof, as all records of a zone share the same.
+	first := records[0]
+	p.HashAlgorithm = first.Hash
+	p.Iterations = first.Iterations
+	p.Salt = strings.ToUpper(first.Salt)
+
+	records = slices.DeleteFunc(slices.Clone(records), func(rr *dns.NSEC3) bool {
+		return rr.Hash != first.Hash || rr.Iterations != first.Iterations || !strings.EqualFold(rr.Salt, first.Salt)
+	})
+
+	if first.Hash != dns.SHA1 {
+		return fmt.Errorf("unsupported NSEC3 hash algorithm %d", first.Hash)
+	}
+
+	if !nxdomain {
+		if nsec3 := matchingNSEC3(records, name); nsec3 != nil {
+			p.OptOut = nsec3.Flags&nsec3OptOut != 0
+			return typeAbsent(nsec3.TypeBitMap, qtype)
+		}
+	}
+
+	encloser, covering, err := nsec3ClosestEncloser(name, records)
+	if err != nil {
+		return err
+	}
+
+	p.OptOut = covering.Flags&nsec3OptOut != 0
+	if !nxdomain && qtype == dns.TypeDS && p.OptOut {
+		return nil
+	}
+
+	wildcard := dns.Fqdn("*." + strings.TrimSuffix(encloser, "."))
+
+	if nxdomain {
+		if coveringNSEC3(records, wildcard) == nil {
+			return fmt.Errorf("no NSEC3 record covers the wildcard %s", wildcard)
+		}
+
+		return nil
+	}
+
+	nsec3 := matchingNSEC3(records, wildcard)
+	if nsec3 == nil {
+		return fmt.Errorf("no NSEC3 record matches %s, or the wildcard %s", name, wildcard)
+	}
+
+	return typeAbsent(nsec3.TypeBitMap, qtype)
+}
+
+// typeAbsent returns an error if the type bit map proves that the type, or a CNAME
+// record aliasing the name, exists. For DS records, the type bit map must also belong
+// to the parent side of the delegation, rather than to the apex of the child zone.
+func typeAbsent(types []uint16, qtype uint16) error {
+	for _, t := range types {
+		switch {
+		case t == qtype || t == dns.TypeCNAME:
+			return fmt.Errorf("the type bit map holds %s", dns.TypeToString[t])
+		case t == dns.TypeSOA && qtype == dns.TypeDS:
+			return errors.New("the type bit map belongs to the apex of the child zone")
+		}
+	}
+
+	return nil
+}
+
+// matchingNSEC returns the NSEC record owned by name, if any.
+func matchingNSEC(records []*dns.NSEC, name string) *dns.NSEC {
+	for _, nsec := range records {
+		if strings.EqualFold(nsec.Hdr.Name, name) {
+			return nsec
+		}
+	}
+
+	return nil
+}
+
+// coveringNSEC returns the NSEC record whose span covers name, if any. The last NSEC
+// record of a zone, whose next domain is the zone's apex, covers every name after it.
+func coveringNSEC(records []*dns.NSEC, name string) *dns.NSEC {
+	for _, nsec := range records {
+		owner, next := nsec.Hdr.Name, nsec.NextDomain
+		if canonicalCompare(owner, name) >= 0 {
+			continue
+		}
+
+		if canonicalCompare(name, next) < 0 || (canonicalCompare(next, owner) <= 0 && dns.IsSubDomain(next, name)) {
+			return nsec
+		}
+	}
+
+	return nil
+}
+
+// nsecClosestEncloser returns the closest encloser of name, its longest existing
+// ancestor, as proven by the NSEC record covering it.
+func nsecClosestEncloser(name string, covering *dns.NSEC) string {
+	labels := max(
+		dns.CompareDomainName(name, covering.Hdr.Name),
+		dns.CompareDomainName(name, covering.NextDomain),
+	)
+
+	indexes := dns.Split(name)
+	if labels == 0 || labels > len(indexes) {
+		return "."
+	}
+
+	return name[indexes[len(indexes)-labels]:]
+}
+
+// matchingNSEC3 returns the NSEC3 record whose hashed owner name matches name, if any.
+func matchingNSEC3(records []*dns.NSEC3, name string) *dns.NSEC3 {
+	for _, nsec3 := range records {
+		if nsec3.Match(name) {
+			return nsec3
+		}
+	}
+
+	return nil
+}
+
+// coveringNSEC3 returns the NSEC3 record whose span covers the hash of name, if any.
+func coveringNSEC3(records []*dns.NSEC3, name string) *dns.NSEC3 {
+	for _, nsec3 := range records {
+		if nsec3.Cover(name) && !nsec3.Match(name) {
+			return nsec3
+		}
+	}
+
+	return nil
+}
+
+// nsec3ClosestEncloser proves the closest encloser of name as per [RFC5155]: an NSEC3
+// record must match the closest encloser, and another must cover the next closer name,
+// its child on the way to name. It returns the closest encloser, and the record
+// covering the next closer name.
+//
+// [RFC5155]: https://www.iana.org/go/rfc5155#section-8.3
+func nsec3ClosestEncloser(name string, records []*dns.NSEC3) (string, *dns.NSEC3, error) {
+	indexes := dns.Split(name)
+	for i := 1; i < len(indexes); i++ {
+		encloser := name[indexes[i]:]
+		if matchingNSEC3(records, encloser) == nil {
+			continue
+		}
+
+		nextCloser := name[indexes[i-1]:]
+
+		covering := coveringNSEC3(records, nextCloser)
+		if covering == nil {
+			return "", nil, fmt.Errorf("no NSEC3 record covers the next closer name %s", nextCloser)
+		}
+
+		return encloser, covering, nil
+	}
+
+	return "", nil, fmt.Errorf("no NSEC3 record matches an ancestor of %s", name)
+}
+
+// canonicalCompare compares two names in the canonical DNS name order defined by
+// [RFC4034], comparing their labels case-insensitively from the rightmost one.
+//
+// [RFC4034]: https://www.iana.org/go/rfc4034#section-6.1
+func canonicalCompare(a, b string) int {
+	aLabels := dns.SplitDomainName(strings.ToLower(a))
+	bLabels := dns.SplitDomainName(strings.ToLower(b))
+
+	for i := 1; i <= min(len(aLabels), len(bLabels)); i++ {
+		if c := strings.Compare(aLabels[len(aLabels)-i], bLabels[len(bLabels)-i]); c != 0 {
+			return c
+		}
+	}
+
+	return cmp.Compare(len(aLabels), len(bLabels))
+}
@@ -0,0 +1,367 @@
+package dns
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_verifyDenial(t *testing.T) {
+	t.Parallel()
+
+	// The names of the k6.test. zone, along with their types. The empty
+	// non-terminals ent.k6.test. and wild.k6.test. only exist in NSEC3 chains.
+	names := map[string][]uint16{
+		"k6.test.":           {dns.TypeSOA, dns.TypeNS, dns.TypeDNSKEY},
+		"www.k6.test.":       {dns.TypeA},
+		"ent.k6.test.":       nil,
+		"host.ent.k6.test.":  {dns.TypeA},
+		"wild.k6.test.":      nil,
+		"*.wild.k6.test.":    {dns.TypeTXT},
+		"secure.k6.test.":    {dns.TypeNS, dns.TypeDS},
+		"unsigned.k6.test.":  {dns.TypeNS},
+		"alias.k6.test.":     {dns.TypeCNAME},
+		"zzz.www.k6.test.":   {dns.TypeA},
+		"www.other.k6.test.": {dns.TypeA},
+		"other.k6.test.":     nil,
+	}
+
+	chains := map[string][]dns.RR{
+		"NSEC":  testNSECChain(t, "k6.test.", names),
+		"NSEC3": testNSEC3Chain(t, "k6.test.", names, false),
+	}
+
+	tests := []struct {
+		name        string
+		query       string
+		qtype       uint16
+		rcode       int
+		wantDenial  string
+		wantCovered bool
+		wantReason  string
+	}{
+		{
+			name:        "missing types of existing names are denied",
+			query:       "www.k6.test.",
+			qtype:       dns.TypeAAAA,
+			wantDenial:  DenialNoData,
+			wantCovered: true,
+		},
+		{
+			name:       "existing types are not denied",
+			query:      "www.k6.test.",
+			qtype:      dns.TypeA,
+			wantDenial: DenialNoData,
+			wantReason: "the type bit map holds A",
+		},
+		{
+			name:       "aliased names are not denied",
+			query:      "alias.k6.test.",
+			qtype:      dns.TypeA,
+			wantDenial: DenialNoData,
+			wantReason: "the type bit map holds CNAME",
+		},
+		{
+			name:        "missing names are denied",
+			query:       "missing.k6.test.",
+			qtype:       dns.TypeA,
+			rcode:       dns.RcodeNameError,
+			wantDenial:  DenialNXDomain,
+			wantCovered: true,
+		},
+		{
+			name:        "missing names below existing names are denied",
+			query:       "missing.host.ent.k6.test.",
+			qtype:       dns.TypeA,
+			rcode:       dns.RcodeNameError,
+			wantDenial:  DenialNXDomain,
+			wantCovered: true,
+		},
+		{
+			name:       "existing names are not denied",
+			query:      "www.k6.test.",
+			qtype:      dns.TypeA,
+			rcode:      dns.RcodeNameError,
+			wantDenial: DenialNXDomain,
+			wantReason: "covers",
+		},
+		{
+			name:       "names matching a wildcard are not denied",
+			query:      "host.wild.k6.test.",
+			qtype:      dns.TypeA,
+			rcode:      dns.RcodeNameError,
+			wantDenial: DenialNXDomain,
+			wantReason: "wildcard *.wild.k6.test.",
+		},
+		{
+			name:        "missing types of wildcards are denied",
+			query:       "host.wild.k6.test.",
+			qtype:       dns.TypeA,
+			wantDenial:  DenialNoData,
+			wantCovered: true,
+		},
+		{
+			name:        "missing DS records of unsigned delegations are denied",
+			query:       "unsigned.k6.test.",
+			qtype:       dns.TypeDS,
+			wantDenial:  DenialNoData,
+			wantCovered: true,
+		},
+		{
+			name:       "existing DS records of signed delegations are not denied",
+			query:      "secure.k6.test.",
+			qtype:      dns.TypeDS,
+			wantDenial: DenialNoData,
+			wantReason: "the type bit map holds DS",
+		},
+		{
+			name:       "DS records are not denied by the apex of the child zone",
+			query:      "k6.test.",
+			qtype:      dns.TypeDS,
+			wantDenial: DenialNoData,
+			wantReason: "the type bit map belongs to the apex of the child zone",
+		},
+	}
+
+	for kind, chain := range chains {
+		for _, tt := range tests {
+			kind, chain, tt := kind, chain, tt
+
+			t.Run(kind+" "+tt.name, func(t *testing.T) {
+				t.Parallel()
+
+				response := new(dns.Msg)
+				response.SetQuestion(tt.query, tt.qtype)
+				response.Rcode = tt.rcode
+				response.Ns = chain
+
+				proof := verifyDenial(tt.query, tt.qtype, response)
+				assert.Equal(t, tt.wantDenial, proof.Denial)
+				assert.Equal(t, kind, proof.Type)
+				assert.Equal(t, tt.wantCovered, proof.Covered, proof.Reason)
+				assert.Contains(t, proof.Reason, tt.wantReason)
+			})
+		}
+	}
+
+	t.Run("responses without NSEC or NSEC3 records are not covered", func(t *testing.T) {
+		t.Parallel()
+
+		response := new(dns.Msg)
+		response.Rcode = dns.RcodeNameError
+		response.Ns = []dns.RR{mustNewRR(t, "k6.test. 300 IN SOA ns.k6.test. admin.k6.test. 1 7200 3600 1209600 300")}
+
+		proof := verifyDenial("missing.k6.test.", dns.TypeA, response)
+		assert.False(t, proof.Covered)
+		assert.Empty(t, proof.Type)
+		assert.Contains(t, proof.Reason, "no NSEC or NSEC3 records")
+	})
+
+	t.Run("NSEC3 proofs report their hash parameters", func(t *testing.T) {
+		t.Parallel()
+
+		response := new(dns.Msg)
+		response.Rcode = dns.RcodeNameError
+		response.Ns = testNSEC3ChainWithParameters(t, "k6.test.", names, false, 10, "aabbccdd")
+
+		proof := verifyDenial("missing.k6.test.", dns.TypeA, response)
+		assert.True(t, proof.Covered, proof.Reason)
+		assert.Equal(t, uint8(dns.SHA1), proof.HashAlgorithm)
+		assert.Equal(t, uint16(10), proof.Iterations)
+		assert.Equal(t, "AABBCCDD", proof.Salt)
+		assert.False(t, proof.OptOut)
+	})
+
+	t.Run("opt-out NSEC3 records deny the DS records of unlisted delegations", func(t *testing.T) {
+		t.Parallel()
+
+		signedOnly := make(map[string][]uint16, len(names))
+		for name, types := range names {
+			if name != "unsigned.k6.test." {
+				signedOnly[name] = types
+			}
+		}
+
+		response := new(dns.Msg)
+		response.Ns = testNSEC3Chain(t, "k6.test.", signedOnly, true)
+
+		proof := verifyDenial("unsigned.k6.test.", dns.TypeDS, response)
+		assert.True(t, proof.Covered, proof.Reason)
+		assert.True(t, proof.OptOut)
+
+		response.Ns = testNSEC3Chain(t, "k6.test.", signedOnly, false)
+
+		proof = verifyDenial("unsigned.k6.test.", dns.TypeDS, response)
+		assert.False(t, proof.Covered)
+		assert.False(t, proof.OptOut)
+	})
+
+	t.Run("NSEC3 proofs using an unknown hash algorithm are not covered", func(t *testing.T) {
+		t.Parallel()
+
+		chain := testNSEC3Chain(t, "k6.test.", names, false)
+		for _, rr := range chain {
+			rr.(*dns.NSEC3).Hash = 2 //nolint:forcetypeassert
+		}
+
+		response := new(dns.Msg)
+		response.Ns = chain
+
+		proof := verifyDenial("www.k6.test.", dns.TypeAAAA, response)
+		assert.False(t, proof.Covered)
+		assert.Contains(t, proof.Reason, "unsupported NSEC3 hash algorithm 2")
+	})
+}
+
+func Test_verifyWildcardExpansion(t *testing.T) {
+	t.Parallel()
+
+	names := map[string][]uint16{
+		"k6.test.":        {dns.TypeSOA, dns.TypeNS, dns.TypeDNSKEY},
+		"www.k6.test.":    {dns.TypeA},
+		"wild.k6.test.":   nil,
+		"*.wild.k6.test.": {dns.TypeTXT},
+	}
+
+	chains := map[string][]dns.RR{
+		"NSEC":  testNSECChain(t, "k6.test.", names),
+		"NSEC3": testNSEC3Chain(t, "k6.test.", names, false),
+	}
+
+	for chainType, chain := range chains {
+		chain := chain
+
+		t.Run(chainType, func(t *testing.T) {
+			t.Parallel()
+
+			assert.NoError(t, verifyWildcardExpansion("host.wild.k6.test.", 3, chain))
+			assert.NoError(t, verifyWildcardExpansion("deeper.host.wild.k6.test.", 3, chain))
+			assert.Error(t, verifyWildcardExpansion("www.k6.test.", 2, chain), "existing names aren't expansions")
+			assert.Error(t, verifyWildcardExpansion("host.wild.k6.test.", 3, nil), "expansions need a proof")
+		})
+	}
+}
+
+func Test_canonicalCompare(t *testing.T) {
+	t.Parallel()
+
+	// The canonical order example of RFC 4034, section 6.1.
+	ordered := []string{
+		"example.",
+		"a.example.",
+		"yljkjljk.a.example.",
+		"Z.a.example.",
+		"zABC.a.EXAMPLE.",
+		"z.example.",
+		"*.z.example.",
+		"\\200.z.example.",
+	}
+
+	for i := 1; i < len(ordered); i++ {
+		assert.Negative(t, canonicalCompare(ordered[i-1], ordered[i]), "%s < %s", ordered[i-1], ordered[i])
+		assert.Positive(t, canonicalCompare(ordered[i], ordered[i-1]), "%s > %s", ordered[i], ordered[i-1])
+	}
+
+	assert.Zero(t, canonicalCompare("Example.", "example."))
+}
+
+// testNSECChain returns the NSEC records of the zone holding the names, each owning
+// the types it maps to. Empty non-terminals, names without types, are left out.
+func testNSECChain(t *testing.T, zone string, names map[string][]uint16) []dns.RR {
+	t.Helper()
+
+	var owners []string
+	for name, types := range names {
+		if len(types) > 0 {
+			owners = append(owners, name)
+		}
+	}
+
+	slices.SortFunc(owners, canonicalCompare)
+
+	chain := make([]dns.RR, 0, len(owners))
+	for i, owner := range owners {
+		chain = append(chain, &dns.NSEC{
+			Hdr:        dns.RR_Header{Name: owner, Rrtype: dns.TypeNSEC, Class: dns.ClassINET, Ttl: 300},
+			NextDomain: owners[(i+1)%len(owners)],
+			TypeBitMap: withDNSSECTypes(names[owner], dns.TypeNSEC),
+		})
+	}
+
+	require.Equal(t, zone, owners[0])
+
+	return chain
+}
+
+// testNSEC3Chain returns the NSEC3 records of the zone holding the names, each owning
+// the types it maps to, hashed without salt nor additional iterations.
+func testNSEC3Chain(t *testing.T, zone string, names map[string][]uint16, optOut bool) []dns.RR {
+	t.Helper()
+
+	return testNSEC3ChainWithParameters(t, zone, names, optOut, 0, "")
+}
+
+// testNSEC3ChainWithParameters returns the NSEC3 records like testNSEC3Chain does,
+// using the provided hash parameters.
+func testNSEC3ChainWithParameters(
+	t *testing.T,
+	zone string,
+	names map[string][]uint16,
+	optOut bool,
+	iterations uint16,
+	salt string,
+) []dns.RR {
+	t.Helper()
+
+	hashes := make(map[string]string, len(names))
+	for name := range names {
+		hashes[dns.HashName(name, dns.SHA1, iterations, salt)] = name
+	}
+
+	ordered := make([]string, 0, len(hashes))
+	for hash := range hashes {
+		ordered = append(ordered, hash)
+	}
+
+	slices.Sort(ordered)
+
+	var flags uint8
+	if optOut {
+		flags = nsec3OptOut
+	}
+
+	chain := make([]dns.RR, 0, len(ordered))
+	for i, hash := range ordered {
+		types := names[hashes[hash]]
+		if len(types) > 0 {
+			types = withDNSSECTypes(types)
+		}
+
+		chain = append(chain, &dns.NSEC3{
+			Hdr:        dns.RR_Header{Name: strings.ToLower(hash) + "." + zone, Rrtype: dns.TypeNSEC3, Class: dns.ClassINET, Ttl: 300},
+			Hash:       dns.SHA1,
+			Flags:      flags,
+			Iterations: iterations,
+			Salt:       salt,
+			HashLength: 20,
+			NextDomain: ordered[(i+1)%len(ordered)],
+			TypeBitMap: types,
+		})
+	}
+
+	return chain
+}
+
+// withDNSSECTypes returns the sorted types, along with the RRSIG type and the
+// additional ones, as signed names own.
+func withDNSSECTypes(types []uint16, additional ...uint16) []uint16 {
+	types = append(slices.Clone(types), dns.TypeRRSIG)
+	types = append(types, additional...)
+	slices.Sort(types)
+
+	return types
+}
@@ -0,0 +1,291 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// defaultNotifyPollInterval is the default interval at which the nameserver's SOA
+	// record is polled after a NOTIFY, when waiting for the new serial.
+	defaultNotifyPollInterval = 100 * time.Millisecond
+
+	// defaultNotifyPollTimeout is the default time we wait for the nameserver to serve
+	// the new serial after a NOTIFY.
+	defaultNotifyPollTimeout = 30 * time.Second
+)
+
+// NotifyOptions holds the options of a NOTIFY message.
+type NotifyOptions struct {
+	// Serial holds the serial of the zone's new version. When set, it is sent to the
+	// nameserver as a hint, in the SOA record of the message's answer section.
+	Serial uint32 `js:"serial"`
+
+	// TSIG holds the key the NOTIFY message, and the SOA queries polling the nameserver,
+	// are signed with, if any. Responses are then verified using the same key. It
+	// defaults to the TSIG key of the Client's options, set in scripts with configure.
+	TSIG TSIGOptions `js:"tsig"`
+
+	// Transport holds the transport protocol the message is sent over, either
+	// TransportUDP or TransportTCP. It defaults to TransportUDP.
+	Transport Transport `js:"transport"`
+
+	// WaitForSerial enables polling the nameserver's SOA record, once it acknowledged
+	// the NOTIFY, until it serves Serial, or a later serial, for the zone.
+	WaitForSerial bool `js:"waitForSerial"`
+
+	// PollInterval holds the interval at which the SOA record is polled when
+	// WaitForSerial is enabled. It defaults to 100 milliseconds.
+	PollInterval time.Duration `js:"-"`
+
+	// PollTimeout holds how long to wait for the nameserver to serve the serial when
+	// WaitForSerial is enabled. It defaults to 30 seconds.
+	PollTimeout time.Duration `js:"-"`
+}
+
+// Validate checks that the options are consistent, and returns an error describing
+// the first problem found otherwise.
+func (o NotifyOptions) Validate() error {
+	switch o.Transport {
+	case "", TransportUDP, TransportTCP:
+	default:
+		return fmt.Errorf(
+			"invalid notify transport %q; expected one of %q or %q",
+			o.Transport, TransportUDP, TransportTCP,
+		)
+	}
+
+	if err := o.TSIG.Validate(); err != nil {
+		return fmt.Errorf("invalid tsig key: %w", err)
+	}
+
+	if o.WaitForSerial && o.Serial == 0 {
+		return errors.New("a serial must be provided to wait for it")
+	}
+
+	if o.PollInterval < 0 || o.PollTimeout < 0 {
+		return errors.New("poll interval and timeout must not be negative")
+	}
+
+	return nil
+}
+
+// NotifySummary holds the outcome of a NOTIFY.
+type NotifySummary struct {
+	// Duration holds the time elapsed from sending the NOTIFY message to receiving
+	// the nameserver's acknowledgement.
+	Duration time.Duration
+
+	// Serial holds the serial the nameserver served for the zone when last polled, if
+	// WaitForSerial is enabled.
+	Serial uint32
+
+	// Polls holds the number of SOA queries sent to the nameserver, if WaitForSerial
+	// is enabled.
+	Polls int
+
+	// Propagation holds the time elapsed from sending the NOTIFY message to the
+	// nameserver serving the new serial, if WaitForSerial is enabled and it did.
+	Propagation time.Duration
+
+	// RecordingErr holds the error opening the recording, or recording the exchanges of
+	// the NOTIFY and of its SOA polls to it, failed with, when recording exchanges. It
+	// doesn't fail the NOTIFY.
+	RecordingErr error
+}
+
+// Notify notifies the nameserver of a change of the zone, as per [RFC1996], and waits
+// for the nameserver to acknowledge it. When WaitForSerial is enabled, it then polls the
+// nameserver's SOA record until it serves the new serial, measuring how long the change
+// took to propagate to the nameserver.
+//
+// NOTIFY messages rejected by the nameserver return an *Error of the kind matching the
+// response code, such as NotAuth or Refused.
+//
+// [RFC1996]: https://www.iana.org/go/rfc1996
+func (r *Client) Notify(
+	ctx context.Context,
+	zone string,
+	nameserver Nameserver,
+	options NotifyOptions,
+) (NotifySummary, error) {
+	var summary NotifySummary
+	if err := options.Validate(); err != nil {
+		return summary, err
+	}
+
+	zone = dns.Fqdn(zone)
+
+	message := new(dns.Msg)
+	message.SetNotify(zone)
+	message.Id = r.nextQueryID(r.options.QueryID)
+
+	if options.Serial != 0 {
+		message.Answer = []dns.RR{&dns.SOA{
+			Hdr:    dns.RR_Header{Name: zone, Rrtype: dns.TypeSOA, Class: dns.ClassINET},
+			Ns:     ".",
+			Mbox:   ".",
+			Serial: options.Serial,
+		}}
+	}
+
+	exchangeOptions := r.sourceOptions(options.Transport)
+	exchangeOptions.QueryID = r.options.QueryID
+	exchangeOptions.TSIG = options.TSIG.or(r.options.TSIG)
+	exchangeOptions.Record = r.options.Record
+
+	var log exchangeLog
+
+	err := r.notify(ctx, zone, message, nameserver, options, exchangeOptions, &log, &summary)
+	summary.RecordingErr = r.recordExchanges(&log, exchangeOptions.Record, err != nil)
+
+	return summary, err
+}
+
+// notify sends the NOTIFY message of the zone to the nameserver, and waits for its
+// serial if the options ask to, recording the outcome in the summary, and adding the
+// exchanges to the log.
+func (r *Client) notify(
+	ctx context.Context,
+	zone string,
+	message *dns.Msg,
+	nameserver Nameserver,
+	options NotifyOptions,
+	exchangeOptions ClientOptions,
+	log *exchangeLog,
+	summary *NotifySummary,
+) error {
+	start := time.Now()
+	response, err := r.exchange(ctx, message, nameserver, exchangeOptions, log)
+	summary.Duration = time.Since(start)
+
+	if err != nil {
+		var signatureErr *Error
+		if errors.As(err, &signatureErr) {
+			return signatureErr
+		}
+
+		return fmt.Errorf("sending the notify of zone %s failed: %w", zone, err)
+	}
+
+	if response.Opcode != dns.OpcodeNotify {
+		return fmt.Errorf(
+			"%w: the response's opcode is %s rather than NOTIFY",
+			ErrResponseMismatch, dns.OpcodeToString[response.Opcode],
+		)
+	}
+
+	if response.Rcode != dns.RcodeSuccess {
+		return newDNSError(response.Rcode, "notify of zone "+zone+" rejected")
+	}
+
+	if !options.WaitForSerial {
+		return nil
+	}
+
+	err = r.waitForSerial(ctx, zone, nameserver, options, exchangeOptions, log, summary)
+	if err == nil {
+		summary.Propagation = time.Since(start)
+	}
+
+	return err
+}
+
+// waitForSerial polls the SOA record of the zone from the nameserver until it serves
+// the options' serial, or a later one, recording the serials served, and the number of
+// polls, in the summary, and adding the polls' exchanges to the log.
+func (r *Client) waitForSerial(
+	ctx context.Context,
+	zone string,
+	nameserver Nameserver,
+	options NotifyOptions,
+	exchangeOptions ClientOptions,
+	log *exchangeLog,
+	summary *NotifySummary,
+) error {
+	interval := options.PollInterval
+	if interval == 0 {
+		interval = defaultNotifyPollInterval
+	}
+
+	timeout := options.PollTimeout
+	if timeout == 0 {
+		timeout = defaultNotifyPollTimeout
+	}
+
+	pollCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	deadline, _ := pollCtx.Deadline()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var pollErr error
+	for {
+		message := new(dns.Msg)
+		message.SetQuestion(zone, dns.TypeSOA)
+		message.Id = r.nextQueryID(exchangeOptions.QueryID)
+
+		summary.Polls++
+
+		response, err := r.exchange(pollCtx, message, nameserver, exchangeOptions, log)
+
+		switch {
+		case err != nil && !time.Now().Before(deadline):
+			// The poll was interrupted by the timeout, and the outcome of the
+			// previous one is reported instead.
+		case err != nil:
+			pollErr = err
+		case response.Rcode != dns.RcodeSuccess:
+			pollErr = newDNSError(response.Rcode, "querying the SOA record of zone "+zone+" failed")
+		default:
+			// Responses without a SOA record, such as those of a zone not loaded
+			// yet, don't serve any serial.
+			pollErr = fmt.Errorf("the response to the SOA query of zone %s holds no SOA record", zone)
+
+			for _, rr := range response.Answer {
+				if soa, ok := rr.(*dns.SOA); ok {
+					summary.Serial = soa.Serial
+					pollErr = nil
+				}
+			}
+
+			if pollErr == nil && serialAtLeast(summary.Serial, options.Serial) {
+				return nil
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-pollCtx.Done():
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return fmt.Errorf("waiting for zone %s to reach serial %d aborted: %w", zone, options.Serial, ctxErr)
+			}
+
+			if pollErr != nil {
+				return fmt.Errorf(
+					"zone %s didn't reach serial %d within %s: %w",
+					zone, options.Serial, timeout, pollErr,
+				)
+			}
+
+			return fmt.Errorf(
+				"zone %s didn't reach serial %d within %s; last served serial is %d",
+				zone, options.Serial, timeout, summary.Serial,
+			)
+		}
+	}
+}
+
+// serialAtLeast returns true if the serial is equal to, or later than, the other
+// serial, using the serial number arithmetic of [RFC1982].
+//
+// [RFC1982]: https://www.iana.org/go/rfc1982
+func serialAtLeast(serial, other uint32) bool {
+	return int32(serial-other) >= 0 //nolint:gosec
+}
@@ -0,0 +1,205 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_NotifyZone(t *testing.T) {
+	t.Parallel()
+
+	t.Run("NOTIFY messages hint the new serial", func(t *testing.T) {
+		t.Parallel()
+
+		var gotSerial atomic.Uint32
+		nameserver := startTestNameserver(t, testNotifyHandler(t, &gotSerial, func() uint32 { return 0 }))
+
+		summary, err := NewDNSClient().Notify(context.Background(), "k6.test", nameserver, NotifyOptions{Serial: 7})
+		require.NoError(t, err)
+
+		assert.Equal(t, uint32(7), gotSerial.Load())
+		assert.Positive(t, summary.Duration)
+		assert.Zero(t, summary.Polls)
+		assert.Zero(t, summary.Propagation)
+	})
+
+	t.Run("waiting for the serial polls the nameserver until it serves it", func(t *testing.T) {
+		t.Parallel()
+
+		var polls atomic.Uint32
+		nameserver := startTestNameserver(t, testNotifyHandler(t, nil, func() uint32 {
+			if polls.Add(1) < 3 {
+				return 6
+			}
+
+			return 7
+		}))
+
+		summary, err := NewDNSClient().Notify(context.Background(), "k6.test", nameserver, NotifyOptions{
+			Serial:        7,
+			WaitForSerial: true,
+			PollInterval:  10 * time.Millisecond,
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, 3, summary.Polls)
+		assert.Equal(t, uint32(7), summary.Serial)
+		assert.GreaterOrEqual(t, summary.Propagation, 20*time.Millisecond)
+		assert.Greater(t, summary.Propagation, summary.Duration)
+	})
+
+	t.Run("waiting for the serial times out if the nameserver never serves it", func(t *testing.T) {
+		t.Parallel()
+
+		nameserver := startTestNameserver(t, testNotifyHandler(t, nil, func() uint32 { return 6 }))
+
+		summary, err := NewDNSClient().Notify(context.Background(), "k6.test", nameserver, NotifyOptions{
+			Serial:        7,
+			WaitForSerial: true,
+			PollInterval:  10 * time.Millisecond,
+			PollTimeout:   50 * time.Millisecond,
+		})
+		require.ErrorContains(t, err, "didn't reach serial 7")
+		assert.ErrorContains(t, err, "last served serial is 6")
+
+		assert.Equal(t, uint32(6), summary.Serial)
+		assert.Greater(t, summary.Polls, 1)
+		assert.Zero(t, summary.Propagation)
+	})
+
+	t.Run("waiting for the serial keeps polling responses without a SOA record", func(t *testing.T) {
+		t.Parallel()
+
+		// The nameserver acknowledges NOTIFY messages, but answers SOA queries with
+		// NODATA responses, as if the zone wasn't loaded yet.
+		nameserver := startTestNameserver(t, func(w dns.ResponseWriter, r *dns.Msg) {
+			response := new(dns.Msg)
+			response.SetReply(r)
+			assert.NoError(t, w.WriteMsg(response))
+		})
+
+		// Serials over 2^31 are later than 0, the serial of a missing SOA record.
+		summary, err := NewDNSClient().Notify(context.Background(), "k6.test", nameserver, NotifyOptions{
+			Serial:        1<<31 + 1,
+			WaitForSerial: true,
+			PollInterval:  10 * time.Millisecond,
+			PollTimeout:   50 * time.Millisecond,
+		})
+		require.ErrorContains(t, err, "didn't reach serial 2147483649")
+		assert.ErrorContains(t, err, "holds no SOA record")
+
+		assert.Zero(t, summary.Serial)
+		assert.Greater(t, summary.Polls, 1)
+		assert.Zero(t, summary.Propagation)
+	})
+
+	t.Run("rejected NOTIFY messages fail with the matching error kind", func(t *testing.T) {
+		t.Parallel()
+
+		nameserver := startTestNameserver(t, func(w dns.ResponseWriter, r *dns.Msg) {
+			response := new(dns.Msg)
+			response.SetRcode(r, dns.RcodeNotAuth)
+			assert.NoError(t, w.WriteMsg(response))
+		})
+
+		_, err := NewDNSClient().Notify(context.Background(), "k6.test", nameserver, NotifyOptions{})
+
+		var dnsErr *Error
+		require.ErrorAs(t, err, &dnsErr)
+		assert.Equal(t, NotAuth, dnsErr.Kind)
+	})
+
+	t.Run("TSIG signed NOTIFY messages are verified", func(t *testing.T) {
+		t.Parallel()
+
+		nameserver := startTestTransferServer(t, nil, func(w dns.ResponseWriter, r *dns.Msg) {
+			response := new(dns.Msg)
+			if tsig := r.IsTsig(); tsig != nil && w.TsigStatus() == nil {
+				response.SetReply(r)
+				response.SetTsig(tsig.Hdr.Name, tsig.Algorithm, tsigFudge, time.Now().Unix())
+			} else {
+				response.SetRcode(r, dns.RcodeRefused)
+			}
+
+			assert.NoError(t, w.WriteMsg(response))
+		})
+
+		options := NotifyOptions{
+			Transport: TransportTCP,
+			TSIG:      TSIGOptions{Name: "transfer.k6.test", Secret: testTSIGSecret},
+		}
+
+		_, err := NewDNSClient().Notify(context.Background(), "k6.test", nameserver, options)
+		require.NoError(t, err)
+
+		options.TSIG = TSIGOptions{}
+		_, err = NewDNSClient().Notify(context.Background(), "k6.test", nameserver, options)
+
+		var dnsErr *Error
+		require.ErrorAs(t, err, &dnsErr)
+		assert.Equal(t, Refused, dnsErr.Kind)
+	})
+
+	t.Run("invalid options are rejected", func(t *testing.T) {
+		t.Parallel()
+
+		for _, options := range []NotifyOptions{
+			{Transport: TransportTLS},
+			{WaitForSerial: true},
+			{Serial: 7, PollInterval: -time.Second},
+			{TSIG: TSIGOptions{Name: "transfer.k6.test", Secret: "not base64!"}},
+		} {
+			_, err := NewDNSClient().Notify(
+				context.Background(), "k6.test", Nameserver{IP: net.IPv4(127, 0, 0, 1), Port: 53}, options,
+			)
+
+			assert.Error(t, err)
+		}
+	})
+}
+
+func Test_serialAtLeast(t *testing.T) {
+	t.Parallel()
+
+	assert.True(t, serialAtLeast(7, 7))
+	assert.True(t, serialAtLeast(8, 7))
+	assert.False(t, serialAtLeast(6, 7))
+
+	// Serials wrap around, as per RFC 1982.
+	assert.True(t, serialAtLeast(1, 4294967295))
+	assert.False(t, serialAtLeast(4294967295, 1))
+}
+
+// testNotifyHandler returns a handler acknowledging NOTIFY messages of the k6.test. zone,
+// storing the serial they hint in gotSerial, if provided, and answering SOA queries with
+// the serial returned by currentSerial.
+func testNotifyHandler(t *testing.T, gotSerial *atomic.Uint32, currentSerial func() uint32) dns.HandlerFunc {
+	t.Helper()
+
+	return func(w dns.ResponseWriter, r *dns.Msg) {
+		response := new(dns.Msg)
+		response.SetReply(r)
+
+		if r.Opcode == dns.OpcodeNotify {
+			if len(r.Answer) > 0 && gotSerial != nil {
+				gotSerial.Store(r.Answer[0].(*dns.SOA).Serial) //nolint:forcetypeassert
+			}
+		} else {
+			response.Answer = []dns.RR{&dns.SOA{
+				Hdr:    dns.RR_Header{Name: "k6.test.", Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 300},
+				Ns:     "ns.k6.test.",
+				Mbox:   "admin.k6.test.",
+				Serial: currentSerial(),
+			}}
+		}
+
+		assert.NoError(t, w.WriteMsg(response))
+	}
+}
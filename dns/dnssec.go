@@ -0,0 +1,802 @@
+package dns
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// DNSSECStatus represents the outcome of the DNSSEC validation of a response, as
+// defined by [RFC4033].
+//
+// [RFC4033]: https://www.iana.org/go/rfc4033
+type DNSSECStatus string
+
+const (
+	// DNSSECSecure means that a chain of trust was built from a trust anchor down to
+	// the response's records, and that all of their signatures are valid.
+	DNSSECSecure DNSSECStatus = "secure"
+
+	// DNSSECInsecure means that the response's records belong to a zone that is proven
+	// not to be signed, as its delegation has no DS records.
+	DNSSECInsecure DNSSECStatus = "insecure"
+
+	// DNSSECBogus means that the response's records should be signed, but that their
+	// signatures, or the chain of trust leading to them, are missing or invalid.
+	DNSSECBogus DNSSECStatus = "bogus"
+
+	// DNSSECIndeterminate means that the response's records could not be validated,
+	// because no trust anchor covers them, or because the records needed to build the
+	// chain of trust could not be retrieved.
+	DNSSECIndeterminate DNSSECStatus = "indeterminate"
+)
+
+// DNSSECResult holds the outcome of the DNSSEC validation of a response.
+type DNSSECResult struct {
+	// Status holds the validation status of the response.
+	Status DNSSECStatus
+
+	// Reason holds why the response is not secure, if so.
+	Reason string
+
+	// Denial holds the verification of the NSEC, or NSEC3, records proving the
+	// denial of a negative response's name or type, for signed negative responses.
+	Denial *DenialProof
+}
+
+// DefaultTrustAnchors holds the DS records of the root zone's key signing keys, as
+// published by [IANA], used as trust anchors when none are provided.
+//
+// [IANA]: https://data.iana.org/root-anchors/root-anchors.xml
+var DefaultTrustAnchors = []string{ //nolint:gochecknoglobals
+	". IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D",
+	". IN DS 38696 8 2 683D2D0ACB8C9B712A1948B27F741219298D0A450D612C483AF444A4C0FB2B16",
+}
+
+// parseTrustAnchors parses trust anchors, provided as DS or DNSKEY records in
+// presentation format, into DS records. DNSKEY records are converted to DS records
+// using a SHA-256 digest.
+func parseTrustAnchors(anchors []string) ([]*dns.DS, error) {
+	if len(anchors) == 0 {
+		anchors = DefaultTrustAnchors
+	}
+
+	parsed := make([]*dns.DS, 0, len(anchors))
+	for _, anchor := range anchors {
+		rr, err := dns.NewRR(anchor)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trust anchor %q: %w", anchor, err)
+		}
+
+		switch t := rr.(type) {
+		case *dns.DS:
+			parsed = append(parsed, t)
+		case *dns.DNSKEY:
+			parsed = append(parsed, t.ToDS(dns.SHA256))
+		default:
+			return nil, fmt.Errorf("invalid trust anchor %q; expected a DS or DNSKEY record", anchor)
+		}
+	}
+
+	return parsed, nil
+}
+
+// dnssecValidator validates the DNSSEC signatures of a response, building the chain
+// of trust from the configured trust anchors down to the response's records.
+//
+// As a stub resolver would, it queries the nameserver that provided the response for
+// the DNSKEY and DS records of each zone along the chain, with the CD bit set, so that
+// a validating recursive nameserver returns bogus records rather than failing.
+type dnssecValidator struct {
+	client     *Client
+	nameserver Nameserver
+	options    ClientOptions
+	anchors    []*dns.DS
+	now        time.Time
+
+	// log holds the exchanges of the validation's queries, to be recorded with those
+	// of the resolution validated.
+	log *exchangeLog
+
+	// keys holds the authenticated keys of each zone of the chain, or the
+	// result preventing their authentication.
+	keys map[string]zoneKeys
+}
+
+// zoneKeys holds the authenticated keys of a zone, or the result that
+// prevented authenticating them.
+type zoneKeys struct {
+	keys   []*dns.DNSKEY
+	result *DNSSECResult
+
+	// expires holds the time the authentication of the keys expires, once the TTL
+	// of their DNSKEY or DS records, or the validity of their signature, runs out.
+	expires time.Time
+}
+
+// newDNSSECValidator creates a new dnssecValidator sending its queries to the
+// nameserver using the provided options, and adding their exchanges to the log.
+func newDNSSECValidator(
+	client *Client,
+	nameserver Nameserver,
+	options ClientOptions,
+	log *exchangeLog,
+) (*dnssecValidator, error) {
+	anchors, err := parseTrustAnchors(options.TrustAnchors)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dnssecValidator{
+		client:     client,
+		nameserver: nameserver,
+		options:    options,
+		anchors:    anchors,
+		now:        time.Now(),
+		log:        log,
+		keys:       make(map[string]zoneKeys),
+	}, nil
+}
+
+// setDNSSECOK sets the DO bit of the message, requesting DNSSEC records, and its
+// CD bit, disabling the validation of recursive nameservers.
+func setDNSSECOK(message *dns.Msg) {
+	message.SetEdns0(dns.DefaultMsgSize, true)
+	message.CheckingDisabled = true
+}
+
+// validate validates the response to the query for name.
+//
+// The records of the answer section are validated for positive responses, and the
+// records of the authority section for negative ones, whose NSEC or NSEC3 records
+// must also prove the denial of the queried name or type. Responses without any
+// signature are secure only if their zone is proven unsigned.
+func (v *dnssecValidator) validate(ctx context.Context, name string, response *dns.Msg) DNSSECResult {
+	name = strings.ToLower(dns.Fqdn(name))
+	if v.anchorZone(name) == "" {
+		return DNSSECResult{Status: DNSSECIndeterminate, Reason: "no trust anchor covers " + name}
+	}
+
+	records := response.Answer
+	if len(records) == 0 {
+		records = response.Ns
+	}
+
+	rrsets, signatures := splitRRsets(records)
+	if len(signatures) == 0 {
+		return v.validateUnsigned(ctx, name, response)
+	}
+
+	for _, rrset := range rrsets {
+		if result := v.verifyRRset(ctx, rrset, signatures); result != nil {
+			return *result
+		}
+	}
+
+	if len(response.Answer) > 0 {
+		if result := v.verifyWildcardExpansions(ctx, rrsets, signatures, response); result != nil {
+			return *result
+		}
+	}
+
+	if len(response.Answer) > 0 || len(response.Question) == 0 {
+		return DNSSECResult{Status: DNSSECSecure}
+	}
+
+	proof := verifyDenial(name, response.Question[0].Qtype, response)
+	if !proof.Covered {
+		return DNSSECResult{Status: DNSSECBogus, Reason: proof.Reason, Denial: &proof}
+	}
+
+	return DNSSECResult{Status: DNSSECSecure, Denial: &proof}
+}
+
+// verifyWildcardExpansions verifies that, for each answer RRset expanded from a wildcard,
+// the signed NSEC or NSEC3 records of the authority section prove that no closer match
+// exists, as per [RFC4035]. It returns nil if so, and the validation result otherwise.
+//
+// [RFC4035]: https://www.iana.org/go/rfc4035#section-5.3.4
+func (v *dnssecValidator) verifyWildcardExpansions(
+	ctx context.Context,
+	rrsets [][]dns.RR,
+	signatures []*dns.RRSIG,
+	response *dns.Msg,
+) *DNSSECResult {
+	authenticated := false
+	for _, rrset := range rrsets {
+		header := rrset[0].Header()
+		owner := strings.ToLower(header.Name)
+
+		labels, expanded := wildcardEncloserLabels(owner, header.Rrtype, signatures)
+		if !expanded {
+			continue
+		}
+
+		// The records proving the expansion are only verified once, and only if
+		// the answer holds an expansion.
+		if !authenticated {
+			authorityRRsets, authoritySignatures := splitRRsets(response.Ns)
+			for _, authorityRRset := range authorityRRsets {
+				rrtype := authorityRRset[0].Header().Rrtype
+				if rrtype != dns.TypeNSEC && rrtype != dns.TypeNSEC3 {
+					continue
+				}
+
+				if result := v.verifyRRset(ctx, authorityRRset, authoritySignatures); result != nil {
+					return result
+				}
+			}
+
+			authenticated = true
+		}
+
+		if err := verifyWildcardExpansion(owner, labels, response.Ns); err != nil {
+			return &DNSSECResult{
+				Status: DNSSECBogus,
+				Reason: fmt.Sprintf("the wildcard expansion of %s %s is not proven: %s",
+					owner, dns.TypeToString[header.Rrtype], err),
+			}
+		}
+	}
+
+	return nil
+}
+
+// wildcardEncloserLabels returns the number of labels of the wildcard the RRset owned
+// by owner was expanded from, without its leading asterisk, as found in the Labels
+// field of the RRset's signatures. It also returns whether the RRset is an expansion,
+// which is the case when the signatures hold fewer labels than the owner name.
+func wildcardEncloserLabels(owner string, rrtype uint16, signatures []*dns.RRSIG) (int, bool) {
+	ownerLabels := dns.CountLabel(owner)
+	if strings.HasPrefix(owner, "*.") {
+		ownerLabels--
+	}
+
+	for _, sig := range signatures {
+		if sig.TypeCovered == rrtype && strings.EqualFold(sig.Hdr.Name, owner) {
+			return int(sig.Labels), int(sig.Labels) < ownerLabels
+		}
+	}
+
+	return 0, false
+}
+
+// validateUnsigned validates a response holding no signatures: it is insecure if the
+// zone holding name is proven to be unsigned, and bogus otherwise.
+func (v *dnssecValidator) validateUnsigned(ctx context.Context, name string, response *dns.Msg) DNSSECResult {
+	zone, err := v.zoneOf(ctx, name, response)
+	if err != nil {
+		return DNSSECResult{Status: DNSSECIndeterminate, Reason: err.Error()}
+	}
+
+	keys := v.zoneKeys(ctx, zone)
+	if keys.result != nil {
+		return *keys.result
+	}
+
+	return DNSSECResult{Status: DNSSECBogus, Reason: "missing signatures for records of signed zone " + zone}
+}
+
+// zoneOf returns the apex of the zone holding name, as found in the SOA record of
+// the response, or of the response to a SOA query for name.
+func (v *dnssecValidator) zoneOf(ctx context.Context, name string, response *dns.Msg) (string, error) {
+	for _, rr := range response.Ns {
+		if soa, ok := rr.(*dns.SOA); ok {
+			return strings.ToLower(soa.Hdr.Name), nil
+		}
+	}
+
+	soaResponse, err := v.query(ctx, name, dns.TypeSOA)
+	if err != nil {
+		return "", err
+	}
+
+	for _, rr := range append(soaResponse.Answer, soaResponse.Ns...) {
+		if soa, ok := rr.(*dns.SOA); ok {
+			return strings.ToLower(soa.Hdr.Name), nil
+		}
+	}
+
+	return "", fmt.Errorf("finding the zone of %s failed: no SOA record found", name)
+}
+
+// verifyRRset verifies that one of the signatures covering the RRset is valid, and
+// made by an authenticated key of the signer's zone. It returns nil if so, and the
+// validation result otherwise.
+func (v *dnssecValidator) verifyRRset(ctx context.Context, rrset []dns.RR, signatures []*dns.RRSIG) *DNSSECResult {
+	header := rrset[0].Header()
+	owner := strings.ToLower(header.Name)
+	description := owner + " " + dns.TypeToString[header.Rrtype]
+
+	var reasons []string
+	for _, sig := range signatures {
+		if sig.TypeCovered != header.Rrtype || !strings.EqualFold(sig.Hdr.Name, header.Name) {
+			continue
+		}
+
+		signer := strings.ToLower(sig.SignerName)
+		if !dns.IsSubDomain(signer, owner) {
+			reasons = append(reasons, fmt.Sprintf("signer %s is not an ancestor of %s", signer, owner))
+			continue
+		}
+
+		keys := v.zoneKeys(ctx, signer)
+		if keys.result != nil {
+			return keys.result
+		}
+
+		if err := verifySignature(sig, keys.keys, rrset, v.now); err != nil {
+			reasons = append(reasons, err.Error())
+			continue
+		}
+
+		return nil
+	}
+
+	if len(reasons) == 0 {
+		return &DNSSECResult{Status: DNSSECBogus, Reason: "missing signature for " + description}
+	}
+
+	return &DNSSECResult{
+		Status: DNSSECBogus,
+		Reason: "invalid signature for " + description + ": " + strings.Join(reasons, "; "),
+	}
+}
+
+// zoneKeys returns the authenticated DNSKEY records of the zone. The DNSKEY RRset must
+// be signed by a key matching either a trust anchor, or the DS records of the zone
+// authenticated by its parent zone.
+//
+// Authenticated keys are cached by the client until their authentication expires, for
+// the validation of further responses not to query them again.
+func (v *dnssecValidator) zoneKeys(ctx context.Context, zone string) zoneKeys {
+	if keys, ok := v.keys[zone]; ok {
+		return keys
+	}
+
+	cacheKey := zoneKeysCacheKey{
+		exchange: newCacheKey(zone, dns.TypeDNSKEY, v.nameserver, v.options),
+		anchors:  strings.Join(v.options.TrustAnchors, "\n"),
+	}
+
+	if keys, ok := v.client.zoneKeys.get(cacheKey, v.now); ok {
+		v.keys[zone] = keys
+		return keys
+	}
+
+	// Guard against chains of trust looping back to the zone, such as
+	// DS records signed by the zone itself.
+	v.keys[zone] = zoneKeys{result: &DNSSECResult{
+		Status: DNSSECBogus,
+		Reason: "the chain of trust of zone " + zone + " loops back to itself",
+	}}
+
+	keys := v.authenticateZoneKeys(ctx, zone)
+	v.keys[zone] = keys
+
+	if keys.result == nil {
+		v.client.zoneKeys.store(cacheKey, keys)
+	}
+
+	return keys
+}
+
+// authenticateZoneKeys fetches and authenticates the DNSKEY records of the zone.
+func (v *dnssecValidator) authenticateZoneKeys(ctx context.Context, zone string) zoneKeys {
+	delegationSigners := v.trustAnchors(zone)
+	anchored := len(delegationSigners) > 0
+	if !anchored {
+		var result *DNSSECResult
+		delegationSigners, result = v.delegationSigners(ctx, zone)
+		if result != nil {
+			return zoneKeys{result: result}
+		}
+	}
+
+	response, err := v.query(ctx, zone, dns.TypeDNSKEY)
+	if err != nil {
+		return zoneKeys{result: &DNSSECResult{Status: DNSSECIndeterminate, Reason: err.Error()}}
+	}
+
+	var keys []*dns.DNSKEY
+	var signatures []*dns.RRSIG
+	var rrset []dns.RR
+	for _, rr := range response.Answer {
+		switch t := rr.(type) {
+		case *dns.DNSKEY:
+			keys = append(keys, t)
+			rrset = append(rrset, t)
+		case *dns.RRSIG:
+			if t.TypeCovered == dns.TypeDNSKEY {
+				signatures = append(signatures, t)
+			}
+		}
+	}
+
+	if len(keys) == 0 {
+		return zoneKeys{result: &DNSSECResult{Status: DNSSECBogus, Reason: "no DNSKEY records found for zone " + zone}}
+	}
+
+	// Only the keys matching a DS record, the secure entry points of the
+	// zone, are trusted to sign its DNSKEY RRset.
+	var entryPoints []*dns.DNSKEY
+	for _, key := range keys {
+		for _, ds := range delegationSigners {
+			if matchesDS(key, ds) {
+				entryPoints = append(entryPoints, key)
+				break
+			}
+		}
+	}
+
+	if len(entryPoints) == 0 {
+		return zoneKeys{result: &DNSSECResult{
+			Status: DNSSECBogus,
+			Reason: "no DNSKEY record of zone " + zone + " matches its DS records",
+		}}
+	}
+
+	var reasons []string
+	for _, sig := range signatures {
+		if !strings.EqualFold(sig.SignerName, zone) {
+			continue
+		}
+
+		if err := verifySignature(sig, entryPoints, rrset, v.now); err != nil {
+			reasons = append(reasons, err.Error())
+			continue
+		}
+
+		// Trust anchors don't expire, as opposed to the DS records of the parent zone.
+		ttl := minTTL(rrset)
+		if !anchored {
+			for _, ds := range delegationSigners {
+				ttl = min(ttl, ds.Hdr.Ttl)
+			}
+		}
+
+		// The signature is valid, thus expires within the next 2^32 seconds, as per the
+		// serial arithmetic of RFC 4034.
+		remaining := sig.Expiration - uint32(v.now.Unix()) //nolint:gosec // truncating the time is intended
+
+		return zoneKeys{keys: keys, expires: v.now.Add(time.Duration(min(ttl, remaining)) * time.Second)}
+	}
+
+	reason := "DNSKEY records of zone " + zone + " are not signed by a key matching its DS records"
+	if len(reasons) > 0 {
+		reason += ": " + strings.Join(reasons, "; ")
+	}
+
+	return zoneKeys{result: &DNSSECResult{Status: DNSSECBogus, Reason: reason}}
+}
+
+// delegationSigners returns the DS records of the zone, authenticated by its parent
+// zone. A zone whose delegation is authenticated as having no DS records is insecure.
+func (v *dnssecValidator) delegationSigners(ctx context.Context, zone string) ([]*dns.DS, *DNSSECResult) {
+	if zone == "." || v.anchorZone(zone) == "" {
+		return nil, &DNSSECResult{Status: DNSSECIndeterminate, Reason: "no trust anchor covers zone " + zone}
+	}
+
+	response, err := v.query(ctx, zone, dns.TypeDS)
+	if err != nil {
+		return nil, &DNSSECResult{Status: DNSSECIndeterminate, Reason: err.Error()}
+	}
+
+	var delegationSigners []*dns.DS
+	for _, rr := range response.Answer {
+		if ds, ok := rr.(*dns.DS); ok && strings.EqualFold(ds.Hdr.Name, zone) {
+			delegationSigners = append(delegationSigners, ds)
+		}
+	}
+
+	records := response.Answer
+	if len(delegationSigners) == 0 {
+		records = response.Ns
+	}
+
+	// The DS RRset, or the negative response proving its absence, must be
+	// signed by the parent zone, which we authenticate in turn.
+	rrsets, signatures := splitRRsets(records)
+	if len(signatures) == 0 {
+		signer := v.signerOf(response, parentZone(zone))
+		if strings.EqualFold(signer, zone) || !dns.IsSubDomain(signer, zone) {
+			signer = parentZone(zone)
+		}
+
+		keys := v.zoneKeys(ctx, signer)
+		if keys.result != nil {
+			return nil, keys.result
+		}
+
+		return nil, &DNSSECResult{
+			Status: DNSSECBogus,
+			Reason: "missing signatures for the DS records of zone " + zone,
+		}
+	}
+
+	for _, rrset := range rrsets {
+		owner := rrset[0].Header().Name
+		if len(delegationSigners) == 0 && strings.EqualFold(owner, zone) && rrset[0].Header().Rrtype == dns.TypeSOA {
+			// A SOA record owned by the zone itself means the nameserver answered
+			// from the child zone, rather than from its parent.
+			return nil, &DNSSECResult{
+				Status: DNSSECIndeterminate,
+				Reason: "the DS records of zone " + zone + " were answered from the zone itself",
+			}
+		}
+
+		if result := v.verifyRRsetFromParent(ctx, zone, rrset, signatures); result != nil {
+			return nil, result
+		}
+	}
+
+	if len(delegationSigners) == 0 {
+		// The absence of DS records must be proven by the parent zone, for
+		// an attacker not to strip them to make the zone look unsigned.
+		if proof := verifyDenial(zone, dns.TypeDS, response); !proof.Covered {
+			return nil, &DNSSECResult{Status: DNSSECBogus, Reason: proof.Reason}
+		}
+
+		return nil, &DNSSECResult{
+			Status: DNSSECInsecure,
+			Reason: "the delegation of zone " + zone + " has no DS records",
+		}
+	}
+
+	return delegationSigners, nil
+}
+
+// verifyRRsetFromParent verifies the RRset like verifyRRset does, additionally checking
+// that it is signed by an ancestor of the zone, as DS records are.
+func (v *dnssecValidator) verifyRRsetFromParent(
+	ctx context.Context,
+	zone string,
+	rrset []dns.RR,
+	signatures []*dns.RRSIG,
+) *DNSSECResult {
+	var fromParent []*dns.RRSIG
+	for _, sig := range signatures {
+		if !strings.EqualFold(sig.SignerName, zone) {
+			fromParent = append(fromParent, sig)
+		}
+	}
+
+	return v.verifyRRset(ctx, rrset, fromParent)
+}
+
+// signerOf returns the signer of the response's first signature, or the provided
+// fallback if it has none.
+func (v *dnssecValidator) signerOf(response *dns.Msg, fallback string) string {
+	for _, rr := range append(response.Answer, response.Ns...) {
+		if sig, ok := rr.(*dns.RRSIG); ok {
+			return strings.ToLower(sig.SignerName)
+		}
+	}
+
+	for _, rr := range response.Ns {
+		if soa, ok := rr.(*dns.SOA); ok {
+			return strings.ToLower(soa.Hdr.Name)
+		}
+	}
+
+	return fallback
+}
+
+// trustAnchors returns the trust anchors of the zone.
+func (v *dnssecValidator) trustAnchors(zone string) []*dns.DS {
+	var anchors []*dns.DS
+	for _, anchor := range v.anchors {
+		if strings.EqualFold(anchor.Hdr.Name, zone) {
+			anchors = append(anchors, anchor)
+		}
+	}
+
+	return anchors
+}
+
+// anchorZone returns the closest zone enclosing name that has a trust anchor, or
+// an empty string if none does.
+func (v *dnssecValidator) anchorZone(name string) string {
+	closest := ""
+	for _, anchor := range v.anchors {
+		zone := strings.ToLower(anchor.Hdr.Name)
+		if dns.IsSubDomain(zone, name) && dns.CountLabel(zone) >= dns.CountLabel(closest) {
+			closest = zone
+		}
+	}
+
+	return closest
+}
+
+// query sends a query for name and qtype, requesting DNSSEC records, and returns
+// the response. Truncated UDP responses are retried over TCP.
+func (v *dnssecValidator) query(ctx context.Context, name string, qtype uint16) (*dns.Msg, error) {
+	options := v.options
+
+	message := new(dns.Msg)
+	message.SetQuestion(dns.Fqdn(name), qtype)
+	message.Id = v.client.nextQueryID(options.QueryID)
+	setDNSSECOK(message)
+
+	response, err := v.client.exchange(ctx, message, v.nameserver, options, v.log)
+	if err == nil && response.Truncated && options.Transport.network() == "udp" {
+		options.Transport = TransportTCP
+		response, err = v.client.exchange(ctx, message, v.nameserver, options, v.log)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("querying the %s records of %s failed: %w", dns.TypeToString[qtype], name, err)
+	}
+
+	if response.Rcode != dns.RcodeSuccess {
+		return nil, fmt.Errorf(
+			"querying the %s records of %s failed: %s",
+			dns.TypeToString[qtype],
+			name,
+			dns.RcodeToString[response.Rcode],
+		)
+	}
+
+	return response, nil
+}
+
+// splitRRsets groups the records into RRsets, in order of appearance, and returns
+// them along with the signatures found among the records.
+func splitRRsets(records []dns.RR) ([][]dns.RR, []*dns.RRSIG) {
+	type rrsetKey struct {
+		name   string
+		rrtype uint16
+		class  uint16
+	}
+
+	var rrsets [][]dns.RR
+	var signatures []*dns.RRSIG
+	index := make(map[rrsetKey]int)
+
+	for _, rr := range records {
+		switch t := rr.(type) {
+		case *dns.RRSIG:
+			signatures = append(signatures, t)
+		case *dns.OPT:
+		default:
+			header := rr.Header()
+			key := rrsetKey{strings.ToLower(header.Name), header.Rrtype, header.Class}
+
+			i, ok := index[key]
+			if !ok {
+				i = len(rrsets)
+				index[key] = i
+				rrsets = append(rrsets, nil)
+			}
+
+			rrsets[i] = append(rrsets[i], rr)
+		}
+	}
+
+	return rrsets, signatures
+}
+
+// verifySignature verifies the signature over the RRset using the matching key, and
+// checks that the current time is within its validity period.
+func verifySignature(sig *dns.RRSIG, keys []*dns.DNSKEY, rrset []dns.RR, now time.Time) error {
+	var verifyErr error
+	for _, key := range keys {
+		if key.KeyTag() != sig.KeyTag || key.Algorithm != sig.Algorithm {
+			continue
+		}
+
+		if err := sig.Verify(key, rrset); err != nil {
+			verifyErr = fmt.Errorf("signature with key tag %d failed verification: %w", sig.KeyTag, err)
+			continue
+		}
+
+		if !sig.ValidityPeriod(now) {
+			return fmt.Errorf(
+				"signature with key tag %d is outside its validity period, from %s to %s",
+				sig.KeyTag,
+				dns.TimeToString(sig.Inception),
+				dns.TimeToString(sig.Expiration),
+			)
+		}
+
+		return nil
+	}
+
+	if verifyErr != nil {
+		return verifyErr
+	}
+
+	return fmt.Errorf("no DNSKEY record matches the signature's key tag %d", sig.KeyTag)
+}
+
+// minTTL returns the lowest TTL of the records.
+func minTTL(records []dns.RR) uint32 {
+	ttl := uint32(math.MaxUint32)
+	for _, rr := range records {
+		ttl = min(ttl, rr.Header().Ttl)
+	}
+
+	return ttl
+}
+
+// matchesDS returns true if the key is the one the DS record refers to.
+func matchesDS(key *dns.DNSKEY, ds *dns.DS) bool {
+	if key.KeyTag() != ds.KeyTag || key.Algorithm != ds.Algorithm {
+		return false
+	}
+
+	computed := key.ToDS(ds.DigestType)
+
+	return computed != nil && strings.EqualFold(computed.Digest, ds.Digest)
+}
+
+// parentZone returns the parent of the zone.
+func parentZone(zone string) string {
+	labels := dns.Split(zone)
+	if len(labels) <= 1 {
+		return "."
+	}
+
+	return zone[labels[1]:]
+}
+
+// zoneKeysCache caches the authenticated DNSKEY records of zones until their
+// authentication expires. It is safe for concurrent use.
+type zoneKeysCache struct {
+	mu      sync.Mutex
+	entries map[zoneKeysCacheKey]zoneKeys
+}
+
+// zoneKeysCacheKey identifies the keys of a zone, as authenticated from the records
+// served by a nameserver, and up to a set of trust anchors. The records are fetched
+// using the options changing the exchange of cached resolutions, such as the transport
+// or TSIG key, which thus only share keys fetched using the same options.
+type zoneKeysCacheKey struct {
+	exchange cacheKey
+	anchors  string
+}
+
+// newZoneKeysCache creates a new, empty, zoneKeysCache.
+func newZoneKeysCache() *zoneKeysCache {
+	return &zoneKeysCache{entries: make(map[zoneKeysCacheKey]zoneKeys)}
+}
+
+// get returns the cached keys matching the key, unless their authentication expired.
+func (c *zoneKeysCache) get(key zoneKeysCacheKey, now time.Time) (zoneKeys, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	keys, ok := c.entries[key]
+	if !ok {
+		return zoneKeys{}, false
+	}
+
+	if !now.Before(keys.expires) {
+		delete(c.entries, key)
+		return zoneKeys{}, false
+	}
+
+	return keys, true
+}
+
+// store caches the authenticated keys under the key, until their authentication expires.
+// The keys whose authentication expired are evicted, as keys are only stored once per
+// zone and TTL.
+func (c *zoneKeysCache) store(key zoneKeysCacheKey, keys zoneKeys) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for cached, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, cached)
+		}
+	}
+
+	c.entries[key] = keys
+}
@@ -0,0 +1,371 @@
+package dns
+
+import (
+	"context"
+	"crypto"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_ResolveWithDNSSECValidation(t *testing.T) {
+	t.Parallel()
+
+	tld := newTestDNSSECZone(t, "test.")
+	signed := newTestDNSSECZone(t, "signed.test.")
+	now := time.Now()
+
+	responses := map[string]testDNSSECResponse{
+		"test. DNSKEY":    {answer: tld.keySet(t)},
+		"signed.test. DS": {answer: tld.sign(t, signed.ds())},
+		"unsigned.test. DS": {ns: slices.Concat(
+			tld.sign(t, mustNewRR(t, "test. 300 IN SOA ns.test. admin.test. 1 7200 3600 1209600 300")),
+			tld.sign(t, mustNewRR(t, "unsigned.test. 300 IN NSEC z.test. NS RRSIG NSEC")),
+		)},
+		"stripped.test. DS":   {ns: tld.sign(t, mustNewRR(t, "test. 300 IN SOA ns.test. admin.test. 1 7200 3600 1209600 300"))},
+		"signed.test. DNSKEY": {answer: signed.keySet(t)},
+		"a.signed.test. A":    {answer: signed.sign(t, mustNewRR(t, "a.signed.test. 60 IN A "+primaryTestIPv4))},
+		"bad.signed.test. A": {answer: append(
+			[]dns.RR{mustNewRR(t, "bad.signed.test. 60 IN A "+secondaryTestIPv4)},
+			signed.sign(t, mustNewRR(t, "bad.signed.test. 60 IN A "+primaryTestIPv4))[1:]...,
+		)},
+		"expired.signed.test. A": {answer: signed.signWithValidity(t,
+			now.Add(-48*time.Hour), now.Add(-24*time.Hour),
+			mustNewRR(t, "expired.signed.test. 60 IN A "+primaryTestIPv4),
+		)},
+		"stripped.signed.test. A": {answer: []dns.RR{mustNewRR(t, "stripped.signed.test. 60 IN A "+primaryTestIPv4)}},
+		"host.wild.signed.test. A": {
+			answer: expandTestWildcard(
+				signed.sign(t, mustNewRR(t, "*.wild.signed.test. 60 IN A "+primaryTestIPv4)),
+				"host.wild.signed.test.",
+			),
+			ns: signed.sign(t, mustNewRR(t, "*.wild.signed.test. 300 IN NSEC z.signed.test. A RRSIG NSEC")),
+		},
+		"unproven.wild.signed.test. A": {
+			answer: expandTestWildcard(
+				signed.sign(t, mustNewRR(t, "*.wild.signed.test. 60 IN A "+primaryTestIPv4)),
+				"unproven.wild.signed.test.",
+			),
+		},
+		"missing.signed.test. A": {
+			rcode: dns.RcodeNameError,
+			ns: slices.Concat(
+				signed.sign(t, mustNewRR(t, "signed.test. 300 IN SOA ns.signed.test. admin.signed.test. 1 7200 3600 1209600 300")),
+				signed.sign(t, mustNewRR(t, "signed.test. 300 IN NSEC a.signed.test. SOA NS RRSIG NSEC DNSKEY")),
+				signed.sign(t, mustNewRR(t, "expired.signed.test. 300 IN NSEC stripped.signed.test. A RRSIG NSEC")),
+			),
+		},
+		"unproven.signed.test. A": {
+			rcode: dns.RcodeNameError,
+			ns: slices.Concat(
+				signed.sign(t, mustNewRR(t, "signed.test. 300 IN SOA ns.signed.test. admin.signed.test. 1 7200 3600 1209600 300")),
+				signed.sign(t, mustNewRR(t, "signed.test. 300 IN NSEC a.signed.test. SOA NS RRSIG NSEC DNSKEY")),
+			),
+		},
+		"stripped.signed.test. SOA": {
+			ns: signed.sign(t, mustNewRR(t, "signed.test. 300 IN SOA ns.signed.test. admin.signed.test. 1 7200 3600 1209600 300")),
+		},
+		"a.unsigned.test. A": {answer: []dns.RR{mustNewRR(t, "a.unsigned.test. 60 IN A "+primaryTestIPv4)}},
+		"a.unsigned.test. SOA": {ns: []dns.RR{
+			mustNewRR(t, "unsigned.test. 300 IN SOA ns.unsigned.test. admin.unsigned.test. 1 7200 3600 1209600 300"),
+		}},
+		"a.stripped.test. A": {answer: []dns.RR{mustNewRR(t, "a.stripped.test. 60 IN A "+primaryTestIPv4)}},
+		"a.stripped.test. SOA": {ns: []dns.RR{
+			mustNewRR(t, "stripped.test. 300 IN SOA ns.stripped.test. admin.stripped.test. 1 7200 3600 1209600 300"),
+		}},
+	}
+
+	nameserver := startTestNameserver(t, testDNSSECHandler(t, responses))
+	anchors := []string{tld.ds().String()}
+
+	tests := []struct {
+		name       string
+		query      string
+		anchors    []string
+		wantStatus DNSSECStatus
+		wantDenial bool
+		wantErr    bool
+	}{
+		{name: "signed answers are secure", query: "a.signed.test", anchors: anchors, wantStatus: DNSSECSecure},
+		{
+			name:       "negative answers with signed denial proofs are secure",
+			query:      "missing.signed.test",
+			anchors:    anchors,
+			wantStatus: DNSSECSecure,
+			wantDenial: true,
+			wantErr:    true,
+		},
+		{
+			name:       "negative answers not proving the denial are bogus",
+			query:      "unproven.signed.test",
+			anchors:    anchors,
+			wantStatus: DNSSECBogus,
+			wantErr:    true,
+		},
+		{
+			name:       "wildcard expansions proving no closer match exists are secure",
+			query:      "host.wild.signed.test",
+			anchors:    anchors,
+			wantStatus: DNSSECSecure,
+		},
+		{
+			name:       "wildcard expansions not proving no closer match exists are bogus",
+			query:      "unproven.wild.signed.test",
+			anchors:    anchors,
+			wantStatus: DNSSECBogus,
+		},
+		{name: "tampered answers are bogus", query: "bad.signed.test", anchors: anchors, wantStatus: DNSSECBogus},
+		{name: "expired signatures are bogus", query: "expired.signed.test", anchors: anchors, wantStatus: DNSSECBogus},
+		{
+			name:       "unsigned answers from signed zones are bogus",
+			query:      "stripped.signed.test",
+			anchors:    anchors,
+			wantStatus: DNSSECBogus,
+		},
+		{
+			name:       "unsigned answers from zones without DS records are insecure",
+			query:      "a.unsigned.test",
+			anchors:    anchors,
+			wantStatus: DNSSECInsecure,
+		},
+		{
+			name:       "unsigned answers from zones whose missing DS records are not proven are bogus",
+			query:      "a.stripped.test",
+			anchors:    anchors,
+			wantStatus: DNSSECBogus,
+		},
+		{
+			name:       "answers no trust anchor covers are indeterminate",
+			query:      "a.signed.test",
+			anchors:    []string{". IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D"},
+			wantStatus: DNSSECIndeterminate,
+		},
+		{
+			name:       "answers not matching the trust anchor are bogus",
+			query:      "a.signed.test",
+			anchors:    []string{"test. IN DS 12345 13 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D"},
+			wantStatus: DNSSECBogus,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			client := NewDNSClient()
+			resolution, err := client.ResolveWithOptions(
+				context.Background(),
+				tt.query,
+				"A",
+				nameserver,
+				ClientOptions{ValidateDNSSEC: true, TrustAnchors: tt.anchors},
+			)
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+
+			require.NotNil(t, resolution.DNSSEC)
+			assert.Equal(t, tt.wantStatus, resolution.DNSSEC.Status, resolution.DNSSEC.Reason)
+
+			if tt.wantDenial {
+				require.NotNil(t, resolution.DNSSEC.Denial)
+				assert.True(t, resolution.DNSSEC.Denial.Covered)
+				assert.Equal(t, DenialNXDomain, resolution.DNSSEC.Denial.Denial)
+			}
+		})
+	}
+
+	t.Run("authenticated keys are cached by the client", func(t *testing.T) {
+		t.Parallel()
+
+		var queries atomic.Int32
+		handler := testDNSSECHandler(t, responses)
+		countingNameserver := startTestNameserver(t, func(w dns.ResponseWriter, r *dns.Msg) {
+			queries.Add(1)
+			handler(w, r)
+		})
+
+		client := NewDNSClient()
+		options := ClientOptions{ValidateDNSSEC: true, TrustAnchors: anchors}
+
+		// The first resolution queries the DNSKEY records of both zones, and the DS
+		// records of the signed zone, while the next ones only query their answer.
+		for i, want := range []int32{4, 5, 6} {
+			resolution, err := client.ResolveWithOptions(context.Background(), "a.signed.test", "A", countingNameserver, options)
+			require.NoError(t, err)
+			require.NotNil(t, resolution.DNSSEC)
+			assert.Equal(t, DNSSECSecure, resolution.DNSSEC.Status, resolution.DNSSEC.Reason)
+			assert.Equal(t, want, queries.Load(), i)
+		}
+
+		// Resolutions over another transport don't reuse the keys fetched over UDP.
+		options.Transport = TransportTCP
+		resolution, err := client.ResolveWithOptions(context.Background(), "a.signed.test", "A", countingNameserver, options)
+		require.NoError(t, err)
+		assert.Equal(t, DNSSECSecure, resolution.DNSSEC.Status, resolution.DNSSEC.Reason)
+		assert.Equal(t, int32(10), queries.Load())
+	})
+
+	t.Run("unsupported answers still report their validation", func(t *testing.T) {
+		t.Parallel()
+
+		nameserver := startTestNameserver(t, func(w dns.ResponseWriter, r *dns.Msg) {
+			response := new(dns.Msg)
+			response.SetReply(r)
+			response.Answer = []dns.RR{mustNewRR(t, r.Question[0].Name+" 60 IN TXT unsupported")}
+			assert.NoError(t, w.WriteMsg(response))
+		})
+
+		options := ClientOptions{ValidateDNSSEC: true, ResponseValidation: ResponseValidationLenient}
+		resolution, err := NewDNSClient().ResolveWithOptions(context.Background(), testDomain, "A", nameserver, options)
+		require.ErrorIs(t, err, ErrUnsupportedRecordType)
+
+		assert.True(t, resolution.Validated)
+		assert.NotNil(t, resolution.DNSSEC)
+		assert.Empty(t, resolution.IPs)
+	})
+
+	t.Run("invalid trust anchors are rejected", func(t *testing.T) {
+		t.Parallel()
+
+		err := ClientOptions{TrustAnchors: []string{"test. IN A 127.0.0.1"}}.Validate()
+		assert.Error(t, err)
+	})
+}
+
+// testDNSSECResponse holds the sections of a response served by testDNSSECHandler.
+type testDNSSECResponse struct {
+	rcode  int
+	answer []dns.RR
+	ns     []dns.RR
+}
+
+// testDNSSECHandler returns a handler serving the responses keyed by question name and
+// type, such as "k6.test. A". Other queries are answered with a REFUSED response.
+func testDNSSECHandler(t *testing.T, responses map[string]testDNSSECResponse) dns.HandlerFunc {
+	t.Helper()
+
+	return func(w dns.ResponseWriter, r *dns.Msg) {
+		question := r.Question[0]
+
+		message := new(dns.Msg)
+		message.SetReply(r)
+
+		response, ok := responses[strings.ToLower(question.Name)+" "+dns.TypeToString[question.Qtype]]
+		if !ok {
+			message.Rcode = dns.RcodeRefused
+		}
+
+		message.Rcode = max(message.Rcode, response.rcode)
+		message.Answer = response.answer
+		message.Ns = response.ns
+
+		assert.NoError(t, w.WriteMsg(message))
+	}
+}
+
+// expandTestWildcard returns the signed RRset owned by a wildcard, expanded into name
+// as a nameserver answering a query for name does.
+func expandTestWildcard(rrset []dns.RR, name string) []dns.RR {
+	for _, rr := range rrset {
+		rr.Header().Name = name
+	}
+
+	return rrset
+}
+
+// testDNSSECZone holds the keys of a signed test zone.
+type testDNSSECZone struct {
+	name           string
+	ksk, zsk       *dns.DNSKEY
+	kskKey, zskKey crypto.Signer
+}
+
+// newTestDNSSECZone generates the key signing and zone signing keys of a test zone.
+func newTestDNSSECZone(t *testing.T, name string) *testDNSSECZone {
+	t.Helper()
+
+	generate := func(flags uint16) (*dns.DNSKEY, crypto.Signer) {
+		key := &dns.DNSKEY{
+			Hdr:       dns.RR_Header{Name: name, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+			Flags:     flags,
+			Protocol:  3,
+			Algorithm: dns.ECDSAP256SHA256,
+		}
+
+		private, err := key.Generate(256)
+		require.NoError(t, err)
+
+		return key, private.(crypto.Signer) //nolint:forcetypeassert
+	}
+
+	zone := &testDNSSECZone{name: name}
+	zone.ksk, zone.kskKey = generate(dns.ZONE | dns.SEP)
+	zone.zsk, zone.zskKey = generate(dns.ZONE)
+
+	return zone
+}
+
+// ds returns the DS record of the zone's key signing key.
+func (z *testDNSSECZone) ds() *dns.DS {
+	return z.ksk.ToDS(dns.SHA256)
+}
+
+// keySet returns the zone's DNSKEY RRset, signed by its key signing key.
+func (z *testDNSSECZone) keySet(t *testing.T) []dns.RR {
+	t.Helper()
+
+	rrset := []dns.RR{z.ksk, z.zsk}
+	sig := z.newSignature(t, dns.TypeDNSKEY, z.ksk, time.Now().Add(-time.Hour), time.Now().Add(24*time.Hour))
+	require.NoError(t, sig.Sign(z.kskKey, rrset))
+
+	return append(rrset, sig)
+}
+
+// sign returns the RRset, followed by its signature by the zone's zone signing key.
+func (z *testDNSSECZone) sign(t *testing.T, rrset ...dns.RR) []dns.RR {
+	t.Helper()
+
+	return z.signWithValidity(t, time.Now().Add(-time.Hour), time.Now().Add(24*time.Hour), rrset...)
+}
+
+// signWithValidity signs the RRset like sign does, using the provided validity period.
+func (z *testDNSSECZone) signWithValidity(t *testing.T, inception, expiration time.Time, rrset ...dns.RR) []dns.RR {
+	t.Helper()
+
+	sig := z.newSignature(t, rrset[0].Header().Rrtype, z.zsk, inception, expiration)
+	require.NoError(t, sig.Sign(z.zskKey, rrset))
+
+	return append(rrset, sig)
+}
+
+// newSignature returns an unsigned RRSIG record covering the type, made with the key.
+func (z *testDNSSECZone) newSignature(
+	t *testing.T,
+	covered uint16,
+	key *dns.DNSKEY,
+	inception, expiration time.Time,
+) *dns.RRSIG {
+	t.Helper()
+
+	return &dns.RRSIG{
+		Hdr:         dns.RR_Header{Ttl: 3600},
+		TypeCovered: covered,
+		Algorithm:   key.Algorithm,
+		OrigTtl:     3600,
+		Inception:   uint32(inception.Unix()),  //nolint:gosec
+		Expiration:  uint32(expiration.Unix()), //nolint:gosec
+		KeyTag:      key.KeyTag(),
+		SignerName:  z.name,
+	}
+}
@@ -0,0 +1,184 @@
+package dns
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// dnstapContentType holds the Frame Streams content type of dnstap payloads.
+const dnstapContentType = "protobuf:dnstap.Dnstap"
+
+// Field numbers and enum values of the [dnstap schema] the recorded exchanges are
+// encoded with.
+//
+// [dnstap schema]: https://github.com/dnstap/dnstap.pb/blob/master/dnstap.proto
+const (
+	dnstapFieldIdentity = 1
+	dnstapFieldVersion  = 2
+	dnstapFieldMessage  = 14
+	dnstapFieldType     = 15
+	dnstapTypeMessage   = 1
+
+	dnstapMessageFieldType             = 1
+	dnstapMessageFieldSocketFamily     = 2
+	dnstapMessageFieldSocketProtocol   = 3
+	dnstapMessageFieldQueryAddress     = 4
+	dnstapMessageFieldResponseAddress  = 5
+	dnstapMessageFieldQueryPort        = 6
+	dnstapMessageFieldResponsePort     = 7
+	dnstapMessageFieldQueryTimeSec     = 8
+	dnstapMessageFieldQueryTimeNsec    = 9
+	dnstapMessageFieldQueryMessage     = 10
+	dnstapMessageFieldResponseTimeSec  = 12
+	dnstapMessageFieldResponseTimeNsec = 13
+	dnstapMessageFieldResponseMessage  = 14
+
+	dnstapMessageToolQuery    = 11
+	dnstapMessageToolResponse = 12
+	dnstapFamilyINET          = 1
+	dnstapFamilyINET6         = 2
+	dnstapProtocolUDP         = 1
+	dnstapProtocolTCP         = 2
+	dnstapProtocolDOT         = 3
+)
+
+// Control frame types and fields of the [Frame Streams protocol] dnstap payloads are
+// sent over.
+//
+// [Frame Streams protocol]: https://github.com/farsightsec/fstrm/blob/master/fstrm/control.h
+const (
+	fstrmControlAccept    = 0x01
+	fstrmControlStart     = 0x02
+	fstrmControlStop      = 0x03
+	fstrmControlReady     = 0x04
+	fstrmControlFinish    = 0x05
+	fstrmFieldContentType = 0x01
+	maxFstrmControlLen    = 512
+)
+
+// dnstapIdentity and dnstapVersion identify the recorder of dnstap messages.
+const (
+	dnstapIdentity = "k6"
+	dnstapVersion  = "xk6-dns"
+)
+
+// encodeDnstap encodes the wire message of the exchange, its query as a dnstap
+// TOOL_QUERY message, or one of its responses as a TOOL_RESPONSE message.
+func encodeDnstap(exchange recordedExchange, wire []byte, response bool) []byte {
+	var message []byte
+
+	messageType := uint64(dnstapMessageToolQuery)
+	if response {
+		messageType = dnstapMessageToolResponse
+	}
+
+	message = protowire.AppendTag(message, dnstapMessageFieldType, protowire.VarintType)
+	message = protowire.AppendVarint(message, messageType)
+
+	family := uint64(dnstapFamilyINET6)
+	if exchange.client.Addr().Is4() {
+		family = dnstapFamilyINET
+	}
+
+	message = protowire.AppendTag(message, dnstapMessageFieldSocketFamily, protowire.VarintType)
+	message = protowire.AppendVarint(message, family)
+
+	protocol := uint64(dnstapProtocolUDP)
+	switch exchange.transport {
+	case TransportTCP:
+		protocol = dnstapProtocolTCP
+	case TransportTLS:
+		protocol = dnstapProtocolDOT
+	}
+
+	message = protowire.AppendTag(message, dnstapMessageFieldSocketProtocol, protowire.VarintType)
+	message = protowire.AppendVarint(message, protocol)
+
+	message = protowire.AppendTag(message, dnstapMessageFieldQueryAddress, protowire.BytesType)
+	message = protowire.AppendBytes(message, exchange.client.Addr().AsSlice())
+	message = protowire.AppendTag(message, dnstapMessageFieldResponseAddress, protowire.BytesType)
+	message = protowire.AppendBytes(message, exchange.server.Addr().AsSlice())
+	message = protowire.AppendTag(message, dnstapMessageFieldQueryPort, protowire.VarintType)
+	message = protowire.AppendVarint(message, uint64(exchange.client.Port()))
+	message = protowire.AppendTag(message, dnstapMessageFieldResponsePort, protowire.VarintType)
+	message = protowire.AppendVarint(message, uint64(exchange.server.Port()))
+
+	// Responses hold the time of their query too, for their round trip time to be
+	// computed.
+	message = protowire.AppendTag(message, dnstapMessageFieldQueryTimeSec, protowire.VarintType)
+	message = protowire.AppendVarint(message, uint64(exchange.queryTime.Unix())) //nolint:gosec // after the epoch
+	message = protowire.AppendTag(message, dnstapMessageFieldQueryTimeNsec, protowire.Fixed32Type)
+	message = protowire.AppendFixed32(message, uint32(exchange.queryTime.Nanosecond())) //nolint:gosec // below a second
+
+	if response {
+		message = protowire.AppendTag(message, dnstapMessageFieldResponseTimeSec, protowire.VarintType)
+		message = protowire.AppendVarint(message, uint64(exchange.responseTime.Unix())) //nolint:gosec // after the epoch
+		message = protowire.AppendTag(message, dnstapMessageFieldResponseTimeNsec, protowire.Fixed32Type)
+		message = protowire.AppendFixed32(message, uint32(exchange.responseTime.Nanosecond())) //nolint:gosec // below a second
+		message = protowire.AppendTag(message, dnstapMessageFieldResponseMessage, protowire.BytesType)
+		message = protowire.AppendBytes(message, wire)
+	} else {
+		message = protowire.AppendTag(message, dnstapMessageFieldQueryMessage, protowire.BytesType)
+		message = protowire.AppendBytes(message, wire)
+	}
+
+	var dnstap []byte
+	dnstap = protowire.AppendTag(dnstap, dnstapFieldIdentity, protowire.BytesType)
+	dnstap = protowire.AppendString(dnstap, dnstapIdentity)
+	dnstap = protowire.AppendTag(dnstap, dnstapFieldVersion, protowire.BytesType)
+	dnstap = protowire.AppendString(dnstap, dnstapVersion)
+	dnstap = protowire.AppendTag(dnstap, dnstapFieldMessage, protowire.BytesType)
+	dnstap = protowire.AppendBytes(dnstap, message)
+	dnstap = protowire.AppendTag(dnstap, dnstapFieldType, protowire.VarintType)
+	dnstap = protowire.AppendVarint(dnstap, dnstapTypeMessage)
+
+	return dnstap
+}
+
+// fstrmDataFrame returns a Frame Streams data frame holding the payload.
+func fstrmDataFrame(payload []byte) []byte {
+	frame := binary.BigEndian.AppendUint32(nil, uint32(len(payload))) //nolint:gosec // bounded by the message size
+
+	return append(frame, payload...)
+}
+
+// fstrmControlFrame returns a Frame Streams control frame of the type, holding the
+// dnstap content type for the frames that carry one.
+func fstrmControlFrame(controlType uint32) []byte {
+	control := binary.BigEndian.AppendUint32(nil, controlType)
+	if controlType == fstrmControlReady || controlType == fstrmControlAccept || controlType == fstrmControlStart {
+		control = binary.BigEndian.AppendUint32(control, fstrmFieldContentType)
+		control = binary.BigEndian.AppendUint32(control, uint32(len(dnstapContentType)))
+		control = append(control, dnstapContentType...)
+	}
+
+	// Control frames are escaped by a zero length, followed by their own length.
+	frame := binary.BigEndian.AppendUint32(nil, 0)
+	frame = binary.BigEndian.AppendUint32(frame, uint32(len(control))) //nolint:gosec // bounded by the content type
+
+	return append(frame, control...)
+}
+
+// readFstrmControlFrame reads a Frame Streams control frame, and returns its type.
+func readFstrmControlFrame(r io.Reader) (uint32, error) {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, fmt.Errorf("reading the frame streams control frame failed: %w", err)
+	}
+
+	length := binary.BigEndian.Uint32(header[4:])
+	if binary.BigEndian.Uint32(header) != 0 || length < 4 || length > maxFstrmControlLen {
+		return 0, errors.New("invalid frame streams control frame")
+	}
+
+	control := make([]byte, length)
+	if _, err := io.ReadFull(r, control); err != nil {
+		return 0, fmt.Errorf("reading the frame streams control frame failed: %w", err)
+	}
+
+	return binary.BigEndian.Uint32(control), nil
+}
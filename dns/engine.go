@@ -0,0 +1,255 @@
+package dns
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// ErrNoFreeQueryID is an error that is returned when the query engine can't find a query ID
+// that is not already in flight to a nameserver.
+var ErrNoFreeQueryID = errors.New("no free query ID")
+
+// ErrQueryTimeout is an error that is returned when the query engine doesn't receive the
+// response to a query in time.
+var ErrQueryTimeout = errors.New("query timed out")
+
+// maxQueryIDAttempts is the number of random query IDs the engine tries before
+// giving up on finding one that is not already in flight.
+const maxQueryIDAttempts = 8
+
+// dnsHeaderLen is the length in bytes of a DNS message header.
+const dnsHeaderLen = 12
+
+// queryEngine sends UDP queries to any nameserver over a couple of sockets shared by
+// all its users, and demultiplexes the responses by source address and query ID.
+//
+// As opposed to the Client, it is designed for throughput rather than for inspecting
+// responses: the engine assigns query IDs itself, to guarantee their uniqueness, reuses
+// its messages and buffers, and only decodes the header of the responses.
+type queryEngine struct {
+	mu      sync.Mutex
+	sockets map[string]*net.UDPConn
+	pending map[engineKey]*engineQuery
+}
+
+// engineKey identifies a query in flight.
+type engineKey struct {
+	nameserver netip.AddrPort
+	id         uint16
+}
+
+// engineQuery holds the state of a query in flight.
+type engineQuery struct {
+	sentAt time.Time
+	timer  *time.Timer
+	done   func(EngineResult)
+}
+
+// EngineResult holds the outcome of a query sent by the query engine.
+type EngineResult struct {
+	// Rcode holds the response code of the response, if any.
+	Rcode int
+
+	// RTT holds the time elapsed between sending the query and receiving its response.
+	RTT time.Duration
+
+	// Err holds the error that prevented getting a response, if any.
+	Err error
+}
+
+// engineMessages pools the messages used to build queries.
+var engineMessages = sync.Pool{ //nolint:gochecknoglobals
+	New: func() any { return new(dns.Msg) },
+}
+
+// engineBuffers pools the buffers queries are packed into.
+var engineBuffers = sync.Pool{ //nolint:gochecknoglobals
+	New: func() any {
+		buf := make([]byte, dns.MinMsgSize)
+		return &buf
+	},
+}
+
+// newQueryEngine creates a new queryEngine. Its sockets are opened on first use.
+func newQueryEngine() *queryEngine {
+	return &queryEngine{
+		sockets: make(map[string]*net.UDPConn),
+		pending: make(map[engineKey]*engineQuery),
+	}
+}
+
+// send sends a query for the given name and type to the nameserver, without waiting
+// for its response. The done function is called once, from another goroutine, with
+// the query's outcome when its response is received, or when it times out.
+func (e *queryEngine) send(
+	name string,
+	qtype uint16,
+	nameserver Nameserver,
+	timeout time.Duration,
+	done func(EngineResult),
+) error {
+	addr, ok := netip.AddrFromSlice(nameserver.IP)
+	if !ok {
+		return fmt.Errorf("invalid nameserver IP address: %s", nameserver.IP)
+	}
+	addr = addr.Unmap()
+
+	socket, err := e.socket(addr)
+	if err != nil {
+		return err
+	}
+
+	query := &engineQuery{done: done}
+
+	e.mu.Lock()
+	key := engineKey{nameserver: netip.AddrPortFrom(addr, nameserver.Port)}
+	found := false
+	for i := 0; i < maxQueryIDAttempts; i++ {
+		key.id = uint16(rand.Uint32()) //nolint:gosec // truncating the random value is intended
+		if _, inFlight := e.pending[key]; !inFlight {
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		e.mu.Unlock()
+		return fmt.Errorf("%w to nameserver %s", ErrNoFreeQueryID, nameserver.Addr())
+	}
+
+	e.pending[key] = query
+	e.mu.Unlock()
+
+	message := engineMessages.Get().(*dns.Msg) //nolint:forcetypeassert
+	defer engineMessages.Put(message)
+	message.SetQuestion(name, qtype)
+	message.Id = key.id
+
+	buf := engineBuffers.Get().(*[]byte) //nolint:forcetypeassert
+	defer engineBuffers.Put(buf)
+
+	packed, err := message.PackBuffer(*buf)
+	if err != nil {
+		e.complete(key, EngineResult{Err: fmt.Errorf("packing query failed: %w", err)})
+		return nil
+	}
+	*buf = packed[:cap(packed)]
+
+	// The timer is armed before sending the query, and while holding the lock,
+	// so that it is set when the response gets processed.
+	e.mu.Lock()
+	query.sentAt = time.Now()
+	query.timer = time.AfterFunc(timeout, func() {
+		e.complete(key, EngineResult{Err: fmt.Errorf("%w after %s", ErrQueryTimeout, timeout)})
+	})
+	e.mu.Unlock()
+
+	if _, err := socket.WriteToUDPAddrPort(packed, key.nameserver); err != nil {
+		e.complete(key, EngineResult{Err: fmt.Errorf("sending query failed: %w", err)})
+	}
+
+	return nil
+}
+
+// socket returns the engine's socket for the IP family of addr, opening
+// it if necessary.
+func (e *queryEngine) socket(addr netip.Addr) (*net.UDPConn, error) {
+	network := "udp6"
+	if addr.Is4() {
+		network = "udp4"
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if socket, ok := e.sockets[network]; ok {
+		return socket, nil
+	}
+
+	socket, err := net.ListenUDP(network, nil)
+	if err != nil {
+		return nil, fmt.Errorf("opening query engine %s socket failed: %w", network, err)
+	}
+
+	e.sockets[network] = socket
+	go e.readLoop(socket)
+
+	return socket, nil
+}
+
+// readLoop reads responses from the socket until it is closed, and completes
+// the queries they answer.
+func (e *queryEngine) readLoop(socket *net.UDPConn) {
+	buf := make([]byte, dns.MaxMsgSize)
+
+	for {
+		n, from, err := socket.ReadFromUDPAddrPort(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+
+		// Other read errors, as well as messages that are too short to hold
+		// a header, don't prevent further responses from being read.
+		if err != nil || n < dnsHeaderLen {
+			continue
+		}
+
+		key := engineKey{
+			nameserver: netip.AddrPortFrom(from.Addr().Unmap(), from.Port()),
+			id:         binary.BigEndian.Uint16(buf[0:2]),
+		}
+
+		flags := binary.BigEndian.Uint16(buf[2:4])
+		if flags&(1<<15) == 0 {
+			// Not a response, thus not something we're waiting for.
+			continue
+		}
+
+		e.complete(key, EngineResult{Rcode: int(flags & 0xF)})
+	}
+}
+
+// complete removes the query identified by key from the queries in flight, and
+// reports its result. Completing a query that is no longer in flight, such as a late
+// response to a query which timed out, or a response from an unexpected source, is a no-op.
+func (e *queryEngine) complete(key engineKey, result EngineResult) {
+	e.mu.Lock()
+	query, ok := e.pending[key]
+	if ok {
+		delete(e.pending, key)
+		if query.timer != nil {
+			query.timer.Stop()
+		}
+	}
+	e.mu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	if !query.sentAt.IsZero() {
+		result.RTT = time.Since(query.sentAt)
+	}
+
+	query.done(result)
+}
+
+// close closes the engine's sockets. Queries in flight time out. The engine remains
+// usable, and reopens its sockets as needed.
+func (e *queryEngine) close() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for network, socket := range e.sockets {
+		_ = socket.Close()
+		delete(e.sockets, network)
+	}
+}
@@ -0,0 +1,73 @@
+package dns
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryEngine_send(t *testing.T) {
+	t.Parallel()
+
+	t.Run("responses are demultiplexed to the queries they answer", func(t *testing.T) {
+		t.Parallel()
+
+		answering := startTestNameserver(t, writeTestAnswerHandler(t))
+		failing := startTestNameserver(t, func(w dns.ResponseWriter, r *dns.Msg) {
+			response := new(dns.Msg)
+			response.SetRcode(r, dns.RcodeNameError)
+			assert.NoError(t, w.WriteMsg(response))
+		})
+
+		engine := newQueryEngine()
+		t.Cleanup(engine.close)
+
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		gotRcodes := make(map[int]int)
+		for i := 0; i < 100; i++ {
+			nameserver := answering
+			if i%2 == 1 {
+				nameserver = failing
+			}
+
+			wg.Add(1)
+			err := engine.send("k6.test.", dns.TypeA, nameserver, time.Second, func(result EngineResult) {
+				defer wg.Done()
+
+				assert.NoError(t, result.Err)
+
+				mu.Lock()
+				gotRcodes[result.Rcode]++
+				mu.Unlock()
+			})
+			require.NoError(t, err)
+		}
+		wg.Wait()
+
+		assert.Equal(t, map[int]int{dns.RcodeSuccess: 50, dns.RcodeNameError: 50}, gotRcodes)
+	})
+
+	t.Run("queries without response time out", func(t *testing.T) {
+		t.Parallel()
+
+		nameserver := startTestNameserver(t, func(dns.ResponseWriter, *dns.Msg) {})
+
+		engine := newQueryEngine()
+		t.Cleanup(engine.close)
+
+		results := make(chan EngineResult, 1)
+		err := engine.send("k6.test.", dns.TypeA, nameserver, 50*time.Millisecond, func(result EngineResult) {
+			results <- result
+		})
+		require.NoError(t, err)
+
+		result := <-results
+		assert.ErrorIs(t, result.Err, ErrQueryTimeout)
+		assert.GreaterOrEqual(t, result.RTT, 50*time.Millisecond)
+	})
+}
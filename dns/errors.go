@@ -6,6 +6,11 @@ import "errors"
 // the module.
 var ErrUnsupportedRecordType = errors.New("unsupported record type")
 
+// ErrResponseMismatch is an error that is returned when a nameserver's response does
+// not match the query it answers, such as when its ID, or the case of its question name
+// when using 0x20 case randomization, differs from the query's.
+var ErrResponseMismatch = errors.New("response mismatch")
+
 // Error represents a DNS error.
 type Error struct {
 	// Name holds the descriptive name of the error.
@@ -35,8 +40,26 @@ func newDNSError(rcode int, message string) *Error {
 	}
 }
 
-// Error returns the error message.
+// newSignatureError creates a new DNSError from the error code of a failed TSIG or
+// SIG(0) verification, and a message.
+func newSignatureError(code uint16, message string) *Error {
+	signatureErr := newDNSError(int(code), message)
+
+	// BADSIG shares its code with BADVERS, which is only ever reported in OPT records.
+	if signatureErr.Kind == BadSig {
+		signatureErr.Name = "BadSig"
+	}
+
+	return signatureErr
+}
+
+// Error returns the error message, prefixed with the error's name, or with its kind
+// if it has none.
 func (e *Error) Error() string {
+	if e.Name != "" {
+		return e.Name + ": " + e.Message
+	}
+
 	return e.Kind.String() + ": " + e.Message
 }
 
@@ -161,3 +184,12 @@ const (
 	// [RFC7873]: https://www.iana.org/go/rfc7873
 	BadCookie errorKind = 23
 )
+
+// Error kinds that are not based on DNS Response Codes. Their values are chosen
+// outside the 12 bits range of extended DNS Response Codes to avoid any overlap.
+const (
+	// MalformedResponse is a DNS error kind that represents a response failing to
+	// validate against the query it answers, such as a response without its QR bit
+	// set, or holding a question that differs from the query's.
+	MalformedResponse errorKind = 4096
+)
@@ -9,11 +9,13 @@ import (
 const (
 	_errorKindName_0 = "FormatErrorServerFailureNonExistingDomainNotImplementedRefusedYXDomainYXRrsetNXRrsetNotAuthNotZone"
 	_errorKindName_1 = "BadVersBadKeyBadTimeBadModeBadNameBadAlgBadTruncBadCookie"
+	_errorKindName_2 = "MalformedResponse"
 )
 
 var (
 	_errorKindIndex_0 = [...]uint8{0, 11, 24, 41, 55, 62, 70, 77, 84, 91, 98}
 	_errorKindIndex_1 = [...]uint8{0, 7, 13, 20, 27, 34, 40, 48, 57}
+	_errorKindIndex_2 = [...]uint8{0, 17}
 )
 
 func (i errorKind) String() string {
@@ -24,12 +26,14 @@ func (i errorKind) String() string {
 	case 16 <= i && i <= 23:
 		i -= 16
 		return _errorKindName_1[_errorKindIndex_1[i]:_errorKindIndex_1[i+1]]
+	case i == 4096:
+		return _errorKindName_2
 	default:
 		return fmt.Sprintf("errorKind(%d)", i)
 	}
 }
 
-var _errorKindValues = []errorKind{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 16, 17, 18, 19, 20, 21, 22, 23}
+var _errorKindValues = []errorKind{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 16, 17, 18, 19, 20, 21, 22, 23, 4096}
 
 var _errorKindNameToValueMap = map[string]errorKind{
 	_errorKindName_0[0:11]:  1,
@@ -50,6 +54,7 @@ var _errorKindNameToValueMap = map[string]errorKind{
 	_errorKindName_1[34:40]: 21,
 	_errorKindName_1[40:48]: 22,
 	_errorKindName_1[48:57]: 23,
+	_errorKindName_2[0:17]:  4096,
 }
 
 // errorKindString retrieves an enum value from the enum constants string name.
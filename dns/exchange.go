@@ -0,0 +1,228 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/grafana/sobek"
+	"go.k6.io/k6/js/common"
+	"go.k6.io/k6/lib/types"
+	"go.k6.io/k6/metrics"
+)
+
+// exchangeResult is the JS representation of an ExchangeSummary.
+type exchangeResult struct {
+	Bytes    sobek.ArrayBuffer `js:"bytes"`
+	Message  *Message          `js:"message"`
+	Duration float64           `js:"duration"`
+}
+
+// Exchange sends the DNS message, provided in wire format as an ArrayBuffer, to the
+// nameserver as is, and waits for its response.
+//
+// It returns a promise resolving to the response as received, as an ArrayBuffer, along
+// with its parsed message, or null if it can't be parsed, and the milliseconds the
+// exchange took.
+func (mi *ModuleInstance) Exchange(message, nameserverAddr, options sobek.Value) *sobek.Promise {
+	rt := mi.vu.Runtime()
+
+	// The response's ArrayBuffer can only be created on the event loop, thus the
+	// promise is resolved from an event loop callback rather than using promises.New.
+	promise, resolve, reject := rt.NewPromise()
+
+	if mi.vu.State() == nil {
+		_ = reject(errors.New("exchange can not be used in the init context"))
+		return promise
+	}
+
+	packed, err := exportBytes(message)
+	if err != nil {
+		_ = reject(fmt.Errorf("message must be an ArrayBuffer; got %v instead", message))
+		return promise
+	}
+
+	var nameserverAddrStr string
+	if common.IsNullish(nameserverAddr) || rt.ExportTo(nameserverAddr, &nameserverAddrStr) != nil {
+		_ = reject(fmt.Errorf("nameserver must be a string; got %v instead", nameserverAddr))
+		return promise
+	}
+
+	nameserver, err := parseNameserverAddr(nameserverAddrStr)
+	if err != nil {
+		_ = reject(fmt.Errorf("parsing nameserver address failed: %w", err))
+		return promise
+	}
+
+	exchangeOptions, err := parseExchangeOptions(rt, options)
+	if err != nil {
+		_ = reject(err)
+		return promise
+	}
+
+	callback := mi.vu.RegisterCallback()
+
+	go func() {
+		summary, exchangeErr := mi.dnsClient.Exchange(mi.vu.Context(), packed, nameserver, exchangeOptions)
+
+		// Recording failures don't fail the exchange
+		mi.logRecordingFailure(summary.RecordingErr)
+
+		mi.emitExchangeMetrics(mi.vu.Context(), nameserver, exchangeOptions.Transport, summary, exchangeErr)
+
+		callback(func() error {
+			if exchangeErr != nil {
+				return reject(exchangeErr)
+			}
+
+			result := exchangeResult{
+				Bytes:    rt.NewArrayBuffer(summary.Response),
+				Duration: durationMillis(summary.Duration),
+			}
+
+			if response, err := UnpackMessage(summary.Response); err == nil {
+				result.Message = &response
+			}
+
+			return resolve(result)
+		})
+	}()
+
+	return promise
+}
+
+// Pack returns the DNS message, provided as an object, in wire format, as an ArrayBuffer.
+func (mi *ModuleInstance) Pack(message sobek.Value) (sobek.ArrayBuffer, error) {
+	if common.IsNullish(message) {
+		return sobek.ArrayBuffer{}, errors.New("message argument must be provided")
+	}
+
+	var msg Message
+	if err := mi.vu.Runtime().ExportTo(message, &msg); err != nil {
+		return sobek.ArrayBuffer{}, fmt.Errorf("message must be an object; got %v instead", message)
+	}
+
+	packed, err := msg.Pack()
+	if err != nil {
+		return sobek.ArrayBuffer{}, err
+	}
+
+	return mi.vu.Runtime().NewArrayBuffer(packed), nil
+}
+
+// Unpack parses the DNS message, provided in wire format as an ArrayBuffer, and
+// returns it as an object.
+func (mi *ModuleInstance) Unpack(message sobek.Value) (Message, error) {
+	packed, err := exportBytes(message)
+	if err != nil {
+		return Message{}, fmt.Errorf("message must be an ArrayBuffer; got %v instead", message)
+	}
+
+	return UnpackMessage(packed)
+}
+
+// exportBytes returns a copy of the bytes of an ArrayBuffer, or of a typed array's view
+// of one. The bytes are copied, as they are used by goroutines while scripts can still
+// modify the buffer.
+func exportBytes(value sobek.Value) ([]byte, error) {
+	if common.IsNullish(value) {
+		return nil, errors.New("no value provided")
+	}
+
+	switch exported := value.Export().(type) {
+	case sobek.ArrayBuffer:
+		return bytes.Clone(exported.Bytes()), nil
+	case []byte:
+		return bytes.Clone(exported), nil
+	default:
+		return nil, fmt.Errorf("unsupported type %T", exported)
+	}
+}
+
+// parseExchangeOptions parses the options of a dns.exchange call.
+func parseExchangeOptions(rt *sobek.Runtime, options sobek.Value) (ExchangeOptions, error) {
+	var exchangeOptions ExchangeOptions
+	if common.IsNullish(options) {
+		return exchangeOptions, nil
+	}
+
+	if err := rt.ExportTo(options, &exchangeOptions); err != nil {
+		return ExchangeOptions{}, fmt.Errorf("options must be an object; got %v instead", options)
+	}
+
+	if value := options.ToObject(rt).Get("timeout"); !common.IsNullish(value) {
+		timeout, err := types.GetDurationValue(value.Export())
+		if err != nil {
+			return ExchangeOptions{}, fmt.Errorf("invalid timeout option: %w", err)
+		}
+
+		exchangeOptions.Timeout = timeout
+	}
+
+	if err := exchangeOptions.Validate(); err != nil {
+		return ExchangeOptions{}, fmt.Errorf("invalid options: %w", err)
+	}
+
+	return exchangeOptions, nil
+}
+
+// emitExchangeMetrics emits the metrics specific to dns.exchange operations.
+func (mi *ModuleInstance) emitExchangeMetrics(
+	ctx context.Context,
+	nameserver Nameserver,
+	transport Transport,
+	summary ExchangeSummary,
+	exchangeErr error,
+) {
+	state := mi.vu.State()
+
+	if transport == "" {
+		transport = TransportUDP
+	}
+
+	tags := state.Tags.GetCurrentValues().Tags
+	tags = tags.With("nameserver", nameserver.Addr())
+	tags = tags.With("transport", string(transport))
+
+	now := time.Now()
+
+	// Increment the exchanges counter
+	metrics.PushIfNotDone(ctx, state.Samples, metrics.Sample{
+		TimeSeries: metrics.TimeSeries{
+			Metric: mi.metrics.DNSExchanges,
+			Tags:   tags,
+		},
+		Time:     now,
+		Value:    float64(1),
+		Metadata: nil,
+	})
+
+	// Emit the exchange duration
+	metrics.PushIfNotDone(ctx, state.Samples, metrics.Sample{
+		TimeSeries: metrics.TimeSeries{
+			Metric: mi.metrics.DNSExchangeDuration,
+			Tags:   tags,
+		},
+		Time:     now,
+		Value:    durationMillis(summary.Duration),
+		Metadata: nil,
+	})
+
+	var failed float64
+	if exchangeErr != nil {
+		failed = 1
+	}
+
+	// Emit the exchange failed rate
+	metrics.PushIfNotDone(ctx, state.Samples, metrics.Sample{
+		TimeSeries: metrics.TimeSeries{
+			Metric: mi.metrics.DNSExchangeFailed,
+			Tags:   tags,
+		},
+		Time:     now,
+		Value:    failed,
+		Metadata: nil,
+	})
+}
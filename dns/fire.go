@@ -0,0 +1,322 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/grafana/sobek"
+	"go.k6.io/k6/js/common"
+	"go.k6.io/k6/js/promises"
+	"go.k6.io/k6/lib/types"
+
+	"github.com/miekg/dns"
+)
+
+// FireOptions holds the options of a dns.fire call.
+type FireOptions struct {
+	// Rate holds the number of queries to send per second.
+	Rate float64 `js:"rate"`
+
+	// Duration holds for how long queries are sent. Either Duration, Count, or both, must be set.
+	Duration time.Duration `js:"-"`
+
+	// Count holds the number of queries to send. Either Duration, Count, or both, must be set.
+	Count int64 `js:"count"`
+
+	// Timeout holds how long to wait for each query's response before considering
+	// it failed. It defaults to 2 seconds.
+	Timeout time.Duration `js:"-"`
+
+	// MaxInFlight bounds the number of queries waiting for a response. Once reached,
+	// sending is paused until responses are received, or queries time out. It defaults
+	// to 10000.
+	MaxInFlight int `js:"maxInFlight"`
+}
+
+// FireSummary holds the outcome of a dns.fire call.
+type FireSummary struct {
+	// Sent holds the number of queries sent.
+	Sent int64 `js:"sent"`
+
+	// Succeeded holds the number of queries answered with a NOERROR response.
+	Succeeded int64 `js:"succeeded"`
+
+	// Failed holds the number of queries answered with an error response, or which
+	// did not get a response at all.
+	Failed int64 `js:"failed"`
+
+	// TimedOut holds the number of failed queries which did not get a response in time.
+	TimedOut int64 `js:"timedOut"`
+
+	// Duration holds the time elapsed sending the queries and waiting for their
+	// responses, in milliseconds.
+	Duration int64 `js:"duration"`
+}
+
+// firedQuery holds the outcome of a query sent by dns.fire, or dns.replay.
+type firedQuery struct {
+	question Question
+	result   EngineResult
+}
+
+const (
+	// defaultFireMaxInFlight is the default bound of queries in flight of a dns.fire call.
+	defaultFireMaxInFlight = 10000
+
+	// fireTick is the interval at which dns.fire sends the queries due since the last tick.
+	fireTick = time.Millisecond
+)
+
+// Fire sends queries for the given name and record type to the nameserver at a fixed
+// rate, using the query engine shared by all VUs, without waiting for each query's
+// response before sending the next one.
+//
+// It returns a promise resolving to a summary of the queries sent, once they have all
+// been answered or have timed out.
+func (mi *ModuleInstance) Fire(query, recordType, nameserverAddr, options sobek.Value) *sobek.Promise {
+	promise, resolve, reject := promises.New(mi.vu)
+
+	if mi.vu.State() == nil {
+		reject(errors.New("fire can not be used in the init context"))
+		return promise
+	}
+
+	var queryStr string
+	if err := mi.vu.Runtime().ExportTo(query, &queryStr); err != nil {
+		reject(fmt.Errorf("query must be a string; got %v instead", query))
+		return promise
+	}
+
+	var recordTypeStr string
+	if err := mi.vu.Runtime().ExportTo(recordType, &recordTypeStr); err != nil {
+		reject(fmt.Errorf("recordType must be a string; got %v instead", recordType))
+		return promise
+	}
+
+	concreteType, err := RecordTypeString(recordTypeStr)
+	if err != nil {
+		reject(fmt.Errorf("fire operation failed with %w, %s is an invalid DNS record type",
+			ErrUnsupportedRecordType, recordTypeStr))
+		return promise
+	}
+
+	var nameserverAddrStr string
+	if err := mi.vu.Runtime().ExportTo(nameserverAddr, &nameserverAddrStr); err != nil {
+		reject(fmt.Errorf("nameserver must be a string; got %v instead", nameserverAddr))
+		return promise
+	}
+
+	nameserver, err := parseNameserverAddr(nameserverAddrStr)
+	if err != nil {
+		reject(fmt.Errorf("parsing nameserver address failed: %w", err))
+		return promise
+	}
+
+	fireOptions, err := parseFireOptions(mi.vu.Runtime(), options, 0)
+	if err != nil {
+		reject(err)
+		return promise
+	}
+
+	engine := mi.root.queryEngine()
+	question := Question{Name: queryStr, Type: concreteType.String()}
+	next := func() (Question, uint16) { return question, uint16(concreteType) }
+
+	go func() {
+		summary, err := mi.fire(mi.vu.Context(), engine, next, nameserver, fireOptions)
+		if err != nil {
+			reject(err)
+			return
+		}
+
+		resolve(summary)
+	}()
+
+	return promise
+}
+
+// parseFireOptions parses the options of a dns.fire, or dns.replay, call. The count
+// defaults to defaultCount, unless a duration is set.
+func parseFireOptions(rt *sobek.Runtime, options sobek.Value, defaultCount int64) (FireOptions, error) {
+	fireOptions := FireOptions{Timeout: defaultExchangeTimeout, MaxInFlight: defaultFireMaxInFlight}
+
+	if common.IsNullish(options) {
+		return FireOptions{}, errors.New("options must be provided, with at least a rate")
+	}
+
+	if err := rt.ExportTo(options, &fireOptions); err != nil {
+		return FireOptions{}, fmt.Errorf("options must be an object; got %v instead", options)
+	}
+
+	optionsObj := options.ToObject(rt)
+	for name, dst := range map[string]*time.Duration{
+		"duration": &fireOptions.Duration,
+		"timeout":  &fireOptions.Timeout,
+	} {
+		value := optionsObj.Get(name)
+		if common.IsNullish(value) {
+			continue
+		}
+
+		duration, err := types.GetDurationValue(value.Export())
+		if err != nil {
+			return FireOptions{}, fmt.Errorf("invalid %s option: %w", name, err)
+		}
+
+		*dst = duration
+	}
+
+	if fireOptions.Rate <= 0 {
+		return FireOptions{}, fmt.Errorf("rate option must be greater than 0; got %v", fireOptions.Rate)
+	}
+
+	if fireOptions.Duration <= 0 && fireOptions.Count <= 0 {
+		fireOptions.Count = defaultCount
+	}
+
+	if fireOptions.Duration <= 0 && fireOptions.Count <= 0 {
+		return FireOptions{}, errors.New("either the duration or count option must be provided")
+	}
+
+	if fireOptions.Timeout <= 0 || fireOptions.MaxInFlight <= 0 {
+		return FireOptions{}, errors.New("timeout and maxInFlight options must be greater than 0")
+	}
+
+	return fireOptions, nil
+}
+
+// fire sends the queries returned by next, along with their type, at the rate defined by
+// the options, and emits the metrics of each query once it completes.
+func (mi *ModuleInstance) fire(
+	ctx context.Context,
+	engine *queryEngine,
+	next func() (Question, uint16),
+	nameserver Nameserver,
+	options FireOptions,
+) (FireSummary, error) {
+	var summary FireSummary
+	var succeeded, failed, timedOut atomic.Int64
+	var completed sync.WaitGroup
+
+	// Results are handed over to a dedicated goroutine emitting their metrics. As a
+	// query only frees its in flight slot once its result has been emitted, at most
+	// MaxInFlight results are handed over at once, and handing them over never blocks
+	// the engine's reader, even when the samples channel is slow to drain.
+	results := make(chan firedQuery, options.MaxInFlight)
+	inFlight := make(chan struct{}, options.MaxInFlight)
+
+	var emitted sync.WaitGroup
+	emitted.Add(1)
+	go func() {
+		defer emitted.Done()
+
+		for fired := range results {
+			result := fired.result
+
+			switch {
+			case errors.Is(result.Err, ErrQueryTimeout):
+				timedOut.Add(1)
+				failed.Add(1)
+			case result.Err != nil || result.Rcode != dns.RcodeSuccess:
+				failed.Add(1)
+			default:
+				succeeded.Add(1)
+			}
+
+			var resultErr error
+			if result.Err != nil {
+				resultErr = result.Err
+			} else if result.Rcode != dns.RcodeSuccess {
+				resultErr = newDNSError(result.Rcode, "DNS query failed")
+			}
+
+			mi.emitResolutionMetrics(
+				ctx,
+				result.RTT.Milliseconds(),
+				fired.question.Name,
+				fired.question.Type,
+				nameserver,
+				Resolution{},
+				resultErr,
+			)
+
+			<-inFlight
+			completed.Done()
+		}
+	}()
+
+	start := time.Now()
+	ticker := time.NewTicker(fireTick)
+	defer ticker.Stop()
+
+	var sendErr error
+send:
+	for {
+		elapsed := time.Since(start)
+		if options.Duration > 0 && elapsed >= options.Duration {
+			break
+		}
+
+		// Send all the queries due since the start, catching up with any delay.
+		due := int64(elapsed.Seconds() * options.Rate)
+		if options.Count > 0 {
+			due = min(due, options.Count)
+		}
+
+		for ; summary.Sent < due; summary.Sent++ {
+			select {
+			case inFlight <- struct{}{}:
+			case <-ctx.Done():
+				break send
+			}
+
+			question, qtype := next()
+			done := func(result EngineResult) {
+				results <- firedQuery{question: question, result: result}
+			}
+
+			completed.Add(1)
+			err := engine.send(dns.Fqdn(question.Name), qtype, nameserver, options.Timeout, done)
+			switch {
+			case errors.Is(err, ErrNoFreeQueryID):
+				// Too many queries are in flight to this nameserver, which
+				// we account for as a failed query.
+				done(EngineResult{Err: err})
+			case err != nil:
+				<-inFlight
+				completed.Done()
+				sendErr = err
+				break send
+			}
+		}
+
+		if options.Count > 0 && summary.Sent >= options.Count {
+			break
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			break send
+		}
+	}
+
+	completed.Wait()
+	close(results)
+	emitted.Wait()
+
+	if sendErr != nil {
+		return FireSummary{}, fmt.Errorf("fire operation failed after sending %d queries: %w", summary.Sent, sendErr)
+	}
+
+	summary.Succeeded = succeeded.Load()
+	summary.Failed = failed.Load()
+	summary.TimedOut = timedOut.Load()
+	summary.Duration = time.Since(start).Milliseconds()
+
+	return summary, nil
+}
@@ -0,0 +1,218 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/grafana/sobek"
+	"go.k6.io/k6/js/common"
+	"go.k6.io/k6/js/promises"
+	"go.k6.io/k6/lib/types"
+	"go.k6.io/k6/metrics"
+)
+
+// fuzzResult is the JS representation of a FuzzSummary.
+type fuzzResult struct {
+	Seed      uint64           `js:"seed"`
+	Cases     []fuzzCaseResult `js:"cases"`
+	Responded int              `js:"responded"`
+	FormErr   int              `js:"formerr"`
+	Dropped   int              `js:"dropped"`
+	Unhealthy int              `js:"unhealthy"`
+}
+
+// fuzzCaseResult is the JS representation of a FuzzCase.
+type fuzzCaseResult struct {
+	Index    int     `js:"index"`
+	Seed     uint64  `js:"seed"`
+	Mutation string  `js:"mutation"`
+	Outcome  string  `js:"outcome"`
+	Rcode    string  `js:"rcode"`
+	Duration float64 `js:"duration"`
+	Healthy  bool    `js:"healthy"`
+}
+
+// mutateResult is the JS representation of a corrupted message returned by Mutate.
+type mutateResult struct {
+	Bytes    sobek.ArrayBuffer `js:"bytes"`
+	Mutation string            `js:"mutation"`
+}
+
+// Fuzz tests the robustness of the nameserver, by sending it corrupted versions of the
+// DNS message, a well-formed query provided in wire format as an ArrayBuffer, and
+// probing it with the well-formed message after each of them.
+//
+// It returns a promise resolving to the seed of the test, and the outcome of each of
+// its cases, along with the number of cases of each outcome, and of failed probes.
+func (mi *ModuleInstance) Fuzz(message, nameserverAddr, options sobek.Value) *sobek.Promise {
+	promise, resolve, reject := promises.New(mi.vu)
+
+	if mi.vu.State() == nil {
+		reject(errors.New("fuzz can not be used in the init context"))
+		return promise
+	}
+
+	packed, err := exportBytes(message)
+	if err != nil {
+		reject(fmt.Errorf("message must be an ArrayBuffer; got %v instead", message))
+		return promise
+	}
+
+	var nameserverAddrStr string
+	if common.IsNullish(nameserverAddr) || mi.vu.Runtime().ExportTo(nameserverAddr, &nameserverAddrStr) != nil {
+		reject(fmt.Errorf("nameserver must be a string; got %v instead", nameserverAddr))
+		return promise
+	}
+
+	nameserver, err := parseNameserverAddr(nameserverAddrStr)
+	if err != nil {
+		reject(fmt.Errorf("parsing nameserver address failed: %w", err))
+		return promise
+	}
+
+	fuzzOptions, err := parseFuzzOptions(mi.vu.Runtime(), options)
+	if err != nil {
+		reject(err)
+		return promise
+	}
+
+	go func() {
+		summary, fuzzErr := mi.dnsClient.Fuzz(mi.vu.Context(), packed, nameserver, fuzzOptions)
+
+		// Recording failures don't fail the test
+		mi.logRecordingFailure(summary.RecordingErr)
+
+		mi.emitFuzzMetrics(mi.vu.Context(), nameserver, summary)
+
+		if fuzzErr != nil {
+			reject(fuzzErr)
+			return
+		}
+
+		result := fuzzResult{
+			Seed:      summary.Seed,
+			Cases:     make([]fuzzCaseResult, 0, len(summary.Cases)),
+			Responded: summary.Responded,
+			FormErr:   summary.FormErr,
+			Dropped:   summary.Dropped,
+			Unhealthy: summary.Unhealthy,
+		}
+
+		for _, fuzzCase := range summary.Cases {
+			result.Cases = append(result.Cases, fuzzCaseResult{
+				Index:    fuzzCase.Index,
+				Seed:     fuzzCase.Seed,
+				Mutation: string(fuzzCase.Mutation),
+				Outcome:  string(fuzzCase.Outcome),
+				Rcode:    fuzzCase.Rcode,
+				Duration: durationMillis(fuzzCase.Duration),
+				Healthy:  fuzzCase.Healthy,
+			})
+		}
+
+		resolve(result)
+	}()
+
+	return promise
+}
+
+// Mutate corrupts the DNS message, a well-formed query provided in wire format as an
+// ArrayBuffer, using one of the mutations picked using the seed, such as the seed of
+// a case of a dns.fuzz test, to reproduce it.
+//
+// It returns the corrupted message, as an ArrayBuffer, along with the mutation applied.
+func (mi *ModuleInstance) Mutate(message, seed, mutations sobek.Value) (*mutateResult, error) {
+	packed, err := exportBytes(message)
+	if err != nil {
+		return nil, fmt.Errorf("message must be an ArrayBuffer; got %v instead", message)
+	}
+
+	var seedInt int64
+	if common.IsNullish(seed) || mi.vu.Runtime().ExportTo(seed, &seedInt) != nil || seedInt < 0 || seedInt > maxSeed {
+		return nil, fmt.Errorf("seed must be a positive integer lower than 2^53; got %v instead", seed)
+	}
+
+	var mutationList []Mutation
+	if !common.IsNullish(mutations) {
+		if err := mi.vu.Runtime().ExportTo(mutations, &mutationList); err != nil {
+			return nil, fmt.Errorf("mutations must be an array of strings; got %v instead", mutations)
+		}
+	}
+
+	mutated, mutation, err := Mutate(packed, uint64(seedInt), mutationList)
+	if err != nil {
+		return nil, err
+	}
+
+	return &mutateResult{Bytes: mi.vu.Runtime().NewArrayBuffer(mutated), Mutation: string(mutation)}, nil
+}
+
+// parseFuzzOptions parses the options of a dns.fuzz call.
+func parseFuzzOptions(rt *sobek.Runtime, options sobek.Value) (FuzzOptions, error) {
+	var fuzzOptions FuzzOptions
+	if common.IsNullish(options) {
+		return fuzzOptions, nil
+	}
+
+	if err := rt.ExportTo(options, &fuzzOptions); err != nil {
+		return FuzzOptions{}, fmt.Errorf("options must be an object; got %v instead", options)
+	}
+
+	if value := options.ToObject(rt).Get("timeout"); !common.IsNullish(value) {
+		timeout, err := types.GetDurationValue(value.Export())
+		if err != nil {
+			return FuzzOptions{}, fmt.Errorf("invalid timeout option: %w", err)
+		}
+
+		fuzzOptions.Timeout = timeout
+	}
+
+	if err := fuzzOptions.Validate(); err != nil {
+		return FuzzOptions{}, fmt.Errorf("invalid options: %w", err)
+	}
+
+	return fuzzOptions, nil
+}
+
+// emitFuzzMetrics emits the metrics specific to dns.fuzz operations, one set per case.
+func (mi *ModuleInstance) emitFuzzMetrics(ctx context.Context, nameserver Nameserver, summary FuzzSummary) {
+	state := mi.vu.State()
+
+	tags := state.Tags.GetCurrentValues().Tags
+	tags = tags.With("nameserver", nameserver.Addr())
+
+	now := time.Now()
+
+	for _, fuzzCase := range summary.Cases {
+		caseTags := tags.With("mutation", string(fuzzCase.Mutation))
+
+		// Increment the cases counter, tagged with their outcome
+		metrics.PushIfNotDone(ctx, state.Samples, metrics.Sample{
+			TimeSeries: metrics.TimeSeries{
+				Metric: mi.metrics.DNSFuzzCases,
+				Tags:   caseTags.With("outcome", string(fuzzCase.Outcome)),
+			},
+			Time:     now,
+			Value:    float64(1),
+			Metadata: nil,
+		})
+
+		var unhealthy float64
+		if !fuzzCase.Healthy {
+			unhealthy = 1
+		}
+
+		// Emit the failed health probes rate
+		metrics.PushIfNotDone(ctx, state.Samples, metrics.Sample{
+			TimeSeries: metrics.TimeSeries{
+				Metric: mi.metrics.DNSFuzzUnhealthy,
+				Tags:   caseTags,
+			},
+			Time:     now,
+			Value:    unhealthy,
+			Metadata: nil,
+		})
+	}
+}
@@ -0,0 +1,598 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// ErrMaxQueriesExceeded is an error that is returned when an iterative resolution
+// needs more queries than allowed, such as when following a delegation loop.
+var ErrMaxQueriesExceeded = errors.New("maximum number of queries exceeded")
+
+// ErrLameDelegation is an error that is returned when none of the nameservers a zone
+// is delegated to provides an answer, or a referral, for the zone.
+var ErrLameDelegation = errors.New("lame delegation")
+
+const (
+	// defaultIterativeMaxQueries is the default maximum number of queries an
+	// iterative resolution can send.
+	defaultIterativeMaxQueries = 64
+
+	// maxMinimiseCount is the maximum number of minimised queries a QNAME minimisation
+	// resolution sends, and minimiseOneLab the number of those adding a single label
+	// to the name, as per [RFC9156].
+	//
+	// [RFC9156]: https://www.iana.org/go/rfc9156
+	maxMinimiseCount = 10
+	minimiseOneLab   = 4
+
+	// maxIterativeDepth is the maximum depth of the nested resolutions an iterative
+	// resolution performs, to follow CNAME records, or to resolve the addresses
+	// of nameservers referrals hold no glue for.
+	maxIterativeDepth = 8
+)
+
+// RootHints holds the addresses of the IPv4 root nameservers, from a. to m.root-servers.net,
+// as published by [IANA].
+//
+// [IANA]: https://www.iana.org/domains/root/servers
+var RootHints = []string{ //nolint:gochecknoglobals
+	"198.41.0.4",
+	"170.247.170.2",
+	"192.33.4.12",
+	"199.7.91.13",
+	"192.203.230.10",
+	"192.5.5.241",
+	"192.112.36.4",
+	"198.97.190.53",
+	"192.36.148.17",
+	"192.58.128.30",
+	"193.0.14.129",
+	"199.7.83.42",
+	"202.12.27.33",
+}
+
+// IterativeOptions holds the options of an IterativeResolver.
+type IterativeOptions struct {
+	// Roots holds the root nameservers resolutions start from. It defaults to RootHints.
+	Roots []Nameserver
+
+	// Port holds the port the nameservers learned from referrals are queried on. It
+	// defaults to 53.
+	Port uint16
+
+	// MaxQueries holds the maximum number of queries a single resolution can send. It
+	// defaults to 64.
+	MaxQueries int
+
+	// QnameMinimisation enables QNAME minimisation, as per [RFC9156]: nameservers are
+	// only sent the labels of the name needed to find the next zone cut.
+	//
+	// [RFC9156]: https://www.iana.org/go/rfc9156
+	QnameMinimisation bool
+
+	// Client holds the options used to send each query.
+	Client ClientOptions
+}
+
+// IterativeResolver is a DNS resolver resolving names iteratively, as a recursive
+// resolver would, rather than relying on one.
+//
+// It starts from the root nameservers, and follows the referrals it receives, and
+// their glue records, down to the nameservers authoritative for the name.
+type IterativeResolver struct {
+	client  *Client
+	options IterativeOptions
+}
+
+// Ensure our IterativeResolver implements the Resolver interface
+var _ Resolver = &IterativeResolver{}
+
+// NewIterativeResolver creates a new IterativeResolver sending its queries using
+// the provided client.
+func NewIterativeResolver(client *Client, options IterativeOptions) *IterativeResolver {
+	if len(options.Roots) == 0 {
+		for _, hint := range RootHints {
+			options.Roots = append(options.Roots, Nameserver{IP: net.ParseIP(hint), Port: 53})
+		}
+	}
+
+	if options.Port == 0 {
+		options.Port = 53
+	}
+
+	if options.MaxQueries <= 0 {
+		options.MaxQueries = defaultIterativeMaxQueries
+	}
+
+	return &IterativeResolver{client: client, options: options}
+}
+
+// Trace holds the outcome of an iterative resolution, and the queries it took.
+type Trace struct {
+	// IPs holds the IP addresses the name resolved to.
+	IPs []string
+
+	// Answer holds the records of the authoritative answer, in presentation format.
+	Answer []string
+
+	// Hops holds the queries sent, in order.
+	Hops []Hop
+
+	// Duration holds the time the whole resolution took.
+	Duration time.Duration
+
+	// RecordingErr holds the error opening the recording, or recording the exchanges of
+	// the hops to it, failed with, when recording exchanges. It doesn't fail the trace.
+	RecordingErr error
+}
+
+// Hop holds a single query of an iterative resolution, and its outcome.
+type Hop struct {
+	// Name holds the name queried.
+	Name string
+
+	// Type holds the type of the record queried.
+	Type string
+
+	// Minimised is true if the query was a QNAME minimisation query, for an ancestor
+	// of the resolved name.
+	Minimised bool
+
+	// Zone holds the zone the queried nameserver was expected to be authoritative for.
+	Zone string
+
+	// Server holds the address of the queried nameserver.
+	Server string
+
+	// Rcode holds the response code of the response, if any.
+	Rcode string
+
+	// Authoritative is true if the response had the AA bit set.
+	Authoritative bool
+
+	// Referral holds the referral the response held, if any.
+	Referral *Referral
+
+	// Answer holds the records of the response's answer section, in presentation format.
+	Answer []string
+
+	// Latency holds the time elapsed between sending the query and receiving its response.
+	Latency time.Duration
+
+	// Error holds why the query failed, or why its response could not be used, if so.
+	Error string
+}
+
+// Referral holds a delegation received from a nameserver.
+type Referral struct {
+	// Zone holds the name of the delegated zone.
+	Zone string
+
+	// Nameservers holds the names of the nameservers the zone is delegated to.
+	Nameservers []string
+
+	// Glue holds the addresses of the nameservers provided by the referral.
+	Glue []string
+}
+
+// Resolve resolves a domain name to a slice of IP addresses iteratively. When its IP
+// is set, the nameserver is used as the only root nameserver instead of the resolver's.
+func (r *IterativeResolver) Resolve(
+	ctx context.Context,
+	query, recordType string,
+	nameserver Nameserver,
+) ([]string, error) {
+	resolver := r
+	if nameserver.IP != nil {
+		options := r.options
+		options.Roots = []Nameserver{nameserver}
+		resolver = &IterativeResolver{client: r.client, options: options}
+	}
+
+	trace, err := resolver.Trace(ctx, query, recordType)
+	return trace.IPs, err
+}
+
+// Trace resolves a domain name iteratively, and returns every query it took. When the
+// resolution fails, the returned Trace still holds the queries sent.
+func (r *IterativeResolver) Trace(ctx context.Context, query, recordType string) (Trace, error) {
+	concreteType, err := RecordTypeString(recordType)
+	if err != nil {
+		return Trace{}, fmt.Errorf(
+			"trace operation failed with %w, %s is an invalid DNS record type",
+			ErrUnsupportedRecordType,
+			recordType,
+		)
+	}
+
+	start := time.Now()
+	it := &iteration{}
+
+	answer, err := r.resolve(ctx, it, dns.Fqdn(query), uint16(concreteType), 0)
+
+	trace := Trace{Hops: it.hops, Duration: time.Since(start)}
+	trace.RecordingErr = r.client.recordExchanges(&it.log, r.options.Client.Record, err != nil)
+	for _, rr := range answer {
+		trace.Answer = append(trace.Answer, rr.String())
+
+		switch t := rr.(type) {
+		case *dns.A:
+			trace.IPs = append(trace.IPs, t.A.String())
+		case *dns.AAAA:
+			trace.IPs = append(trace.IPs, t.AAAA.String())
+		}
+	}
+
+	return trace, err
+}
+
+// iteration holds the state of an iterative resolution.
+type iteration struct {
+	hops []Hop
+
+	// log holds the exchanges of the hops, recorded once the resolution ends.
+	log exchangeLog
+}
+
+// resolve resolves the name iteratively starting from the roots, and returns the
+// records of the authoritative answer, including the CNAME records leading to them.
+// A NODATA response yields no records, and no error.
+//
+// With QNAME minimisation, the nameservers of each zone are first queried for the
+// A record of the name's ancestors, one or more labels below the deepest name known
+// not to be a zone cut. Ancestors that exist, or are empty non-terminals, are answered
+// without a referral, while an NXDOMAIN response means that neither the ancestor, nor
+// the name, exist, as per [RFC8020].
+//
+// [RFC8020]: https://www.iana.org/go/rfc8020
+func (r *IterativeResolver) resolve(
+	ctx context.Context,
+	it *iteration,
+	name string,
+	qtype uint16,
+	depth int,
+) ([]dns.RR, error) {
+	if depth > maxIterativeDepth {
+		return nil, fmt.Errorf("resolving %s failed: maximum resolution depth exceeded", name)
+	}
+
+	zone, known := ".", "."
+	servers := r.options.Roots
+	minimised := 0
+
+	for {
+		qname, qnameType := name, qtype
+		if r.options.QnameMinimisation {
+			if ancestor := minimisedName(name, known, minimised); ancestor != name {
+				qname, qnameType = ancestor, dns.TypeA
+				minimised++
+			}
+		}
+
+		response, referral, err := r.queryZone(ctx, it, zone, servers, qname, qnameType, qname != name)
+		if err != nil {
+			return nil, err
+		}
+
+		if response.Rcode == dns.RcodeNameError {
+			if qname != name {
+				return nil, newDNSError(response.Rcode, "DNS query failed, "+qname+" does not exist")
+			}
+
+			return nil, newDNSError(response.Rcode, "DNS query failed")
+		}
+
+		if referral != nil {
+			servers, err = r.referralServers(ctx, it, referral, response, depth)
+			if err != nil {
+				return nil, err
+			}
+
+			zone, known = referral.Zone, referral.Zone
+			continue
+		}
+
+		if qname != name {
+			// The ancestor is not a zone cut, thus we move on to the next labels
+			// of the name, querying the same nameservers.
+			known = qname
+			continue
+		}
+
+		answer, target := answerRecords(response, name, qtype)
+		if target == "" {
+			return answer, nil
+		}
+
+		// The name is an alias, whose target we resolve from the roots, as it
+		// might well live in another zone.
+		targetAnswer, err := r.resolve(ctx, it, target, qtype, depth+1)
+		return append(answer, targetAnswer...), err
+	}
+}
+
+// queryZone queries the nameservers of the zone in turn, until one of them provides
+// a usable response: an answer, an authoritative negative response, or a referral to
+// a zone closer to the name. It returns the response, and its referral, if any. The
+// minimised flag records in the hops whether name is a QNAME minimisation ancestor.
+func (r *IterativeResolver) queryZone(
+	ctx context.Context,
+	it *iteration,
+	zone string,
+	servers []Nameserver,
+	name string,
+	qtype uint16,
+	minimised bool,
+) (*dns.Msg, *Referral, error) {
+	for _, server := range servers {
+		if len(it.hops) >= r.options.MaxQueries {
+			return nil, nil, fmt.Errorf("resolving %s failed: %w (%d)", name, ErrMaxQueriesExceeded, r.options.MaxQueries)
+		}
+
+		hop := Hop{
+			Name:      name,
+			Type:      dns.TypeToString[qtype],
+			Minimised: minimised,
+			Zone:      zone,
+			Server:    server.Addr(),
+		}
+
+		response, err := r.query(ctx, it, name, qtype, server, &hop)
+		if err != nil {
+			if ctx.Err() != nil {
+				it.hops = append(it.hops, hop)
+				return nil, nil, fmt.Errorf("querying %s failed: %w", server.Addr(), err)
+			}
+
+			hop.Error = err.Error()
+			it.hops = append(it.hops, hop)
+			continue
+		}
+
+		referral := newReferral(response, zone, name)
+		hop.Referral = referral
+		it.hops = append(it.hops, hop)
+
+		switch {
+		case response.Rcode != dns.RcodeSuccess && response.Rcode != dns.RcodeNameError:
+			// Nameservers failing to answer, or refusing to, are skipped in favor
+			// of the zone's other nameservers.
+			it.hops[len(it.hops)-1].Error = "unusable response code " + dns.RcodeToString[response.Rcode]
+			continue
+		case referral == nil && !response.Authoritative && len(response.Answer) == 0:
+			it.hops[len(it.hops)-1].Error = ErrLameDelegation.Error()
+			continue
+		}
+
+		return response, referral, nil
+	}
+
+	return nil, nil, fmt.Errorf("resolving %s failed: %w, no nameserver of zone %s answered", name, ErrLameDelegation, zone)
+}
+
+// query sends a single non-recursive query to the server, retrying over TCP if
+// the response is truncated, and records its outcome in the hop.
+func (r *IterativeResolver) query(
+	ctx context.Context,
+	it *iteration,
+	name string,
+	qtype uint16,
+	server Nameserver,
+	hop *Hop,
+) (*dns.Msg, error) {
+	options := r.options.Client
+
+	message := new(dns.Msg)
+	message.SetQuestion(name, qtype)
+	message.RecursionDesired = false
+	message.Id = r.client.nextQueryID(options.QueryID)
+
+	start := time.Now()
+	response, err := r.client.exchange(ctx, message, server, options, &it.log)
+	if err == nil && response.Truncated && options.Transport.network() == "udp" {
+		options.Transport = TransportTCP
+		response, err = r.client.exchange(ctx, message, server, options, &it.log)
+	}
+	hop.Latency = time.Since(start)
+
+	if err != nil {
+		return nil, err
+	}
+
+	hop.Rcode = dns.RcodeToString[response.Rcode]
+	hop.Authoritative = response.Authoritative
+	for _, rr := range response.Answer {
+		hop.Answer = append(hop.Answer, rr.String())
+	}
+
+	return response, nil
+}
+
+// referralServers returns the addresses of the nameservers of the referral, using
+// its glue records, or resolving the nameservers' addresses if it has none.
+func (r *IterativeResolver) referralServers(
+	ctx context.Context,
+	it *iteration,
+	referral *Referral,
+	response *dns.Msg,
+	depth int,
+) ([]Nameserver, error) {
+	var servers []Nameserver
+	for _, glue := range referral.Glue {
+		servers = append(servers, Nameserver{IP: net.ParseIP(glue), Port: r.options.Port})
+	}
+
+	if len(servers) > 0 {
+		return servers, nil
+	}
+
+	// Without glue, we resolve the nameservers' addresses ourselves, stopping
+	// at the first one that resolves.
+	var lastErr error
+	for _, ns := range referral.Nameservers {
+		answer, err := r.resolve(ctx, it, ns, dns.TypeA, depth+1)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, err
+			}
+
+			lastErr = err
+			continue
+		}
+
+		for _, rr := range answer {
+			if a, ok := rr.(*dns.A); ok {
+				servers = append(servers, Nameserver{IP: a.A, Port: r.options.Port})
+			}
+		}
+
+		if len(servers) > 0 {
+			return servers, nil
+		}
+	}
+
+	if lastErr != nil {
+		return nil, fmt.Errorf("resolving the nameservers of zone %s failed: %w", referral.Zone, lastErr)
+	}
+
+	return nil, fmt.Errorf(
+		"resolving %s failed: %w, no address found for the nameservers of zone %s",
+		response.Question[0].Name,
+		ErrLameDelegation,
+		referral.Zone,
+	)
+}
+
+// minimisedName returns the ancestor of name to query next when using QNAME minimisation,
+// known being the deepest ancestor known not to be a zone cut, and sent the number of
+// minimised queries already sent. As per [RFC9156], the first minimiseOneLab queries add
+// a single label to known, and the following ones spread the remaining labels over
+// the maxMinimiseCount budget, so that long names don't take a query per label.
+//
+// [RFC9156]: https://www.iana.org/go/rfc9156
+func minimisedName(name, known string, sent int) string {
+	nameLabels := dns.CountLabel(name)
+	remaining := nameLabels - dns.CountLabel(known)
+	if remaining <= 1 || sent >= maxMinimiseCount {
+		return name
+	}
+
+	add := 1
+	if sent >= minimiseOneLab {
+		add = max(1, remaining/(maxMinimiseCount-sent))
+	}
+
+	offsets := dns.Split(name)
+	return name[offsets[remaining-add]:]
+}
+
+// newReferral returns the referral held by the response to a query for name sent to a
+// nameserver of zone, or nil if it holds none. Only referrals to zones below zone, and
+// enclosing name, are considered, so that resolutions always progress.
+func newReferral(response *dns.Msg, zone, name string) *Referral {
+	if len(response.Answer) > 0 || response.Rcode != dns.RcodeSuccess {
+		return nil
+	}
+
+	var referral *Referral
+	for _, rr := range response.Ns {
+		ns, ok := rr.(*dns.NS)
+		if !ok {
+			continue
+		}
+
+		owner := strings.ToLower(ns.Hdr.Name)
+		if dns.CountLabel(owner) <= dns.CountLabel(zone) ||
+			!dns.IsSubDomain(zone, owner) ||
+			!dns.IsSubDomain(owner, name) {
+			continue
+		}
+
+		if referral == nil {
+			referral = &Referral{Zone: owner}
+		} else if owner != referral.Zone {
+			continue
+		}
+
+		referral.Nameservers = append(referral.Nameservers, strings.ToLower(ns.Ns))
+	}
+
+	if referral == nil {
+		return nil
+	}
+
+	for _, rr := range response.Extra {
+		for _, ns := range referral.Nameservers {
+			if !strings.EqualFold(rr.Header().Name, ns) {
+				continue
+			}
+
+			switch t := rr.(type) {
+			case *dns.A:
+				referral.Glue = append(referral.Glue, t.A.String())
+			case *dns.AAAA:
+				referral.Glue = append(referral.Glue, t.AAAA.String())
+			}
+		}
+	}
+
+	return referral
+}
+
+// answerRecords returns the answer records of the response relevant to the query for
+// name and qtype, following the CNAME chain it holds. When the chain ends on an alias
+// the response holds no records for, it also returns the alias' target.
+func answerRecords(response *dns.Msg, name string, qtype uint16) ([]dns.RR, string) {
+	var answer []dns.RR
+
+	owner := name
+	for followed := 0; followed <= len(response.Answer); followed++ {
+		var target string
+		found := false
+
+		for _, rr := range response.Answer {
+			header := rr.Header()
+			if !strings.EqualFold(header.Name, owner) {
+				continue
+			}
+
+			switch {
+			case header.Rrtype == qtype:
+				answer = append(answer, rr)
+				found = true
+			case header.Rrtype == dns.TypeCNAME && qtype != dns.TypeCNAME:
+				answer = append(answer, rr)
+				target = rr.(*dns.CNAME).Target //nolint:forcetypeassert
+			}
+		}
+
+		if found || target == "" {
+			return answer, ""
+		}
+
+		owner = target
+		if !containsOwner(response.Answer, owner) {
+			return answer, owner
+		}
+	}
+
+	return answer, ""
+}
+
+// containsOwner returns true if any of the records is owned by name.
+func containsOwner(records []dns.RR, name string) bool {
+	for _, rr := range records {
+		if strings.EqualFold(rr.Header().Name, name) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,334 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/grafana/xk6-dns/dnstest"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIterativeResolver_Trace(t *testing.T) {
+	t.Parallel()
+
+	root, port := startTestHierarchy(t)
+
+	newResolver := func(roots ...Nameserver) *IterativeResolver {
+		return NewIterativeResolver(NewDNSClient(), IterativeOptions{Roots: roots, Port: port})
+	}
+
+	t.Run("resolution follows referrals and glue down to the authoritative answer", func(t *testing.T) {
+		t.Parallel()
+
+		trace, err := newResolver(root).Trace(context.Background(), testDomain, "A")
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{primaryTestIPv4}, trace.IPs)
+		require.Len(t, trace.Hops, 3)
+
+		assert.Equal(t, ".", trace.Hops[0].Zone)
+		assert.Equal(t, root.Addr(), trace.Hops[0].Server)
+		require.NotNil(t, trace.Hops[0].Referral)
+		assert.Equal(t, "test.", trace.Hops[0].Referral.Zone)
+		assert.Equal(t, []string{"ns.test."}, trace.Hops[0].Referral.Nameservers)
+		assert.Equal(t, []string{"127.0.0.2"}, trace.Hops[0].Referral.Glue)
+
+		assert.Equal(t, "test.", trace.Hops[1].Zone)
+		assert.Equal(t, net.JoinHostPort("127.0.0.2", strconv.Itoa(int(port))), trace.Hops[1].Server)
+		require.NotNil(t, trace.Hops[1].Referral)
+		assert.Equal(t, "k6.test.", trace.Hops[1].Referral.Zone)
+
+		assert.Equal(t, "k6.test.", trace.Hops[2].Zone)
+		assert.True(t, trace.Hops[2].Authoritative)
+		assert.Nil(t, trace.Hops[2].Referral)
+		assert.Equal(t, "NOERROR", trace.Hops[2].Rcode)
+
+		for _, hop := range trace.Hops {
+			assert.Positive(t, hop.Latency)
+		}
+	})
+
+	t.Run("aliases are followed from the roots, resolving nameservers without glue", func(t *testing.T) {
+		t.Parallel()
+
+		trace, err := newResolver(root).Trace(context.Background(), "www."+testDomain, "A")
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{secondaryTestIPv4}, trace.IPs)
+		require.Len(t, trace.Answer, 2)
+		assert.Contains(t, trace.Answer[0], "CNAME")
+
+		var resolvedNameserver bool
+		for _, hop := range trace.Hops {
+			if hop.Name == "ns.k6.test." {
+				resolvedNameserver = true
+			}
+		}
+		assert.True(t, resolvedNameserver)
+	})
+
+	t.Run("non-existing names fail with the authoritative NXDOMAIN", func(t *testing.T) {
+		t.Parallel()
+
+		trace, err := newResolver(root).Trace(context.Background(), "missing."+testDomain, "A")
+
+		var dnsErr *Error
+		require.True(t, errors.As(err, &dnsErr))
+		assert.Equal(t, NonExistingDomain, dnsErr.Kind)
+		assert.Len(t, trace.Hops, 3)
+	})
+
+	t.Run("nameservers refusing to answer are skipped", func(t *testing.T) {
+		t.Parallel()
+
+		refusing := startTestNameserver(t, func(w dns.ResponseWriter, r *dns.Msg) {
+			response := new(dns.Msg)
+			response.SetRcode(r, dns.RcodeRefused)
+			assert.NoError(t, w.WriteMsg(response))
+		})
+
+		trace, err := newResolver(refusing, root).Trace(context.Background(), testDomain, "A")
+		require.NoError(t, err)
+
+		require.Len(t, trace.Hops, 4)
+		assert.Equal(t, "REFUSED", trace.Hops[0].Rcode)
+		assert.NotEmpty(t, trace.Hops[0].Error)
+	})
+
+	t.Run("nameservers providing neither answers nor referrals are lame", func(t *testing.T) {
+		t.Parallel()
+
+		lame := startTestNameserver(t, func(w dns.ResponseWriter, r *dns.Msg) {
+			response := new(dns.Msg)
+			response.SetReply(r)
+			assert.NoError(t, w.WriteMsg(response))
+		})
+
+		_, err := newResolver(lame).Trace(context.Background(), testDomain, "A")
+		assert.ErrorIs(t, err, ErrLameDelegation)
+	})
+
+	t.Run("resolving implements the Resolver interface", func(t *testing.T) {
+		t.Parallel()
+
+		ips, err := newResolver().Resolve(context.Background(), testDomain, "A", root)
+		require.NoError(t, err)
+		assert.Equal(t, []string{primaryTestIPv4}, ips)
+	})
+}
+
+// startTestHierarchy starts in-process nameservers for a small DNS hierarchy: a root
+// zone delegating the test. zone, itself delegating the k6.test. and other.test. zones.
+//
+// As referrals only hold the nameservers' IP addresses, each nameserver listens on a
+// distinct loopback address, and all of them on the same port. It returns the root
+// nameserver, and that port.
+func startTestHierarchy(t *testing.T) (Nameserver, uint16) {
+	t.Helper()
+
+	rootListener, tldListener, authListener := listenOnLoopbackAddrs(t)
+
+	root := serveTestNameserver(t, rootListener, testZoneHandler(t, ".",
+		". 3600 IN SOA a.root.test. admin.test. 1 7200 3600 1209600 300",
+		"test. 3600 IN NS ns.test.",
+		"ns.test. 3600 IN A 127.0.0.2",
+	))
+
+	serveTestNameserver(t, tldListener, testZoneHandler(t, "test.",
+		"test. 3600 IN SOA ns.test. admin.test. 1 7200 3600 1209600 300",
+		"k6.test. 3600 IN NS ns1.k6.test.",
+		"ns1.k6.test. 3600 IN A 127.0.0.3",
+		"other.test. 3600 IN NS ns.k6.test.",
+	))
+
+	mux := dns.NewServeMux()
+	mux.HandleFunc("k6.test.", testZoneHandler(t, "k6.test.",
+		"k6.test. 3600 IN SOA ns1.k6.test. admin.k6.test. 1 7200 3600 1209600 300",
+		"k6.test. 3600 IN NS ns1.k6.test.",
+		"k6.test. 60 IN A "+primaryTestIPv4,
+		"ns1.k6.test. 3600 IN A 127.0.0.3",
+		"ns.k6.test. 3600 IN A 127.0.0.3",
+		"www.k6.test. 60 IN CNAME www.other.test.",
+		"host.ent.k6.test. 60 IN A "+primaryTestIPv4,
+	))
+	mux.HandleFunc("other.test.", testZoneHandler(t, "other.test.",
+		"other.test. 3600 IN SOA ns.k6.test. admin.other.test. 1 7200 3600 1209600 300",
+		"other.test. 3600 IN NS ns.k6.test.",
+		"www.other.test. 60 IN A "+secondaryTestIPv4,
+	))
+	serveTestNameserver(t, authListener, mux.ServeDNS)
+
+	return root, root.Port
+}
+
+// listenOnLoopbackAddrs listens on 127.0.0.1, 127.0.0.2 and 127.0.0.3 using the same
+// port, and skips the test if the platform doesn't support additional loopback addresses.
+func listenOnLoopbackAddrs(t *testing.T) (net.Listener, net.Listener, net.Listener) {
+	t.Helper()
+
+	for attempt := 0; attempt < 8; attempt++ {
+		first, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+
+		port := strconv.Itoa(first.Addr().(*net.TCPAddr).Port) //nolint:forcetypeassert
+
+		second, err := net.Listen("tcp", net.JoinHostPort("127.0.0.2", port))
+		if err != nil {
+			_ = first.Close()
+			if strings.Contains(err.Error(), "can't assign requested address") {
+				t.Skip("additional loopback addresses are not available on this platform")
+			}
+
+			continue
+		}
+
+		third, err := net.Listen("tcp", net.JoinHostPort("127.0.0.3", port))
+		if err != nil {
+			_ = first.Close()
+			_ = second.Close()
+
+			continue
+		}
+
+		return first, second, third
+	}
+
+	t.Fatal("failed to listen on the loopback addresses using the same port")
+
+	return nil, nil, nil
+}
+
+// testZoneHandler returns a handler answering queries authoritatively for the zone,
+// from the provided records in presentation format. Queries for names below the
+// zone's delegations are answered with referrals, holding the glue records found.
+func testZoneHandler(t *testing.T, zone string, records ...string) dns.HandlerFunc {
+	t.Helper()
+
+	z, err := dnstest.NewZone(zone, records...)
+	require.NoError(t, err)
+
+	return z.ServeDNS
+}
+
+func TestIterativeResolver_QnameMinimisation(t *testing.T) {
+	t.Parallel()
+
+	root, port := startTestHierarchy(t)
+
+	newResolver := func(qnameMinimisation bool, roots ...Nameserver) *IterativeResolver {
+		return NewIterativeResolver(NewDNSClient(), IterativeOptions{
+			Roots:             roots,
+			Port:              port,
+			QnameMinimisation: qnameMinimisation,
+		})
+	}
+
+	hopNames := func(trace Trace) []string {
+		names := make([]string, 0, len(trace.Hops))
+		for _, hop := range trace.Hops {
+			names = append(names, hop.Name+" "+hop.Type)
+		}
+
+		return names
+	}
+
+	t.Run("nameservers are only sent the labels needed to find the next zone cut", func(t *testing.T) {
+		t.Parallel()
+
+		trace, err := newResolver(true, root).Trace(context.Background(), "host.ent."+testDomain, "AAAA")
+		require.NoError(t, err)
+
+		assert.Empty(t, trace.IPs)
+		assert.Equal(t, []string{
+			"test. A",
+			"k6.test. A",
+			"ent.k6.test. A",
+			"host.ent.k6.test. AAAA",
+		}, hopNames(trace))
+		assert.True(t, trace.Hops[2].Minimised)
+		assert.False(t, trace.Hops[3].Minimised)
+	})
+
+	t.Run("full names are sent without minimisation", func(t *testing.T) {
+		t.Parallel()
+
+		trace, err := newResolver(false, root).Trace(context.Background(), "host.ent."+testDomain, "A")
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{primaryTestIPv4}, trace.IPs)
+		assert.Equal(t, []string{
+			"host.ent.k6.test. A",
+			"host.ent.k6.test. A",
+			"host.ent.k6.test. A",
+		}, hopNames(trace))
+	})
+
+	t.Run("NXDOMAIN responses for an ancestor cut the resolution off", func(t *testing.T) {
+		t.Parallel()
+
+		trace, err := newResolver(true, root).Trace(context.Background(), "a.b.missing."+testDomain, "A")
+
+		var dnsErr *Error
+		require.True(t, errors.As(err, &dnsErr))
+		assert.Equal(t, NonExistingDomain, dnsErr.Kind)
+		assert.Equal(t, "missing.k6.test. A", hopNames(trace)[len(trace.Hops)-1])
+	})
+
+	t.Run("wrong NXDOMAIN responses for empty non-terminals fail the resolution", func(t *testing.T) {
+		t.Parallel()
+
+		zone := testZoneHandler(t, ".",
+			". 3600 IN SOA a.root.test. admin.test. 1 7200 3600 1209600 300",
+			"host.ent.test. 60 IN A "+primaryTestIPv4,
+		)
+		buggy := startTestNameserver(t, func(w dns.ResponseWriter, r *dns.Msg) {
+			if r.Question[0].Name == "ent.test." {
+				response := new(dns.Msg)
+				response.SetRcode(r, dns.RcodeNameError)
+				response.Authoritative = true
+				assert.NoError(t, w.WriteMsg(response))
+
+				return
+			}
+
+			zone(w, r)
+		})
+
+		_, err := newResolver(true, buggy).Trace(context.Background(), "host.ent.test", "A")
+		var dnsErr *Error
+		require.True(t, errors.As(err, &dnsErr))
+		assert.Equal(t, NonExistingDomain, dnsErr.Kind)
+
+		trace, err := newResolver(false, buggy).Trace(context.Background(), "host.ent.test", "A")
+		require.NoError(t, err)
+		assert.Equal(t, []string{primaryTestIPv4}, trace.IPs)
+	})
+}
+
+func Test_minimisedName(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		known string
+		sent  int
+		want  string
+	}{
+		{name: "a.b.c.example.", known: ".", sent: 0, want: "example."},
+		{name: "a.b.c.example.", known: "c.example.", sent: 2, want: "b.c.example."},
+		{name: "a.b.c.example.", known: "b.c.example.", sent: 3, want: "a.b.c.example."},
+		{name: "1.2.3.4.5.6.7.8.9.10.11.12.13.14.example.", known: "5.6.7.8.9.10.11.12.13.14.example.", sent: 4, want: "4.5.6.7.8.9.10.11.12.13.14.example."},
+		{name: "1.2.3.4.5.6.7.8.9.10.11.12.13.14.example.", known: "11.12.13.14.example.", sent: 8, want: "6.7.8.9.10.11.12.13.14.example."},
+		{name: "a.b.c.example.", known: ".", sent: maxMinimiseCount, want: "a.b.c.example."},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, minimisedName(tt.name, tt.known, tt.sent), "%s from %s", tt.name, tt.known)
+	}
+}
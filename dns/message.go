@@ -0,0 +1,389 @@
+package dns
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// Message holds a DNS message, as defined in [RFC1035], in a form that can be crafted
+// freely, such as with several questions, or unusual flags, opcodes and response codes.
+//
+// [RFC1035]: https://www.iana.org/go/rfc1035
+type Message struct {
+	// ID holds the message ID.
+	ID uint16 `js:"id"`
+
+	// Response is true if the message is a response, as signaled by the QR flag.
+	Response bool `js:"response"`
+
+	// Opcode holds the mnemonic of the message's opcode, such as QUERY or NOTIFY, or its
+	// number if it has none. It defaults to QUERY.
+	Opcode string `js:"opcode"`
+
+	// Rcode holds the mnemonic of the message's response code, such as NOERROR or
+	// NXDOMAIN, or its number if it has none. It defaults to NOERROR. Extended response
+	// codes, greater than 15, require the message to hold an EDNS pseudo-record.
+	Rcode string `js:"rcode"`
+
+	// Authoritative holds the AA flag.
+	Authoritative bool `js:"authoritative"`
+
+	// Truncated holds the TC flag.
+	Truncated bool `js:"truncated"`
+
+	// RecursionDesired holds the RD flag.
+	RecursionDesired bool `js:"recursionDesired"`
+
+	// RecursionAvailable holds the RA flag.
+	RecursionAvailable bool `js:"recursionAvailable"`
+
+	// Zero holds the Z flag, reserved and expected to be unset.
+	Zero bool `js:"zero"`
+
+	// AuthenticatedData holds the AD flag.
+	AuthenticatedData bool `js:"authenticatedData"`
+
+	// CheckingDisabled holds the CD flag.
+	CheckingDisabled bool `js:"checkingDisabled"`
+
+	// Questions holds the questions of the message.
+	Questions []Question `js:"questions"`
+
+	// Answer holds the records of the answer section, in presentation format.
+	Answer []string `js:"answer"`
+
+	// Authority holds the records of the authority section, in presentation format.
+	Authority []string `js:"authority"`
+
+	// Additional holds the records of the additional section, in presentation format,
+	// except for the EDNS pseudo-record.
+	Additional []string `js:"additional"`
+
+	// EDNS holds the EDNS pseudo-record of the message, if any.
+	EDNS *EDNS `js:"edns"`
+}
+
+// Question holds a question of a DNS message.
+type Question struct {
+	// Name holds the queried name.
+	Name string `js:"name"`
+
+	// Type holds the mnemonic of the queried type, such as A or AAAA, or TYPE followed
+	// by its number, as per [RFC3597], if it has none.
+	//
+	// [RFC3597]: https://www.iana.org/go/rfc3597
+	Type string `js:"type"`
+
+	// Class holds the mnemonic of the queried class, or CLASS followed by its number,
+	// as per [RFC3597], if it has none. It defaults to IN.
+	//
+	// [RFC3597]: https://www.iana.org/go/rfc3597
+	Class string `js:"class"`
+}
+
+// EDNS holds the EDNS pseudo-record of a DNS message, as per [RFC6891].
+//
+// [RFC6891]: https://www.iana.org/go/rfc6891
+type EDNS struct {
+	// UDPSize holds the maximum size of UDP responses the sender accepts.
+	UDPSize uint16 `js:"udpSize"`
+
+	// Version holds the EDNS version.
+	Version uint8 `js:"version"`
+
+	// DNSSECOK holds the DO flag.
+	DNSSECOK bool `js:"dnssecOk"`
+
+	// Options holds the EDNS options.
+	Options []EDNSOption `js:"options"`
+}
+
+// EDNSOption holds an EDNS option.
+type EDNSOption struct {
+	// Code holds the option code.
+	Code uint16 `js:"code"`
+
+	// Data holds the hex encoded data of the option.
+	Data string `js:"data"`
+}
+
+// Pack returns the message in wire format.
+func (m Message) Pack() ([]byte, error) {
+	msg, err := m.msg()
+	if err != nil {
+		return nil, err
+	}
+
+	packed, err := msg.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("packing the message failed: %w", err)
+	}
+
+	return packed, nil
+}
+
+// UnpackMessage parses a DNS message in wire format.
+func UnpackMessage(packed []byte) (Message, error) {
+	msg := new(dns.Msg)
+	if err := msg.Unpack(packed); err != nil {
+		return Message{}, fmt.Errorf("unpacking the message failed: %w", err)
+	}
+
+	return newMessage(msg)
+}
+
+// msg converts the message to its miekg/dns representation.
+func (m Message) msg() (*dns.Msg, error) {
+	msg := new(dns.Msg)
+	msg.Id = m.ID
+	msg.Response = m.Response
+	msg.Authoritative = m.Authoritative
+	msg.Truncated = m.Truncated
+	msg.RecursionDesired = m.RecursionDesired
+	msg.RecursionAvailable = m.RecursionAvailable
+	msg.Zero = m.Zero
+	msg.AuthenticatedData = m.AuthenticatedData
+	msg.CheckingDisabled = m.CheckingDisabled
+
+	var err error
+	if msg.Opcode, err = parseCode(m.Opcode, dns.StringToOpcode); err != nil {
+		return nil, fmt.Errorf("invalid opcode: %w", err)
+	}
+
+	if msg.Rcode, err = parseCode(m.Rcode, dns.StringToRcode); err != nil {
+		return nil, fmt.Errorf("invalid rcode: %w", err)
+	}
+
+	for _, question := range m.Questions {
+		q, err := question.question()
+		if err != nil {
+			return nil, err
+		}
+
+		msg.Question = append(msg.Question, q)
+	}
+
+	for _, section := range []struct {
+		name    string
+		records []string
+		dst     *[]dns.RR
+	}{
+		{name: "answer", records: m.Answer, dst: &msg.Answer},
+		{name: "authority", records: m.Authority, dst: &msg.Ns},
+		{name: "additional", records: m.Additional, dst: &msg.Extra},
+	} {
+		for _, record := range section.records {
+			rr, err := dns.NewRR(record)
+			if err == nil && rr == nil {
+				err = errors.New("no record found")
+			}
+
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s record %q: %w", section.name, record, err)
+			}
+
+			*section.dst = append(*section.dst, rr)
+		}
+	}
+
+	if m.EDNS != nil {
+		opt, err := m.EDNS.opt()
+		if err != nil {
+			return nil, err
+		}
+
+		msg.Extra = append(msg.Extra, opt)
+	}
+
+	return msg, nil
+}
+
+// question converts the question to its miekg/dns representation.
+func (q Question) question() (dns.Question, error) {
+	qtype, ok := dns.StringToType[strings.ToUpper(q.Type)]
+	if !ok {
+		code, err := parseGenericCode(q.Type, "TYPE")
+		if err != nil {
+			return dns.Question{}, fmt.Errorf("invalid type %q of question %s: %w", q.Type, q.Name, err)
+		}
+
+		qtype = code
+	}
+
+	qclass := uint16(dns.ClassINET)
+	if q.Class != "" {
+		var ok bool
+		if qclass, ok = dns.StringToClass[strings.ToUpper(q.Class)]; !ok {
+			code, err := parseGenericCode(q.Class, "CLASS")
+			if err != nil {
+				return dns.Question{}, fmt.Errorf("invalid class %q of question %s: %w", q.Class, q.Name, err)
+			}
+
+			qclass = code
+		}
+	}
+
+	return dns.Question{Name: dns.Fqdn(q.Name), Qtype: qtype, Qclass: qclass}, nil
+}
+
+// opt converts the EDNS pseudo-record to its miekg/dns representation.
+func (e EDNS) opt() (*dns.OPT, error) {
+	opt := &dns.OPT{Hdr: dns.RR_Header{Name: ".", Rrtype: dns.TypeOPT}}
+	opt.SetUDPSize(e.UDPSize)
+	opt.SetVersion(e.Version)
+	opt.SetDo(e.DNSSECOK)
+
+	for _, option := range e.Options {
+		data, err := hex.DecodeString(option.Data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid data of EDNS option %d: %w", option.Code, err)
+		}
+
+		opt.Option = append(opt.Option, &dns.EDNS0_LOCAL{Code: option.Code, Data: data})
+	}
+
+	return opt, nil
+}
+
+// newMessage converts a miekg/dns message.
+func newMessage(msg *dns.Msg) (Message, error) {
+	m := Message{
+		ID:                 msg.Id,
+		Response:           msg.Response,
+		Opcode:             codeString(msg.Opcode, dns.OpcodeToString),
+		Rcode:              codeString(msg.Rcode, dns.RcodeToString),
+		Authoritative:      msg.Authoritative,
+		Truncated:          msg.Truncated,
+		RecursionDesired:   msg.RecursionDesired,
+		RecursionAvailable: msg.RecursionAvailable,
+		Zero:               msg.Zero,
+		AuthenticatedData:  msg.AuthenticatedData,
+		CheckingDisabled:   msg.CheckingDisabled,
+		Questions:          make([]Question, 0, len(msg.Question)),
+		Answer:             presentRecords(msg.Answer),
+		Authority:          presentRecords(msg.Ns),
+		Additional:         make([]string, 0, len(msg.Extra)),
+	}
+
+	for _, q := range msg.Question {
+		m.Questions = append(m.Questions, Question{
+			Name:  q.Name,
+			Type:  dns.Type(q.Qtype).String(),
+			Class: dns.Class(q.Qclass).String(),
+		})
+	}
+
+	for _, rr := range msg.Extra {
+		opt, ok := rr.(*dns.OPT)
+		if !ok || m.EDNS != nil {
+			m.Additional = append(m.Additional, rr.String())
+			continue
+		}
+
+		edns, err := newEDNS(opt)
+		if err != nil {
+			return Message{}, err
+		}
+
+		m.EDNS = edns
+	}
+
+	return m, nil
+}
+
+// newEDNS converts a miekg/dns OPT record.
+func newEDNS(opt *dns.OPT) (*EDNS, error) {
+	edns := &EDNS{
+		UDPSize:  opt.UDPSize(),
+		Version:  opt.Version(),
+		DNSSECOK: opt.Do(),
+		Options:  make([]EDNSOption, 0, len(opt.Option)),
+	}
+
+	// The data of the options miekg/dns knows about is only available in their
+	// parsed form, thus we read it from the packed record instead.
+	packed := make([]byte, dns.Len(opt))
+	end, err := dns.PackRR(opt, packed, 0, nil, false)
+	if err != nil {
+		return nil, fmt.Errorf("reading the EDNS options failed: %w", err)
+	}
+
+	// The packed record starts with the root name, its type, class and TTL, and the
+	// length of its data.
+	const rdataOffset = 1 + 2 + 2 + 4 + 2
+
+	rdata := packed[rdataOffset:end]
+	for len(rdata) >= 4 {
+		code := binary.BigEndian.Uint16(rdata)
+		length := int(binary.BigEndian.Uint16(rdata[2:]))
+		if len(rdata) < 4+length {
+			break
+		}
+
+		edns.Options = append(edns.Options, EDNSOption{Code: code, Data: hex.EncodeToString(rdata[4 : 4+length])})
+		rdata = rdata[4+length:]
+	}
+
+	return edns, nil
+}
+
+// presentRecords returns the records in presentation format.
+func presentRecords(records []dns.RR) []string {
+	presented := make([]string, 0, len(records))
+	for _, rr := range records {
+		presented = append(presented, rr.String())
+	}
+
+	return presented
+}
+
+// parseCode parses an opcode or response code, either from its mnemonic, found in
+// the mnemonics, or from its number. An empty value parses to 0.
+func parseCode(value string, mnemonics map[string]int) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	if code, ok := mnemonics[strings.ToUpper(value)]; ok {
+		return code, nil
+	}
+
+	code, err := strconv.ParseUint(value, 10, 12)
+	if err != nil {
+		return 0, fmt.Errorf("unknown code %q", value)
+	}
+
+	return int(code), nil
+}
+
+// codeString returns the mnemonic of an opcode or response code, or its number if
+// it has none.
+func codeString(code int, mnemonics map[int]string) string {
+	if mnemonic, ok := mnemonics[code]; ok {
+		return mnemonic
+	}
+
+	return strconv.Itoa(code)
+}
+
+// parseGenericCode parses a type or class number in the generic TYPE123 or CLASS123
+// notation of RFC 3597.
+func parseGenericCode(value, prefix string) (uint16, error) {
+	digits, ok := strings.CutPrefix(strings.ToUpper(value), prefix)
+	if !ok {
+		return 0, fmt.Errorf("expected a mnemonic, or the %s123 notation", prefix)
+	}
+
+	code, err := strconv.ParseUint(digits, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s number: %w", strings.ToLower(prefix), err)
+	}
+
+	return uint16(code), nil
+}
@@ -0,0 +1,102 @@
+package dns
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessage_Pack(t *testing.T) {
+	t.Parallel()
+
+	t.Run("crafted messages survive a round trip", func(t *testing.T) {
+		t.Parallel()
+
+		message := Message{
+			ID:                1234,
+			Opcode:            "NOTIFY",
+			Rcode:             "BADCOOKIE",
+			Authoritative:     true,
+			Zero:              true,
+			CheckingDisabled:  true,
+			Questions:         []Question{{Name: "k6.test", Type: "SOA"}, {Name: "www.k6.test.", Type: "TYPE65280", Class: "CH"}},
+			Answer:            []string{"k6.test. 300 IN SOA ns.k6.test. admin.k6.test. 7 3600 600 86400 300"},
+			Additional:        []string{"www.k6.test. 60 IN A " + primaryTestIPv4},
+			EDNS:              &EDNS{UDPSize: 1232, DNSSECOK: true, Options: []EDNSOption{{Code: 10, Data: "0102030405060708"}}},
+			AuthenticatedData: true,
+		}
+
+		packed, err := message.Pack()
+		require.NoError(t, err)
+
+		unpacked, err := UnpackMessage(packed)
+		require.NoError(t, err)
+
+		assert.Equal(t, uint16(1234), unpacked.ID)
+		assert.Equal(t, "NOTIFY", unpacked.Opcode)
+		assert.Equal(t, "BADCOOKIE", unpacked.Rcode)
+		assert.True(t, unpacked.Authoritative)
+		assert.True(t, unpacked.Zero)
+		assert.True(t, unpacked.CheckingDisabled)
+		assert.True(t, unpacked.AuthenticatedData)
+		assert.False(t, unpacked.Response)
+		assert.Equal(t, []Question{
+			{Name: "k6.test.", Type: "SOA", Class: "IN"},
+			{Name: "www.k6.test.", Type: "TYPE65280", Class: "CH"},
+		}, unpacked.Questions)
+		assert.Len(t, unpacked.Answer, 1)
+		assert.Empty(t, unpacked.Authority)
+		assert.Equal(t, []string{"www.k6.test.\t60\tIN\tA\t" + primaryTestIPv4}, unpacked.Additional)
+		assert.Equal(t, &EDNS{
+			UDPSize:  1232,
+			DNSSECOK: true,
+			Options:  []EDNSOption{{Code: 10, Data: "0102030405060708"}},
+		}, unpacked.EDNS)
+	})
+
+	t.Run("unassigned opcodes and response codes are given by number", func(t *testing.T) {
+		t.Parallel()
+
+		packed, err := Message{Opcode: "3", Rcode: "12"}.Pack()
+		require.NoError(t, err)
+
+		unpacked, err := UnpackMessage(packed)
+		require.NoError(t, err)
+
+		assert.Equal(t, "3", unpacked.Opcode)
+		assert.Equal(t, "12", unpacked.Rcode)
+		assert.Empty(t, unpacked.Questions)
+	})
+
+	t.Run("invalid messages are rejected", func(t *testing.T) {
+		t.Parallel()
+
+		for _, message := range []Message{
+			{Opcode: "SHOUT"},
+			{Rcode: "BADCOOKIE"},
+			{Questions: []Question{{Name: "k6.test", Type: "NOPE"}}},
+			{Questions: []Question{{Name: "k6.test", Type: "A", Class: "CLASSX"}}},
+			{Answer: []string{"not a record"}},
+			{Authority: []string{""}},
+			{EDNS: &EDNS{Options: []EDNSOption{{Code: 10, Data: "not hex"}}}},
+		} {
+			_, err := message.Pack()
+			assert.Error(t, err, "%+v", message)
+		}
+	})
+
+	t.Run("truncated messages fail to unpack", func(t *testing.T) {
+		t.Parallel()
+
+		query := new(dns.Msg)
+		query.SetQuestion("k6.test.", dns.TypeA)
+
+		packed, err := query.Pack()
+		require.NoError(t, err)
+
+		_, err = UnpackMessage(packed[:len(packed)-3])
+		assert.Error(t, err)
+	})
+}
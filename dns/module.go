@@ -5,11 +5,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"go.k6.io/k6/js/common"
 	"go.k6.io/k6/js/modules"
 	"go.k6.io/k6/js/promises"
+	"go.k6.io/k6/lib/types"
 	"go.k6.io/k6/metrics"
 
 	"github.com/grafana/sobek"
@@ -17,16 +21,63 @@ import (
 
 type (
 	// RootModule is the module that will be registered with the runtime.
-	RootModule struct{}
+	RootModule struct {
+		// shared holds the resources shared by all VUs' clients, such as the
+		// connections and cache used in the shared connection reuse and cache modes.
+		shared     *sharedResources
+		sharedOnce sync.Once
+
+		// testEndOnce ensures the resources shared by the VUs, such as their clients'
+		// recordings and pooled connections, are closed once the test ends.
+		testEndOnce sync.Once
+
+		// engine holds the query engine shared by all VUs' dns.fire calls.
+		engine     *queryEngine
+		engineOnce sync.Once
+
+		// servers holds the servers started by the VUs, by address, for them to be
+		// stopped by another VU, such as servers started in setup() and stopped in
+		// teardown().
+		servers sync.Map
+
+		// files holds the files parsed in the init context, such as the workloads
+		// and captures loaded by dns.loadQueryFile and dns.loadCapture, by key, for
+		// every VU to share the same read-only copy, as SharedArray does.
+		files   map[string]any
+		filesMu sync.Mutex
+	}
 
 	// ModuleInstance is the module instance that will be created for each VU.
 	ModuleInstance struct {
+		root      *RootModule
 		vu        modules.VU
 		dnsClient *Client
 		metrics   *moduleInstanceMetrics
+
+		// lastIteration holds the iteration the client's connections were last
+		// used in, and is used to honor k6's noVUConnectionReuse option.
+		lastIteration int64
+
+		// connectionsCtx holds the VU context the client's connections are closed
+		// once done with. It is replaced by each new context the VU runs with, such
+		// as the context of each scenario it runs.
+		connectionsCtx context.Context //nolint:containedctx // only awaited, to close the connections
+
+		// recordingFailed is true once the VU logged a failure to record an exchange,
+		// for further failures not to flood the logs.
+		recordingFailed atomic.Bool
+
+		// detachedHandlersMu serializes the calls of the server handlers running
+		// outside of the VU's event loop, as they share its runtime.
+		detachedHandlersMu sync.Mutex
 	}
 )
 
+// defaultClientOptions holds the default options of the clients created by the module.
+var defaultClientOptions = ClientOptions{ //nolint:gochecknoglobals
+	ConnectionReuse: ConnectionReuseVU,
+}
+
 // Ensure the interfaces are implemented correctly
 var (
 	_ modules.Instance = &ModuleInstance{}
@@ -45,23 +96,166 @@ func (rm *RootModule) NewModuleInstance(vu modules.VU) modules.Instance {
 		common.Throw(vu.Runtime(), fmt.Errorf("failed to register dns module instance's metrics; reason: %w", err))
 	}
 
+	rm.testEndOnce.Do(func() {
+		rm.closeAtTestEnd(vu)
+	})
+
 	return &ModuleInstance{
+		root:      rm,
 		vu:        vu,
-		dnsClient: NewDNSClient(),
+		dnsClient: newClient(defaultClientOptions, rm.sharedResources()),
 		metrics:   instanceMetrics,
 	}
 }
 
+// testEndEvent and exitEvent are the types of the global events k6 emits once the test
+// ends, and before it exits, even if the test was aborted. k6 declares them in an
+// internal package, thus they are mirrored here.
+const (
+	testEndEvent = 3
+	exitEvent    = 6
+)
+
+// closeAtTestEnd closes the resources shared by the VUs once the test ends: the
+// recordings of their clients, for their files to be flushed, and dnstap collectors to
+// see their streams stop, before k6 exits, the connections of their shared pool, the
+// SIG(0) keys they parsed, and the sockets of the query engine used by dns.fire.
+func (rm *RootModule) closeAtTestEnd(vu modules.VU) {
+	events := vu.Events().Global
+	if events == nil {
+		return
+	}
+
+	logger := vu.InitEnv().Logger
+	subID, eventsCh := events.Subscribe(testEndEvent, exitEvent)
+
+	go func() {
+		defer events.Unsubscribe(subID)
+
+		for event := range eventsCh {
+			shared := rm.sharedResources()
+			if err := shared.recorders.close(); err != nil {
+				logger.WithError(err).Warn("closing the recordings of DNS exchanges failed")
+			}
+
+			shared.pool.close()
+			shared.sig0Keys.clear()
+			rm.queryEngine().close()
+
+			event.Done()
+
+			if event.Type == exitEvent {
+				return
+			}
+		}
+	}()
+}
+
+// sharedResources returns the resources shared by all the VUs' clients.
+func (rm *RootModule) sharedResources() *sharedResources {
+	rm.sharedOnce.Do(func() {
+		rm.shared = newSharedResources()
+	})
+
+	return rm.shared
+}
+
+// queryEngine returns the query engine shared by all the VUs.
+func (rm *RootModule) queryEngine() *queryEngine {
+	rm.engineOnce.Do(func() {
+		rm.engine = newQueryEngine()
+	})
+
+	return rm.engine
+}
+
+// loadFile returns the file parsed under the key, parsing it using load if no VU did
+// yet.
+func (rm *RootModule) loadFile(key string, load func() (any, error)) (any, error) {
+	rm.filesMu.Lock()
+	defer rm.filesMu.Unlock()
+
+	if file, ok := rm.files[key]; ok {
+		return file, nil
+	}
+
+	file, err := load()
+	if err != nil {
+		return nil, err
+	}
+
+	if rm.files == nil {
+		rm.files = make(map[string]any)
+	}
+
+	rm.files[key] = file
+
+	return file, nil
+}
+
 // Exports returns the module exports, that will be available in the runtime.
 func (mi *ModuleInstance) Exports() modules.Exports {
 	return modules.Exports{Named: map[string]interface{}{
-		"resolve": mi.Resolve,
-		"lookup":  mi.Lookup,
+		"configure":      mi.Configure,
+		"resolve":        mi.Resolve,
+		"lookup":         mi.Lookup,
+		"fire":           mi.Fire,
+		"trace":          mi.Trace,
+		"transfer":       mi.Transfer,
+		"streamTransfer": mi.StreamTransfer,
+		"update":         mi.Update,
+		"notify":         mi.Notify,
+		"exchange":       mi.Exchange,
+		"pack":           mi.Pack,
+		"unpack":         mi.Unpack,
+		"fuzz":           mi.Fuzz,
+		"mutate":         mi.Mutate,
+		"Server":         mi.NewServer,
+		"stopServer":     mi.StopServer,
+		"loadQueryFile":  mi.LoadQueryFile,
+		"loadCapture":    mi.LoadCapture,
+		"replay":         mi.Replay,
+
+		"daysUntilExpiration": mi.DaysUntilExpiration,
 	}}
 }
 
+// Configure replaces the default options of the VU's client, used by every operation
+// unless overridden by the options of a call, such as the local address or network
+// interface queries are sent from, or the TSIG key they are signed with.
+//
+// It accepts the same options as Resolve, and can only be used in the init context,
+// before the client sends any query.
+func (mi *ModuleInstance) Configure(options sobek.Value) error {
+	if mi.vu.State() != nil {
+		return errors.New("configure can only be used in the init context")
+	}
+
+	clientOptions := defaultClientOptions
+	if !common.IsNullish(options) {
+		if err := mi.vu.Runtime().ExportTo(options, &clientOptions); err != nil {
+			return fmt.Errorf("options must be an object; got %v instead", options)
+		}
+
+		if err := parseChaosDurations(mi.vu.Runtime(), options, &clientOptions.Chaos); err != nil {
+			return err
+		}
+	}
+
+	if err := clientOptions.Validate(); err != nil {
+		return fmt.Errorf("invalid options: %w", err)
+	}
+
+	mi.dnsClient = newClient(clientOptions, mi.root.sharedResources())
+
+	return nil
+}
+
 // Resolve resolves a domain name to an IP address.
-func (mi *ModuleInstance) Resolve(query, recordType, nameserverAddr sobek.Value) *sobek.Promise {
+//
+// The optional options argument allows to override the client's default options
+// for this specific resolution.
+func (mi *ModuleInstance) Resolve(query, recordType, nameserverAddr, options sobek.Value) *sobek.Promise {
 	promise, resolve, reject := promises.New(mi.vu)
 
 	if mi.vu.State() == nil {
@@ -98,16 +292,47 @@ func (mi *ModuleInstance) Resolve(query, recordType, nameserverAddr sobek.Value)
 		return promise
 	}
 
+	clientOptions := mi.dnsClient.Options()
+	if !common.IsNullish(options) {
+		if err := mi.vu.Runtime().ExportTo(options, &clientOptions); err != nil {
+			reject(fmt.Errorf("options must be an object; got %v instead", options))
+			return promise
+		}
+
+		overrideSource(mi.vu.Runtime(), options, &clientOptions)
+
+		if err := parseChaosDurations(mi.vu.Runtime(), options, &clientOptions.Chaos); err != nil {
+			reject(err)
+			return promise
+		}
+	}
+
+	if err := clientOptions.Validate(); err != nil {
+		reject(fmt.Errorf("invalid options: %w", err))
+		return promise
+	}
+
+	clientOptions.ConnectionReuse = mi.connectionReuseMode(clientOptions.ConnectionReuse)
+
 	go func() {
 		// Start timer for resolution
 		resolutionStartTime := time.Now()
 
 		// Resolve the query
-		fetchedIPs, resolveErr := mi.dnsClient.Resolve(mi.vu.Context(), queryStr, recordTypeStr, nameserver)
+		resolution, resolveErr := mi.dnsClient.ResolveWithOptions(
+			mi.vu.Context(),
+			queryStr,
+			recordTypeStr,
+			nameserver,
+			clientOptions,
+		)
 
 		// Stop the timer for resolution
 		sinceResolutionStart := time.Since(resolutionStartTime).Milliseconds()
 
+		// Recording failures don't fail the resolution
+		mi.logRecordingFailure(resolution.RecordingErr)
+
 		// Emit the metrics, regardless of the result
 		mi.emitResolutionMetrics(
 			mi.vu.Context(),
@@ -115,6 +340,7 @@ func (mi *ModuleInstance) Resolve(query, recordType, nameserverAddr sobek.Value)
 			queryStr,
 			recordTypeStr,
 			nameserver,
+			resolution,
 			resolveErr,
 		)
 
@@ -124,12 +350,184 @@ func (mi *ModuleInstance) Resolve(query, recordType, nameserverAddr sobek.Value)
 			return
 		}
 
-		resolve(fetchedIPs)
+		// DNSSEC validating resolutions also report the outcome of the validation
+		if resolution.DNSSEC != nil {
+			resolve(validatedResolution{
+				IPs:     resolution.IPs,
+				Records: resolution.Records,
+				DNSSEC: dnssecResult{
+					Status: string(resolution.DNSSEC.Status),
+					Reason: resolution.DNSSEC.Reason,
+					Denial: resolution.DNSSEC.Denial,
+				},
+			})
+			return
+		}
+
+		// DNSSEC record types resolve to structured records rather than IPs
+		if concreteType, _ := RecordTypeString(recordTypeStr); !concreteType.isAddress() {
+			resolve(resolution.Records)
+			return
+		}
+
+		resolve(resolution.IPs)
 	}()
 
 	return promise
 }
 
+// logRecordingFailure logs the error recording an exchange failed with, if not nil. Only
+// the VU's first failure is logged, for further failures not to flood the logs.
+func (mi *ModuleInstance) logRecordingFailure(err error) {
+	if err == nil || mi.recordingFailed.Swap(true) {
+		return
+	}
+
+	if state := mi.vu.State(); state != nil {
+		state.Logger.WithError(err).
+			Warn("recording a DNS exchange failed; further recording failures of this VU aren't logged")
+	}
+}
+
+// overrideSource ensures the local address, or network interface, set by the options
+// of a call replace the one set by the client's default options, rather than conflict
+// with it.
+func overrideSource(rt *sobek.Runtime, options sobek.Value, clientOptions *ClientOptions) {
+	obj := options.ToObject(rt)
+	hasLocalAddress := !common.IsNullish(obj.Get("localAddress"))
+	hasInterface := !common.IsNullish(obj.Get("interface"))
+
+	switch {
+	case hasLocalAddress && !hasInterface:
+		clientOptions.Interface = ""
+	case hasInterface && !hasLocalAddress:
+		clientOptions.LocalAddress = ""
+	}
+}
+
+// parseChaosDurations parses the durations of the chaos options of a dns.resolve call,
+// which are expressed either as a number of milliseconds, or as a duration string.
+func parseChaosDurations(rt *sobek.Runtime, options sobek.Value, chaos *ChaosOptions) error {
+	chaosValue := options.ToObject(rt).Get("chaos")
+	if common.IsNullish(chaosValue) {
+		return nil
+	}
+
+	if err := parseDurations(rt, chaosValue, map[string]*time.Duration{
+		"timeout": &chaos.Timeout,
+	}); err != nil {
+		return fmt.Errorf("invalid chaos options: %w", err)
+	}
+
+	latencyValue := chaosValue.ToObject(rt).Get("latency")
+	if common.IsNullish(latencyValue) {
+		return nil
+	}
+
+	if err := parseDurations(rt, latencyValue, map[string]*time.Duration{
+		"mean":   &chaos.Latency.Mean,
+		"stdDev": &chaos.Latency.StdDev,
+		"min":    &chaos.Latency.Min,
+		"max":    &chaos.Latency.Max,
+	}); err != nil {
+		return fmt.Errorf("invalid chaos latency options: %w", err)
+	}
+
+	return nil
+}
+
+// parseDurations parses the durations held by the object's properties into their
+// destination.
+func parseDurations(rt *sobek.Runtime, object sobek.Value, durations map[string]*time.Duration) error {
+	obj := object.ToObject(rt)
+	for name, dst := range durations {
+		value := obj.Get(name)
+		if common.IsNullish(value) {
+			continue
+		}
+
+		duration, err := types.GetDurationValue(value.Export())
+		if err != nil {
+			return fmt.Errorf("invalid %s option: %w", name, err)
+		}
+
+		*dst = duration
+	}
+
+	return nil
+}
+
+// validatedResolution is the JS representation of a DNSSEC validating resolution.
+type validatedResolution struct {
+	IPs     []string     `js:"ips"`
+	Records []any        `js:"records"`
+	DNSSEC  dnssecResult `js:"dnssec"`
+}
+
+// DaysUntilExpiration returns the number of days remaining before an RRSIG record,
+// as resolved by Resolve, expires. It is negative once the signature has expired.
+func (mi *ModuleInstance) DaysUntilExpiration(rrsig sobek.Value) (float64, error) {
+	if common.IsNullish(rrsig) {
+		return 0, errors.New("rrsig argument must be provided")
+	}
+
+	var record RRSIGRecord
+	if err := mi.vu.Runtime().ExportTo(rrsig, &record); err != nil {
+		return 0, fmt.Errorf("rrsig must be an RRSIG record; got %v instead", rrsig)
+	}
+
+	if record.Type != RecordTypeRRSIG.String() {
+		return 0, fmt.Errorf("rrsig must be an RRSIG record; got a %q record instead", record.Type)
+	}
+
+	return record.DaysUntilExpiration(time.Now()), nil
+}
+
+// dnssecResult is the JS representation of a DNSSECResult.
+type dnssecResult struct {
+	Status string       `js:"status"`
+	Reason string       `js:"reason"`
+	Denial *DenialProof `js:"denial"`
+}
+
+// connectionReuseMode returns the connection reuse mode to use instead of the requested
+// one, to honor k6's noConnectionReuse and noVUConnectionReuse options.
+//
+// As connections shared between VUs can't be dropped at the end of a single VU's
+// iteration, the shared mode falls back to per VU reuse when noVUConnectionReuse is set.
+func (mi *ModuleInstance) connectionReuseMode(requested ConnectionReuseMode) ConnectionReuseMode {
+	state := mi.vu.State()
+
+	// Ensure the connections kept open by this VU get closed once it's done with
+	// its current context.
+	if ctx := mi.vu.Context(); ctx != mi.connectionsCtx {
+		mi.connectionsCtx = ctx
+		go func() {
+			<-ctx.Done()
+			mi.dnsClient.CloseConnections()
+		}()
+	}
+
+	if state.Options.NoConnectionReuse.Bool {
+		return ConnectionReuseNone
+	}
+
+	if !state.Options.NoVUConnectionReuse.Bool {
+		return requested
+	}
+
+	if state.Iteration != mi.lastIteration {
+		mi.dnsClient.CloseConnections()
+		mi.lastIteration = state.Iteration
+	}
+
+	if requested == ConnectionReuseShared {
+		return ConnectionReuseVU
+	}
+
+	return requested
+}
+
 // Lookup resolves a domain name to an IP address using the default system nameservers.
 func (mi *ModuleInstance) Lookup(hostname sobek.Value) *sobek.Promise {
 	promise, resolve, reject := promises.New(mi.vu)
@@ -195,6 +593,141 @@ func registerMetrics(registry *metrics.Registry) (*moduleInstanceMetrics, error)
 		return nil, fmt.Errorf("failed registering dns_resolution_failed metric: %w", err)
 	}
 
+	m.DNSResponseMismatch, err = registry.NewMetric("dns_response_mismatch", metrics.Counter)
+	if err != nil {
+		return nil, fmt.Errorf("failed registering dns_response_mismatch metric: %w", err)
+	}
+
+	m.DNSInvalidResponses, err = registry.NewMetric("dns_invalid_responses", metrics.Rate)
+	if err != nil {
+		return nil, fmt.Errorf("failed registering dns_invalid_responses metric: %w", err)
+	}
+
+	m.DNSDNSSECBogus, err = registry.NewMetric("dns_dnssec_bogus", metrics.Rate)
+	if err != nil {
+		return nil, fmt.Errorf("failed registering dns_dnssec_bogus metric: %w", err)
+	}
+
+	m.DNSDNSSECInvalidDenials, err = registry.NewMetric("dns_dnssec_invalid_denials", metrics.Rate)
+	if err != nil {
+		return nil, fmt.Errorf("failed registering dns_dnssec_invalid_denials metric: %w", err)
+	}
+
+	m.DNSCacheHits, err = registry.NewMetric("dns_cache_hits", metrics.Counter)
+	if err != nil {
+		return nil, fmt.Errorf("failed registering dns_cache_hits metric: %w", err)
+	}
+
+	m.DNSCacheMisses, err = registry.NewMetric("dns_cache_misses", metrics.Counter)
+	if err != nil {
+		return nil, fmt.Errorf("failed registering dns_cache_misses metric: %w", err)
+	}
+
+	m.DNSInjectedFaults, err = registry.NewMetric("dns_injected_faults", metrics.Counter)
+	if err != nil {
+		return nil, fmt.Errorf("failed registering dns_injected_faults metric: %w", err)
+	}
+
+	m.DNSTraceDuration, err = registry.NewMetric("dns_trace_duration", metrics.Trend, metrics.Time)
+	if err != nil {
+		return nil, fmt.Errorf("failed registering dns_trace_duration metric: %w", err)
+	}
+
+	m.DNSTraceQueries, err = registry.NewMetric("dns_trace_queries", metrics.Trend)
+	if err != nil {
+		return nil, fmt.Errorf("failed registering dns_trace_queries metric: %w", err)
+	}
+
+	m.DNSTraceFailed, err = registry.NewMetric("dns_trace_failed", metrics.Rate)
+	if err != nil {
+		return nil, fmt.Errorf("failed registering dns_trace_failed metric: %w", err)
+	}
+
+	m.DNSTransferDuration, err = registry.NewMetric("dns_transfer_duration", metrics.Trend, metrics.Time)
+	if err != nil {
+		return nil, fmt.Errorf("failed registering dns_transfer_duration metric: %w", err)
+	}
+
+	m.DNSTransferMessages, err = registry.NewMetric("dns_transfer_messages", metrics.Counter)
+	if err != nil {
+		return nil, fmt.Errorf("failed registering dns_transfer_messages metric: %w", err)
+	}
+
+	m.DNSTransferBytes, err = registry.NewMetric("dns_transfer_bytes", metrics.Counter, metrics.Data)
+	if err != nil {
+		return nil, fmt.Errorf("failed registering dns_transfer_bytes metric: %w", err)
+	}
+
+	m.DNSTransferFailed, err = registry.NewMetric("dns_transfer_failed", metrics.Rate)
+	if err != nil {
+		return nil, fmt.Errorf("failed registering dns_transfer_failed metric: %w", err)
+	}
+
+	m.DNSUpdates, err = registry.NewMetric("dns_updates", metrics.Counter)
+	if err != nil {
+		return nil, fmt.Errorf("failed registering dns_updates metric: %w", err)
+	}
+
+	m.DNSUpdateDuration, err = registry.NewMetric("dns_update_duration", metrics.Trend, metrics.Time)
+	if err != nil {
+		return nil, fmt.Errorf("failed registering dns_update_duration metric: %w", err)
+	}
+
+	m.DNSUpdateFailed, err = registry.NewMetric("dns_update_failed", metrics.Rate)
+	if err != nil {
+		return nil, fmt.Errorf("failed registering dns_update_failed metric: %w", err)
+	}
+
+	m.DNSNotifyDuration, err = registry.NewMetric("dns_notify_duration", metrics.Trend, metrics.Time)
+	if err != nil {
+		return nil, fmt.Errorf("failed registering dns_notify_duration metric: %w", err)
+	}
+
+	m.DNSNotifyPropagation, err = registry.NewMetric("dns_notify_propagation", metrics.Trend, metrics.Time)
+	if err != nil {
+		return nil, fmt.Errorf("failed registering dns_notify_propagation metric: %w", err)
+	}
+
+	m.DNSNotifyFailed, err = registry.NewMetric("dns_notify_failed", metrics.Rate)
+	if err != nil {
+		return nil, fmt.Errorf("failed registering dns_notify_failed metric: %w", err)
+	}
+
+	m.DNSExchanges, err = registry.NewMetric("dns_exchanges", metrics.Counter)
+	if err != nil {
+		return nil, fmt.Errorf("failed registering dns_exchanges metric: %w", err)
+	}
+
+	m.DNSExchangeDuration, err = registry.NewMetric("dns_exchange_duration", metrics.Trend, metrics.Time)
+	if err != nil {
+		return nil, fmt.Errorf("failed registering dns_exchange_duration metric: %w", err)
+	}
+
+	m.DNSExchangeFailed, err = registry.NewMetric("dns_exchange_failed", metrics.Rate)
+	if err != nil {
+		return nil, fmt.Errorf("failed registering dns_exchange_failed metric: %w", err)
+	}
+
+	m.DNSFuzzCases, err = registry.NewMetric("dns_fuzz_cases", metrics.Counter)
+	if err != nil {
+		return nil, fmt.Errorf("failed registering dns_fuzz_cases metric: %w", err)
+	}
+
+	m.DNSFuzzUnhealthy, err = registry.NewMetric("dns_fuzz_unhealthy", metrics.Rate)
+	if err != nil {
+		return nil, fmt.Errorf("failed registering dns_fuzz_unhealthy metric: %w", err)
+	}
+
+	m.DNSServerQueries, err = registry.NewMetric("dns_server_queries", metrics.Counter)
+	if err != nil {
+		return nil, fmt.Errorf("failed registering dns_server_queries metric: %w", err)
+	}
+
+	m.DNSServerDuration, err = registry.NewMetric("dns_server_duration", metrics.Trend, metrics.Time)
+	if err != nil {
+		return nil, fmt.Errorf("failed registering dns_server_duration metric: %w", err)
+	}
+
 	m.DNSLookups, err = registry.NewMetric("dns_lookups", metrics.Counter)
 	if err != nil {
 		return nil, fmt.Errorf("failed registering dns_lookups metric: %w", err)
@@ -220,6 +753,7 @@ func (mi *ModuleInstance) emitResolutionMetrics(
 	query,
 	recordType string,
 	nameserver Nameserver,
+	resolution Resolution,
 	resolutionErr error,
 ) {
 	state := mi.vu.State()
@@ -229,6 +763,14 @@ func (mi *ModuleInstance) emitResolutionMetrics(
 	tags = tags.With("recordType", recordType)
 	tags = tags.With("nameserver", nameserver.Addr())
 
+	// Resolutions faults could be injected in are tagged, for them to be told apart
+	if resolution.ChaosUsed {
+		tags = tags.With("injected", strconv.FormatBool(len(resolution.Faults) > 0))
+		if len(resolution.Faults) > 0 {
+			tags = tags.With("fault", faultsTag(resolution.Faults))
+		}
+	}
+
 	now := time.Now()
 
 	// Increment the DNS lookups counter
@@ -268,6 +810,109 @@ func (mi *ModuleInstance) emitResolutionMetrics(
 		Value:    failed,
 		Metadata: nil,
 	})
+
+	// Emit the DNS invalid responses rate, if the response was validated
+	if resolution.Validated {
+		var invalid float64
+		if len(resolution.Violations) > 0 {
+			invalid = 1
+		}
+
+		metrics.PushIfNotDone(ctx, state.Samples, metrics.Sample{
+			TimeSeries: metrics.TimeSeries{
+				Metric: mi.metrics.DNSInvalidResponses,
+				Tags:   tags,
+			},
+			Time:     now,
+			Value:    invalid,
+			Metadata: nil,
+		})
+	}
+
+	// Increment the DNS cache hits or misses counter, if the resolution was looked up in a cache
+	if resolution.CacheUsed {
+		cacheMetric := mi.metrics.DNSCacheMisses
+		if resolution.CacheHit {
+			cacheMetric = mi.metrics.DNSCacheHits
+		}
+
+		metrics.PushIfNotDone(ctx, state.Samples, metrics.Sample{
+			TimeSeries: metrics.TimeSeries{
+				Metric: cacheMetric,
+				Tags:   tags,
+			},
+			Time:     now,
+			Value:    float64(1),
+			Metadata: nil,
+		})
+	}
+
+	// Increment the injected faults counter, once per fault
+	for _, fault := range resolution.Faults {
+		metrics.PushIfNotDone(ctx, state.Samples, metrics.Sample{
+			TimeSeries: metrics.TimeSeries{
+				Metric: mi.metrics.DNSInjectedFaults,
+				Tags:   tags.With("fault", string(fault)),
+			},
+			Time:     now,
+			Value:    float64(1),
+			Metadata: nil,
+		})
+	}
+
+	// Emit the DNSSEC bogus answers rate, if the response was DNSSEC validated
+	if resolution.DNSSEC != nil {
+		var bogus float64
+		if resolution.DNSSEC.Status == DNSSECBogus {
+			bogus = 1
+		}
+
+		metrics.PushIfNotDone(ctx, state.Samples, metrics.Sample{
+			TimeSeries: metrics.TimeSeries{
+				Metric: mi.metrics.DNSDNSSECBogus,
+				Tags:   tags,
+			},
+			Time:     now,
+			Value:    bogus,
+			Metadata: nil,
+		})
+	}
+
+	if resolution.DNSSEC != nil && resolution.DNSSEC.Denial != nil {
+		var invalid float64
+		if !resolution.DNSSEC.Denial.Covered {
+			invalid = 1
+		}
+
+		metrics.PushIfNotDone(ctx, state.Samples, metrics.Sample{
+			TimeSeries: metrics.TimeSeries{
+				Metric: mi.metrics.DNSDNSSECInvalidDenials,
+				Tags:   tags,
+			},
+			Time:     now,
+			Value:    invalid,
+			Metadata: nil,
+		})
+	}
+
+	// Increment the DNS response mismatch counter, once per response skipped because of
+	// its ID, and once more if the response didn't match the query
+	mismatches := resolution.Mismatches
+	if errors.Is(resolutionErr, ErrResponseMismatch) {
+		mismatches++
+	}
+
+	if mismatches > 0 {
+		metrics.PushIfNotDone(ctx, state.Samples, metrics.Sample{
+			TimeSeries: metrics.TimeSeries{
+				Metric: mi.metrics.DNSResponseMismatch,
+				Tags:   tags,
+			},
+			Time:     now,
+			Value:    float64(mismatches),
+			Metadata: nil,
+		})
+	}
 }
 
 // emitLookupMetrics emits the metrics specific to DNS lookup operations.
@@ -334,6 +979,89 @@ type moduleInstanceMetrics struct {
 	// DNSResolutionFailed is a Rate metric tracking the rate of failed DNS resolutions.
 	DNSResolutionFailed *metrics.Metric
 
+	// DNSResponseMismatch is a counter metric tracking the number of responses not matching their query.
+	DNSResponseMismatch *metrics.Metric
+
+	// DNSInvalidResponses is a Rate metric tracking the rate of responses failing validation.
+	DNSInvalidResponses *metrics.Metric
+
+	// DNSDNSSECBogus is a Rate metric tracking the rate of DNSSEC validated answers found bogus.
+	DNSDNSSECBogus *metrics.Metric
+
+	// DNSDNSSECInvalidDenials is a Rate metric tracking the rate of signed negative answers
+	// whose NSEC or NSEC3 records don't prove the denial of the queried name or type.
+	DNSDNSSECInvalidDenials *metrics.Metric
+
+	// DNSCacheHits is a counter metric tracking the number of resolutions served from a cache.
+	DNSCacheHits *metrics.Metric
+
+	// DNSCacheMisses is a counter metric tracking the number of resolutions not found in a cache.
+	DNSCacheMisses *metrics.Metric
+
+	// DNSInjectedFaults is a counter metric tracking the number of faults injected in DNS resolutions.
+	DNSInjectedFaults *metrics.Metric
+
+	// DNSTraceDuration is a trend metric tracking the duration of iterative resolutions.
+	DNSTraceDuration *metrics.Metric
+
+	// DNSTraceQueries is a trend metric tracking the number of queries iterative resolutions take.
+	DNSTraceQueries *metrics.Metric
+
+	// DNSTraceFailed is a Rate metric tracking the rate of failed iterative resolutions.
+	DNSTraceFailed *metrics.Metric
+
+	// DNSTransferDuration is a trend metric tracking the duration of zone transfers.
+	DNSTransferDuration *metrics.Metric
+
+	// DNSTransferMessages is a counter metric tracking the number of messages received during zone transfers.
+	DNSTransferMessages *metrics.Metric
+
+	// DNSTransferBytes is a counter metric tracking the number of bytes received during zone transfers.
+	DNSTransferBytes *metrics.Metric
+
+	// DNSTransferFailed is a Rate metric tracking the rate of failed zone transfers.
+	DNSTransferFailed *metrics.Metric
+
+	// DNSUpdates is a counter metric tracking the total number of dynamic updates.
+	DNSUpdates *metrics.Metric
+
+	// DNSUpdateDuration is a trend metric tracking the duration of dynamic updates.
+	DNSUpdateDuration *metrics.Metric
+
+	// DNSUpdateFailed is a Rate metric tracking the rate of failed, or rejected, dynamic updates.
+	DNSUpdateFailed *metrics.Metric
+
+	// DNSNotifyDuration is a trend metric tracking the time NOTIFY messages take to be acknowledged.
+	DNSNotifyDuration *metrics.Metric
+
+	// DNSNotifyPropagation is a trend metric tracking the time zone changes take to be served by
+	// the nameservers they are notified to.
+	DNSNotifyPropagation *metrics.Metric
+
+	// DNSNotifyFailed is a Rate metric tracking the rate of failed, or rejected, NOTIFY messages.
+	DNSNotifyFailed *metrics.Metric
+
+	// DNSExchanges is a counter metric tracking the total number of raw message exchanges.
+	DNSExchanges *metrics.Metric
+
+	// DNSExchangeDuration is a trend metric tracking the duration of raw message exchanges.
+	DNSExchangeDuration *metrics.Metric
+
+	// DNSExchangeFailed is a Rate metric tracking the rate of failed, or unanswered, raw message exchanges.
+	DNSExchangeFailed *metrics.Metric
+
+	// DNSFuzzCases is a counter metric tracking the number of corrupted messages sent by robustness tests.
+	DNSFuzzCases *metrics.Metric
+
+	// DNSFuzzUnhealthy is a Rate metric tracking the rate of health probes failed after a corrupted message.
+	DNSFuzzUnhealthy *metrics.Metric
+
+	// DNSServerQueries is a counter metric tracking the number of queries received by the module's servers.
+	DNSServerQueries *metrics.Metric
+
+	// DNSServerDuration is a trend metric tracking the time the module's servers take to respond to queries.
+	DNSServerDuration *metrics.Metric
+
 	// DNSLookups is a counter metric tracking the total number of DNS lookups.
 	DNSLookups *metrics.Metric
 
@@ -1,26 +1,37 @@
 package dns
 
 import (
+	"bytes"
 	"context"
+	"encoding/binary"
 	"fmt"
 	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
 	"strconv"
-	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
-	"github.com/docker/go-connections/nat"
+	"github.com/grafana/xk6-dns/dnstest"
+	"github.com/miekg/dns"
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
 
-	"github.com/testcontainers/testcontainers-go/wait"
-
-	"github.com/testcontainers/testcontainers-go"
 	"go.k6.io/k6/metrics"
 
 	"go.k6.io/k6/lib"
+	"go.k6.io/k6/lib/fsext"
 
 	"github.com/stretchr/testify/assert"
 
 	"github.com/stretchr/testify/require"
 
+	"go.k6.io/k6/cmd/state"
+	"go.k6.io/k6/js/common"
 	"go.k6.io/k6/js/modulestest"
 )
 
@@ -64,19 +75,35 @@ func TestClient_Resolve(t *testing.T) {
 	t.Run("Resolving in the init context should fail", func(t *testing.T) {
 		t.Parallel()
 
+		zone, err := dnstest.NewZone(testDomain, testDomain+". 60 IN A "+primaryTestIPv4)
+		require.NoError(t, err)
+
+		// The nameserver drops the queries, for a query sent despite the init context
+		// not to be answered.
+		handler := dnstest.NewFaultHandler(zone, dnstest.Fault{Drop: true})
+		server := dnstest.NewServer(handler)
+		t.Cleanup(server.Close)
+
 		runtime, err := newConfiguredRuntime(t)
 		require.NoError(t, err)
 
 		_, err = runtime.RunOnEventLoop(wrapInAsyncLambda(`
-			await dns.resolve("k6.io", "A", "1.1.1.1:53");
+			await dns.resolve("` + testDomain + `", "A", "` + server.Addr + `");
 		`))
 
-		assert.Error(t, err)
+		assert.ErrorContains(t, err, "init context")
+		assert.Zero(t, handler.Injected())
 	})
 
-	t.Run("Resolving existing A records against cloudflare nameserver should succeed", func(t *testing.T) {
+	t.Run("Resolving against a failing nameserver should fail", func(t *testing.T) {
 		t.Parallel()
 
+		zone, err := dnstest.NewZone(testDomain, testDomain+". 60 IN A "+primaryTestIPv4)
+		require.NoError(t, err)
+
+		server := dnstest.NewServer(dnstest.NewFaultHandler(zone, dnstest.Fault{Rcode: dns.RcodeServerFailure}))
+		t.Cleanup(server.Close)
+
 		runtime, err := newConfiguredRuntime(t)
 		require.NoError(t, err)
 
@@ -88,11 +115,17 @@ func TestClient_Resolve(t *testing.T) {
 		})
 
 		_, err = runtime.RunOnEventLoop(wrapInAsyncLambda(`
-			const resolveResults = await dns.resolve("k6.io", "A", "1.1.1.1:53");
-		
-			if (resolveResults.length === 0) {
-				throw "Resolving k6.io against cloudflare CDN returned no results, expected at least one IP"
+			try {
+				await dns.resolve("` + testDomain + `", "A", "` + server.Addr + `");
+			} catch (err) {
+				if (err.name !== "ServerFailure") {
+					throw "Resolving against a failing nameserver returned unexpected error, expected ServerFailure, got: " + err.name
+				}
+
+				return
 			}
+
+			throw "Resolving against a failing nameserver should have thrown an error, but it didn't"
 		`))
 
 		assert.NoError(t, err)
@@ -101,13 +134,7 @@ func TestClient_Resolve(t *testing.T) {
 	t.Run("Resolving existing A records against test nameserver should succeed", func(t *testing.T) {
 		t.Parallel()
 
-		ctx := context.Background()
-		unboundContainer, mappedPort := startUnboundContainer(ctx, t)
-		defer func() {
-			if err := unboundContainer.Terminate(ctx); err != nil {
-				t.Fatalf("could not stop unbound: %s", err.Error())
-			}
-		}()
+		nameserverAddr := startTestZoneServer(t)
 
 		runtime, err := newConfiguredRuntime(t)
 		require.NoError(t, err)
@@ -123,15 +150,15 @@ func TestClient_Resolve(t *testing.T) {
 			const resolveResults = await dns.resolve(
 				"` + testDomain + `",
 				"` + RecordTypeA.String() + `",
-				"127.0.0.1:` + strconv.Itoa(mappedPort.Int()) + `"
+				"` + nameserverAddr + `"
 			);
 		
 			if (resolveResults.length === 0) {
-				throw "Resolving k6.local against unbound server test container returned no results, expected ['` + primaryTestIPv4 + `']"
+				throw "Resolving k6.local against the test nameserver returned no results, expected ['` + primaryTestIPv4 + `']"
 			}
 			
 			if (resolveResults.length !== 2) {
-				throw "Resolving k6.local against unbound server test container returned an unexpected number of results, expected 2 ips, got:" + resolveResults.length
+				throw "Resolving k6.local against the test nameserver returned an unexpected number of results, expected 2 ips, got:" + resolveResults.length
 			}
 		
 			// We sort the results to ensure that the order is consistent
@@ -140,11 +167,11 @@ func TestClient_Resolve(t *testing.T) {
 
 		
 			if (resolveResults[0] !== "` + primaryTestIPv4 + `") {
-				throw "Resolving k6.local against unbound server test container returned unexpected result, expected '` + primaryTestIPv4 + `', got " + resolveResults[0]
+				throw "Resolving k6.local against the test nameserver returned unexpected result, expected '` + primaryTestIPv4 + `', got " + resolveResults[0]
 			}
 		
 			if (resolveResults[1] !== "` + secondaryTestIPv4 + `") {
-				throw "Resolving k6.local against unbound server test container returned unexpected result, expected '` + secondaryTestIPv4 + `', got " + resolveResults[1]
+				throw "Resolving k6.local against the test nameserver returned unexpected result, expected '` + secondaryTestIPv4 + `', got " + resolveResults[1]
 			}
 		`
 
@@ -155,13 +182,7 @@ func TestClient_Resolve(t *testing.T) {
 	t.Run("Resolving non-existing A records against test nameserver should succeed", func(t *testing.T) {
 		t.Parallel()
 
-		ctx := context.Background()
-		unboundContainer, mappedPort := startUnboundContainer(ctx, t)
-		defer func() {
-			if err := unboundContainer.Terminate(ctx); err != nil {
-				t.Fatalf("could not stop unbound: %s", err.Error())
-			}
-		}()
+		nameserverAddr := startTestZoneServer(t)
 
 		runtime, err := newConfiguredRuntime(t)
 		require.NoError(t, err)
@@ -176,20 +197,20 @@ func TestClient_Resolve(t *testing.T) {
 		testScript := `
 			try {
 				const resolvedResults = await dns.resolve(
-					"missing.domain",
+					"missing.` + testDomain + `",
 					"` + RecordTypeA.String() + `",
-					"127.0.0.1:` + strconv.Itoa(mappedPort.Int()) + `"
+					"` + nameserverAddr + `"
 				);
 			} catch (err) {
 				if (err.name !== "NonExistingDomain") {
-					throw "Resolving missing.domain against unbound server test container returned unexpected error, expected NonExistingDomain, got: " + err.Name
+					throw "Resolving a missing domain against the test nameserver returned unexpected error, expected NonExistingDomain, got: " + err.Name
 				}
 		
 				// We expected this error, so we can return
 				return
 			}
 		
-			throw "Resolving missing.domain against unbound server test container should have thrown an error, but it didn't"
+			throw "Resolving a missing domain against the test nameserver should have thrown an error, but it didn't"
 		`
 
 		_, err = runtime.RunOnEventLoop(wrapInAsyncLambda(testScript))
@@ -199,13 +220,7 @@ func TestClient_Resolve(t *testing.T) {
 	t.Run("Resolving existing AAAA records against test nameserver should succeed", func(t *testing.T) {
 		t.Parallel()
 
-		ctx := context.Background()
-		unboundContainer, mappedPort := startUnboundContainer(ctx, t)
-		defer func() {
-			if err := unboundContainer.Terminate(ctx); err != nil {
-				t.Fatalf("could not stop unbound: %s", err.Error())
-			}
-		}()
+		nameserverAddr := startTestZoneServer(t)
 
 		runtime, err := newConfiguredRuntime(t)
 		require.NoError(t, err)
@@ -221,7 +236,7 @@ func TestClient_Resolve(t *testing.T) {
 			const resolveResults = await dns.resolve(
 				"` + testDomain + `",
 				"` + RecordTypeAAAA.String() + `",
-				"127.0.0.1:` + strconv.Itoa(mappedPort.Int()) + `"
+				"` + nameserverAddr + `"
 			);
 		
 			// We sort the results to ensure that the order is consistent
@@ -229,19 +244,19 @@ func TestClient_Resolve(t *testing.T) {
 			resolveResults.sort();
 		
 			if (resolveResults.length === 0) {
-				throw "Resolving k6.local against unbound server test container returned no results, expected ['` + primaryTestIPv6 + `']"
+				throw "Resolving k6.local against the test nameserver returned no results, expected ['` + primaryTestIPv6 + `']"
 			}
 			
 			if (resolveResults.length !== 2) {
-				throw "Resolving k6.local against unbound server test container returned an unexpected number of results, expected 2 ips, got:" + resolveResults.length
+				throw "Resolving k6.local against the test nameserver returned an unexpected number of results, expected 2 ips, got:" + resolveResults.length
 			}
 		
 			if (resolveResults[0] !== "` + primaryTestIPv6 + `") {
-				throw "Resolving k6.local against unbound server test container returned unexpected result, expected '` + primaryTestIPv6 + `', got " + resolveResults[0]
+				throw "Resolving k6.local against the test nameserver returned unexpected result, expected '` + primaryTestIPv6 + `', got " + resolveResults[0]
 			}
 		
 			if (resolveResults[1] !== "` + secondaryTestIPv6 + `") {
-				throw "Resolving k6.local against unbound server test container returned unexpected result, expected '` + secondaryTestIPv6 + `', got " + resolveResults[1]
+				throw "Resolving k6.local against the test nameserver returned unexpected result, expected '` + secondaryTestIPv6 + `', got " + resolveResults[1]
 			}
 		`
 
@@ -252,13 +267,7 @@ func TestClient_Resolve(t *testing.T) {
 	t.Run("Resolving non-existing AAAA records against test nameserver should succeed", func(t *testing.T) {
 		t.Parallel()
 
-		ctx := context.Background()
-		unboundContainer, mappedPort := startUnboundContainer(ctx, t)
-		defer func() {
-			if err := unboundContainer.Terminate(ctx); err != nil {
-				t.Fatalf("could not stop unbound: %s", err.Error())
-			}
-		}()
+		nameserverAddr := startTestZoneServer(t)
 
 		runtime, err := newConfiguredRuntime(t)
 		require.NoError(t, err)
@@ -273,20 +282,20 @@ func TestClient_Resolve(t *testing.T) {
 		testScript := `
 			try {
 				const resolvedResults = await dns.resolve(
-					"missing.domain",
+					"missing.` + testDomain + `",
 					"` + RecordTypeAAAA.String() + `",
-					"127.0.0.1:` + strconv.Itoa(mappedPort.Int()) + `"
+					"` + nameserverAddr + `"
 				);
 			} catch (err) {
 				if (err.name !== "NonExistingDomain") {
-					throw "Resolving missing.domain against unbound server test container returned unexpected error, expected NonExistingDomain, got: " + err.Name
+					throw "Resolving a missing domain against the test nameserver returned unexpected error, expected NonExistingDomain, got: " + err.Name
 				}
 		
 				// We expected this error, so we can return
 				return
 			}
 		
-			throw "Resolving missing.domain against unbound server test container should have thrown an error, but it didn't"
+			throw "Resolving a missing domain against the test nameserver should have thrown an error, but it didn't"
 		`
 
 		_, err = runtime.RunOnEventLoop(wrapInAsyncLambda(testScript))
@@ -294,151 +303,1600 @@ func TestClient_Resolve(t *testing.T) {
 	})
 }
 
-func TestClient_Lookup(t *testing.T) {
+func TestClient_ResolveOptions(t *testing.T) {
 	t.Parallel()
 
-	t.Run("Lookup fails in the init context", func(t *testing.T) {
+	t.Run("Resolving with options should apply them", func(t *testing.T) {
 		t.Parallel()
 
+		var mu sync.Mutex
+		var gotIDs []uint16
+		nameserver := startTestNameserver(t, func(w dns.ResponseWriter, r *dns.Msg) {
+			mu.Lock()
+			gotIDs = append(gotIDs, r.Id)
+			mu.Unlock()
+
+			writeTestAnswer(t, w, r)
+		})
+
 		runtime, err := newConfiguredRuntime(t)
 		require.NoError(t, err)
 
+		runtime.MoveToVUContext(&lib.State{
+			BuiltinMetrics: metrics.RegisterBuiltinMetrics(metrics.NewRegistry()),
+			Tags:           lib.NewVUStateTags(metrics.NewRegistry().RootTagSet().With("tag-vu", "mytag")),
+			Samples:        make(chan metrics.SampleContainer, 1024),
+		})
+
 		_, err = runtime.RunOnEventLoop(wrapInAsyncLambda(`
-			await dns.lookup("k6.io");
+			const options = {
+				transport: "tcp",
+				queryId: { mode: "sequential", value: 100 },
+				randomizeCase: true,
+				responseValidation: "strict",
+			};
+
+			for (let i = 0; i < 2; i++) {
+				const resolveResults = await dns.resolve("` + testDomain + `", "A", "` + nameserver.Addr() + `", options);
+
+				if (resolveResults.length !== 1 || resolveResults[0] !== "` + primaryTestIPv4 + `") {
+					throw "Resolving with options returned unexpected results, got " + resolveResults
+				}
+			}
 		`))
+		require.NoError(t, err)
 
-		// network operations are forbidden in the init context, thus
-		// we explicitly expect an error here
-		assert.Error(t, err)
+		assert.Equal(t, []uint16{100, 101}, gotIDs)
 	})
 
-	t.Run("Lookup returns the system's default resolver results", func(t *testing.T) {
+	t.Run("Resolving with a TSIG key should sign queries and verify responses", func(t *testing.T) {
 		t.Parallel()
 
-		ctx := context.Background()
-		wantIPs, err := net.DefaultResolver.LookupHost(ctx, "k6.io")
+		nameserver := startTestTransferServer(t, nil, func(w dns.ResponseWriter, r *dns.Msg) {
+			response := new(dns.Msg)
+			response.SetReply(r)
+			response.Answer = []dns.RR{mustNewRR(t, r.Question[0].Name+" 60 IN A "+primaryTestIPv4)}
+
+			if tsig := r.IsTsig(); tsig != nil {
+				response.SetTsig(tsig.Hdr.Name, tsig.Algorithm, tsigFudge, time.Now().Unix())
+			}
+
+			assert.NoError(t, w.WriteMsg(response))
+		})
+
+		runtime, err := newConfiguredRuntime(t)
+		require.NoError(t, err)
+
+		runtime.MoveToVUContext(&lib.State{
+			BuiltinMetrics: metrics.RegisterBuiltinMetrics(metrics.NewRegistry()),
+			Tags:           lib.NewVUStateTags(metrics.NewRegistry().RootTagSet().With("tag-vu", "mytag")),
+			Samples:        make(chan metrics.SampleContainer, 1024),
+		})
+
+		_, err = runtime.RunOnEventLoop(wrapInAsyncLambda(`
+			const resolveResults = await dns.resolve("` + testDomain + `", "A", "` + nameserver.Addr() + `", {
+				transport: "tcp",
+				tsig: { name: "transfer.k6.test", algorithm: "hmac-sha256", secret: "` + testTSIGSecret + `" },
+			});
+
+			if (resolveResults.length !== 1 || resolveResults[0] !== "` + primaryTestIPv4 + `") {
+				throw "Resolving with a TSIG key returned unexpected results, got " + resolveResults;
+			}
+
+			let kind;
+			try {
+				await dns.resolve("` + testDomain + `", "A", "` + nameserver.Addr() + `", {
+					transport: "tcp",
+					tsig: { name: "transfer.k6.test", algorithm: "hmac-sha256", secret: "b3RoZXItc2VjcmV0" },
+				});
+			} catch (e) {
+				kind = e.name;
+			}
+
+			if (kind !== "BadSig") {
+				throw "Resolving with the wrong TSIG secret should fail with BadSig, got " + kind;
+			}
+		`))
 		require.NoError(t, err)
+	})
+
+	t.Run("Resolving with DNSSEC validation should report its outcome", func(t *testing.T) {
+		t.Parallel()
+
+		zone := newTestDNSSECZone(t, "k6.test.")
+		nameserver := startTestNameserver(t, testDNSSECHandler(t, map[string]testDNSSECResponse{
+			"k6.test. DNSKEY": {answer: zone.keySet(t)},
+			"k6.test. A":      {answer: zone.sign(t, mustNewRR(t, "k6.test. 60 IN A "+primaryTestIPv4))},
+		}))
+
+		runtime, err := newConfiguredRuntime(t)
+		require.NoError(t, err)
+
+		samples := make(chan metrics.SampleContainer, 1024)
+		runtime.MoveToVUContext(&lib.State{
+			BuiltinMetrics: metrics.RegisterBuiltinMetrics(metrics.NewRegistry()),
+			Tags:           lib.NewVUStateTags(metrics.NewRegistry().RootTagSet().With("tag-vu", "mytag")),
+			Samples:        samples,
+		})
+
+		_, err = runtime.RunOnEventLoop(wrapInAsyncLambda(`
+			const result = await dns.resolve("` + testDomain + `", "A", "` + nameserver.Addr() + `", {
+				validate: true,
+				trustAnchors: ["` + zone.ds().String() + `"],
+			});
+
+			if (result.ips.length !== 1 || result.ips[0] !== "` + primaryTestIPv4 + `" || result.dnssec.status !== "secure") {
+				throw "Resolving with DNSSEC validation returned unexpected results, got " + JSON.stringify(result)
+			}
+		`))
+		require.NoError(t, err)
+
+		bogus := -1.0
+		for len(samples) > 0 {
+			for _, sample := range (<-samples).GetSamples() {
+				if sample.Metric.Name == "dns_dnssec_bogus" {
+					bogus = sample.Value
+				}
+			}
+		}
+		assert.Equal(t, 0.0, bogus)
+	})
+
+	t.Run("Resolving with chaos options should tag the injected faults", func(t *testing.T) {
+		t.Parallel()
+
+		nameserver := startTestNameserver(t, writeTestAnswerHandler(t))
+
+		runtime, err := newConfiguredRuntime(t)
+		require.NoError(t, err)
+
+		samples := make(chan metrics.SampleContainer, 1024)
+		runtime.MoveToVUContext(&lib.State{
+			BuiltinMetrics: metrics.RegisterBuiltinMetrics(metrics.NewRegistry()),
+			Tags:           lib.NewVUStateTags(metrics.NewRegistry().RootTagSet().With("tag-vu", "mytag")),
+			Samples:        samples,
+		})
+
+		_, err = runtime.RunOnEventLoop(wrapInAsyncLambda(`
+			const truncated = await dns.resolve("` + testDomain + `", "A", "` + nameserver.Addr() + `", {
+				chaos: { latency: { distribution: "constant", mean: "10ms" }, truncateRate: 1 },
+			});
+
+			if (truncated.length !== 0) {
+				throw "Resolving with forced truncation returned unexpected results, got " + truncated
+			}
+
+			try {
+				await dns.resolve("` + testDomain + `", "A", "` + nameserver.Addr() + `", { chaos: { dropRate: 1 } });
+			} catch (err) {
+				return
+			}
+
+			throw "Resolving with forced drops should have thrown an error, but it didn't"
+		`))
+		require.NoError(t, err)
+
+		var gotFaults []string
+		var gotInjected []string
+		for len(samples) > 0 {
+			for _, sample := range (<-samples).GetSamples() {
+				switch sample.Metric.Name {
+				case "dns_injected_faults":
+					fault, _ := sample.Tags.Get("fault")
+					gotFaults = append(gotFaults, fault)
+				case "dns_resolutions":
+					injected, _ := sample.Tags.Get("injected")
+					fault, _ := sample.Tags.Get("fault")
+					gotInjected = append(gotInjected, injected+" "+fault)
+				}
+			}
+		}
+
+		assert.Equal(t, []string{"latency", "truncate", "drop"}, gotFaults)
+		assert.Equal(t, []string{"true latency+truncate", "true drop"}, gotInjected)
+	})
+
+	t.Run("Resolving with record options should record the failed exchanges", func(t *testing.T) {
+		t.Parallel()
+
+		nameserver := startTestNameserver(t, func(w dns.ResponseWriter, r *dns.Msg) {
+			response := new(dns.Msg)
+			response.SetRcode(r, dns.RcodeServerFailure)
+			assert.NoError(t, w.WriteMsg(response))
+		})
 
 		runtime, err := newConfiguredRuntime(t)
 		require.NoError(t, err)
 
-		// Setting up the runtime with the necessary state
 		runtime.MoveToVUContext(&lib.State{
 			BuiltinMetrics: metrics.RegisterBuiltinMetrics(metrics.NewRegistry()),
 			Tags:           lib.NewVUStateTags(metrics.NewRegistry().RootTagSet().With("tag-vu", "mytag")),
 			Samples:        make(chan metrics.SampleContainer, 1024),
 		})
 
-		_, gotErr := runtime.RunOnEventLoop(wrapInAsyncLambda(fmt.Sprintf(`
-			const lookupResults = await dns.lookup("k6.io");
+		path := filepath.Join(t.TempDir(), "failures.pcap")
 
-			if (lookupResults.length !== %d) {
-				throw "Looking up k6.io using the system's default resolver returned unexpected number of results, expected %d, got " + lookupResults
+		_, err = runtime.RunOnEventLoop(wrapInAsyncLambda(`
+			try {
+				await dns.resolve("` + testDomain + `", "A", "` + nameserver.Addr() + `", {
+					record: { path: ` + strconv.Quote(path) + `, failedOnly: true },
+				});
+			} catch (err) {
+				return
 			}
-		`, len(wantIPs), len(wantIPs))))
 
-		assert.NoError(t, gotErr)
+			throw "Resolving against a failing nameserver should have thrown an error, but it didn't"
+		`))
+		require.NoError(t, err)
+
+		recording, err := os.ReadFile(path)
+		require.NoError(t, err)
+
+		capture, err := ParseCapture(bytes.NewReader(recording), CaptureOptions{Port: nameserver.Port})
+		require.NoError(t, err)
+		require.Equal(t, 1, capture.Len())
+		require.NotNil(t, capture.Query(0).Reply)
+		assert.Equal(t, "SERVFAIL", capture.Query(0).Reply.Rcode)
 	})
-}
 
-const initGlobals = `
-	globalThis.dns = require("k6/x/dns");
-`
+	t.Run("Resolving with unreachable record options should resolve, and log the failure once", func(t *testing.T) {
+		t.Parallel()
 
-func newConfiguredRuntime(t testing.TB) (*modulestest.Runtime, error) {
-	runtime := modulestest.NewRuntime(t)
+		runtime, err := newConfiguredRuntime(t)
+		require.NoError(t, err)
 
-	err := runtime.SetupModuleSystem(
-		map[string]interface{}{"k6/x/dns": New()},
-		nil,
-		nil,
-	)
-	if err != nil {
-		return nil, err
-	}
+		logger, hook := logtest.NewNullLogger()
+		runtime.MoveToVUContext(&lib.State{
+			BuiltinMetrics: metrics.RegisterBuiltinMetrics(metrics.NewRegistry()),
+			Tags:           lib.NewVUStateTags(metrics.NewRegistry().RootTagSet().With("tag-vu", "mytag")),
+			Samples:        make(chan metrics.SampleContainer, 1024),
+			Logger:         logger,
+		})
 
-	// Ensure the `fs` module is available in the VU's runtime.
-	_, err = runtime.VU.Runtime().RunString(initGlobals)
-	require.NoError(t, err)
+		nameserver := startTestNameserver(t, writeTestAnswerHandler(t))
+		path := filepath.Join(t.TempDir(), "missing", "exchanges.pcap")
 
-	return runtime, err
-}
+		_, err = runtime.RunOnEventLoop(wrapInAsyncLambda(`
+			for (let i = 0; i < 2; i++) {
+				const ips = await dns.resolve("` + testDomain + `", "A", "` + nameserver.Addr() + `", {
+					record: { path: ` + strconv.Quote(path) + ` },
+				});
 
-// wrapInAsyncLambda is a helper function that wraps the provided input in an async lambda. This
-// makes the use of `await` statements in the input possible.
-func wrapInAsyncLambda(input string) string {
-	// This makes it possible to use `await` freely on the "top" level
-	return "(async () => {\n " + input + "\n })()"
-}
+				if (ips[0] !== "` + primaryTestIPv4 + `") {
+					throw "Resolving while failing to record should resolve; got " + ips + " instead"
+				}
+			}
+		`))
+		require.NoError(t, err)
 
-func startUnboundContainer(ctx context.Context, t *testing.T) (runningContainer testcontainers.Container, mappedPort nat.Port) {
-	recordsConfig := newUnboundRecordsConfiguration(
-		unboundRecord{testDomain, RecordTypeA.String(), primaryTestIPv4},
-		unboundRecord{testDomain, RecordTypeA.String(), secondaryTestIPv4},
-		unboundRecord{testDomain, RecordTypeAAAA.String(), primaryTestIPv6},
-		unboundRecord{testDomain, RecordTypeAAAA.String(), secondaryTestIPv6},
-	)
+		require.Len(t, hook.AllEntries(), 1)
+		assert.Equal(t, logrus.WarnLevel, hook.LastEntry().Level)
+		assert.Contains(t, hook.LastEntry().Message, "recording a DNS exchange failed")
+	})
+
+	t.Run("Resolving DNSSEC records should resolve to structured records", func(t *testing.T) {
+		t.Parallel()
 
-	network := testcontainers.DockerNetwork{Name: "testcontainers"}
+		zone := newTestDNSSECZone(t, "k6.test.")
+		nameserver := startTestNameserver(t, testDNSSECHandler(t, map[string]testDNSSECResponse{
+			"k6.test. RRSIG": {answer: zone.keySet(t)[2:]},
+		}))
 
-	containerRequest := testcontainers.ContainerRequest{
-		Image: "mvance/unbound:1.20.0",
-		Files: []testcontainers.ContainerFile{
-			{
-				Reader:            strings.NewReader(recordsConfig),
-				ContainerFilePath: "/opt/unbound/etc/unbound/a-records.conf",
-			},
-		},
-		ExposedPorts: []string{"53/tcp", "53/udp"},
-		WaitingFor:   wait.ForListeningPort("53/udp"),
-		Networks:     []string{network.Name},
-	}
+		runtime, err := newConfiguredRuntime(t)
+		require.NoError(t, err)
+
+		runtime.MoveToVUContext(&lib.State{
+			BuiltinMetrics: metrics.RegisterBuiltinMetrics(metrics.NewRegistry()),
+			Tags:           lib.NewVUStateTags(metrics.NewRegistry().RootTagSet().With("tag-vu", "mytag")),
+			Samples:        make(chan metrics.SampleContainer, 1024),
+		})
+
+		_, err = runtime.RunOnEventLoop(wrapInAsyncLambda(`
+			const records = await dns.resolve("` + testDomain + `", "RRSIG", "` + nameserver.Addr() + `");
+
+			if (records.length !== 1 || records[0].typeCovered !== "DNSKEY" || records[0].keyTag !== ` +
+			strconv.Itoa(int(zone.ksk.KeyTag())) + `) {
+				throw "Resolving RRSIG records returned unexpected results, got " + JSON.stringify(records)
+			}
 
-	runningContainer, err := testcontainers.GenericContainer(ctx, testcontainers.GenericContainerRequest{
-		ContainerRequest: containerRequest,
-		Started:          true,
-		Reuse:            false,
+			const days = dns.daysUntilExpiration(records[0]);
+			if (days < 0.9 || days > 1) {
+				throw "Computing the days until the RRSIG expiration returned an unexpected result, got " + days
+			}
+		`))
+		require.NoError(t, err)
 	})
-	if err != nil {
-		t.Fatal(err)
-	}
 
-	mappedPort, err = runningContainer.MappedPort(ctx, "53/udp")
-	require.NoError(t, err)
+	t.Run("Resolving with invalid options should fail", func(t *testing.T) {
+		t.Parallel()
 
-	return runningContainer, mappedPort
-}
+		runtime, err := newConfiguredRuntime(t)
+		require.NoError(t, err)
 
-// newUnboundRecordsConfiguration creates a new unbound configuration with the provided records.
-//
-// It returns a string that can be used to configure (as the content of a file an unbound server to resolve the provided
-// records.
-func newUnboundRecordsConfiguration(records ...unboundRecord) string {
-	var sb strings.Builder
-	for _, record := range records {
-		sb.WriteString(record.String())
-		sb.WriteString("\n")
-	}
+		runtime.MoveToVUContext(&lib.State{
+			BuiltinMetrics: metrics.RegisterBuiltinMetrics(metrics.NewRegistry()),
+			Tags:           lib.NewVUStateTags(metrics.NewRegistry().RootTagSet().With("tag-vu", "mytag")),
+			Samples:        make(chan metrics.SampleContainer, 1024),
+		})
 
-	return sb.String()
+		_, err = runtime.RunOnEventLoop(wrapInAsyncLambda(`
+			await dns.resolve("` + testDomain + `", "A", "127.0.0.1:53", { transport: "carrier-pigeon" });
+		`))
+		assert.Error(t, err)
+	})
 }
 
-// unboundRecord holds the information necessary to configure an unbound server to resolve a domain
-// to a specific IP address.
-//
-// Specifically this is used to generate the local-data configuration entries for unbound.
-type unboundRecord struct {
-	// Domain holds the domain name to resolve.
-	Domain string
+func TestClient_Configure(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Configuring the client outside the init context should fail", func(t *testing.T) {
+		t.Parallel()
+
+		runtime, err := newConfiguredRuntime(t)
+		require.NoError(t, err)
+
+		runtime.MoveToVUContext(&lib.State{})
 
-	// RecordType holds the record type to resolve the domain to.
-	RecordType string
+		_, err = runtime.VU.Runtime().RunString(`dns.configure({ localAddress: "127.0.0.2" })`)
+		assert.ErrorContains(t, err, "init context")
+	})
 
-	// IP holds the IP address to resolve the domain to.
-	IP string
-}
+	t.Run("Configuring the client should apply its options to every call", func(t *testing.T) {
+		t.Parallel()
+
+		var mu sync.Mutex
+		var gotAddrs []string
+		nameserver := startTestNameserver(t, func(w dns.ResponseWriter, r *dns.Msg) {
+			host, _, err := net.SplitHostPort(w.RemoteAddr().String())
+			assert.NoError(t, err)
+
+			mu.Lock()
+			gotAddrs = append(gotAddrs, host)
+			mu.Unlock()
+
+			writeTestAnswer(t, w, r)
+		})
+
+		runtime, err := newConfiguredRuntime(t)
+		require.NoError(t, err)
+
+		_, err = runtime.VU.Runtime().RunString(`dns.configure({ localAddress: "127.0.0.2" })`)
+		require.NoError(t, err)
+
+		runtime.MoveToVUContext(&lib.State{
+			BuiltinMetrics: metrics.RegisterBuiltinMetrics(metrics.NewRegistry()),
+			Tags:           lib.NewVUStateTags(metrics.NewRegistry().RootTagSet().With("tag-vu", "mytag")),
+			Samples:        make(chan metrics.SampleContainer, 1024),
+		})
+
+		// The options of a call replace the configured local address, rather
+		// than conflict with it.
+		_, err = runtime.RunOnEventLoop(wrapInAsyncLambda(`
+			await dns.resolve("` + testDomain + `", "A", "` + nameserver.Addr() + `");
+			await dns.resolve("` + testDomain + `", "A", "` + nameserver.Addr() + `", { interface: "` +
+			loopbackInterfaceName(t) + `" });
+		`))
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"127.0.0.2", "127.0.0.1"}, gotAddrs)
+	})
+
+	t.Run("Configuring a TSIG key should sign updates, notifications and transfers", func(t *testing.T) {
+		t.Parallel()
+
+		// The nameserver only acknowledges signed messages.
+		nameserver := startTestTransferServer(t, nil, func(w dns.ResponseWriter, r *dns.Msg) {
+			response := new(dns.Msg)
+			if r.IsTsig() == nil || w.TsigStatus() != nil {
+				response.SetRcode(r, dns.RcodeNotAuth)
+			} else {
+				response.SetReply(r)
+				response.SetTsig(r.IsTsig().Hdr.Name, r.IsTsig().Algorithm, tsigFudge, time.Now().Unix())
+			}
+
+			assert.NoError(t, w.WriteMsg(response))
+		})
+		transferNameserver := startTestTransferServer(t, nil, testTransferHandler(t, testZoneEnvelopes(t), true))
+
+		runtime, err := newConfiguredRuntime(t)
+		require.NoError(t, err)
+
+		_, err = runtime.VU.Runtime().RunString(`dns.configure({
+			tsig: { name: "transfer.k6.test", secret: "` + testTSIGSecret + `" },
+		})`)
+		require.NoError(t, err)
+
+		runtime.MoveToVUContext(&lib.State{
+			BuiltinMetrics: metrics.RegisterBuiltinMetrics(metrics.NewRegistry()),
+			Tags:           lib.NewVUStateTags(metrics.NewRegistry().RootTagSet().With("tag-vu", "mytag")),
+			Samples:        make(chan metrics.SampleContainer, 1024),
+		})
+
+		_, err = runtime.RunOnEventLoop(wrapInAsyncLambda(`
+			await dns.update("k6.test", "` + nameserver.Addr() + `", {
+				add: ["www.k6.test. 60 IN A ` + primaryTestIPv4 + `"],
+				transport: "tcp",
+			});
+			await dns.notify("k6.test", "` + nameserver.Addr() + `", { transport: "tcp" });
+
+			const transfer = await dns.transfer("k6.test", "` + transferNameserver.Addr() + `");
+			if (transfer.records.length !== 5) {
+				throw "Transferring with the configured TSIG key returned unexpected records, got " + transfer.records;
+			}
+		`))
+		require.NoError(t, err)
+	})
+}
+
+func TestModuleInstance_connectionReuseMode(t *testing.T) {
+	t.Parallel()
+
+	t.Run("connections are closed once each VU context is done", func(t *testing.T) {
+		t.Parallel()
+
+		nameserver := startTestNameserver(t, writeTestAnswerHandler(t))
+
+		runtime := modulestest.NewRuntime(t)
+		mi := New().NewModuleInstance(runtime.VU).(*ModuleInstance) //nolint:forcetypeassert
+		runtime.MoveToVUContext(&lib.State{Options: lib.Options{}})
+
+		// Each scenario the VU runs comes with a new context, which the connections
+		// opened under it are closed with.
+		for scenario := 0; scenario < 2; scenario++ {
+			ctx, cancel := context.WithCancel(context.Background())
+			runtime.VU.CtxField = ctx
+
+			options := ClientOptions{ConnectionReuse: mi.connectionReuseMode(ConnectionReuseVU)}
+			_, err := mi.dnsClient.ResolveWithOptions(ctx, testDomain, "A", nameserver, options)
+			require.NoError(t, err)
+
+			pooledConns := func() int {
+				mi.dnsClient.pool.mu.Lock()
+				defer mi.dnsClient.pool.mu.Unlock()
+
+				return len(mi.dnsClient.pool.conns)
+			}
+			require.Equal(t, 1, pooledConns())
+
+			cancel()
+			assert.Eventually(t, func() bool { return pooledConns() == 0 }, time.Second, 10*time.Millisecond, scenario)
+		}
+	})
+}
+
+func TestRootModule_closeAtTestEnd(t *testing.T) {
+	t.Parallel()
+
+	nameserver := startTestNameserver(t, writeTestAnswerHandler(t))
+	events := state.NewGlobalState(context.Background()).Events
+
+	runtime := modulestest.NewRuntime(t)
+	runtime.VU.EventsField = common.Events{Global: events}
+	mi := New().NewModuleInstance(runtime.VU).(*ModuleInstance) //nolint:forcetypeassert
+
+	path := filepath.Join(t.TempDir(), "exchanges.dnstap")
+	options := ClientOptions{
+		ConnectionReuse: ConnectionReuseShared,
+		Record:          RecordOptions{Format: RecordFormatDnstap, Path: path},
+	}
+	_, err := mi.dnsClient.ResolveWithOptions(context.Background(), testDomain, "A", nameserver, options)
+	require.NoError(t, err)
+
+	pool := mi.root.sharedResources().pool
+	pooledConns := func() int {
+		pool.mu.Lock()
+		defer pool.mu.Unlock()
+
+		return len(pool.conns)
+	}
+	require.Equal(t, 1, pooledConns())
+
+	engine := mi.root.queryEngine()
+	answered := make(chan EngineResult, 1)
+	require.NoError(t, engine.send(testDomain+".", dns.TypeA, nameserver, time.Second, func(result EngineResult) {
+		answered <- result
+	}))
+	require.NoError(t, (<-answered).Err)
+
+	engineSockets := func() int {
+		engine.mu.Lock()
+		defer engine.mu.Unlock()
+
+		return len(engine.sockets)
+	}
+	require.Equal(t, 1, engineSockets())
+
+	key, signer := newTestSIG0Key(t, "update.k6.test.", dns.ED25519, 256)
+	_, err = mi.dnsClient.sig0Key(SIG0Options{Key: key.String(), PrivateKey: key.PrivateKeyString(signer)})
+	require.NoError(t, err)
+
+	sig0Keys := mi.root.sharedResources().sig0Keys
+	cachedSIG0Keys := func() int {
+		sig0Keys.mu.Lock()
+		defer sig0Keys.mu.Unlock()
+
+		return len(sig0Keys.keys)
+	}
+	require.Equal(t, 1, cachedSIG0Keys())
+
+	wait := events.Emit(newTestEvent(events.Emit, testEndEvent))
+	require.NoError(t, wait(context.Background()))
+
+	recording, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	// The recording's stream is stopped, the shared connections and query engine
+	// sockets are closed, and the parsed SIG(0) keys released, once the test ends.
+	require.Greater(t, len(recording), 12)
+	assert.Equal(t, fstrmControlFrame(fstrmControlStop), recording[len(recording)-12:])
+	assert.Zero(t, pooledConns())
+	assert.Zero(t, engineSockets())
+	assert.Zero(t, cachedSIG0Keys())
+}
+
+// newTestEvent returns a k6 event of the type, whose declaration is internal to k6, and
+// thus inferred from the Emit method of the event system it's emitted with.
+func newTestEvent[E any](_ func(*E) func(context.Context) error, eventType uint8) *E {
+	event := new(E)
+	reflect.ValueOf(event).Elem().FieldByName("Type").SetUint(uint64(eventType))
+
+	return event
+}
+
+func TestClient_Fire(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Firing queries should resolve to a summary", func(t *testing.T) {
+		t.Parallel()
+
+		nameserver := startTestNameserver(t, writeTestAnswerHandler(t))
+
+		runtime, err := newConfiguredRuntime(t)
+		require.NoError(t, err)
+
+		samples := make(chan metrics.SampleContainer, 1024)
+		runtime.MoveToVUContext(&lib.State{
+			BuiltinMetrics: metrics.RegisterBuiltinMetrics(metrics.NewRegistry()),
+			Tags:           lib.NewVUStateTags(metrics.NewRegistry().RootTagSet().With("tag-vu", "mytag")),
+			Samples:        samples,
+		})
+
+		_, err = runtime.RunOnEventLoop(wrapInAsyncLambda(`
+			const summary = await dns.fire("` + testDomain + `", "A", "` + nameserver.Addr() + `", {
+				rate: 1000,
+				count: 50,
+				timeout: "1s",
+			});
+
+			if (summary.sent !== 50 || summary.succeeded !== 50 || summary.failed !== 0) {
+				throw "Firing queries returned an unexpected summary: " + JSON.stringify(summary)
+			}
+		`))
+		require.NoError(t, err)
+
+		resolutions := 0
+		for len(samples) > 0 {
+			for _, sample := range (<-samples).GetSamples() {
+				if sample.Metric.Name == "dns_resolutions" {
+					resolutions++
+				}
+			}
+		}
+		assert.Equal(t, 50, resolutions)
+	})
+
+	t.Run("Slowly emitted metrics should not block the query engine", func(t *testing.T) {
+		t.Parallel()
+
+		nameserver := startTestNameserver(t, writeTestAnswerHandler(t))
+
+		engine := newQueryEngine()
+		t.Cleanup(engine.close)
+
+		// The samples channel isn't drained until the end of the test, blocking the
+		// emission of the fired queries' metrics.
+		runtime := modulestest.NewRuntime(t)
+		mi := New().NewModuleInstance(runtime.VU).(*ModuleInstance) //nolint:forcetypeassert
+		samples := make(chan metrics.SampleContainer)
+		runtime.MoveToVUContext(&lib.State{
+			BuiltinMetrics: metrics.RegisterBuiltinMetrics(metrics.NewRegistry()),
+			Tags:           lib.NewVUStateTags(metrics.NewRegistry().RootTagSet()),
+			Samples:        samples,
+		})
+
+		question := Question{Name: testDomain, Type: "A"}
+		next := func() (Question, uint16) { return question, dns.TypeA }
+		options := FireOptions{Rate: 1000, Count: 8, Timeout: time.Second, MaxInFlight: 1}
+
+		fired := make(chan FireSummary, 1)
+		go func() {
+			summary, err := mi.fire(context.Background(), engine, next, nameserver, options)
+			assert.NoError(t, err)
+			fired <- summary
+		}()
+
+		// Other queries sent using the engine are still answered.
+		time.Sleep(50 * time.Millisecond)
+		answered := make(chan EngineResult, 1)
+		require.NoError(t, engine.send(dns.Fqdn(testDomain), dns.TypeA, nameserver, time.Second, func(result EngineResult) {
+			answered <- result
+		}))
+
+		select {
+		case result := <-answered:
+			assert.NoError(t, result.Err)
+		case <-time.After(500 * time.Millisecond):
+			t.Fatal("the query engine is blocked by the emission of metrics")
+		}
+
+		for {
+			select {
+			case <-samples:
+			case summary := <-fired:
+				assert.Equal(t, int64(8), summary.Succeeded)
+				return
+			}
+		}
+	})
+
+	t.Run("Firing queries without a rate should fail", func(t *testing.T) {
+		t.Parallel()
+
+		runtime, err := newConfiguredRuntime(t)
+		require.NoError(t, err)
+
+		runtime.MoveToVUContext(&lib.State{
+			BuiltinMetrics: metrics.RegisterBuiltinMetrics(metrics.NewRegistry()),
+			Tags:           lib.NewVUStateTags(metrics.NewRegistry().RootTagSet().With("tag-vu", "mytag")),
+			Samples:        make(chan metrics.SampleContainer, 1024),
+		})
+
+		_, err = runtime.RunOnEventLoop(wrapInAsyncLambda(`
+			await dns.fire("` + testDomain + `", "A", "127.0.0.1:53", { count: 10 });
+		`))
+		assert.Error(t, err)
+	})
+}
+
+func TestClient_Replay(t *testing.T) {
+	t.Parallel()
+
+	// newRuntimeWithQueryFile returns a runtime whose init context loaded the query file
+	// holding the queries as the workload global, before moving to the VU context.
+	newRuntimeWithQueryFile := func(t *testing.T, queries string, samples chan metrics.SampleContainer) *modulestest.Runtime {
+		t.Helper()
+
+		runtime, err := newConfiguredRuntime(t)
+		require.NoError(t, err)
+
+		fs := fsext.NewMemMapFs()
+		require.NoError(t, fsext.WriteFile(fs, "/queries.txt", []byte(queries), 0o644))
+		runtime.VU.InitEnvField.FileSystems = map[string]fsext.Fs{"file": fs}
+
+		_, err = runtime.VU.Runtime().RunString(`globalThis.workload = dns.loadQueryFile("/queries.txt");`)
+		require.NoError(t, err)
+
+		runtime.MoveToVUContext(&lib.State{
+			BuiltinMetrics: metrics.RegisterBuiltinMetrics(metrics.NewRegistry()),
+			Tags:           lib.NewVUStateTags(metrics.NewRegistry().RootTagSet().With("tag-vu", "mytag")),
+			Samples:        samples,
+		})
+
+		return runtime
+	}
+
+	t.Run("Loaded query files should be iterable", func(t *testing.T) {
+		t.Parallel()
+
+		runtime := newRuntimeWithQueryFile(t, "; production sample\nwww.k6.test A\nk6.test. MX\n", make(chan metrics.SampleContainer, 1024))
+
+		_, err := runtime.RunOnEventLoop(wrapInAsyncLambda(`
+			if (workload.length !== 2 || workload.queries[1].name !== "k6.test" || workload.queries[1].type !== "MX") {
+				throw "Loading a query file returned unexpected queries: " + JSON.stringify(workload.queries)
+			}
+
+			const names = [workload.next().name, workload.next().name, workload.next().name];
+			if (names.join(",") !== "www.k6.test,k6.test,www.k6.test") {
+				throw "Iterating a workload in order returned unexpected queries: " + names
+			}
+
+			try {
+				workload.queries[0] = { name: "k6.io", type: "A" };
+			} catch (err) {
+				return
+			}
+
+			throw "Modifying the queries of a workload should have thrown an error, but it didn't"
+		`))
+		assert.NoError(t, err)
+	})
+
+	t.Run("Replaying a workload should resolve to a summary", func(t *testing.T) {
+		t.Parallel()
+
+		nameserver := startTestNameserver(t, writeTestAnswerHandler(t))
+
+		samples := make(chan metrics.SampleContainer, 1024)
+		runtime := newRuntimeWithQueryFile(t, "www.k6.test A\napi.k6.test AAAA\n", samples)
+
+		_, err := runtime.RunOnEventLoop(wrapInAsyncLambda(`
+			const summary = await dns.replay(workload, "` + nameserver.Addr() + `", { rate: 1000, timeout: "1s" });
+
+			if (summary.sent !== 2 || summary.succeeded !== 2) {
+				throw "Replaying a workload returned an unexpected summary: " + JSON.stringify(summary)
+			}
+		`))
+		require.NoError(t, err)
+
+		var queries []string
+		for len(samples) > 0 {
+			for _, sample := range (<-samples).GetSamples() {
+				if sample.Metric.Name == "dns_resolutions" {
+					query, _ := sample.Tags.Get("query")
+					recordType, _ := sample.Tags.Get("recordType")
+					queries = append(queries, query+" "+recordType)
+				}
+			}
+		}
+		assert.ElementsMatch(t, []string{"www.k6.test A", "api.k6.test AAAA"}, queries)
+	})
+
+	t.Run("Loading query files outside of the init context should fail", func(t *testing.T) {
+		t.Parallel()
+
+		runtime, err := newConfiguredRuntime(t)
+		require.NoError(t, err)
+
+		runtime.MoveToVUContext(&lib.State{
+			BuiltinMetrics: metrics.RegisterBuiltinMetrics(metrics.NewRegistry()),
+			Tags:           lib.NewVUStateTags(metrics.NewRegistry().RootTagSet().With("tag-vu", "mytag")),
+			Samples:        make(chan metrics.SampleContainer, 1024),
+		})
+
+		_, err = runtime.RunOnEventLoop(wrapInAsyncLambda(`
+			dns.loadQueryFile("/queries.txt");
+		`))
+		assert.Error(t, err)
+	})
+}
+
+func TestClient_LoadCapture(t *testing.T) {
+	t.Parallel()
+
+	nameserver := startTestNameserver(t, writeTestAnswerHandler(t))
+
+	client := netip.MustParseAddrPort("192.0.2.10:41000")
+	server := netip.MustParseAddrPort("192.0.2.53:53")
+	start := time.Unix(1700000000, 0)
+
+	query, reply := newTestCapturedExchange(t, testDomain, dns.TypeA, primaryTestIPv4)
+	capture := newTestPcap(binary.LittleEndian,
+		testCapturedPacket{time: start, data: newTestEthernetFrame(encodeIPPacket(TransportUDP, client, server, query))},
+		testCapturedPacket{
+			time: start.Add(2 * time.Millisecond),
+			data: newTestEthernetFrame(encodeIPPacket(TransportUDP, server, client, reply)),
+		},
+	)
+
+	runtime, err := newConfiguredRuntime(t)
+	require.NoError(t, err)
+
+	fs := fsext.NewMemMapFs()
+	require.NoError(t, fsext.WriteFile(fs, "/queries.pcap", capture, 0o644))
+	runtime.VU.InitEnvField.FileSystems = map[string]fsext.Fs{"file": fs}
+
+	_, err = runtime.VU.Runtime().RunString(`globalThis.capture = dns.loadCapture("/queries.pcap");`)
+	require.NoError(t, err)
+
+	runtime.MoveToVUContext(&lib.State{
+		BuiltinMetrics: metrics.RegisterBuiltinMetrics(metrics.NewRegistry()),
+		Tags:           lib.NewVUStateTags(metrics.NewRegistry().RootTagSet().With("tag-vu", "mytag")),
+		Samples:        make(chan metrics.SampleContainer, 1024),
+	})
+
+	_, err = runtime.RunOnEventLoop(wrapInAsyncLambda(`
+		const query = capture.queries[0];
+		if (capture.length !== 1 || query.name !== "` + testDomain + `" || query.type !== "A" || query.rtt !== 2) {
+			throw "Loading a capture returned unexpected queries: " + JSON.stringify(capture.queries)
+		}
+
+		if (!query.message.edns.dnssecOk || query.reply.answer.length !== 1) {
+			throw "Loading a capture returned an unexpected query message: " + JSON.stringify(query)
+		}
+
+		const result = await dns.exchange(query.bytes, "` + nameserver.Addr() + `");
+
+		const differences = capture.verify(0, result.message);
+		if (differences.length !== 0) {
+			throw "Verifying a matching response returned differences: " + differences
+		}
+
+		const mismatched = capture.verify(0, { rcode: "NXDOMAIN", answer: [] });
+		if (mismatched.length !== 2) {
+			throw "Verifying a mismatched response returned unexpected differences: " + mismatched
+		}
+
+		try {
+			dns.loadCapture("/queries.pcap");
+		} catch (err) {
+			return
+		}
+
+		throw "Loading a capture outside of the init context should have thrown an error, but it didn't"
+	`))
+	assert.NoError(t, err)
+}
+
+func TestClient_Trace(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Tracing should resolve to every hop of the iterative resolution", func(t *testing.T) {
+		t.Parallel()
+
+		root, port := startTestHierarchy(t)
+
+		runtime, err := newConfiguredRuntime(t)
+		require.NoError(t, err)
+
+		samples := make(chan metrics.SampleContainer, 1024)
+		runtime.MoveToVUContext(&lib.State{
+			BuiltinMetrics: metrics.RegisterBuiltinMetrics(metrics.NewRegistry()),
+			Tags:           lib.NewVUStateTags(metrics.NewRegistry().RootTagSet().With("tag-vu", "mytag")),
+			Samples:        samples,
+		})
+
+		_, err = runtime.RunOnEventLoop(wrapInAsyncLambda(`
+			const trace = await dns.trace("` + testDomain + `", "A", {
+				roots: ["` + root.Addr() + `"],
+				port: ` + strconv.Itoa(int(port)) + `,
+			});
+
+			if (trace.ips.length !== 1 || trace.ips[0] !== "` + primaryTestIPv4 + `") {
+				throw "Tracing returned unexpected results, got " + trace.ips
+			}
+
+			if (trace.hops.length !== 3 || trace.hops[1].referral.zone !== "k6.test." || trace.hops[2].latency <= 0) {
+				throw "Tracing returned unexpected hops, got " + JSON.stringify(trace.hops)
+			}
+		`))
+		require.NoError(t, err)
+
+		traces := 0
+		for len(samples) > 0 {
+			for _, sample := range (<-samples).GetSamples() {
+				if sample.Metric.Name == "dns_trace_duration" {
+					traces++
+				}
+			}
+		}
+		assert.Equal(t, 1, traces)
+	})
+}
+
+func TestClient_Transfer(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Transferring should resolve to the zone's records", func(t *testing.T) {
+		t.Parallel()
+
+		nameserver := startTestTransferServer(t, nil, testTransferHandler(t, testZoneEnvelopes(t), true))
+
+		runtime, err := newConfiguredRuntime(t)
+		require.NoError(t, err)
+
+		samples := make(chan metrics.SampleContainer, 1024)
+		runtime.MoveToVUContext(&lib.State{
+			BuiltinMetrics: metrics.RegisterBuiltinMetrics(metrics.NewRegistry()),
+			Tags:           lib.NewVUStateTags(metrics.NewRegistry().RootTagSet().With("tag-vu", "mytag")),
+			Samples:        samples,
+		})
+
+		_, err = runtime.RunOnEventLoop(wrapInAsyncLambda(`
+			const transfer = await dns.transfer("k6.test", "` + nameserver.Addr() + `", {
+				type: "AXFR",
+				tsig: { name: "transfer.k6.test", algorithm: "hmac-sha512", secret: "` + testTSIGSecret + `" },
+			});
+
+			if (transfer.records.length !== 5 || transfer.serial !== 2024010101 || transfer.messages !== 2) {
+				throw "Transferring returned unexpected results, got " + JSON.stringify(transfer)
+			}
+		`))
+		require.NoError(t, err)
+
+		bytes := 0.0
+		for len(samples) > 0 {
+			for _, sample := range (<-samples).GetSamples() {
+				if sample.Metric.Name == "dns_transfer_bytes" {
+					bytes += sample.Value
+				}
+			}
+		}
+		assert.Positive(t, bytes)
+	})
+
+	t.Run("Streaming a transfer should deliver every message to the callback", func(t *testing.T) {
+		t.Parallel()
+
+		nameserver := startTestTransferServer(t, nil, testTransferHandler(t, testZoneEnvelopes(t), false))
+
+		runtime, err := newConfiguredRuntime(t)
+		require.NoError(t, err)
+
+		runtime.MoveToVUContext(&lib.State{
+			BuiltinMetrics: metrics.RegisterBuiltinMetrics(metrics.NewRegistry()),
+			Tags:           lib.NewVUStateTags(metrics.NewRegistry().RootTagSet().With("tag-vu", "mytag")),
+			Samples:        make(chan metrics.SampleContainer, 1024),
+		})
+
+		_, err = runtime.RunOnEventLoop(wrapInAsyncLambda(`
+			let addresses = 0;
+			let messages = 0;
+			const summary = await dns.streamTransfer("k6.test", "` + nameserver.Addr() + `", (records) => {
+				messages++;
+				addresses += records.filter((record) => record.includes("\tA\t")).length;
+			});
+
+			if (messages !== 2 || addresses !== 2 || summary.recordCount !== 5 || summary.serial !== 2024010101) {
+				throw "Streaming a transfer returned unexpected results, got " + JSON.stringify(summary) +
+					" after " + messages + " messages holding " + addresses + " addresses";
+			}
+
+			let rejected = false;
+			try {
+				await dns.streamTransfer("k6.test", "` + nameserver.Addr() + `", () => { throw "stop"; });
+			} catch (e) {
+				rejected = true;
+			}
+
+			if (!rejected) {
+				throw "Streaming a transfer should fail when the callback throws";
+			}
+		`))
+		require.NoError(t, err)
+	})
+
+	t.Run("Transferring in the init context should fail", func(t *testing.T) {
+		t.Parallel()
+
+		runtime, err := newConfiguredRuntime(t)
+		require.NoError(t, err)
+
+		_, err = runtime.RunOnEventLoop(wrapInAsyncLambda(`
+			await dns.transfer("k6.test", "127.0.0.1:53");
+		`))
+		assert.Error(t, err)
+	})
+}
+
+func TestClient_Update(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Updating should resolve once the nameserver applied the update", func(t *testing.T) {
+		t.Parallel()
+
+		nameserver := startTestNameserver(t, func(w dns.ResponseWriter, r *dns.Msg) {
+			response := new(dns.Msg)
+			if len(r.Answer) > 0 {
+				// The zone holds no record, thus prerequisites are never met
+				response.SetRcode(r, dns.RcodeNXRrset)
+			} else {
+				response.SetReply(r)
+			}
+
+			assert.NoError(t, w.WriteMsg(response))
+		})
+
+		runtime, err := newConfiguredRuntime(t)
+		require.NoError(t, err)
+
+		samples := make(chan metrics.SampleContainer, 1024)
+		runtime.MoveToVUContext(&lib.State{
+			BuiltinMetrics: metrics.RegisterBuiltinMetrics(metrics.NewRegistry()),
+			Tags:           lib.NewVUStateTags(metrics.NewRegistry().RootTagSet().With("tag-vu", "mytag")),
+			Samples:        samples,
+		})
+
+		_, err = runtime.RunOnEventLoop(wrapInAsyncLambda(`
+			const update = await dns.update("k6.test", "` + nameserver.Addr() + `", {
+				add: ["www.k6.test. 60 IN A ` + primaryTestIPv4 + `"],
+				remove: ["old.k6.test. ANY"],
+			});
+
+			if (update.added !== 1 || update.removed !== 1 || update.prerequisites !== 0) {
+				throw "Updating returned unexpected results, got " + JSON.stringify(update);
+			}
+
+			let kind;
+			try {
+				await dns.update("k6.test", "` + nameserver.Addr() + `", {
+					add: ["www.k6.test. 60 IN A ` + primaryTestIPv4 + `"],
+					prerequisites: ["yxrrset www.k6.test. A"],
+				});
+			} catch (e) {
+				kind = e.name;
+			}
+
+			if (kind !== "NXRrset") {
+				throw "Updating with unmet prerequisites should fail with NXRrset, got " + kind;
+			}
+		`))
+		require.NoError(t, err)
+
+		failed := make([]float64, 0, 2)
+		for len(samples) > 0 {
+			for _, sample := range (<-samples).GetSamples() {
+				if sample.Metric.Name == "dns_update_failed" {
+					failed = append(failed, sample.Value)
+				}
+			}
+		}
+		assert.Equal(t, []float64{0, 1}, failed)
+	})
+
+	t.Run("Updating with a SIG(0) key should sign the update", func(t *testing.T) {
+		t.Parallel()
+
+		key, signer := newTestSIG0Key(t, "update.k6.test.", dns.ED25519, 256)
+		nameserver := startTestSIG0Server(t, key, nil, nil)
+
+		runtime, err := newConfiguredRuntime(t)
+		require.NoError(t, err)
+
+		require.NoError(t, runtime.VU.Runtime().Set("key", key.String()))
+		require.NoError(t, runtime.VU.Runtime().Set("privateKey", key.PrivateKeyString(signer)))
+
+		runtime.MoveToVUContext(&lib.State{
+			BuiltinMetrics: metrics.RegisterBuiltinMetrics(metrics.NewRegistry()),
+			Tags:           lib.NewVUStateTags(metrics.NewRegistry().RootTagSet().With("tag-vu", "mytag")),
+			Samples:        make(chan metrics.SampleContainer, 1024),
+		})
+
+		_, err = runtime.RunOnEventLoop(wrapInAsyncLambda(`
+			await dns.update("k6.test", "` + nameserver.Addr() + `", {
+				add: ["www.k6.test. 60 IN A ` + primaryTestIPv4 + `"],
+				sig0: { key: key, privateKey: privateKey },
+			});
+		`))
+		require.NoError(t, err)
+	})
+
+	t.Run("Updating in the init context should fail", func(t *testing.T) {
+		t.Parallel()
+
+		runtime, err := newConfiguredRuntime(t)
+		require.NoError(t, err)
+
+		_, err = runtime.RunOnEventLoop(wrapInAsyncLambda(`
+			await dns.update("k6.test", "127.0.0.1:53", { add: ["www.k6.test. 60 IN A 192.0.2.1"] });
+		`))
+		assert.Error(t, err)
+	})
+}
+
+func TestClient_Notify(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Notifying with waitForSerial should report the propagation delay", func(t *testing.T) {
+		t.Parallel()
+
+		var polls atomic.Uint32
+		nameserver := startTestNameserver(t, testNotifyHandler(t, nil, func() uint32 {
+			if polls.Add(1) < 2 {
+				return 2024010101
+			}
+
+			return 2024010102
+		}))
+
+		runtime, err := newConfiguredRuntime(t)
+		require.NoError(t, err)
+
+		samples := make(chan metrics.SampleContainer, 1024)
+		runtime.MoveToVUContext(&lib.State{
+			BuiltinMetrics: metrics.RegisterBuiltinMetrics(metrics.NewRegistry()),
+			Tags:           lib.NewVUStateTags(metrics.NewRegistry().RootTagSet().With("tag-vu", "mytag")),
+			Samples:        samples,
+		})
+
+		_, err = runtime.RunOnEventLoop(wrapInAsyncLambda(`
+			const notification = await dns.notify("k6.test", "` + nameserver.Addr() + `", {
+				serial: 2024010102,
+				waitForSerial: true,
+				pollInterval: "10ms",
+			});
+
+			if (notification.serial !== 2024010102 || notification.polls !== 2 || notification.propagation <= 0) {
+				throw "Notifying returned unexpected results, got " + JSON.stringify(notification);
+			}
+		`))
+		require.NoError(t, err)
+
+		var propagations int
+		for len(samples) > 0 {
+			for _, sample := range (<-samples).GetSamples() {
+				if sample.Metric.Name == "dns_notify_propagation" {
+					propagations++
+					assert.Positive(t, sample.Value)
+				}
+			}
+		}
+		assert.Equal(t, 1, propagations)
+	})
+
+	t.Run("Notifying in the init context should fail", func(t *testing.T) {
+		t.Parallel()
+
+		runtime, err := newConfiguredRuntime(t)
+		require.NoError(t, err)
+
+		_, err = runtime.RunOnEventLoop(wrapInAsyncLambda(`
+			await dns.notify("k6.test", "127.0.0.1:53");
+		`))
+		assert.Error(t, err)
+	})
+}
+
+func TestClient_Exchange(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Exchanging a crafted message should resolve to the raw and parsed response", func(t *testing.T) {
+		t.Parallel()
+
+		nameserver := startTestNameserver(t, func(w dns.ResponseWriter, r *dns.Msg) {
+			response := new(dns.Msg)
+			response.SetRcode(r, dns.RcodeFormatError)
+			response.Question = r.Question
+			assert.NoError(t, w.WriteMsg(response))
+		})
+
+		runtime, err := newConfiguredRuntime(t)
+		require.NoError(t, err)
+
+		samples := make(chan metrics.SampleContainer, 1024)
+		runtime.MoveToVUContext(&lib.State{
+			BuiltinMetrics: metrics.RegisterBuiltinMetrics(metrics.NewRegistry()),
+			Tags:           lib.NewVUStateTags(metrics.NewRegistry().RootTagSet().With("tag-vu", "mytag")),
+			Samples:        samples,
+		})
+
+		_, err = runtime.RunOnEventLoop(wrapInAsyncLambda(`
+			const query = dns.pack({
+				id: 4242,
+				opcode: "QUERY",
+				questions: [{ name: "a.k6.test", type: "A" }, { name: "b.k6.test", type: "AAAA" }],
+				edns: { udpSize: 1232, dnssecOk: true },
+			});
+
+			if (!(query instanceof ArrayBuffer)) {
+				throw "Packing should return an ArrayBuffer, got " + query;
+			}
+
+			const exchanged = await dns.exchange(query, "` + nameserver.Addr() + `", { transport: "tcp", timeout: "1s" });
+
+			if (!(exchanged.bytes instanceof ArrayBuffer) || exchanged.duration <= 0) {
+				throw "Exchanging returned unexpected results, got " + JSON.stringify(exchanged);
+			}
+
+			const response = exchanged.message;
+			if (response.id !== 4242 || response.rcode !== "FORMERR" || response.questions.length !== 2) {
+				throw "Exchanging returned an unexpected response, got " + JSON.stringify(response);
+			}
+
+			const unpacked = dns.unpack(new Uint8Array(exchanged.bytes));
+			if (unpacked.questions[1].type !== "AAAA" || !unpacked.response) {
+				throw "Unpacking returned an unexpected message, got " + JSON.stringify(unpacked);
+			}
+		`))
+		require.NoError(t, err)
+
+		var exchanges int
+		for len(samples) > 0 {
+			for _, sample := range (<-samples).GetSamples() {
+				if sample.Metric.Name == "dns_exchanges" {
+					exchanges++
+					assert.Equal(t, "tcp", sample.Tags.Map()["transport"])
+				}
+			}
+		}
+		assert.Equal(t, 1, exchanges)
+	})
+
+	t.Run("Modifying a buffer being exchanged should not alter the query", func(t *testing.T) {
+		t.Parallel()
+
+		nameserver := startTestNameserver(t, writeTestAnswerHandler(t))
+
+		runtime, err := newConfiguredRuntime(t)
+		require.NoError(t, err)
+
+		runtime.MoveToVUContext(&lib.State{
+			BuiltinMetrics: metrics.RegisterBuiltinMetrics(metrics.NewRegistry()),
+			Tags:           lib.NewVUStateTags(metrics.NewRegistry().RootTagSet().With("tag-vu", "mytag")),
+			Samples:        make(chan metrics.SampleContainer, 1024),
+		})
+
+		_, err = runtime.RunOnEventLoop(wrapInAsyncLambda(`
+			const query = dns.pack({ id: 4242, questions: [{ name: "` + testDomain + `", type: "A" }] });
+
+			const exchanging = dns.exchange(query, "` + nameserver.Addr() + `", { timeout: "1s" });
+			new Uint8Array(query).fill(0);
+
+			const response = (await exchanging).message;
+			if (response.id !== 4242 || response.answer.length !== 1) {
+				throw "Exchanging returned an unexpected response, got " + JSON.stringify(response);
+			}
+		`))
+		require.NoError(t, err)
+	})
+
+	t.Run("Exchanging in the init context should fail", func(t *testing.T) {
+		t.Parallel()
+
+		runtime, err := newConfiguredRuntime(t)
+		require.NoError(t, err)
+
+		_, err = runtime.RunOnEventLoop(wrapInAsyncLambda(`
+			await dns.exchange(dns.pack({ questions: [{ name: "k6.test", type: "A" }] }), "127.0.0.1:53");
+		`))
+		assert.Error(t, err)
+	})
+
+	t.Run("Packing an invalid message should throw", func(t *testing.T) {
+		t.Parallel()
+
+		runtime, err := newConfiguredRuntime(t)
+		require.NoError(t, err)
+
+		_, err = runtime.RunOnEventLoop(wrapInAsyncLambda(`
+			dns.pack({ questions: [{ name: "k6.test", type: "NOPE" }] });
+		`))
+		assert.Error(t, err)
+	})
+}
+
+func TestClient_Fuzz(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Fuzzing should report the outcome of every case, and be replayable", func(t *testing.T) {
+		t.Parallel()
+
+		nameserver := startTestNameserver(t, writeTestAnswerHandler(t))
+
+		runtime, err := newConfiguredRuntime(t)
+		require.NoError(t, err)
+
+		samples := make(chan metrics.SampleContainer, 1024)
+		runtime.MoveToVUContext(&lib.State{
+			BuiltinMetrics: metrics.RegisterBuiltinMetrics(metrics.NewRegistry()),
+			Tags:           lib.NewVUStateTags(metrics.NewRegistry().RootTagSet().With("tag-vu", "mytag")),
+			Samples:        samples,
+		})
+
+		_, err = runtime.RunOnEventLoop(wrapInAsyncLambda(`
+			const query = dns.pack({ id: 7, questions: [{ name: "www.k6.test", type: "A" }] });
+			const mutations = ["truncatedHeader", "bitFlip", "compressionLoop"];
+
+			const result = await dns.fuzz(query, "` + nameserver.Addr() + `", {
+				seed: 9007199254740991,
+				count: 8,
+				mutations: mutations,
+				timeout: "50ms",
+			});
+
+			if (result.seed !== 9007199254740991 || result.cases.length !== 8 || result.unhealthy !== 0) {
+				throw "Fuzzing returned unexpected results, got " + JSON.stringify(result);
+			}
+
+			if (result.responded + result.formerr + result.dropped !== 8) {
+				throw "Fuzzing returned inconsistent outcomes, got " + JSON.stringify(result);
+			}
+
+			for (const fuzzCase of result.cases) {
+				const replayed = dns.mutate(query, fuzzCase.seed, mutations);
+				if (!(replayed.bytes instanceof ArrayBuffer) || replayed.mutation !== fuzzCase.mutation) {
+					throw "Replaying case " + fuzzCase.index + " returned " + JSON.stringify(replayed);
+				}
+			}
+		`))
+		require.NoError(t, err)
+
+		var cases int
+		for len(samples) > 0 {
+			for _, sample := range (<-samples).GetSamples() {
+				if sample.Metric.Name == "dns_fuzz_cases" {
+					cases++
+					assert.NotEmpty(t, sample.Tags.Map()["outcome"])
+				}
+			}
+		}
+		assert.Equal(t, 8, cases)
+	})
+
+	t.Run("Fuzzing in the init context should fail", func(t *testing.T) {
+		t.Parallel()
+
+		runtime, err := newConfiguredRuntime(t)
+		require.NoError(t, err)
+
+		_, err = runtime.RunOnEventLoop(wrapInAsyncLambda(`
+			await dns.fuzz(dns.pack({ questions: [{ name: "k6.test", type: "A" }] }), "127.0.0.1:53");
+		`))
+		assert.Error(t, err)
+	})
+}
+
+func TestClient_Server(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Servers should answer from their zone, and be stopped by address", func(t *testing.T) {
+		t.Parallel()
+
+		runtime, err := newConfiguredRuntime(t)
+		require.NoError(t, err)
+
+		samples := make(chan metrics.SampleContainer, 1024)
+		runtime.MoveToVUContext(&lib.State{
+			BuiltinMetrics: metrics.RegisterBuiltinMetrics(metrics.NewRegistry()),
+			Tags:           lib.NewVUStateTags(metrics.NewRegistry().RootTagSet().With("tag-vu", "mytag")),
+			Samples:        samples,
+		})
+
+		_, err = runtime.RunOnEventLoop(wrapInAsyncLambda(`
+			const server = new dns.Server({
+				zone: {
+					name: "k6.test",
+					records: [
+						"@ 3600 IN SOA ns.k6.test. admin.k6.test. 7 3600 600 86400 300",
+						"www 60 IN A ` + primaryTestIPv4 + `",
+					],
+				},
+				latency: "5ms",
+			});
+
+			const address = server.start();
+			if (address !== server.address) {
+				throw "The server's address should be " + address + ", got " + server.address;
+			}
+
+			const ips = await dns.resolve("www.k6.test", "A", address);
+			if (ips.length !== 1 || ips[0] !== "` + primaryTestIPv4 + `") {
+				throw "Resolving from the server returned unexpected results, got " + JSON.stringify(ips);
+			}
+
+			dns.stopServer(address);
+
+			let stopped = false;
+			try {
+				dns.stopServer(address);
+			} catch (e) {
+				stopped = true;
+			}
+
+			if (!stopped) {
+				throw "Stopping a stopped server should throw";
+			}
+		`))
+		require.NoError(t, err)
+
+		var queries int
+		for len(samples) > 0 {
+			for _, sample := range (<-samples).GetSamples() {
+				if sample.Metric.Name == "dns_server_queries" {
+					queries++
+					assert.Equal(t, "NOERROR", sample.Tags.Map()["rcode"])
+				}
+			}
+		}
+		assert.Equal(t, 1, queries)
+	})
+
+	t.Run("Servers should answer using their handler", func(t *testing.T) {
+		t.Parallel()
+
+		runtime, err := newConfiguredRuntime(t)
+		require.NoError(t, err)
+
+		runtime.MoveToVUContext(&lib.State{
+			VUID:           1,
+			BuiltinMetrics: metrics.RegisterBuiltinMetrics(metrics.NewRegistry()),
+			Tags:           lib.NewVUStateTags(metrics.NewRegistry().RootTagSet().With("tag-vu", "mytag")),
+			Samples:        make(chan metrics.SampleContainer, 1024),
+		})
+
+		_, err = runtime.RunOnEventLoop(wrapInAsyncLambda(`
+			const server = new dns.Server({
+				handler: (query, info) => {
+					if (query.questions[0].name === "refused.k6.test.") {
+						return { rcode: "REFUSED" };
+					}
+
+					return {
+						authoritative: true,
+						answer: [query.questions[0].name + " 60 IN A ` + primaryTestIPv4 + `"],
+					};
+				},
+			});
+
+			const address = server.start();
+
+			try {
+				const ips = await dns.resolve("www.k6.test", "A", address);
+				if (ips.length !== 1 || ips[0] !== "` + primaryTestIPv4 + `") {
+					throw "Resolving from the handler returned unexpected results, got " + JSON.stringify(ips);
+				}
+
+				let refused = false;
+				try {
+					await dns.resolve("refused.k6.test", "A", address);
+				} catch (e) {
+					refused = e.name === "Refused";
+				}
+
+				if (!refused) {
+					throw "The handler's rcode should have been returned";
+				}
+			} finally {
+				server.stop();
+			}
+		`))
+		require.NoError(t, err)
+	})
+
+	t.Run("Servers answering using a handler started in setup should answer once it returns", func(t *testing.T) {
+		t.Parallel()
+
+		root := New()
+		runtime := modulestest.NewRuntime(t)
+		require.NoError(t, runtime.SetupModuleSystem(map[string]interface{}{"k6/x/dns": root}, nil, nil))
+		_, err := runtime.VU.Runtime().RunString(initGlobals)
+		require.NoError(t, err)
+
+		// setup() runs in a VU with ID 0, whose context is done once it returns.
+		ctx, cancel := context.WithCancel(context.Background())
+		runtime.MoveToVUContext(&lib.State{
+			BuiltinMetrics: metrics.RegisterBuiltinMetrics(metrics.NewRegistry()),
+			Tags:           lib.NewVUStateTags(metrics.NewRegistry().RootTagSet().With("tag-vu", "mytag")),
+			Samples:        make(chan metrics.SampleContainer, 1024),
+		})
+		runtime.VU.CtxField = ctx
+
+		_, err = runtime.RunOnEventLoop(wrapInAsyncLambda(`
+			globalThis.address = new dns.Server({
+				handler: (query) => ({ answer: [query.questions[0].name + " 60 IN A ` + primaryTestIPv4 + `"] }),
+			}).start();
+		`))
+		require.NoError(t, err)
+
+		address := runtime.VU.Runtime().Get("address").String()
+		t.Cleanup(func() {
+			server, ok := root.servers.Load(address)
+			require.True(t, ok)
+			server.(*jsServer).stop() //nolint:forcetypeassert
+		})
+
+		// k6 interrupts the runtime of setup() once it returned.
+		cancel()
+		runtime.VU.Runtime().Interrupt(context.Canceled)
+
+		nameserver, err := parseNameserverAddr(address)
+		require.NoError(t, err)
+
+		for i := 0; i < 2; i++ {
+			resolution, err := NewDNSClient().ResolveWithOptions(
+				context.Background(), testDomain, "A", nameserver, ClientOptions{},
+			)
+			require.NoError(t, err)
+			assert.Equal(t, []string{primaryTestIPv4}, resolution.IPs)
+		}
+	})
+
+	t.Run("Servers without a zone or handler should throw", func(t *testing.T) {
+		t.Parallel()
+
+		runtime, err := newConfiguredRuntime(t)
+		require.NoError(t, err)
+
+		_, err = runtime.RunOnEventLoop(wrapInAsyncLambda(`
+			new dns.Server({ latency: "5ms" });
+		`))
+		assert.Error(t, err)
+	})
+}
+
+func TestClient_Lookup(t *testing.T) {
+	t.Parallel()
+
+	t.Run("Lookup fails in the init context", func(t *testing.T) {
+		t.Parallel()
+
+		runtime, err := newConfiguredRuntime(t)
+		require.NoError(t, err)
+
+		_, err = runtime.RunOnEventLoop(wrapInAsyncLambda(`
+			await dns.lookup("localhost");
+		`))
+
+		// network operations are forbidden in the init context, thus
+		// we explicitly expect an error here
+		assert.Error(t, err)
+	})
+
+	t.Run("Lookup returns the system's default resolver results", func(t *testing.T) {
+		t.Parallel()
+
+		ctx := context.Background()
+		wantIPs, err := net.DefaultResolver.LookupHost(ctx, "localhost")
+		require.NoError(t, err)
+
+		runtime, err := newConfiguredRuntime(t)
+		require.NoError(t, err)
+
+		// Setting up the runtime with the necessary state
+		runtime.MoveToVUContext(&lib.State{
+			BuiltinMetrics: metrics.RegisterBuiltinMetrics(metrics.NewRegistry()),
+			Tags:           lib.NewVUStateTags(metrics.NewRegistry().RootTagSet().With("tag-vu", "mytag")),
+			Samples:        make(chan metrics.SampleContainer, 1024),
+		})
+
+		_, gotErr := runtime.RunOnEventLoop(wrapInAsyncLambda(fmt.Sprintf(`
+			const lookupResults = await dns.lookup("localhost");
+
+			if (lookupResults.length !== %d) {
+				throw "Looking up localhost using the system's default resolver returned unexpected number of results, expected %d, got " + lookupResults
+			}
+		`, len(wantIPs), len(wantIPs))))
+
+		assert.NoError(t, gotErr)
+	})
+}
+
+const initGlobals = `
+	globalThis.dns = require("k6/x/dns");
+`
+
+func newConfiguredRuntime(t testing.TB) (*modulestest.Runtime, error) {
+	runtime := modulestest.NewRuntime(t)
+
+	err := runtime.SetupModuleSystem(
+		map[string]interface{}{"k6/x/dns": New()},
+		nil,
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Ensure the `fs` module is available in the VU's runtime.
+	_, err = runtime.VU.Runtime().RunString(initGlobals)
+	require.NoError(t, err)
+
+	return runtime, err
+}
+
+// wrapInAsyncLambda is a helper function that wraps the provided input in an async lambda. This
+// makes the use of `await` statements in the input possible.
+func wrapInAsyncLambda(input string) string {
+	// This makes it possible to use `await` freely on the "top" level
+	return "(async () => {\n " + input + "\n })()"
+}
+
+// startTestZoneServer starts an in-process nameserver resolving the testDomain to the
+// primary and secondary test IPs, and returns its address.
+func startTestZoneServer(t *testing.T) string {
+	t.Helper()
+
+	zone, err := dnstest.NewZone(
+		testDomain,
+		testDomain+". 0 IN SOA ns."+testDomain+". admin."+testDomain+". 1 3600 600 86400 0",
+		testDomain+". 0 IN A "+primaryTestIPv4,
+		testDomain+". 0 IN A "+secondaryTestIPv4,
+		testDomain+". 0 IN AAAA "+primaryTestIPv6,
+		testDomain+". 0 IN AAAA "+secondaryTestIPv6,
+	)
+	require.NoError(t, err)
+
+	server := dnstest.NewServer(zone)
+	t.Cleanup(server.Close)
 
-// String returns the unbound configuration entry for the unboundRecord.
-func (c unboundRecord) String() string {
-	return fmt.Sprintf(`local-data: "%s. 0 IN %s %s"`, c.Domain, c.RecordType, c.IP)
+	return server.Addr
 }
@@ -0,0 +1,243 @@
+package dns
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+)
+
+// Mutation represents a way of corrupting a well-formed DNS message.
+type Mutation string
+
+const (
+	// MutationLabelLength corrupts the length of a label of the first question's name,
+	// either with a reserved label type, or with a length overrunning the message.
+	MutationLabelLength Mutation = "labelLength"
+
+	// MutationCompressionLoop replaces the first question's name with compression
+	// pointers pointing back at themselves.
+	MutationCompressionLoop Mutation = "compressionLoop"
+
+	// MutationTruncatedHeader truncates the message within its 12 bytes header.
+	MutationTruncatedHeader Mutation = "truncatedHeader"
+
+	// MutationOversizedEDNS appends an OPT pseudo-record either holding a single
+	// option of several kilobytes, or whose option lengths overrun its data.
+	MutationOversizedEDNS Mutation = "oversizedEdns"
+
+	// MutationSectionCount changes the record count of one of the message's sections,
+	// so that it no longer matches the records the section holds.
+	MutationSectionCount Mutation = "sectionCount"
+
+	// MutationBitFlip flips up to 8 random bits of the message.
+	MutationBitFlip Mutation = "bitFlip"
+)
+
+// Mutations holds every supported mutation.
+var Mutations = []Mutation{ //nolint:gochecknoglobals
+	MutationLabelLength,
+	MutationCompressionLoop,
+	MutationTruncatedHeader,
+	MutationOversizedEDNS,
+	MutationSectionCount,
+	MutationBitFlip,
+}
+
+// maxSeed is the largest mutation seed. Seeds are kept below 2^53 so that they can be
+// represented exactly by JS numbers, and replayed from k6 scripts.
+const maxSeed = 1<<53 - 1
+
+// mutationStream is the PCG stream mutation seeds select, for a seed to always
+// produce the same mutation.
+const mutationStream = 0x6b36646e73
+
+// headerSize is the size of the DNS message header, as per RFC 1035.
+const headerSize = 12
+
+// Validate checks that the mutation is supported.
+func (m Mutation) Validate() error {
+	for _, mutation := range Mutations {
+		if m == mutation {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unsupported mutation %q; expected one of %q", m, Mutations)
+}
+
+// Mutate corrupts the packed message, using one of the mutations picked using the
+// seed, and returns the corrupted message along with the mutation applied. The same
+// message, seed and mutations always produce the same corrupted message.
+//
+// The message is expected to be well-formed, and to hold at least one question.
+// Mutations default to every supported mutation.
+func Mutate(packed []byte, seed uint64, mutations []Mutation) ([]byte, Mutation, error) {
+	if len(mutations) == 0 {
+		mutations = Mutations
+	}
+
+	for _, mutation := range mutations {
+		if err := mutation.Validate(); err != nil {
+			return nil, "", err
+		}
+	}
+
+	nameStart, nameEnd, err := questionNameBounds(packed)
+	if err != nil {
+		return nil, "", err
+	}
+
+	rng := rand.New(rand.NewPCG(seed, mutationStream)) //nolint:gosec // mutations must be reproducible
+	mutation := mutations[rng.IntN(len(mutations))]
+
+	// The message is copied, as mutations corrupt it in place.
+	mutated := append([]byte(nil), packed...)
+
+	switch mutation {
+	case MutationLabelLength:
+		mutated = mutateLabelLength(rng, mutated, nameStart, nameEnd)
+	case MutationCompressionLoop:
+		mutated = mutateCompressionLoop(rng, mutated, nameStart, nameEnd)
+	case MutationTruncatedHeader:
+		mutated = mutated[:1+rng.IntN(headerSize-1)]
+	case MutationOversizedEDNS:
+		mutated = mutateOversizedEDNS(rng, mutated)
+	case MutationSectionCount:
+		mutated = mutateSectionCount(rng, mutated)
+	case MutationBitFlip:
+		for flips := 1 + rng.IntN(8); flips > 0; flips-- {
+			bit := rng.IntN(len(mutated) * 8)
+			mutated[bit/8] ^= 1 << (bit % 8)
+		}
+	}
+
+	return mutated, mutation, nil
+}
+
+// questionNameBounds returns the offsets of the first and past the last byte of the
+// first question's name.
+func questionNameBounds(packed []byte) (int, int, error) {
+	if len(packed) < headerSize || binary.BigEndian.Uint16(packed[4:]) == 0 {
+		return 0, 0, errors.New("the message to mutate must hold at least one question")
+	}
+
+	offset := headerSize
+	for offset < len(packed) {
+		length := int(packed[offset])
+
+		switch {
+		case length == 0:
+			return headerSize, offset + 1, nil
+		case length&0xC0 == 0xC0:
+			return headerSize, offset + 2, nil
+		case length&0xC0 != 0:
+			return 0, 0, errors.New("the message to mutate holds an invalid question name")
+		}
+
+		offset += 1 + length
+	}
+
+	return 0, 0, errors.New("the message to mutate holds a truncated question name")
+}
+
+// mutateLabelLength corrupts the length of one of the labels of the name found
+// between start and end.
+func mutateLabelLength(rng *rand.Rand, packed []byte, start, end int) []byte {
+	var labels []int
+	for offset := start; offset < end && packed[offset] != 0 && packed[offset]&0xC0 == 0; {
+		labels = append(labels, offset)
+		offset += 1 + int(packed[offset])
+	}
+
+	// The root name has no label, thus its terminating byte is corrupted instead.
+	label := start
+	if len(labels) > 0 {
+		label = labels[rng.IntN(len(labels))]
+	}
+
+	if rng.IntN(2) == 0 {
+		// Label types 0b01 and 0b10 are reserved.
+		packed[label] = byte(0x40 + rng.IntN(0x80))
+	} else {
+		// The label overruns the message, up to the maximum label length.
+		remaining := len(packed) - label - 1
+		packed[label] = byte(min(remaining+1+rng.IntN(8), 63))
+		if int(packed[label]) <= remaining {
+			packed = packed[:label+1]
+		}
+	}
+
+	return packed
+}
+
+// mutateCompressionLoop replaces the name found between start and end with
+// compression pointers looping back at themselves, either directly, or after the
+// name's first label.
+func mutateCompressionLoop(rng *rand.Rand, packed []byte, start, end int) []byte {
+	pointer := []byte{0xC0 | byte(start>>8), byte(start)}
+
+	var name []byte
+	if length := int(packed[start]); rng.IntN(2) == 0 && length > 0 && length&0xC0 == 0 {
+		name = append(name, packed[start:start+1+length]...)
+	}
+
+	name = append(name, pointer...)
+
+	mutated := append([]byte(nil), packed[:start]...)
+	mutated = append(mutated, name...)
+
+	return append(mutated, packed[end:]...)
+}
+
+// mutateOversizedEDNS appends an OPT pseudo-record to the message, either holding a
+// padding option of several kilobytes, or with an option length overrunning its data.
+func mutateOversizedEDNS(rng *rand.Rand, packed []byte) []byte {
+	var rdata []byte
+	if rng.IntN(2) == 0 {
+		size := 4096 + rng.IntN(8192)
+		rdata = binary.BigEndian.AppendUint16(rdata, 12) // Padding, as per RFC 7830
+		rdata = binary.BigEndian.AppendUint16(rdata, uint16(size))
+		rdata = append(rdata, make([]byte, size)...)
+	} else {
+		rdata = binary.BigEndian.AppendUint16(rdata, 10) // Cookie, as per RFC 7873
+		rdata = binary.BigEndian.AppendUint16(rdata, uint16(64+rng.IntN(0xFF00)))
+		rdata = append(rdata, make([]byte, 8)...)
+	}
+
+	// The OPT record is owned by the root name, and advertises the largest UDP size.
+	packed = append(packed, 0)
+	packed = binary.BigEndian.AppendUint16(packed, 41)
+	packed = binary.BigEndian.AppendUint16(packed, 0xFFFF)
+	packed = binary.BigEndian.AppendUint32(packed, 0)
+	packed = binary.BigEndian.AppendUint16(packed, uint16(len(rdata))) //nolint:gosec
+	packed = append(packed, rdata...)
+
+	arcount := binary.BigEndian.Uint16(packed[10:])
+	binary.BigEndian.PutUint16(packed[10:], arcount+1)
+
+	return packed
+}
+
+// mutateSectionCount changes the record count of one of the message's sections.
+func mutateSectionCount(rng *rand.Rand, packed []byte) []byte {
+	offset := 4 + 2*rng.IntN(4)
+	count := binary.BigEndian.Uint16(packed[offset:])
+
+	switch rng.IntN(3) {
+	case 0:
+		count++
+	case 1:
+		count = 0xFFFF
+	default:
+		count += uint16(2 + rng.IntN(16))
+	}
+
+	if count == binary.BigEndian.Uint16(packed[offset:]) {
+		count++
+	}
+
+	binary.BigEndian.PutUint16(packed[offset:], count)
+
+	return packed
+}
@@ -0,0 +1,117 @@
+package dns
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMutate(t *testing.T) {
+	t.Parallel()
+
+	query := new(dns.Msg)
+	query.SetQuestion("www.k6.test.", dns.TypeA)
+
+	packed, err := query.Pack()
+	require.NoError(t, err)
+
+	t.Run("mutations are reproducible from their seed", func(t *testing.T) {
+		t.Parallel()
+
+		for seed := uint64(0); seed < 64; seed++ {
+			first, firstMutation, err := Mutate(packed, seed, nil)
+			require.NoError(t, err)
+
+			second, secondMutation, err := Mutate(packed, seed, nil)
+			require.NoError(t, err)
+
+			assert.Equal(t, firstMutation, secondMutation)
+			assert.Equal(t, first, second)
+		}
+	})
+
+	t.Run("mutations don't alter the original message", func(t *testing.T) {
+		t.Parallel()
+
+		original := append([]byte(nil), packed...)
+		for seed := uint64(0); seed < 64; seed++ {
+			_, _, err := Mutate(packed, seed, nil)
+			require.NoError(t, err)
+		}
+
+		assert.Equal(t, original, packed)
+	})
+
+	for _, mutation := range []Mutation{
+		MutationLabelLength,
+		MutationCompressionLoop,
+		MutationTruncatedHeader,
+	} {
+		t.Run(string(mutation)+" mutations produce malformed messages", func(t *testing.T) {
+			t.Parallel()
+
+			for seed := uint64(0); seed < 32; seed++ {
+				mutated, applied, err := Mutate(packed, seed, []Mutation{mutation})
+				require.NoError(t, err)
+				assert.Equal(t, mutation, applied)
+
+				assert.Error(t, new(dns.Msg).Unpack(mutated), "seed %d", seed)
+			}
+		})
+	}
+
+	t.Run("oversized EDNS mutations announce the OPT record", func(t *testing.T) {
+		t.Parallel()
+
+		mutated, _, err := Mutate(packed, 1, []Mutation{MutationOversizedEDNS})
+		require.NoError(t, err)
+
+		assert.Equal(t, uint16(1), binary.BigEndian.Uint16(mutated[10:]))
+		assert.Greater(t, len(mutated), len(packed))
+	})
+
+	t.Run("section count mutations change a single count", func(t *testing.T) {
+		t.Parallel()
+
+		for seed := uint64(0); seed < 32; seed++ {
+			mutated, _, err := Mutate(packed, seed, []Mutation{MutationSectionCount})
+			require.NoError(t, err)
+
+			require.Len(t, mutated, len(packed))
+			assert.Equal(t, packed[:4], mutated[:4])
+			assert.NotEqual(t, packed[4:headerSize], mutated[4:headerSize])
+			assert.Equal(t, packed[headerSize:], mutated[headerSize:])
+		}
+	})
+
+	t.Run("bit flips keep the message's size", func(t *testing.T) {
+		t.Parallel()
+
+		for seed := uint64(0); seed < 32; seed++ {
+			mutated, _, err := Mutate(packed, seed, []Mutation{MutationBitFlip})
+			require.NoError(t, err)
+
+			assert.Len(t, mutated, len(packed))
+			assert.NotEqual(t, packed, mutated)
+		}
+	})
+
+	t.Run("invalid messages and mutations are rejected", func(t *testing.T) {
+		t.Parallel()
+
+		_, _, err := Mutate(packed, 1, []Mutation{"shuffle"})
+		assert.Error(t, err)
+
+		_, _, err = Mutate(packed[:8], 1, nil)
+		assert.Error(t, err)
+
+		noQuestion, err := new(dns.Msg).Pack()
+		require.NoError(t, err)
+
+		_, _, err = Mutate(noQuestion, 1, nil)
+		assert.Error(t, err)
+	})
+}
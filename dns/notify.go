@@ -0,0 +1,178 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/grafana/sobek"
+	"go.k6.io/k6/js/common"
+	"go.k6.io/k6/js/promises"
+	"go.k6.io/k6/lib/types"
+	"go.k6.io/k6/metrics"
+)
+
+// notifyResult is the JS representation of a NotifySummary.
+type notifyResult struct {
+	Duration    float64 `js:"duration"`
+	Serial      uint32  `js:"serial"`
+	Polls       int     `js:"polls"`
+	Propagation float64 `js:"propagation"`
+}
+
+// Notify notifies the nameserver of a change of the zone, and waits for it to acknowledge
+// the NOTIFY message. When the waitForSerial option is set, it then polls the nameserver's
+// SOA record until it serves the new serial.
+//
+// It returns a promise resolving to the milliseconds the acknowledgement took, along
+// with, when waiting for the serial, the last serial served, the number of polls, and
+// the milliseconds the change took to propagate to the nameserver.
+func (mi *ModuleInstance) Notify(zone, nameserverAddr, options sobek.Value) *sobek.Promise {
+	promise, resolve, reject := promises.New(mi.vu)
+
+	if mi.vu.State() == nil {
+		reject(errors.New("notify can not be used in the init context"))
+		return promise
+	}
+
+	var zoneStr string
+	if err := mi.vu.Runtime().ExportTo(zone, &zoneStr); err != nil || zoneStr == "" {
+		reject(fmt.Errorf("zone must be a non-empty string; got %v instead", zone))
+		return promise
+	}
+
+	var nameserverAddrStr string
+	if common.IsNullish(nameserverAddr) || mi.vu.Runtime().ExportTo(nameserverAddr, &nameserverAddrStr) != nil {
+		reject(fmt.Errorf("nameserver must be a string; got %v instead", nameserverAddr))
+		return promise
+	}
+
+	nameserver, err := parseNameserverAddr(nameserverAddrStr)
+	if err != nil {
+		reject(fmt.Errorf("parsing nameserver address failed: %w", err))
+		return promise
+	}
+
+	notifyOptions, err := parseNotifyOptions(mi.vu.Runtime(), options)
+	if err != nil {
+		reject(err)
+		return promise
+	}
+
+	go func() {
+		summary, notifyErr := mi.dnsClient.Notify(mi.vu.Context(), zoneStr, nameserver, notifyOptions)
+
+		// Recording failures don't fail the notify
+		mi.logRecordingFailure(summary.RecordingErr)
+
+		mi.emitNotifyMetrics(mi.vu.Context(), zoneStr, nameserver, summary, notifyErr)
+
+		if notifyErr != nil {
+			reject(notifyErr)
+			return
+		}
+
+		resolve(notifyResult{
+			Duration:    durationMillis(summary.Duration),
+			Serial:      summary.Serial,
+			Polls:       summary.Polls,
+			Propagation: durationMillis(summary.Propagation),
+		})
+	}()
+
+	return promise
+}
+
+// parseNotifyOptions parses the options of a dns.notify call.
+func parseNotifyOptions(rt *sobek.Runtime, options sobek.Value) (NotifyOptions, error) {
+	var notifyOptions NotifyOptions
+	if common.IsNullish(options) {
+		return notifyOptions, nil
+	}
+
+	if err := rt.ExportTo(options, &notifyOptions); err != nil {
+		return NotifyOptions{}, fmt.Errorf("options must be an object; got %v instead", options)
+	}
+
+	optionsObj := options.ToObject(rt)
+	for name, dst := range map[string]*time.Duration{
+		"pollInterval": &notifyOptions.PollInterval,
+		"pollTimeout":  &notifyOptions.PollTimeout,
+	} {
+		value := optionsObj.Get(name)
+		if common.IsNullish(value) {
+			continue
+		}
+
+		duration, err := types.GetDurationValue(value.Export())
+		if err != nil {
+			return NotifyOptions{}, fmt.Errorf("invalid %s option: %w", name, err)
+		}
+
+		*dst = duration
+	}
+
+	if err := notifyOptions.Validate(); err != nil {
+		return NotifyOptions{}, fmt.Errorf("invalid options: %w", err)
+	}
+
+	return notifyOptions, nil
+}
+
+// emitNotifyMetrics emits the metrics specific to dns.notify operations.
+func (mi *ModuleInstance) emitNotifyMetrics(
+	ctx context.Context,
+	zone string,
+	nameserver Nameserver,
+	summary NotifySummary,
+	notifyErr error,
+) {
+	state := mi.vu.State()
+
+	tags := state.Tags.GetCurrentValues().Tags
+	tags = tags.With("zone", zone)
+	tags = tags.With("nameserver", nameserver.Addr())
+
+	now := time.Now()
+
+	// Emit the acknowledgement duration
+	metrics.PushIfNotDone(ctx, state.Samples, metrics.Sample{
+		TimeSeries: metrics.TimeSeries{
+			Metric: mi.metrics.DNSNotifyDuration,
+			Tags:   tags,
+		},
+		Time:     now,
+		Value:    durationMillis(summary.Duration),
+		Metadata: nil,
+	})
+
+	// Emit the propagation delay, only known once the nameserver served the new serial
+	if summary.Propagation > 0 {
+		metrics.PushIfNotDone(ctx, state.Samples, metrics.Sample{
+			TimeSeries: metrics.TimeSeries{
+				Metric: mi.metrics.DNSNotifyPropagation,
+				Tags:   tags,
+			},
+			Time:     now,
+			Value:    durationMillis(summary.Propagation),
+			Metadata: nil,
+		})
+	}
+
+	var failed float64
+	if notifyErr != nil {
+		failed = 1
+	}
+
+	// Emit the DNS notify failed rate
+	metrics.PushIfNotDone(ctx, state.Samples, metrics.Sample{
+		TimeSeries: metrics.TimeSeries{
+			Metric: mi.metrics.DNSNotifyFailed,
+			Tags:   tags,
+		},
+		Time:     now,
+		Value:    failed,
+		Metadata: nil,
+	})
+}
@@ -0,0 +1,228 @@
+package dns
+
+import (
+	"errors"
+	"fmt"
+	"net"
+)
+
+// ClientOptions holds the options controlling how the Client builds and sends its queries.
+//
+// The zero value is a valid configuration, and matches the Client's historical behavior:
+// queries sent over UDP with random IDs, from a source address and port picked by the
+// kernel, and with query names sent as-is.
+type ClientOptions struct {
+	// QueryID controls how the ID of outgoing DNS messages is generated.
+	QueryID QueryIDOptions `js:"queryId"`
+
+	// Transport holds the transport protocol queries are sent over. It defaults
+	// to TransportUDP.
+	Transport Transport `js:"transport"`
+
+	// TLS holds the options used when Transport is TransportTLS.
+	TLS TLSOptions `js:"tls"`
+
+	// ConnectionReuse controls whether, and across which queries, connections to
+	// nameservers are reused. It defaults to ConnectionReuseNone for clients created
+	// with NewDNSClient, and to ConnectionReuseVU for the k6 module's clients.
+	ConnectionReuse ConnectionReuseMode `js:"connectionReuse"`
+
+	// Cache controls whether, and how, resolutions are cached.
+	Cache CacheOptions `js:"cache"`
+
+	// LocalAddress holds the IPv4 or IPv6 address queries are sent from.
+	//
+	// When left empty, the kernel picks the source address.
+	LocalAddress string `js:"localAddress"`
+
+	// Interface holds the name of the network interface queries are sent from. The
+	// interface's first address of the same IP family as the nameserver is used as
+	// source address, and, on Linux, the sockets are bound to the interface using
+	// SO_BINDTODEVICE. It is mutually exclusive with LocalAddress.
+	Interface string `js:"interface"`
+
+	// SourcePort restricts the local port queries are sent from to the given range.
+	//
+	// When left empty, the kernel picks the source port.
+	SourcePort PortRange `js:"sourcePort"`
+
+	// RandomizeCase enables DNS 0x20 mixed-case query randomization.
+	//
+	// When enabled, the case of each letter of the query name is randomized before
+	// being sent, and the response is verified to echo the query name with the exact
+	// same case. Responses that don't are rejected with ErrResponseMismatch.
+	RandomizeCase bool `js:"randomizeCase"`
+
+	// ResponseValidation controls whether, and how strictly, responses are validated
+	// against the query they answer. It defaults to ResponseValidationNone.
+	ResponseValidation ResponseValidationMode `js:"responseValidation"`
+
+	// ValidateDNSSEC enables the DNSSEC validation of responses.
+	//
+	// When enabled, queries are sent with the DO and CD bits set, and the chain of
+	// trust of the response's records is built, and verified, from the trust anchors
+	// down, querying the nameserver for the DNSKEY and DS records of each zone.
+	ValidateDNSSEC bool `js:"validate"`
+
+	// TrustAnchors holds the DS or DNSKEY records, in presentation format, DNSSEC
+	// validation starts from. It defaults to DefaultTrustAnchors, the root zone's keys.
+	TrustAnchors []string `js:"trustAnchors"`
+
+	// TSIG holds the key queries are signed with, if any. Responses are then verified
+	// using the same key. It is also the default key of the Client's zone transfers and
+	// dynamic updates.
+	//
+	// Signed queries are sent over a dedicated connection, regardless of ConnectionReuse,
+	// as their responses' signatures chain to the query's.
+	TSIG TSIGOptions `js:"tsig"`
+
+	// Chaos controls the faults injected in resolutions, to test how applications cope
+	// with failing nameservers. It injects none by default.
+	Chaos ChaosOptions `js:"chaos"`
+
+	// Record controls whether, and where, the queries and responses the Client exchanges
+	// with nameservers are recorded: those of resolutions and of their DNSSEC validation,
+	// of iterative resolutions, updates, notifies and their SOA polls, zone transfers,
+	// and raw exchanges. It records none by default.
+	Record RecordOptions `js:"record"`
+}
+
+// QueryIDOptions controls how the ID of outgoing DNS messages is generated.
+type QueryIDOptions struct {
+	// Mode holds the query ID generation strategy. It defaults to QueryIDModeRandom.
+	Mode QueryIDMode `js:"mode"`
+
+	// Value holds the query ID used when Mode is QueryIDModeFixed, and the
+	// ID sequential query IDs start from when Mode is QueryIDModeSequential.
+	Value uint16 `js:"value"`
+}
+
+// QueryIDMode represents a query ID generation strategy.
+type QueryIDMode string
+
+const (
+	// QueryIDModeRandom generates a random ID for each query.
+	QueryIDModeRandom QueryIDMode = "random"
+
+	// QueryIDModeSequential increments the ID by one for each query sent by the Client.
+	QueryIDModeSequential QueryIDMode = "sequential"
+
+	// QueryIDModeFixed uses the same, configured, ID for every query.
+	QueryIDModeFixed QueryIDMode = "fixed"
+)
+
+// PortRange represents an inclusive range of ports.
+type PortRange struct {
+	// Min is the lowest port of the range.
+	Min uint16 `js:"min"`
+
+	// Max is the highest port of the range.
+	Max uint16 `js:"max"`
+}
+
+// IsZero returns true if the range is empty, and thus unset.
+func (p PortRange) IsZero() bool {
+	return p.Min == 0 && p.Max == 0
+}
+
+// Size returns the number of ports contained in the range.
+func (p PortRange) Size() int {
+	return int(p.Max) - int(p.Min) + 1
+}
+
+// Validate checks that the options are consistent, and returns an error describing
+// the first problem found otherwise.
+func (o ClientOptions) Validate() error {
+	switch o.QueryID.Mode {
+	case "", QueryIDModeRandom, QueryIDModeSequential, QueryIDModeFixed:
+	default:
+		return fmt.Errorf(
+			"invalid query ID mode %q; expected one of %q, %q or %q",
+			o.QueryID.Mode, QueryIDModeRandom, QueryIDModeSequential, QueryIDModeFixed,
+		)
+	}
+
+	switch o.ResponseValidation {
+	case "", ResponseValidationNone, ResponseValidationLenient, ResponseValidationStrict:
+	default:
+		return fmt.Errorf(
+			"invalid response validation mode %q; expected one of %q, %q or %q",
+			o.ResponseValidation, ResponseValidationNone, ResponseValidationLenient, ResponseValidationStrict,
+		)
+	}
+
+	switch o.Transport {
+	case "", TransportUDP, TransportTCP, TransportTLS:
+	default:
+		return fmt.Errorf(
+			"invalid transport %q; expected one of %q, %q or %q",
+			o.Transport, TransportUDP, TransportTCP, TransportTLS,
+		)
+	}
+
+	switch o.ConnectionReuse {
+	case "", ConnectionReuseNone, ConnectionReuseVU, ConnectionReuseShared:
+	default:
+		return fmt.Errorf(
+			"invalid connection reuse mode %q; expected one of %q, %q or %q",
+			o.ConnectionReuse, ConnectionReuseNone, ConnectionReuseVU, ConnectionReuseShared,
+		)
+	}
+
+	switch o.Cache.Mode {
+	case "", CacheModeNone, CacheModeVU, CacheModeShared:
+	default:
+		return fmt.Errorf(
+			"invalid cache mode %q; expected one of %q, %q or %q",
+			o.Cache.Mode, CacheModeNone, CacheModeVU, CacheModeShared,
+		)
+	}
+
+	if o.Cache.MaxTTL > 0 && o.Cache.MaxTTL < o.Cache.MinTTL {
+		return fmt.Errorf(
+			"invalid cache TTL range; max TTL %d is lower than min TTL %d",
+			o.Cache.MaxTTL, o.Cache.MinTTL,
+		)
+	}
+
+	if _, err := parseTrustAnchors(o.TrustAnchors); err != nil {
+		return err
+	}
+
+	if err := o.TSIG.Validate(); err != nil {
+		return fmt.Errorf("invalid tsig key: %w", err)
+	}
+
+	if err := o.Chaos.Validate(); err != nil {
+		return fmt.Errorf("invalid chaos options: %w", err)
+	}
+
+	if err := o.Record.Validate(); err != nil {
+		return fmt.Errorf("invalid record options: %w", err)
+	}
+
+	if o.LocalAddress != "" {
+		if o.Interface != "" {
+			return errors.New("local address and interface options are mutually exclusive")
+		}
+
+		if net.ParseIP(o.LocalAddress) == nil {
+			return fmt.Errorf("invalid local address %q; expected an IPv4 or IPv6 address", o.LocalAddress)
+		}
+	}
+
+	if !o.SourcePort.IsZero() {
+		if o.SourcePort.Min == 0 {
+			return errors.New("invalid source port range; min port must be greater than 0")
+		}
+
+		if o.SourcePort.Max < o.SourcePort.Min {
+			return fmt.Errorf(
+				"invalid source port range; max port %d is lower than min port %d",
+				o.SourcePort.Max, o.SourcePort.Min,
+			)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,555 @@
+package dns
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/netip"
+	"slices"
+	"time"
+)
+
+// Magic numbers identifying the capture file formats, as read in big endian order.
+const (
+	pcapMagicMicros         = 0xa1b2c3d4
+	pcapMagicMicrosSwapped  = 0xd4c3b2a1
+	pcapMagicNanos          = 0xa1b23c4d
+	pcapMagicNanosSwapped   = 0x4d3cb2a1
+	pcapngSectionHeaderType = 0x0a0d0d0a
+	pcapngByteOrderMagic    = 0x1a2b3c4d
+	pcapngByteOrderSwapped  = 0x4d3c2b1a
+)
+
+// Types of the pcapng blocks packets are read from.
+const (
+	pcapngInterfaceDescriptionType = 0x00000001
+	pcapngPacketType               = 0x00000002
+	pcapngSimplePacketType         = 0x00000003
+	pcapngEnhancedPacketType       = 0x00000006
+)
+
+// Link types of the packets that can be decoded, as per [the tcpdump registry].
+//
+// [the tcpdump registry]: https://www.tcpdump.org/linktypes.html
+const (
+	linkTypeNull      = 0
+	linkTypeEthernet  = 1
+	linkTypeRaw       = 101
+	linkTypeLoop      = 108
+	linkTypeLinuxSLL  = 113
+	linkTypeIPv4      = 228
+	linkTypeIPv6      = 229
+	linkTypeLinuxSLL2 = 276
+)
+
+// Protocol numbers of the network and transport layers that can be decoded.
+const (
+	etherTypeIPv4 = 0x0800
+	etherTypeIPv6 = 0x86dd
+	etherTypeVLAN = 0x8100
+	etherTypeQinQ = 0x88a8
+	ipProtocolTCP = 6
+	ipProtocolUDP = 17
+)
+
+// maxCaptureBlockLen bounds the length of the pcapng blocks read.
+const maxCaptureBlockLen = 16 << 20
+
+// errUnknownCaptureFormat is returned when a file is neither a pcap nor a pcapng file.
+var errUnknownCaptureFormat = errors.New("unknown capture format; expected a pcap or pcapng file")
+
+// capturedPacket holds a packet read from a capture file.
+type capturedPacket struct {
+	time     time.Time
+	linkType uint32
+	data     []byte
+}
+
+// readCapturedPackets reads the packets of a pcap or pcapng capture file, detecting
+// its format from its first bytes.
+func readCapturedPackets(r io.Reader) ([]capturedPacket, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading the capture failed: %w", err)
+	}
+
+	if len(data) < 4 {
+		return nil, errUnknownCaptureFormat
+	}
+
+	switch binary.BigEndian.Uint32(data) {
+	case pcapMagicMicros, pcapMagicMicrosSwapped, pcapMagicNanos, pcapMagicNanosSwapped:
+		return readPcap(data)
+	case pcapngSectionHeaderType:
+		return readPcapng(data)
+	default:
+		return nil, errUnknownCaptureFormat
+	}
+}
+
+// readPcap reads the packets of a pcap file, as per [draft-ietf-opsawg-pcap].
+//
+// [draft-ietf-opsawg-pcap]: https://datatracker.ietf.org/doc/draft-ietf-opsawg-pcap/
+func readPcap(data []byte) ([]capturedPacket, error) {
+	const (
+		fileHeaderLen   = 24
+		recordHeaderLen = 16
+	)
+
+	if len(data) < fileHeaderLen {
+		return nil, errors.New("truncated pcap file header")
+	}
+
+	var order binary.ByteOrder = binary.BigEndian
+
+	magic := binary.BigEndian.Uint32(data)
+	if magic == pcapMagicMicrosSwapped || magic == pcapMagicNanosSwapped {
+		order = binary.LittleEndian
+	}
+
+	resolution := time.Microsecond
+	if magic == pcapMagicNanos || magic == pcapMagicNanosSwapped {
+		resolution = time.Nanosecond
+	}
+
+	// The upper bits of the link type field hold the FCS length, and are ignored.
+	linkType := order.Uint32(data[20:]) & 0x0fffffff
+
+	var packets []capturedPacket
+	for offset := fileHeaderLen; offset < len(data); {
+		if len(data)-offset < recordHeaderLen {
+			return nil, fmt.Errorf("truncated pcap record header at offset %d", offset)
+		}
+
+		header := data[offset : offset+recordHeaderLen]
+		capturedLen := int(order.Uint32(header[8:]))
+		offset += recordHeaderLen
+
+		if capturedLen > len(data)-offset {
+			return nil, fmt.Errorf("truncated pcap record at offset %d", offset)
+		}
+
+		// A trailing frame check sequence, if captured, is ignored when decoding the
+		// packet, as only the length announced by its IP header is read.
+		packets = append(packets, capturedPacket{
+			time:     time.Unix(int64(order.Uint32(header)), int64(order.Uint32(header[4:]))*int64(resolution)),
+			linkType: linkType,
+			data:     data[offset : offset+capturedLen],
+		})
+
+		offset += capturedLen
+	}
+
+	return packets, nil
+}
+
+// pcapngInterface holds the properties of a pcapng interface packets refer to.
+type pcapngInterface struct {
+	linkType uint32
+
+	// unitsPerSecond holds the resolution of the interface's timestamps.
+	unitsPerSecond uint64
+}
+
+// readPcapng reads the packets of a pcapng file, as per [draft-ietf-opsawg-pcapng].
+// Files may hold several sections, each with its own byte order and interfaces.
+//
+// [draft-ietf-opsawg-pcapng]: https://datatracker.ietf.org/doc/draft-ietf-opsawg-pcapng/
+func readPcapng(data []byte) ([]capturedPacket, error) {
+	var (
+		order      binary.ByteOrder = binary.BigEndian
+		interfaces []pcapngInterface
+		packets    []capturedPacket
+		last       time.Time
+	)
+
+	for offset := 0; offset < len(data); {
+		if len(data)-offset < 12 {
+			return nil, fmt.Errorf("truncated pcapng block at offset %d", offset)
+		}
+
+		blockType := order.Uint32(data[offset:])
+
+		// Section header blocks define the byte order of the blocks that follow,
+		// including their own length.
+		if binary.BigEndian.Uint32(data[offset:]) == pcapngSectionHeaderType {
+			blockType = pcapngSectionHeaderType
+
+			switch binary.BigEndian.Uint32(data[offset+8:]) {
+			case pcapngByteOrderMagic:
+				order = binary.BigEndian
+			case pcapngByteOrderSwapped:
+				order = binary.LittleEndian
+			default:
+				return nil, fmt.Errorf("invalid pcapng byte order magic at offset %d", offset+8)
+			}
+
+			interfaces = nil
+		}
+
+		blockLen := int(order.Uint32(data[offset+4:]))
+		if blockLen < 12 || blockLen%4 != 0 || blockLen > maxCaptureBlockLen || blockLen > len(data)-offset {
+			return nil, fmt.Errorf("invalid pcapng block length %d at offset %d", blockLen, offset)
+		}
+
+		body := data[offset+8 : offset+blockLen-4]
+		offset += blockLen
+
+		switch blockType {
+		case pcapngInterfaceDescriptionType:
+			iface, err := readPcapngInterface(body, order)
+			if err != nil {
+				return nil, err
+			}
+
+			interfaces = append(interfaces, iface)
+		case pcapngEnhancedPacketType, pcapngPacketType:
+			// Both blocks share their layout, except obsolete packet blocks hold a
+			// 16 bits interface ID, followed by a drops count.
+			if len(body) < 20 {
+				return nil, errors.New("truncated pcapng packet block")
+			}
+
+			interfaceID := order.Uint32(body)
+			if blockType == pcapngPacketType {
+				interfaceID = uint32(order.Uint16(body))
+			}
+
+			if int(interfaceID) >= len(interfaces) {
+				return nil, fmt.Errorf("pcapng packet refers to undefined interface %d", interfaceID)
+			}
+
+			iface := interfaces[interfaceID]
+			capturedLen := int(order.Uint32(body[12:]))
+			if capturedLen > len(body)-20 {
+				return nil, errors.New("truncated pcapng packet block")
+			}
+
+			timestamp := uint64(order.Uint32(body[4:]))<<32 | uint64(order.Uint32(body[8:]))
+			last = pcapngTime(timestamp, iface.unitsPerSecond)
+
+			packets = append(packets, capturedPacket{time: last, linkType: iface.linkType, data: body[20 : 20+capturedLen]})
+		case pcapngSimplePacketType:
+			// Simple packet blocks have no timestamp, thus they are given the time of
+			// the previous packet.
+			if len(body) < 4 || len(interfaces) == 0 {
+				return nil, errors.New("invalid pcapng simple packet block")
+			}
+
+			capturedLen := min(int(order.Uint32(body)), len(body)-4)
+			packets = append(packets, capturedPacket{time: last, linkType: interfaces[0].linkType, data: body[4 : 4+capturedLen]})
+		}
+	}
+
+	return packets, nil
+}
+
+// readPcapngInterface reads the body of a pcapng interface description block.
+func readPcapngInterface(body []byte, order binary.ByteOrder) (pcapngInterface, error) {
+	const optionTimestampResolution = 9
+
+	if len(body) < 8 {
+		return pcapngInterface{}, errors.New("truncated pcapng interface description block")
+	}
+
+	iface := pcapngInterface{linkType: uint32(order.Uint16(body)), unitsPerSecond: 1e6}
+
+	for options := body[8:]; len(options) >= 4; {
+		code := order.Uint16(options)
+		length := int(order.Uint16(options[2:]))
+		if length > len(options)-4 {
+			break
+		}
+
+		if code == optionTimestampResolution && length >= 1 {
+			// The most significant bit tells whether the resolution is a negative power
+			// of 2, rather than of 10.
+			base, exponent := 10.0, float64(options[4]&0x7f)
+			if options[4]&0x80 != 0 {
+				base = 2
+			}
+
+			units := math.Pow(base, exponent)
+			if units < 1 || units > math.MaxInt64 {
+				return pcapngInterface{}, fmt.Errorf("unsupported pcapng timestamp resolution %#x", options[4])
+			}
+
+			iface.unitsPerSecond = uint64(units)
+		}
+
+		// Options are padded to 32 bits.
+		options = options[min(len(options), 4+(length+3)&^3):]
+	}
+
+	return iface, nil
+}
+
+// pcapngTime converts a pcapng timestamp, counted in units of the given resolution
+// since the Unix epoch.
+func pcapngTime(timestamp, unitsPerSecond uint64) time.Time {
+	seconds := timestamp / unitsPerSecond
+	units := timestamp % unitsPerSecond
+
+	return time.Unix(int64(seconds), int64(units*uint64(time.Second)/unitsPerSecond)) //nolint:gosec // bounded by the resolution
+}
+
+// segment holds the transport payload of a decoded packet.
+type segment struct {
+	src, dst  netip.AddrPort
+	transport Transport
+	payload   []byte
+}
+
+// decodePacket decodes the link, network and transport layers of a packet, and
+// returns its UDP or TCP payload. It returns false for packets of other protocols,
+// fragmented IP packets, and truncated packets.
+func decodePacket(linkType uint32, data []byte) (segment, bool) {
+	var etherType uint16
+
+	switch linkType {
+	case linkTypeEthernet:
+		if len(data) < 14 {
+			return segment{}, false
+		}
+
+		etherType, data = binary.BigEndian.Uint16(data[12:]), data[14:]
+		for (etherType == etherTypeVLAN || etherType == etherTypeQinQ) && len(data) >= 4 {
+			etherType, data = binary.BigEndian.Uint16(data[2:]), data[4:]
+		}
+	case linkTypeLinuxSLL:
+		if len(data) < 16 {
+			return segment{}, false
+		}
+
+		etherType, data = binary.BigEndian.Uint16(data[14:]), data[16:]
+	case linkTypeLinuxSLL2:
+		if len(data) < 20 {
+			return segment{}, false
+		}
+
+		etherType, data = binary.BigEndian.Uint16(data), data[20:]
+	case linkTypeNull, linkTypeLoop:
+		// Both hold the address family of the packet, which differs across systems,
+		// thus the IP version is read from the packet itself instead.
+		if len(data) < 4 {
+			return segment{}, false
+		}
+
+		data = data[4:]
+	case linkTypeRaw, linkTypeIPv4, linkTypeIPv6:
+	default:
+		return segment{}, false
+	}
+
+	if etherType != 0 && etherType != etherTypeIPv4 && etherType != etherTypeIPv6 {
+		return segment{}, false
+	}
+
+	if len(data) == 0 {
+		return segment{}, false
+	}
+
+	switch data[0] >> 4 {
+	case 4:
+		return decodeIPv4(data)
+	case 6:
+		return decodeIPv6(data)
+	default:
+		return segment{}, false
+	}
+}
+
+// decodeIPv4 decodes an IPv4 packet.
+func decodeIPv4(data []byte) (segment, bool) {
+	if len(data) < 20 {
+		return segment{}, false
+	}
+
+	headerLen := int(data[0]&0x0f) * 4
+	totalLen := int(binary.BigEndian.Uint16(data[2:]))
+	if headerLen < 20 || totalLen < headerLen || totalLen > len(data) {
+		return segment{}, false
+	}
+
+	// Fragments are ignored, as reassembling them is not supported.
+	if fragment := binary.BigEndian.Uint16(data[6:]); fragment&0x3fff != 0 {
+		return segment{}, false
+	}
+
+	src := netip.AddrFrom4([4]byte(data[12:16]))
+	dst := netip.AddrFrom4([4]byte(data[16:20]))
+
+	return decodeTransport(data[9], src, dst, data[headerLen:totalLen])
+}
+
+// decodeIPv6 decodes an IPv6 packet, skipping its extension headers.
+func decodeIPv6(data []byte) (segment, bool) {
+	const (
+		headerHopByHop    = 0
+		headerRouting     = 43
+		headerFragment    = 44
+		headerDestination = 60
+	)
+
+	if len(data) < 40 {
+		return segment{}, false
+	}
+
+	payloadLen := int(binary.BigEndian.Uint16(data[4:]))
+	if payloadLen > len(data)-40 {
+		return segment{}, false
+	}
+
+	src := netip.AddrFrom16([16]byte(data[8:24]))
+	dst := netip.AddrFrom16([16]byte(data[24:40]))
+
+	next, payload := data[6], data[40:40+payloadLen]
+	for next == headerHopByHop || next == headerRouting || next == headerDestination {
+		if len(payload) < 8 {
+			return segment{}, false
+		}
+
+		length := (int(payload[1]) + 1) * 8
+		if length > len(payload) {
+			return segment{}, false
+		}
+
+		next, payload = payload[0], payload[length:]
+	}
+
+	// Fragments are ignored, as reassembling them is not supported.
+	if next == headerFragment {
+		return segment{}, false
+	}
+
+	return decodeTransport(next, src, dst, payload)
+}
+
+// decodeTransport decodes a UDP datagram or a TCP segment.
+func decodeTransport(protocol uint8, src, dst netip.Addr, data []byte) (segment, bool) {
+	switch protocol {
+	case ipProtocolUDP:
+		if len(data) < 8 {
+			return segment{}, false
+		}
+
+		length := int(binary.BigEndian.Uint16(data[4:]))
+		if length < 8 || length > len(data) {
+			return segment{}, false
+		}
+
+		return segment{
+			src:       netip.AddrPortFrom(src, binary.BigEndian.Uint16(data)),
+			dst:       netip.AddrPortFrom(dst, binary.BigEndian.Uint16(data[2:])),
+			transport: TransportUDP,
+			payload:   data[8:length],
+		}, true
+	case ipProtocolTCP:
+		if len(data) < 20 {
+			return segment{}, false
+		}
+
+		headerLen := int(data[12]>>4) * 4
+		if headerLen < 20 || headerLen > len(data) {
+			return segment{}, false
+		}
+
+		return segment{
+			src:       netip.AddrPortFrom(src, binary.BigEndian.Uint16(data)),
+			dst:       netip.AddrPortFrom(dst, binary.BigEndian.Uint16(data[2:])),
+			transport: TransportTCP,
+			payload:   data[headerLen:],
+		}, true
+	default:
+		return segment{}, false
+	}
+}
+
+// encodeIPPacket returns an IPv4 or IPv6 packet, depending on the family of the source
+// address, holding a UDP datagram, or a TCP segment, of the payload sent from src to
+// dst. TCP segments are sent without a handshake, with zero sequence numbers, as they
+// only carry the payload for tools such as Wireshark to decode it.
+func encodeIPPacket(transport Transport, src, dst netip.AddrPort, payload []byte) []byte {
+	var header []byte
+	protocol := uint8(ipProtocolUDP)
+
+	if transport == TransportUDP {
+		header = make([]byte, 8, 8+len(payload))
+		binary.BigEndian.PutUint16(header[4:], uint16(8+len(payload))) //nolint:gosec // bounded by the message size
+	} else {
+		protocol = ipProtocolTCP
+		header = make([]byte, 20, 20+len(payload))
+		header[12] = 5 << 4
+		header[13] = 0x18 // PSH and ACK flags
+		binary.BigEndian.PutUint16(header[14:], 0xffff)
+	}
+
+	binary.BigEndian.PutUint16(header, src.Port())
+	binary.BigEndian.PutUint16(header[2:], dst.Port())
+	segment := append(header, payload...)
+
+	// The transport checksum covers a pseudo header made of the addresses, the
+	// protocol and the segment length.
+	checksumOffset := 6
+	if protocol == ipProtocolTCP {
+		checksumOffset = 16
+	}
+
+	pseudoHeader := append(src.Addr().AsSlice(), dst.Addr().AsSlice()...)
+	pseudoHeader = append(pseudoHeader, 0, protocol)
+	pseudoHeader = binary.BigEndian.AppendUint16(pseudoHeader, uint16(len(segment))) //nolint:gosec // bounded by the message size
+
+	checksum := internetChecksum(pseudoHeader, segment)
+	if checksum == 0 && protocol == ipProtocolUDP {
+		checksum = 0xffff
+	}
+
+	binary.BigEndian.PutUint16(segment[checksumOffset:], checksum)
+
+	if src.Addr().Is4() {
+		ip := make([]byte, 20, 20+len(segment))
+		ip[0] = 4<<4 | 5
+		binary.BigEndian.PutUint16(ip[2:], uint16(20+len(segment))) //nolint:gosec // bounded by the message size
+		ip[8] = 64
+		ip[9] = protocol
+		copy(ip[12:], src.Addr().AsSlice())
+		copy(ip[16:], dst.Addr().AsSlice())
+		binary.BigEndian.PutUint16(ip[10:], internetChecksum(ip))
+
+		return append(ip, segment...)
+	}
+
+	ip := make([]byte, 40, 40+len(segment))
+	ip[0] = 6 << 4
+	binary.BigEndian.PutUint16(ip[4:], uint16(len(segment))) //nolint:gosec // bounded by the message size
+	ip[6] = protocol
+	ip[7] = 64
+	copy(ip[8:], src.Addr().AsSlice())
+	copy(ip[24:], dst.Addr().AsSlice())
+
+	return append(ip, segment...)
+}
+
+// internetChecksum returns the checksum of the data, as defined in [RFC1071].
+//
+// [RFC1071]: https://www.iana.org/go/rfc1071
+func internetChecksum(parts ...[]byte) uint16 {
+	data := slices.Concat(parts...)
+
+	var sum uint32
+	for i := 0; i+1 < len(data); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(data[i:]))
+	}
+
+	if len(data)%2 == 1 {
+		sum += uint32(data[len(data)-1]) << 8
+	}
+
+	for sum > 0xffff {
+		sum = sum>>16 + sum&0xffff
+	}
+
+	return ^uint16(sum) //nolint:gosec // folded to 16 bits
+}
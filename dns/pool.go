@@ -0,0 +1,388 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// ConnectionReuseMode represents how the Client reuses its connections to nameservers
+// across queries.
+type ConnectionReuseMode string
+
+const (
+	// ConnectionReuseNone dials a new connection for every query. It is the default
+	// of a Client created outside the k6 module.
+	ConnectionReuseNone ConnectionReuseMode = "none"
+
+	// ConnectionReuseVU keeps connections open, and reuses them across the queries of
+	// a single Client. The k6 module creates a Client per VU, thus its name.
+	ConnectionReuseVU ConnectionReuseMode = "vu"
+
+	// ConnectionReuseShared keeps connections open, and reuses them across the queries
+	// of every Client sharing the same pool. The k6 module shares its pool between all VUs.
+	ConnectionReuseShared ConnectionReuseMode = "shared"
+)
+
+// defaultExchangeTimeout is the maximum time we wait for a response over a pooled
+// connection, when the context doesn't define an earlier deadline. It matches the
+// miekg/dns Client default read timeout.
+const defaultExchangeTimeout = 2 * time.Second
+
+// errConnClosed is returned when a query is sent over, or waits for a response on, a
+// pooled connection that has been closed.
+var errConnClosed = errors.New("pooled connection closed")
+
+// errIDInFlight is returned when a query is sent over a pooled connection which already
+// has a query with the same ID in flight, and the responses would thus be ambiguous.
+var errIDInFlight = errors.New("query ID already in flight on pooled connection")
+
+// connPool holds open connections to nameservers, so that they can be reused
+// across queries.
+//
+// Each connection is shared by all the queries sent to the same nameserver, with the
+// same transport and source options: queries are multiplexed over the connection by
+// their ID, and pipelined over TCP and TLS connections, as per [RFC7766].
+//
+// [RFC7766]: https://www.iana.org/go/rfc7766
+type connPool struct {
+	mu    sync.Mutex
+	conns map[connPoolKey]*muxConn
+}
+
+// connPoolKey identifies the connections of a pool that can be used interchangeably.
+type connPoolKey struct {
+	network    string
+	addr       string
+	localIP    string
+	iface      string
+	sourcePort PortRange
+	tls        TLSOptions
+}
+
+// newConnPool creates a new, empty, connPool.
+func newConnPool() *connPool {
+	return &connPool{conns: make(map[connPoolKey]*muxConn)}
+}
+
+// exchange sends the message to the nameserver over a pooled connection, dialing it
+// using the provided client if necessary, and returns the response.
+//
+// Queries failing because a reused connection has been closed by the nameserver,
+// such as an idle TCP connection, are retried once over a new connection.
+func (p *connPool) exchange(
+	ctx context.Context,
+	client dns.Client,
+	message *dns.Msg,
+	nameserver Nameserver,
+	options ClientOptions,
+	localIP net.IP,
+	trace *exchangeTrace,
+) (*dns.Msg, error) {
+	key := connPoolKey{
+		network:    client.Net,
+		addr:       nameserver.Addr(),
+		localIP:    localIP.String(),
+		iface:      options.Interface,
+		sourcePort: options.SourcePort,
+		tls:        options.TLS,
+	}
+
+	dial := func(ctx context.Context) (*dns.Conn, error) {
+		if options.SourcePort.IsZero() {
+			if localIP != nil {
+				client.Dialer = options.dialer(localIP, 0)
+			}
+
+			return client.DialContext(ctx, nameserver.Addr())
+		}
+
+		return dialFromPortRange(ctx, client, nameserver, options, localIP)
+	}
+
+	for attempt := 0; ; attempt++ {
+		conn, reused, err := p.get(ctx, key, dial)
+		if err != nil {
+			return nil, err
+		}
+
+		response, err := conn.exchange(ctx, message, trace)
+		if errors.Is(err, errConnClosed) && reused && attempt == 0 {
+			continue
+		}
+
+		return response, err
+	}
+}
+
+// get returns an open connection matching the key, dialing a new one if necessary. It
+// also returns whether the connection has already been used by previous queries.
+func (p *connPool) get(
+	ctx context.Context,
+	key connPoolKey,
+	dial func(context.Context) (*dns.Conn, error),
+) (conn *muxConn, reused bool, err error) {
+	p.mu.Lock()
+	conn, ok := p.conns[key]
+	p.mu.Unlock()
+
+	if ok && !conn.isClosed() {
+		return conn, true, nil
+	}
+
+	// We dial without holding the lock, so that slow handshakes don't
+	// block the queries sent to other nameservers.
+	dnsConn, err := dial(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("dialing the DNS nameserver failed: %w", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	// Another query might have dialed a connection concurrently, in which
+	// case we use it rather than ours.
+	if existing, ok := p.conns[key]; ok && !existing.isClosed() {
+		_ = dnsConn.Close()
+		return existing, true, nil
+	}
+
+	conn = newMuxConn(dnsConn)
+	p.conns[key] = conn
+
+	return conn, false, nil
+}
+
+// close closes all the connections of the pool.
+func (p *connPool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for key, conn := range p.conns {
+		conn.close(errConnClosed)
+		delete(p.conns, key)
+	}
+}
+
+// muxConn is a connection to a nameserver multiplexing concurrent queries by ID.
+//
+// A single goroutine reads the responses from the connection, and dispatches them
+// to the query waiting for the response with the same ID.
+type muxConn struct {
+	conn *dns.Conn
+
+	// writeMu serializes the writes to the connection.
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	pending map[uint16]*muxQuery
+	err     error
+	closed  chan struct{}
+}
+
+// muxQuery is a query sent over a muxConn, waiting for its response.
+type muxQuery struct {
+	question dns.Question
+	resultCh chan muxResult
+
+	// mismatches holds the number of responses to the query's question whose ID
+	// didn't match the query's.
+	mismatches int
+}
+
+// muxResult holds the outcome of a query sent over a muxConn.
+type muxResult struct {
+	response *dns.Msg
+	err      error
+
+	// raw holds the response in wire format.
+	raw []byte
+}
+
+// newMuxConn wraps the connection in a new muxConn, and starts reading
+// responses from it.
+func newMuxConn(conn *dns.Conn) *muxConn {
+	// Responses are read without knowing the size the query advertised,
+	// so we accept messages up to the maximum size.
+	conn.UDPSize = dns.MaxMsgSize
+
+	m := &muxConn{
+		conn:    conn,
+		pending: make(map[uint16]*muxQuery),
+		closed:  make(chan struct{}),
+	}
+
+	go m.readLoop()
+
+	return m
+}
+
+// exchange sends the message over the connection, and waits for the response
+// with the same ID. The message and its response are recorded in the trace in
+// wire format, and responses to its question with another ID are counted in the
+// trace as mismatches.
+func (m *muxConn) exchange(ctx context.Context, message *dns.Msg, trace *exchangeTrace) (*dns.Msg, error) {
+	query := &muxQuery{resultCh: make(chan muxResult, 1)}
+	if len(message.Question) > 0 {
+		query.question = message.Question[0]
+	}
+
+	m.mu.Lock()
+	if m.err != nil {
+		m.mu.Unlock()
+		return nil, m.err
+	}
+
+	if _, inFlight := m.pending[message.Id]; inFlight {
+		m.mu.Unlock()
+		return nil, errIDInFlight
+	}
+
+	m.pending[message.Id] = query
+	m.mu.Unlock()
+
+	defer func() {
+		m.mu.Lock()
+		if m.pending[message.Id] == query {
+			delete(m.pending, message.Id)
+		}
+		trace.mismatches += query.mismatches
+		m.mu.Unlock()
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, defaultExchangeTimeout)
+	defer cancel()
+
+	deadline, _ := ctx.Deadline()
+
+	packed, err := message.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	m.writeMu.Lock()
+	_ = m.conn.SetWriteDeadline(deadline)
+	_, err = m.conn.Write(packed)
+	m.writeMu.Unlock()
+
+	if err != nil {
+		m.close(fmt.Errorf("%w: %w", errConnClosed, err))
+		return nil, err
+	}
+
+	trace.query = packed
+
+	select {
+	case result := <-query.resultCh:
+		trace.response = result.raw
+		return result.response, result.err
+	case <-m.closed:
+		return nil, m.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// readLoop reads responses from the connection until it is closed, and
+// dispatches them to the queries waiting for them.
+func (m *muxConn) readLoop() {
+	_, isPacketConn := m.conn.Conn.(net.PacketConn)
+
+	for {
+		var response *dns.Msg
+
+		raw, err := m.conn.ReadMsgHeader(nil)
+		if err == nil {
+			response = new(dns.Msg)
+			err = response.Unpack(raw)
+		}
+
+		switch {
+		case err == nil:
+			m.dispatch(response, muxResult{response: response, raw: raw})
+		case response != nil:
+			// The message could be read, but not unpacked. Its header,
+			// and thus its ID, are still available.
+			m.dispatch(response, muxResult{err: err, raw: raw})
+		case isPacketConn && !errors.Is(err, net.ErrClosed):
+			// Errors reading from a UDP socket, such as an ICMP port unreachable,
+			// fail the queries in flight, but don't prevent the socket's reuse.
+			m.failPending(err)
+		default:
+			m.close(fmt.Errorf("%w: %w", errConnClosed, err))
+			return
+		}
+	}
+}
+
+// dispatch delivers the result to the query waiting for the response with the
+// response's ID.
+//
+// Responses with another ID, but the question of a query in flight, are counted
+// as mismatches of that query. Other responses nobody waits for, such as late
+// responses to queries which timed out, are dropped.
+func (m *muxConn) dispatch(response *dns.Msg, result muxResult) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if query, ok := m.pending[response.Id]; ok {
+		delete(m.pending, response.Id)
+		query.resultCh <- result
+
+		return
+	}
+
+	if len(response.Question) == 0 {
+		return
+	}
+
+	for _, query := range m.pending {
+		if query.question.Qtype == response.Question[0].Qtype &&
+			strings.EqualFold(query.question.Name, response.Question[0].Name) {
+			query.mismatches++
+
+			return
+		}
+	}
+}
+
+// failPending fails all the queries in flight with the provided error.
+func (m *muxConn) failPending(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, query := range m.pending {
+		query.resultCh <- muxResult{err: err}
+		delete(m.pending, id)
+	}
+}
+
+// isClosed returns true if the connection has been closed.
+func (m *muxConn) isClosed() bool {
+	select {
+	case <-m.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// close closes the connection, failing the queries in flight with err.
+func (m *muxConn) close(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.err != nil {
+		return
+	}
+
+	m.err = err
+	close(m.closed)
+	_ = m.conn.Close()
+}
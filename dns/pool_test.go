@@ -0,0 +1,152 @@
+package dns
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_ConnectionReuse(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name            string
+		connectionReuse ConnectionReuseMode
+		transport       Transport
+		wantConns       int
+	}{
+		{
+			name:            "no reuse dials a UDP socket per query",
+			connectionReuse: ConnectionReuseNone,
+			transport:       TransportUDP,
+			wantConns:       8,
+		},
+		{
+			name:            "per VU reuse multiplexes queries over a single UDP socket",
+			connectionReuse: ConnectionReuseVU,
+			transport:       TransportUDP,
+			wantConns:       1,
+		},
+		{
+			name:            "per VU reuse pipelines queries over a single TCP connection",
+			connectionReuse: ConnectionReuseVU,
+			transport:       TransportTCP,
+			wantConns:       1,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var mu sync.Mutex
+			gotConns := make(map[string]bool)
+			nameserver := startTestNameserver(t, func(w dns.ResponseWriter, r *dns.Msg) {
+				mu.Lock()
+				gotConns[w.RemoteAddr().String()] = true
+				mu.Unlock()
+
+				writeTestAnswer(t, w, r)
+			})
+
+			client := NewDNSClientWithOptions(ClientOptions{
+				ConnectionReuse: tt.connectionReuse,
+				Transport:       tt.transport,
+			})
+			t.Cleanup(client.CloseConnections)
+
+			// The first query ensures the connection is open before we start
+			// sending concurrent queries over it.
+			_, err := client.Resolve(context.Background(), testDomain, "A", nameserver)
+			require.NoError(t, err)
+
+			var wg sync.WaitGroup
+			for i := 0; i < 7; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+
+					ips, err := client.Resolve(context.Background(), testDomain, "A", nameserver)
+					assert.NoError(t, err)
+					assert.Equal(t, []string{primaryTestIPv4}, ips)
+				}()
+			}
+			wg.Wait()
+
+			assert.Len(t, gotConns, tt.wantConns)
+		})
+	}
+
+	t.Run("queries with an ID already in flight fall back to a dedicated connection", func(t *testing.T) {
+		t.Parallel()
+
+		nameserver := startTestNameserver(t, writeTestAnswerHandler(t))
+
+		client := NewDNSClientWithOptions(ClientOptions{
+			ConnectionReuse: ConnectionReuseVU,
+			QueryID:         QueryIDOptions{Mode: QueryIDModeFixed, Value: 53},
+		})
+		t.Cleanup(client.CloseConnections)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				_, err := client.Resolve(context.Background(), testDomain, "A", nameserver)
+				assert.NoError(t, err)
+			}()
+		}
+		wg.Wait()
+	})
+
+	t.Run("queries bound to an interface don't share the connections of its address", func(t *testing.T) {
+		t.Parallel()
+
+		var mu sync.Mutex
+		gotConns := make(map[string]bool)
+		nameserver := startTestNameserver(t, func(w dns.ResponseWriter, r *dns.Msg) {
+			mu.Lock()
+			gotConns[w.RemoteAddr().String()] = true
+			mu.Unlock()
+
+			writeTestAnswer(t, w, r)
+		})
+
+		client := NewDNSClient()
+		t.Cleanup(client.CloseConnections)
+
+		for _, options := range []ClientOptions{
+			{ConnectionReuse: ConnectionReuseVU, LocalAddress: "127.0.0.1"},
+			{ConnectionReuse: ConnectionReuseVU, Interface: loopbackInterfaceName(t)},
+		} {
+			_, err := client.ResolveWithOptions(context.Background(), testDomain, "A", nameserver, options)
+			require.NoError(t, err)
+		}
+
+		assert.Len(t, gotConns, 2)
+	})
+
+	t.Run("closed connections are dialed again", func(t *testing.T) {
+		t.Parallel()
+
+		nameserver := startTestNameserver(t, writeTestAnswerHandler(t))
+
+		client := NewDNSClientWithOptions(ClientOptions{ConnectionReuse: ConnectionReuseVU, Transport: TransportTCP})
+		t.Cleanup(client.CloseConnections)
+
+		for i := 0; i < 2; i++ {
+			_, err := client.Resolve(context.Background(), testDomain, "A", nameserver)
+			require.NoError(t, err)
+
+			client.CloseConnections()
+		}
+	})
+}
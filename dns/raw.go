@@ -0,0 +1,157 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// ExchangeOptions holds the options of a raw message exchange.
+type ExchangeOptions struct {
+	// Transport holds the transport protocol the message is sent over. It defaults
+	// to TransportUDP.
+	Transport Transport `js:"transport"`
+
+	// TLS holds the options used when the message is sent over TLS.
+	TLS TLSOptions `js:"tls"`
+
+	// Timeout holds the maximum time we wait for the response. It defaults to
+	// 2 seconds.
+	Timeout time.Duration `js:"-"`
+}
+
+// Validate checks that the options are consistent, and returns an error describing
+// the first problem found otherwise.
+func (o ExchangeOptions) Validate() error {
+	switch o.Transport {
+	case "", TransportUDP, TransportTCP, TransportTLS:
+	default:
+		return fmt.Errorf(
+			"invalid exchange transport %q; expected one of %q, %q or %q",
+			o.Transport, TransportUDP, TransportTCP, TransportTLS,
+		)
+	}
+
+	if o.Timeout < 0 {
+		return errors.New("timeout must not be negative")
+	}
+
+	return nil
+}
+
+// ExchangeSummary holds the outcome of a raw message exchange.
+type ExchangeSummary struct {
+	// Response holds the nameserver's response, as received.
+	Response []byte
+
+	// Duration holds the time elapsed from sending the message to receiving the response.
+	Duration time.Duration
+
+	// RecordingErr holds the error opening the recording, or recording the exchange to
+	// it, failed with, when recording exchanges. It doesn't fail the exchange.
+	RecordingErr error
+}
+
+// Exchange sends the packed message to the nameserver as is, and returns its response
+// as received, without parsing it.
+//
+// Unlike Resolve, it lets the message be crafted freely, such as with several
+// questions, or unusual flags and opcodes. As a consequence, the response isn't checked
+// to match the message, and the first message received from the nameserver is returned.
+func (r *Client) Exchange(
+	ctx context.Context,
+	packed []byte,
+	nameserver Nameserver,
+	options ExchangeOptions,
+) (ExchangeSummary, error) {
+	var summary ExchangeSummary
+	if err := options.Validate(); err != nil {
+		return summary, err
+	}
+
+	client := r.client
+	client.Net = options.Transport.network()
+	if options.Transport == TransportTLS {
+		client.TLSConfig = options.TLS.config()
+	}
+
+	// The message is sent from the local address, or network interface, of the
+	// client's options, if any.
+	source := r.sourceOptions(options.Transport)
+	localIP, err := source.localIP(nameserver)
+	if err != nil {
+		return summary, err
+	}
+
+	if localIP != nil {
+		client.Dialer = source.dialer(localIP, 0)
+	}
+
+	timeout := options.Timeout
+	if timeout == 0 {
+		timeout = defaultExchangeTimeout
+	}
+
+	var log exchangeLog
+
+	trace := exchangeTrace{start: time.Now()}
+	response, err := exchangeRaw(ctx, client, packed, nameserver, timeout, &trace)
+	summary.Duration = time.Since(trace.start)
+
+	source.Record = r.options.Record
+	log.add(trace, nameserver, source)
+	summary.RecordingErr = r.recordExchanges(&log, source.Record, err != nil)
+
+	if err != nil {
+		return summary, fmt.Errorf("exchanging the message with nameserver %s failed: %w", nameserver.Addr(), err)
+	}
+
+	summary.Response = response
+
+	return summary, nil
+}
+
+// exchangeRaw sends the packed message to the nameserver, over a connection dialed
+// using the client, and returns the first message received in response, as received.
+// The message, once sent, and its response, are recorded in the trace.
+func exchangeRaw(
+	ctx context.Context,
+	client dns.Client,
+	packed []byte,
+	nameserver Nameserver,
+	timeout time.Duration,
+	trace *exchangeTrace,
+) ([]byte, error) {
+	conn, err := client.DialContext(ctx, nameserver.Addr())
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = conn.Close() }()
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	deadline, _ := ctx.Deadline()
+	_ = conn.SetDeadline(deadline)
+
+	// Closing the connection once the context is done unblocks the exchange.
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+
+	conn.UDPSize = dns.MaxMsgSize
+	if _, err := conn.Write(packed); err != nil {
+		return nil, err
+	}
+
+	trace.query = packed
+
+	response, err := conn.ReadMsgHeader(nil)
+	if err == nil {
+		trace.response = response
+	}
+
+	return response, err
+}
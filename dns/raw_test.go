@@ -0,0 +1,90 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_RawExchange(t *testing.T) {
+	t.Parallel()
+
+	// multiQuestionHandler answers every question of the message, rather than only
+	// the first one, as most nameservers do.
+	multiQuestionHandler := func(w dns.ResponseWriter, r *dns.Msg) {
+		response := new(dns.Msg)
+		response.SetReply(r)
+		response.Question = r.Question
+
+		for _, q := range r.Question {
+			response.Answer = append(response.Answer, &dns.A{
+				Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+				A:   net.ParseIP(primaryTestIPv4),
+			})
+		}
+
+		assert.NoError(t, w.WriteMsg(response))
+	}
+
+	packed, err := Message{
+		ID:               42,
+		RecursionDesired: true,
+		Questions:        []Question{{Name: "a.k6.test", Type: "A"}, {Name: "b.k6.test", Type: "A"}},
+	}.Pack()
+	require.NoError(t, err)
+
+	for _, transport := range []Transport{TransportUDP, TransportTCP} {
+		t.Run("multi-question messages are exchanged over "+string(transport), func(t *testing.T) {
+			t.Parallel()
+
+			nameserver := startTestNameserver(t, multiQuestionHandler)
+
+			summary, err := NewDNSClient().Exchange(
+				context.Background(), packed, nameserver, ExchangeOptions{Transport: transport},
+			)
+			require.NoError(t, err)
+			assert.Positive(t, summary.Duration)
+
+			response, err := UnpackMessage(summary.Response)
+			require.NoError(t, err)
+
+			assert.Equal(t, uint16(42), response.ID)
+			assert.True(t, response.Response)
+			assert.Len(t, response.Questions, 2)
+			assert.Len(t, response.Answer, 2)
+		})
+	}
+
+	t.Run("unanswered messages time out", func(t *testing.T) {
+		t.Parallel()
+
+		nameserver := startTestNameserver(t, func(dns.ResponseWriter, *dns.Msg) {})
+
+		start := time.Now()
+		_, err := NewDNSClient().Exchange(
+			context.Background(), packed, nameserver, ExchangeOptions{Timeout: 50 * time.Millisecond},
+		)
+		require.Error(t, err)
+		assert.Less(t, time.Since(start), time.Second)
+	})
+
+	t.Run("invalid options are rejected", func(t *testing.T) {
+		t.Parallel()
+
+		for _, options := range []ExchangeOptions{
+			{Transport: "quic"},
+			{Timeout: -time.Second},
+		} {
+			_, err := NewDNSClient().Exchange(
+				context.Background(), packed, Nameserver{IP: net.IPv4(127, 0, 0, 1), Port: 53}, options,
+			)
+
+			assert.Error(t, err)
+		}
+	})
+}
@@ -0,0 +1,445 @@
+package dns
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/netip"
+	"os"
+	"sync"
+	"time"
+)
+
+// RecordFormat represents the format exchanges are recorded in.
+type RecordFormat string
+
+const (
+	// RecordFormatPcap records exchanges as IP packets, in a pcap file readable by
+	// tools such as Wireshark or tcpdump. It is the default.
+	RecordFormatPcap RecordFormat = "pcap"
+
+	// RecordFormatDnstap records exchanges as dnstap messages, sent over a Frame
+	// Streams file or Unix socket.
+	RecordFormatDnstap RecordFormat = "dnstap"
+)
+
+// recordHandshakeTimeout bounds the time the Frame Streams handshake with a dnstap
+// collector's Unix socket takes.
+const recordHandshakeTimeout = 5 * time.Second
+
+// RecordOptions controls whether, where, and which, queries and responses the Client
+// exchanges with nameservers are recorded, to inspect the packets of failing operations.
+//
+// Exchanges are sampled by operation: every exchange of a recorded resolution, such as
+// its DNSSEC validation queries, is recorded along with it.
+//
+// Exchanges recorded to the same file or socket are written to the same recorder, for
+// every client, such as every VU, to share it. The zero value records none.
+type RecordOptions struct {
+	// Format holds the format exchanges are recorded in. It defaults to
+	// RecordFormatPcap.
+	Format RecordFormat `js:"format"`
+
+	// Path holds the path of the file exchanges are recorded to. It is created, or
+	// truncated, once the first exchange recorded to it is made.
+	Path string `js:"path"`
+
+	// Socket holds the path of the Unix socket of a dnstap collector exchanges are
+	// recorded to, using the dnstap format. It is mutually exclusive with Path.
+	Socket string `js:"socket"`
+
+	// Rate holds the rate of operations whose exchanges are recorded, between 0 and 1.
+	// It defaults to 1, recording every operation.
+	Rate float64 `js:"rate"`
+
+	// FailedOnly restricts the recorded operations to the failed ones, such as timed
+	// out resolutions, or resolutions answered with an error response code.
+	FailedOnly bool `js:"failedOnly"`
+}
+
+// Enabled returns true if the options record exchanges.
+func (o RecordOptions) Enabled() bool {
+	return o.Path != "" || o.Socket != ""
+}
+
+// Validate checks that the options are consistent, and returns an error describing
+// the first problem found otherwise.
+func (o RecordOptions) Validate() error {
+	switch o.Format {
+	case "", RecordFormatPcap, RecordFormatDnstap:
+	default:
+		return fmt.Errorf("invalid format %q; expected one of %q or %q", o.Format, RecordFormatPcap, RecordFormatDnstap)
+	}
+
+	if o.Path != "" && o.Socket != "" {
+		return errors.New("path and socket options are mutually exclusive")
+	}
+
+	if o.Socket != "" && o.Format != RecordFormatDnstap {
+		return fmt.Errorf("recording to a socket requires the %q format", RecordFormatDnstap)
+	}
+
+	if (o.Format != "" || o.Rate != 0 || o.FailedOnly) && !o.Enabled() {
+		return errors.New("a path or socket to record exchanges to is required")
+	}
+
+	if o.Rate < 0 || o.Rate > 1 {
+		return fmt.Errorf("the rate must be between 0 and 1; got %v", o.Rate)
+	}
+
+	return nil
+}
+
+// sampled returns true if an operation, which failed if failed is true, is picked to
+// have its exchanges recorded.
+func (o RecordOptions) sampled(failed bool) bool {
+	if o.FailedOnly && !failed {
+		return false
+	}
+
+	return o.Rate == 0 || rand.Float64() < o.Rate //nolint:gosec // sampling doesn't need to be cryptographically random
+}
+
+// recordedExchange holds a query sent by the Client, and the responses it received,
+// if any, in wire format. Only zone transfers receive more than one response.
+type recordedExchange struct {
+	query     []byte
+	responses [][]byte
+	transport Transport
+
+	// client and server hold the addresses the query was sent from, and to. The client
+	// address is unspecified, and its port zero, unless the query was sent from a
+	// fixed local address.
+	client, server netip.AddrPort
+
+	queryTime, responseTime time.Time
+}
+
+// newRecordedExchange returns the exchange of the query and responses with the
+// nameserver, sent from the local IP, if any.
+func newRecordedExchange(
+	query []byte,
+	responses [][]byte,
+	nameserver Nameserver,
+	localIP net.IP,
+	transport Transport,
+	queryTime, responseTime time.Time,
+) recordedExchange {
+	server, _ := netip.AddrFromSlice(nameserver.IP)
+	server = server.Unmap()
+
+	client, ok := netip.AddrFromSlice(localIP)
+	if client = client.Unmap(); !ok || client.Is4() != server.Is4() {
+		client = netip.IPv6Unspecified()
+		if server.Is4() {
+			client = netip.IPv4Unspecified()
+		}
+	}
+
+	if transport == "" {
+		transport = TransportUDP
+	}
+
+	return recordedExchange{
+		query:        query,
+		responses:    responses,
+		transport:    transport,
+		client:       netip.AddrPortFrom(client, 0),
+		server:       netip.AddrPortFrom(server, nameserver.Port),
+		queryTime:    queryTime,
+		responseTime: responseTime,
+	}
+}
+
+// exchangeLog holds the exchanges of an operation, such as a resolution and the queries
+// validating its DNSSEC signatures, until the operation's outcome decides whether they
+// are recorded. Its methods accept a nil log, which holds none.
+type exchangeLog struct {
+	exchanges []recordedExchange
+}
+
+// add appends the exchange traced with the nameserver to the log, if the options record
+// exchanges, and the exchange's query was sent.
+func (l *exchangeLog) add(trace exchangeTrace, nameserver Nameserver, options ClientOptions) {
+	if l == nil || !options.Record.Enabled() || trace.query == nil {
+		return
+	}
+
+	var responses [][]byte
+	if trace.response != nil {
+		responses = append([][]byte{trace.response}, trace.more...)
+	}
+
+	localIP, _ := options.localIP(nameserver)
+	l.exchanges = append(l.exchanges,
+		newRecordedExchange(trace.query, responses, nameserver, localIP, options.Transport, trace.start, time.Now()))
+}
+
+// exchangeRecorder records exchanges to a file or socket. It is safe for concurrent use.
+type exchangeRecorder interface {
+	// record records the exchange.
+	record(exchange recordedExchange) error
+
+	// close flushes the recording, and closes its file or socket.
+	close() error
+}
+
+// recorderSet holds the recorders exchanges are recorded to, by file or socket.
+type recorderSet struct {
+	mu        sync.Mutex
+	recorders map[string]recorderSetEntry
+}
+
+// recorderSetEntry holds a recorder of the set, along with its format.
+type recorderSetEntry struct {
+	format   RecordFormat
+	recorder exchangeRecorder
+}
+
+// newRecorderSet creates a new, empty, set of recorders.
+func newRecorderSet() *recorderSet {
+	return &recorderSet{recorders: make(map[string]recorderSetEntry)}
+}
+
+// get returns the recorder of the options' file or socket, opening it if no client
+// recorded to it yet.
+func (s *recorderSet) get(options RecordOptions) (exchangeRecorder, error) {
+	format := options.Format
+	if format == "" {
+		format = RecordFormatPcap
+	}
+
+	key := "file:" + options.Path
+	if options.Socket != "" {
+		key = "socket:" + options.Socket
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry, ok := s.recorders[key]; ok {
+		if entry.format != format {
+			return nil, fmt.Errorf("exchanges are already recorded to %s in the %s format", key, entry.format)
+		}
+
+		return entry.recorder, nil
+	}
+
+	recorder, err := openRecorder(format, options)
+	if err != nil {
+		return nil, err
+	}
+
+	s.recorders[key] = recorderSetEntry{format: format, recorder: recorder}
+
+	return recorder, nil
+}
+
+// close closes every recorder of the set, and returns the errors encountered.
+func (s *recorderSet) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var errs []error
+	for key, entry := range s.recorders {
+		errs = append(errs, entry.recorder.close())
+		delete(s.recorders, key)
+	}
+
+	return errors.Join(errs...)
+}
+
+// openRecorder opens the file or socket of the options, and returns a recorder of the
+// format writing to it.
+func openRecorder(format RecordFormat, options RecordOptions) (exchangeRecorder, error) {
+	if options.Socket != "" {
+		conn, err := net.DialTimeout("unix", options.Socket, recordHandshakeTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("connecting to dnstap socket %s failed: %w", options.Socket, err)
+		}
+
+		recorder, err := newDnstapRecorder(conn, true)
+		if err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("opening dnstap socket %s failed: %w", options.Socket, err)
+		}
+
+		return recorder, nil
+	}
+
+	file, err := os.Create(options.Path)
+	if err != nil {
+		return nil, fmt.Errorf("creating recording file failed: %w", err)
+	}
+
+	var recorder exchangeRecorder
+	if format == RecordFormatDnstap {
+		recorder, err = newDnstapRecorder(file, false)
+	} else {
+		recorder, err = newPcapRecorder(file)
+	}
+
+	if err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("writing recording file %s failed: %w", options.Path, err)
+	}
+
+	return recorder, nil
+}
+
+// pcapRecorder records exchanges as IP packets in a pcap file, with nanosecond
+// timestamps. Packets are written as they are recorded, for the file to be readable
+// even if the recording isn't closed.
+type pcapRecorder struct {
+	mu sync.Mutex
+	w  io.WriteCloser
+}
+
+// newPcapRecorder writes the pcap file header to w, and returns a recorder writing to it.
+func newPcapRecorder(w io.WriteCloser) (*pcapRecorder, error) {
+	const snapLen = 262144
+
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint32(header, pcapMagicNanos)
+	binary.LittleEndian.PutUint16(header[4:], 2)
+	binary.LittleEndian.PutUint16(header[6:], 4)
+	binary.LittleEndian.PutUint32(header[16:], snapLen)
+	binary.LittleEndian.PutUint32(header[20:], linkTypeRaw)
+
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	return &pcapRecorder{w: w}, nil
+}
+
+// record writes the packets of the query, and of its responses, if any.
+func (p *pcapRecorder) record(exchange recordedExchange) error {
+	var records []byte
+
+	records = appendPcapRecord(records, exchange.queryTime,
+		encodeIPPacket(exchange.transport, exchange.client, exchange.server, streamPayload(exchange.transport, exchange.query)))
+
+	for _, response := range exchange.responses {
+		records = appendPcapRecord(records, exchange.responseTime,
+			encodeIPPacket(exchange.transport, exchange.server, exchange.client, streamPayload(exchange.transport, response)))
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	_, err := p.w.Write(records)
+
+	return err
+}
+
+// close closes the pcap file.
+func (p *pcapRecorder) close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.w.Close()
+}
+
+// appendPcapRecord appends a pcap record of the packet, captured at t, to records.
+func appendPcapRecord(records []byte, t time.Time, packet []byte) []byte {
+	records = binary.LittleEndian.AppendUint32(records, uint32(t.Unix()))       //nolint:gosec // after the epoch
+	records = binary.LittleEndian.AppendUint32(records, uint32(t.Nanosecond())) //nolint:gosec // below a second
+	records = binary.LittleEndian.AppendUint32(records, uint32(len(packet)))    //nolint:gosec // bounded by the snap length
+	records = binary.LittleEndian.AppendUint32(records, uint32(len(packet)))    //nolint:gosec // bounded by the snap length
+
+	return append(records, packet...)
+}
+
+// streamPayload returns the message as sent over the transport: prefixed by its
+// length over TCP and TLS, as is over UDP. TLS exchanges are recorded in clear text.
+func streamPayload(transport Transport, message []byte) []byte {
+	if transport == TransportUDP {
+		return message
+	}
+
+	payload := binary.BigEndian.AppendUint16(nil, uint16(len(message))) //nolint:gosec // bounded by the message size
+
+	return append(payload, message...)
+}
+
+// dnstapRecorder records exchanges as dnstap messages, sent over a Frame Streams file
+// or socket. Frames are written as they are recorded, for files to be readable even if
+// the recording isn't closed.
+type dnstapRecorder struct {
+	mu sync.Mutex
+	w  io.ReadWriteCloser
+
+	// bidirectional is true when writing to a socket, whose reader acknowledges the
+	// start and end of the stream.
+	bidirectional bool
+}
+
+// newDnstapRecorder starts a Frame Streams stream of dnstap messages over w, first
+// completing the handshake with its reader if it is bidirectional.
+func newDnstapRecorder(w io.ReadWriteCloser, bidirectional bool) (*dnstapRecorder, error) {
+	if bidirectional {
+		if conn, ok := w.(net.Conn); ok {
+			_ = conn.SetDeadline(time.Now().Add(recordHandshakeTimeout))
+			defer func() { _ = conn.SetDeadline(time.Time{}) }()
+		}
+
+		if _, err := w.Write(fstrmControlFrame(fstrmControlReady)); err != nil {
+			return nil, err
+		}
+
+		controlType, err := readFstrmControlFrame(w)
+		if err != nil {
+			return nil, err
+		}
+
+		if controlType != fstrmControlAccept {
+			return nil, fmt.Errorf("expected a frame streams ACCEPT control frame; got type %d", controlType)
+		}
+	}
+
+	if _, err := w.Write(fstrmControlFrame(fstrmControlStart)); err != nil {
+		return nil, err
+	}
+
+	return &dnstapRecorder{w: w, bidirectional: bidirectional}, nil
+}
+
+// record writes the dnstap messages of the query, and of its responses, if any.
+func (d *dnstapRecorder) record(exchange recordedExchange) error {
+	frames := fstrmDataFrame(encodeDnstap(exchange, exchange.query, false))
+	for _, response := range exchange.responses {
+		frames = append(frames, fstrmDataFrame(encodeDnstap(exchange, response, true))...)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	_, err := d.w.Write(frames)
+
+	return err
+}
+
+// close stops the stream, waiting for its reader to acknowledge it if it is
+// bidirectional, and closes its file or socket.
+func (d *dnstapRecorder) close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	_, err := d.w.Write(fstrmControlFrame(fstrmControlStop))
+	if err == nil && d.bidirectional {
+		if conn, ok := d.w.(net.Conn); ok {
+			_ = conn.SetDeadline(time.Now().Add(recordHandshakeTimeout))
+		}
+
+		var controlType uint32
+		if controlType, err = readFstrmControlFrame(d.w); err == nil && controlType != fstrmControlFinish {
+			err = fmt.Errorf("expected a frame streams FINISH control frame; got type %d", controlType)
+		}
+	}
+
+	return errors.Join(err, d.w.Close())
+}
@@ -0,0 +1,528 @@
+package dns
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestClient_Record(t *testing.T) {
+	t.Parallel()
+
+	// The nameserver answers queries for testDomain, and fails the others.
+	nameserver := startTestNameserver(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		if r.Question[0].Name != dns.Fqdn(testDomain) {
+			response := new(dns.Msg)
+			response.SetRcode(r, dns.RcodeNameError)
+			assert.NoError(t, w.WriteMsg(response))
+
+			return
+		}
+
+		writeTestAnswer(t, w, r)
+	})
+
+	// resolve resolves the names using a new client recording its exchanges with the
+	// options, and returns the recording once closed.
+	resolve := func(t *testing.T, options ClientOptions, names ...string) []byte {
+		t.Helper()
+
+		client := NewDNSClient()
+		for _, name := range names {
+			_, _ = client.ResolveWithOptions(context.Background(), name, "A", nameserver, options)
+		}
+
+		require.NoError(t, client.CloseRecordings())
+
+		if options.Record.Socket != "" {
+			return nil
+		}
+
+		recording, err := os.ReadFile(options.Record.Path)
+		require.NoError(t, err)
+
+		return recording
+	}
+
+	t.Run("exchanges are recorded to pcap files", func(t *testing.T) {
+		t.Parallel()
+
+		for _, transport := range []Transport{TransportUDP, TransportTCP} {
+			path := filepath.Join(t.TempDir(), "exchanges.pcap")
+			recording := resolve(t, ClientOptions{Transport: transport, Record: RecordOptions{Path: path}},
+				testDomain, "missing."+testDomain)
+
+			capture, err := ParseCapture(bytes.NewReader(recording), CaptureOptions{Port: nameserver.Port})
+			require.NoError(t, err, transport)
+			require.Equal(t, 2, capture.Len(), transport)
+
+			assert.Equal(t, transport, capture.Query(0).Transport)
+			require.NotNil(t, capture.Query(0).Reply, transport)
+			assert.Len(t, capture.Query(0).Reply.Answer, 1, transport)
+			require.NotNil(t, capture.Query(1).Reply, transport)
+			assert.Equal(t, "NXDOMAIN", capture.Query(1).Reply.Rcode, transport)
+		}
+	})
+
+	t.Run("failed resolutions can be recorded alone", func(t *testing.T) {
+		t.Parallel()
+
+		path := filepath.Join(t.TempDir(), "failures.pcap")
+		recording := resolve(t, ClientOptions{Record: RecordOptions{Path: path, FailedOnly: true}},
+			testDomain, "missing."+testDomain, testDomain)
+
+		capture, err := ParseCapture(bytes.NewReader(recording), CaptureOptions{Port: nameserver.Port})
+		require.NoError(t, err)
+		require.Equal(t, 1, capture.Len())
+		assert.Equal(t, "missing."+testDomain+".", capture.Query(0).Message.Questions[0].Name)
+	})
+
+	t.Run("exchanges are recorded to dnstap files", func(t *testing.T) {
+		t.Parallel()
+
+		path := filepath.Join(t.TempDir(), "exchanges.dnstap")
+		recording := resolve(t, ClientOptions{Record: RecordOptions{Format: RecordFormatDnstap, Path: path}}, testDomain)
+
+		reader := bufio.NewReader(bytes.NewReader(recording))
+
+		controlType, err := readFstrmControlFrame(reader)
+		require.NoError(t, err)
+		assert.Equal(t, uint32(fstrmControlStart), controlType)
+
+		assertTestDnstapExchange(t, reader)
+
+		controlType, err = readFstrmControlFrame(reader)
+		require.NoError(t, err)
+		assert.Equal(t, uint32(fstrmControlStop), controlType)
+	})
+
+	t.Run("exchanges are recorded to dnstap sockets", func(t *testing.T) {
+		t.Parallel()
+
+		socket := filepath.Join(t.TempDir(), "dnstap.sock")
+		listener, err := net.Listen("unix", socket)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = listener.Close() })
+
+		// The collector completes the bidirectional handshake, and collects the data
+		// frames until the stream is stopped.
+		var frames bytes.Buffer
+		collected := make(chan struct{})
+		go func() {
+			defer close(collected)
+
+			conn, err := listener.Accept()
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer func() { _ = conn.Close() }()
+
+			controlType, err := readFstrmControlFrame(conn)
+			assert.NoError(t, err)
+			assert.Equal(t, uint32(fstrmControlReady), controlType)
+
+			_, err = conn.Write(fstrmControlFrame(fstrmControlAccept))
+			assert.NoError(t, err)
+
+			controlType, err = readFstrmControlFrame(conn)
+			assert.NoError(t, err)
+			assert.Equal(t, uint32(fstrmControlStart), controlType)
+
+			reader := bufio.NewReader(conn)
+			for {
+				header, err := reader.Peek(4)
+				if !assert.NoError(t, err) {
+					return
+				}
+
+				if binary.BigEndian.Uint32(header) != 0 {
+					_, err = io.CopyN(&frames, reader, 4+int64(binary.BigEndian.Uint32(header)))
+					assert.NoError(t, err)
+
+					continue
+				}
+
+				controlType, err := readFstrmControlFrame(reader)
+				assert.NoError(t, err)
+				assert.Equal(t, uint32(fstrmControlStop), controlType)
+
+				_, err = conn.Write(fstrmControlFrame(fstrmControlFinish))
+				assert.NoError(t, err)
+
+				return
+			}
+		}()
+
+		resolve(t, ClientOptions{Record: RecordOptions{Format: RecordFormatDnstap, Socket: socket}}, testDomain)
+		<-collected
+
+		assertTestDnstapExchange(t, &frames)
+	})
+
+	t.Run("responses failing to unpack are recorded as received", func(t *testing.T) {
+		t.Parallel()
+
+		// The nameserver's responses are cut short of their answer's last byte.
+		malformed := startTestNameserver(t, func(w dns.ResponseWriter, r *dns.Msg) {
+			response := new(dns.Msg)
+			response.SetReply(r)
+			response.Answer = append(response.Answer, mustNewRR(t, testDomain+". 60 IN A "+primaryTestIPv4))
+
+			packed, err := response.Pack()
+			assert.NoError(t, err)
+
+			_, err = w.Write(packed[:len(packed)-1])
+			assert.NoError(t, err)
+		})
+
+		for _, transport := range []Transport{TransportUDP, TransportTCP} {
+			for _, reuse := range []ConnectionReuseMode{ConnectionReuseNone, ConnectionReuseVU} {
+				path := filepath.Join(t.TempDir(), "exchanges.dnstap")
+				options := ClientOptions{
+					Transport:       transport,
+					ConnectionReuse: reuse,
+					Record:          RecordOptions{Format: RecordFormatDnstap, Path: path},
+				}
+
+				client := NewDNSClient()
+				_, err := client.ResolveWithOptions(context.Background(), testDomain, "A", malformed, options)
+				require.Error(t, err, "%s with %s reuse", transport, reuse)
+				require.NoError(t, client.CloseRecordings())
+
+				recording, err := os.ReadFile(path)
+				require.NoError(t, err)
+
+				reader := bufio.NewReader(bytes.NewReader(recording))
+				_, err = readFstrmControlFrame(reader)
+				require.NoError(t, err)
+
+				query := readTestDnstapMessage(t, reader, dnstapMessageFieldQueryMessage)
+				response := readTestDnstapMessage(t, reader, dnstapMessageFieldResponseMessage)
+
+				require.GreaterOrEqual(t, len(response), 12, "%s with %s reuse", transport, reuse)
+				assert.Equal(t, query[:2], response[:2], "%s with %s reuse", transport, reuse)
+				assert.Error(t, new(dns.Msg).Unpack(response), "%s with %s reuse", transport, reuse)
+			}
+		}
+	})
+
+	t.Run("unreachable recordings don't fail resolutions", func(t *testing.T) {
+		t.Parallel()
+
+		options := ClientOptions{Record: RecordOptions{Path: filepath.Join(t.TempDir(), "missing", "exchanges.pcap")}}
+
+		resolution, err := NewDNSClient().ResolveWithOptions(context.Background(), testDomain, "A", nameserver, options)
+		require.NoError(t, err)
+		assert.Equal(t, []string{primaryTestIPv4}, resolution.IPs)
+		assert.Error(t, resolution.RecordingErr)
+	})
+
+	t.Run("invalid options are rejected", func(t *testing.T) {
+		t.Parallel()
+
+		for _, record := range []RecordOptions{
+			{Format: "json", Path: "exchanges.json"},
+			{Path: "exchanges.pcap", Socket: "dnstap.sock", Format: RecordFormatDnstap},
+			{Socket: "dnstap.sock"},
+			{FailedOnly: true},
+			{Path: "exchanges.pcap", Rate: 2},
+		} {
+			assert.Error(t, record.Validate(), record)
+		}
+	})
+}
+
+func TestClient_RecordOperations(t *testing.T) {
+	t.Parallel()
+
+	// readCapture closes the recordings of the client, and returns the capture of the
+	// pcap file at path, of the exchanges with nameservers listening on port.
+	readCapture := func(t *testing.T, client *Client, path string, port uint16) *Capture {
+		t.Helper()
+
+		require.NoError(t, client.CloseRecordings())
+
+		recording, err := os.ReadFile(path)
+		require.NoError(t, err)
+
+		capture, err := ParseCapture(bytes.NewReader(recording), CaptureOptions{Port: port})
+		require.NoError(t, err)
+
+		return capture
+	}
+
+	t.Run("DNSSEC validation queries are recorded along with their resolution", func(t *testing.T) {
+		t.Parallel()
+
+		tld := newTestDNSSECZone(t, "test.")
+		signed := newTestDNSSECZone(t, "signed.test.")
+		nameserver := startTestNameserver(t, testDNSSECHandler(t, map[string]testDNSSECResponse{
+			"test. DNSKEY":        {answer: tld.keySet(t)},
+			"signed.test. DS":     {answer: tld.sign(t, signed.ds())},
+			"signed.test. DNSKEY": {answer: signed.keySet(t)},
+			"a.signed.test. A":    {answer: signed.sign(t, mustNewRR(t, "a.signed.test. 60 IN A "+primaryTestIPv4))},
+		}))
+
+		path := filepath.Join(t.TempDir(), "exchanges.pcap")
+		options := ClientOptions{
+			ValidateDNSSEC: true,
+			TrustAnchors:   []string{tld.ds().String()},
+			Record:         RecordOptions{Path: path},
+		}
+
+		client := NewDNSClient()
+		resolution, err := client.ResolveWithOptions(context.Background(), "a.signed.test", "A", nameserver, options)
+		require.NoError(t, err)
+		require.NoError(t, resolution.RecordingErr)
+		assert.Equal(t, DNSSECSecure, resolution.DNSSEC.Status, resolution.DNSSEC.Reason)
+
+		capture := readCapture(t, client, path, nameserver.Port)
+		require.Equal(t, 4, capture.Len())
+
+		var types []string
+		for i := 0; i < capture.Len(); i++ {
+			require.NotNil(t, capture.Query(i).Reply, i)
+			types = append(types, capture.Query(i).Message.Questions[0].Type)
+		}
+
+		assert.ElementsMatch(t, []string{"A", "DNSKEY", "DS", "DNSKEY"}, types)
+	})
+
+	t.Run("iterative resolutions record every hop", func(t *testing.T) {
+		t.Parallel()
+
+		root, port := startTestHierarchy(t)
+
+		path := filepath.Join(t.TempDir(), "hops.pcap")
+		client := NewDNSClient()
+		resolver := NewIterativeResolver(client, IterativeOptions{
+			Roots:  []Nameserver{root},
+			Port:   port,
+			Client: ClientOptions{Record: RecordOptions{Path: path}},
+		})
+
+		trace, err := resolver.Trace(context.Background(), testDomain, "A")
+		require.NoError(t, err)
+		require.NoError(t, trace.RecordingErr)
+
+		capture := readCapture(t, client, path, port)
+		require.Equal(t, len(trace.Hops), capture.Len())
+
+		for i, hop := range trace.Hops {
+			assert.Equal(t, hop.Server, capture.Query(i).Server.String(), i)
+			assert.NotNil(t, capture.Query(i).Reply, i)
+		}
+	})
+
+	t.Run("notifies are recorded along with their SOA polls", func(t *testing.T) {
+		t.Parallel()
+
+		var polls atomic.Uint32
+		nameserver := startTestNameserver(t, testNotifyHandler(t, nil, func() uint32 {
+			if polls.Add(1) < 2 {
+				return 6
+			}
+
+			return 7
+		}))
+
+		path := filepath.Join(t.TempDir(), "notifies.pcap")
+		client := NewDNSClientWithOptions(ClientOptions{Record: RecordOptions{Path: path}})
+
+		summary, err := client.Notify(context.Background(), "k6.test", nameserver, NotifyOptions{
+			Serial:        7,
+			WaitForSerial: true,
+			PollInterval:  10 * time.Millisecond,
+		})
+		require.NoError(t, err)
+		require.NoError(t, summary.RecordingErr)
+
+		capture := readCapture(t, client, path, nameserver.Port)
+		require.Equal(t, 1+summary.Polls, capture.Len())
+
+		assert.Equal(t, "NOTIFY", capture.Query(0).Message.Opcode)
+		for i := 1; i < capture.Len(); i++ {
+			assert.Equal(t, "SOA", capture.Query(i).Message.Questions[0].Type, i)
+			assert.NotNil(t, capture.Query(i).Reply, i)
+		}
+	})
+
+	t.Run("transfers are recorded with every message received", func(t *testing.T) {
+		t.Parallel()
+
+		nameserver := startTestTransferServer(t, nil, testTransferHandler(t, testZoneEnvelopes(t), false))
+
+		path := filepath.Join(t.TempDir(), "transfers.dnstap")
+		client := NewDNSClientWithOptions(ClientOptions{Record: RecordOptions{Format: RecordFormatDnstap, Path: path}})
+
+		transfer, err := client.Transfer(context.Background(), "k6.test", nameserver, TransferOptions{})
+		require.NoError(t, err)
+		require.NoError(t, transfer.RecordingErr)
+		require.NoError(t, client.CloseRecordings())
+
+		recording, err := os.ReadFile(path)
+		require.NoError(t, err)
+
+		reader := bufio.NewReader(bytes.NewReader(recording))
+		_, err = readFstrmControlFrame(reader)
+		require.NoError(t, err)
+
+		query := new(dns.Msg)
+		require.NoError(t, query.Unpack(readTestDnstapMessage(t, reader, dnstapMessageFieldQueryMessage)))
+		assert.Equal(t, dns.TypeAXFR, query.Question[0].Qtype)
+
+		for i := 0; i < transfer.Messages; i++ {
+			response := new(dns.Msg)
+			require.NoError(t, response.Unpack(readTestDnstapMessage(t, reader, dnstapMessageFieldResponseMessage)), i)
+			assert.Equal(t, query.Id, response.Id, i)
+		}
+
+		controlType, err := readFstrmControlFrame(reader)
+		require.NoError(t, err)
+		assert.Equal(t, uint32(fstrmControlStop), controlType)
+	})
+
+	t.Run("failed transfers can be recorded alone", func(t *testing.T) {
+		t.Parallel()
+
+		nameserver := startTestTransferServer(t, nil, testTransferHandler(t, testZoneEnvelopes(t), false))
+
+		path := filepath.Join(t.TempDir(), "failures.pcap")
+		client := NewDNSClientWithOptions(ClientOptions{Record: RecordOptions{Path: path, FailedOnly: true}})
+
+		for _, zone := range []string{"k6.test", "refused.test", "k6.test"} {
+			_, _ = client.Transfer(context.Background(), zone, nameserver, TransferOptions{})
+		}
+
+		capture := readCapture(t, client, path, nameserver.Port)
+		require.Equal(t, 1, capture.Len())
+		assert.Equal(t, TransportTCP, capture.Query(0).Transport)
+		assert.Equal(t, "refused.test.", capture.Query(0).Message.Questions[0].Name)
+		require.NotNil(t, capture.Query(0).Reply)
+		assert.Equal(t, "REFUSED", capture.Query(0).Reply.Rcode)
+	})
+
+	t.Run("raw exchanges are recorded as exchanged", func(t *testing.T) {
+		t.Parallel()
+
+		nameserver := startTestNameserver(t, func(w dns.ResponseWriter, r *dns.Msg) {
+			writeTestAnswer(t, w, r)
+		})
+
+		message := new(dns.Msg)
+		message.SetQuestion(dns.Fqdn(testDomain), dns.TypeA)
+		packed, err := message.Pack()
+		require.NoError(t, err)
+
+		path := filepath.Join(t.TempDir(), "exchanges.pcap")
+		client := NewDNSClientWithOptions(ClientOptions{Record: RecordOptions{Path: path}})
+
+		summary, err := client.Exchange(context.Background(), packed, nameserver, ExchangeOptions{})
+		require.NoError(t, err)
+		require.NoError(t, summary.RecordingErr)
+
+		capture := readCapture(t, client, path, nameserver.Port)
+		require.Equal(t, 1, capture.Len())
+		assert.Equal(t, message.Id, capture.Query(0).Message.ID)
+		require.NotNil(t, capture.Query(0).Reply)
+		assert.Len(t, capture.Query(0).Reply.Answer, 1)
+	})
+}
+
+func TestRecordOptions_Sampled(t *testing.T) {
+	t.Parallel()
+
+	options := RecordOptions{Path: "exchanges.pcap", Rate: 0.25}
+
+	var sampled int
+	for i := 0; i < 4000; i++ {
+		if options.sampled(false) {
+			sampled++
+		}
+	}
+
+	assert.InDelta(t, 1000, sampled, 150)
+	assert.True(t, RecordOptions{Path: "exchanges.pcap"}.sampled(false))
+	assert.False(t, RecordOptions{Path: "exchanges.pcap", FailedOnly: true}.sampled(false))
+	assert.True(t, RecordOptions{Path: "exchanges.pcap", FailedOnly: true}.sampled(true))
+}
+
+// assertTestDnstapExchange reads the dnstap data frames of a query for testDomain, and
+// of its response, and asserts they hold them.
+func assertTestDnstapExchange(t *testing.T, r io.Reader) {
+	t.Helper()
+
+	for _, field := range []protowire.Number{dnstapMessageFieldQueryMessage, dnstapMessageFieldResponseMessage} {
+		msg := new(dns.Msg)
+		require.NoError(t, msg.Unpack(readTestDnstapMessage(t, r, field)))
+		assert.Equal(t, dns.Fqdn(testDomain), msg.Question[0].Name)
+	}
+}
+
+// readTestDnstapMessage reads a dnstap data frame, asserts it holds a query, or a
+// response, according to the field, and returns the DNS message it holds.
+func readTestDnstapMessage(t *testing.T, r io.Reader, field protowire.Number) []byte {
+	t.Helper()
+
+	header := make([]byte, 4)
+	_, err := io.ReadFull(r, header)
+	require.NoError(t, err)
+
+	frame := make([]byte, binary.BigEndian.Uint32(header))
+	_, err = io.ReadFull(r, frame)
+	require.NoError(t, err)
+
+	message := consumeTestProtobufField(t, frame, dnstapFieldMessage)
+	require.NotNil(t, message)
+
+	messageType := dnstapMessageToolQuery
+	if field == dnstapMessageFieldResponseMessage {
+		messageType = dnstapMessageToolResponse
+	}
+
+	actualType, _ := protowire.ConsumeVarint(consumeTestProtobufField(t, message, dnstapMessageFieldType))
+	assert.Equal(t, uint64(messageType), actualType)
+
+	return consumeTestProtobufField(t, message, field)
+}
+
+// consumeTestProtobufField returns the raw value of the protobuf field of the message,
+// or nil if it holds none.
+func consumeTestProtobufField(t *testing.T, message []byte, number protowire.Number) []byte {
+	t.Helper()
+
+	for len(message) > 0 {
+		fieldNumber, fieldType, n := protowire.ConsumeTag(message)
+		require.GreaterOrEqual(t, n, 0)
+		message = message[n:]
+
+		length := protowire.ConsumeFieldValue(fieldNumber, fieldType, message)
+		require.GreaterOrEqual(t, length, 0)
+
+		if fieldNumber == number {
+			if fieldType == protowire.BytesType {
+				value, _ := protowire.ConsumeBytes(message)
+				return value
+			}
+
+			return message[:length]
+		}
+
+		message = message[length:]
+	}
+
+	return nil
+}
@@ -10,12 +10,14 @@ import "github.com/miekg/dns"
 // The currently supported values are:
 // - A
 // - AAAA
+// - DNSKEY, DS, RRSIG, NSEC, NSEC3, NSEC3PARAM, CDS and CDNSKEY
 //
-// The supported values are the ones that are most likely to be
-// used by the users of this extension and package, as they are
-// those returning IP addresses. Other record types could be
-// supported later on, as long as we extend our resolver's logic
-// to support them.
+// The address record types are the ones that are most likely to be
+// used by the users of this extension and package. The DNSSEC record
+// types allow inspecting the keys and signatures of signed zones, and
+// are resolved to structured records rather than IP addresses. Other
+// record types could be supported later on, as long as we extend our
+// resolver's logic to support them.
 //
 // We use a custom type to restrict the set of values, and to
 // avoid leaking the underlying dns package's types to the
@@ -30,6 +32,20 @@ type RecordType uint16
 // Note that the RecordType enum values are explicitly typed to allow enumer
 // to detect them.
 const (
-	RecordTypeA    RecordType = RecordType(dns.TypeA)
-	RecordTypeAAAA RecordType = RecordType(dns.TypeAAAA)
+	RecordTypeA          RecordType = RecordType(dns.TypeA)
+	RecordTypeAAAA       RecordType = RecordType(dns.TypeAAAA)
+	RecordTypeDS         RecordType = RecordType(dns.TypeDS)
+	RecordTypeRRSIG      RecordType = RecordType(dns.TypeRRSIG)
+	RecordTypeNSEC       RecordType = RecordType(dns.TypeNSEC)
+	RecordTypeDNSKEY     RecordType = RecordType(dns.TypeDNSKEY)
+	RecordTypeNSEC3      RecordType = RecordType(dns.TypeNSEC3)
+	RecordTypeNSEC3PARAM RecordType = RecordType(dns.TypeNSEC3PARAM)
+	RecordTypeCDS        RecordType = RecordType(dns.TypeCDS)
+	RecordTypeCDNSKEY    RecordType = RecordType(dns.TypeCDNSKEY)
 )
+
+// isAddress returns true if the record type is one of the address record types,
+// which resolve to IP addresses.
+func (i RecordType) isAddress() bool {
+	return i == RecordTypeA || i == RecordTypeAAAA
+}
@@ -9,11 +9,19 @@ import (
 const (
 	_RecordTypeName_0 = "A"
 	_RecordTypeName_1 = "AAAA"
+	_RecordTypeName_2 = "DS"
+	_RecordTypeName_3 = "RRSIGNSECDNSKEY"
+	_RecordTypeName_4 = "NSEC3NSEC3PARAM"
+	_RecordTypeName_5 = "CDSCDNSKEY"
 )
 
 var (
 	_RecordTypeIndex_0 = [...]uint8{0, 1}
 	_RecordTypeIndex_1 = [...]uint8{0, 4}
+	_RecordTypeIndex_2 = [...]uint8{0, 2}
+	_RecordTypeIndex_3 = [...]uint8{0, 5, 9, 15}
+	_RecordTypeIndex_4 = [...]uint8{0, 5, 15}
+	_RecordTypeIndex_5 = [...]uint8{0, 3, 10}
 )
 
 func (i RecordType) String() string {
@@ -22,16 +30,35 @@ func (i RecordType) String() string {
 		return _RecordTypeName_0
 	case i == 28:
 		return _RecordTypeName_1
+	case i == 43:
+		return _RecordTypeName_2
+	case 46 <= i && i <= 48:
+		i -= 46
+		return _RecordTypeName_3[_RecordTypeIndex_3[i]:_RecordTypeIndex_3[i+1]]
+	case 50 <= i && i <= 51:
+		i -= 50
+		return _RecordTypeName_4[_RecordTypeIndex_4[i]:_RecordTypeIndex_4[i+1]]
+	case 59 <= i && i <= 60:
+		i -= 59
+		return _RecordTypeName_5[_RecordTypeIndex_5[i]:_RecordTypeIndex_5[i+1]]
 	default:
 		return fmt.Sprintf("RecordType(%d)", i)
 	}
 }
 
-var _RecordTypeValues = []RecordType{1, 28}
+var _RecordTypeValues = []RecordType{1, 28, 43, 46, 47, 48, 50, 51, 59, 60}
 
 var _RecordTypeNameToValueMap = map[string]RecordType{
-	_RecordTypeName_0[0:1]: 1,
-	_RecordTypeName_1[0:4]: 28,
+	_RecordTypeName_0[0:1]:  1,
+	_RecordTypeName_1[0:4]:  28,
+	_RecordTypeName_2[0:2]:  43,
+	_RecordTypeName_3[0:5]:  46,
+	_RecordTypeName_3[5:9]:  47,
+	_RecordTypeName_3[9:15]: 48,
+	_RecordTypeName_4[0:5]:  50,
+	_RecordTypeName_4[5:15]: 51,
+	_RecordTypeName_5[0:3]:  59,
+	_RecordTypeName_5[3:10]: 60,
 }
 
 // RecordTypeString retrieves an enum value from the enum constants string name.
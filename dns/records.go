@@ -0,0 +1,318 @@
+package dns
+
+import (
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// DNSKEYRecord holds a DNSKEY, or CDNSKEY, record.
+type DNSKEYRecord struct {
+	// Name holds the owner name of the record.
+	Name string `js:"name"`
+
+	// Type holds the type of the record, either DNSKEY or CDNSKEY.
+	Type string `js:"type"`
+
+	// TTL holds the time to live of the record, in seconds.
+	TTL uint32 `js:"ttl"`
+
+	// Flags holds the flags of the key.
+	Flags uint16 `js:"flags"`
+
+	// SecureEntryPoint is true if the key has the SEP flag set, as key signing keys do.
+	SecureEntryPoint bool `js:"secureEntryPoint"`
+
+	// Protocol holds the protocol of the key, which is always 3.
+	Protocol uint8 `js:"protocol"`
+
+	// Algorithm holds the number of the key's algorithm.
+	Algorithm uint8 `js:"algorithm"`
+
+	// AlgorithmName holds the mnemonic of the key's algorithm, such as ECDSAP256SHA256.
+	AlgorithmName string `js:"algorithmName"`
+
+	// KeyTag holds the key tag of the key, as computed from its data.
+	KeyTag uint16 `js:"keyTag"`
+
+	// PublicKey holds the base64 encoded public key.
+	PublicKey string `js:"publicKey"`
+}
+
+// DSRecord holds a DS, or CDS, record.
+type DSRecord struct {
+	// Name holds the owner name of the record.
+	Name string `js:"name"`
+
+	// Type holds the type of the record, either DS or CDS.
+	Type string `js:"type"`
+
+	// TTL holds the time to live of the record, in seconds.
+	TTL uint32 `js:"ttl"`
+
+	// KeyTag holds the key tag of the key the record refers to.
+	KeyTag uint16 `js:"keyTag"`
+
+	// Algorithm holds the number of the algorithm of the key the record refers to.
+	Algorithm uint8 `js:"algorithm"`
+
+	// AlgorithmName holds the mnemonic of the algorithm of the key the record refers to.
+	AlgorithmName string `js:"algorithmName"`
+
+	// DigestType holds the number of the digest algorithm.
+	DigestType uint8 `js:"digestType"`
+
+	// Digest holds the hex encoded digest of the key the record refers to.
+	Digest string `js:"digest"`
+}
+
+// RRSIGRecord holds an RRSIG record.
+type RRSIGRecord struct {
+	// Name holds the owner name of the record.
+	Name string `js:"name"`
+
+	// Type holds the type of the record, RRSIG.
+	Type string `js:"type"`
+
+	// TTL holds the time to live of the record, in seconds.
+	TTL uint32 `js:"ttl"`
+
+	// TypeCovered holds the type of the records the signature covers.
+	TypeCovered string `js:"typeCovered"`
+
+	// Algorithm holds the number of the signature's algorithm.
+	Algorithm uint8 `js:"algorithm"`
+
+	// AlgorithmName holds the mnemonic of the signature's algorithm.
+	AlgorithmName string `js:"algorithmName"`
+
+	// Labels holds the number of labels of the signed records' owner name.
+	Labels uint8 `js:"labels"`
+
+	// OriginalTTL holds the TTL of the signed records, as found in the zone.
+	OriginalTTL uint32 `js:"originalTtl"`
+
+	// Inception holds the time the signature becomes valid, in seconds since the Unix epoch.
+	Inception int64 `js:"inception"`
+
+	// Expiration holds the time the signature expires, in seconds since the Unix epoch.
+	Expiration int64 `js:"expiration"`
+
+	// KeyTag holds the key tag of the key that made the signature.
+	KeyTag uint16 `js:"keyTag"`
+
+	// SignerName holds the name of the zone that made the signature.
+	SignerName string `js:"signerName"`
+
+	// Signature holds the base64 encoded signature.
+	Signature string `js:"signature"`
+}
+
+// DaysUntilExpiration returns the number of days remaining before the signature
+// expires, from now. It is negative once the signature has expired.
+func (r RRSIGRecord) DaysUntilExpiration(now time.Time) float64 {
+	return time.Unix(r.Expiration, 0).Sub(now).Hours() / 24
+}
+
+// NSECRecord holds an NSEC record.
+type NSECRecord struct {
+	// Name holds the owner name of the record.
+	Name string `js:"name"`
+
+	// Type holds the type of the record, NSEC.
+	Type string `js:"type"`
+
+	// TTL holds the time to live of the record, in seconds.
+	TTL uint32 `js:"ttl"`
+
+	// NextDomain holds the next owner name of the zone, in canonical order.
+	NextDomain string `js:"nextDomain"`
+
+	// Types holds the types of the records owned by the record's owner name.
+	Types []string `js:"types"`
+}
+
+// NSEC3Record holds an NSEC3 record.
+type NSEC3Record struct {
+	// Name holds the owner name of the record, the hashed owner name followed by the zone.
+	Name string `js:"name"`
+
+	// Type holds the type of the record, NSEC3.
+	Type string `js:"type"`
+
+	// TTL holds the time to live of the record, in seconds.
+	TTL uint32 `js:"ttl"`
+
+	// HashAlgorithm holds the number of the hash algorithm, 1 for SHA-1.
+	HashAlgorithm uint8 `js:"hashAlgorithm"`
+
+	// Flags holds the flags of the record.
+	Flags uint8 `js:"flags"`
+
+	// OptOut is true if the record has the opt-out flag set.
+	OptOut bool `js:"optOut"`
+
+	// Iterations holds the number of additional hash iterations.
+	Iterations uint16 `js:"iterations"`
+
+	// Salt holds the hex encoded salt, or an empty string if there is none.
+	Salt string `js:"salt"`
+
+	// NextDomain holds the next hashed owner name of the zone, in base32hex.
+	NextDomain string `js:"nextDomain"`
+
+	// Types holds the types of the records owned by the original owner name.
+	Types []string `js:"types"`
+}
+
+// NSEC3PARAMRecord holds an NSEC3PARAM record.
+type NSEC3PARAMRecord struct {
+	// Name holds the owner name of the record.
+	Name string `js:"name"`
+
+	// Type holds the type of the record, NSEC3PARAM.
+	Type string `js:"type"`
+
+	// TTL holds the time to live of the record, in seconds.
+	TTL uint32 `js:"ttl"`
+
+	// HashAlgorithm holds the number of the hash algorithm, 1 for SHA-1.
+	HashAlgorithm uint8 `js:"hashAlgorithm"`
+
+	// Flags holds the flags of the record.
+	Flags uint8 `js:"flags"`
+
+	// Iterations holds the number of additional hash iterations.
+	Iterations uint16 `js:"iterations"`
+
+	// Salt holds the hex encoded salt, or an empty string if there is none.
+	Salt string `js:"salt"`
+}
+
+// newRecord converts the record to its structured representation, one of the
+// *DNSKEYRecord, *DSRecord, *RRSIGRecord, *NSECRecord, *NSEC3Record or
+// *NSEC3PARAMRecord types. It returns nil for other record types.
+func newRecord(rr dns.RR) any {
+	header := rr.Header()
+	name := header.Name
+	rrtype := dns.TypeToString[header.Rrtype]
+
+	switch t := rr.(type) {
+	case *dns.DNSKEY:
+		return newDNSKEYRecord(t, rrtype)
+	case *dns.CDNSKEY:
+		return newDNSKEYRecord(&t.DNSKEY, rrtype)
+	case *dns.DS:
+		return newDSRecord(t, rrtype)
+	case *dns.CDS:
+		return newDSRecord(&t.DS, rrtype)
+	case *dns.RRSIG:
+		return &RRSIGRecord{
+			Name:          name,
+			Type:          rrtype,
+			TTL:           header.Ttl,
+			TypeCovered:   dns.TypeToString[t.TypeCovered],
+			Algorithm:     t.Algorithm,
+			AlgorithmName: dns.AlgorithmToString[t.Algorithm],
+			Labels:        t.Labels,
+			OriginalTTL:   t.OrigTtl,
+			Inception:     signatureTime(t.Inception),
+			Expiration:    signatureTime(t.Expiration),
+			KeyTag:        t.KeyTag,
+			SignerName:    t.SignerName,
+			Signature:     t.Signature,
+		}
+	case *dns.NSEC:
+		return &NSECRecord{
+			Name:       name,
+			Type:       rrtype,
+			TTL:        header.Ttl,
+			NextDomain: t.NextDomain,
+			Types:      typeNames(t.TypeBitMap),
+		}
+	case *dns.NSEC3:
+		return &NSEC3Record{
+			Name:          name,
+			Type:          rrtype,
+			TTL:           header.Ttl,
+			HashAlgorithm: t.Hash,
+			Flags:         t.Flags,
+			OptOut:        t.Flags&nsec3OptOut != 0,
+			Iterations:    t.Iterations,
+			Salt:          strings.ToUpper(t.Salt),
+			NextDomain:    t.NextDomain,
+			Types:         typeNames(t.TypeBitMap),
+		}
+	case *dns.NSEC3PARAM:
+		return &NSEC3PARAMRecord{
+			Name:          name,
+			Type:          rrtype,
+			TTL:           header.Ttl,
+			HashAlgorithm: t.Hash,
+			Flags:         t.Flags,
+			Iterations:    t.Iterations,
+			Salt:          strings.ToUpper(t.Salt),
+		}
+	default:
+		return nil
+	}
+}
+
+// nsec3OptOut is the opt-out flag of NSEC3 records, as per [RFC5155].
+//
+// [RFC5155]: https://www.iana.org/go/rfc5155
+const nsec3OptOut = 0x01
+
+// newDNSKEYRecord converts a DNSKEY, or CDNSKEY, record of the given type.
+func newDNSKEYRecord(key *dns.DNSKEY, rrtype string) *DNSKEYRecord {
+	return &DNSKEYRecord{
+		Name:             key.Hdr.Name,
+		Type:             rrtype,
+		TTL:              key.Hdr.Ttl,
+		Flags:            key.Flags,
+		SecureEntryPoint: key.Flags&dns.SEP != 0,
+		Protocol:         key.Protocol,
+		Algorithm:        key.Algorithm,
+		AlgorithmName:    dns.AlgorithmToString[key.Algorithm],
+		KeyTag:           key.KeyTag(),
+		PublicKey:        key.PublicKey,
+	}
+}
+
+// newDSRecord converts a DS, or CDS, record of the given type.
+func newDSRecord(ds *dns.DS, rrtype string) *DSRecord {
+	return &DSRecord{
+		Name:          ds.Hdr.Name,
+		Type:          rrtype,
+		TTL:           ds.Hdr.Ttl,
+		KeyTag:        ds.KeyTag,
+		Algorithm:     ds.Algorithm,
+		AlgorithmName: dns.AlgorithmToString[ds.Algorithm],
+		DigestType:    ds.DigestType,
+		Digest:        strings.ToUpper(ds.Digest),
+	}
+}
+
+// signatureTime converts a signature's inception or expiration time, expressed in
+// serial number arithmetic as per [RFC4034], to seconds since the Unix epoch.
+//
+// [RFC4034]: https://www.iana.org/go/rfc4034
+func signatureTime(t uint32) int64 {
+	parsed, err := time.Parse("20060102150405", dns.TimeToString(t))
+	if err != nil {
+		return int64(t)
+	}
+
+	return parsed.Unix()
+}
+
+// typeNames returns the mnemonics of the types of a type bit map.
+func typeNames(types []uint16) []string {
+	names := make([]string, 0, len(types))
+	for _, t := range types {
+		names = append(names, dns.Type(t).String())
+	}
+
+	return names
+}
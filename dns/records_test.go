@@ -0,0 +1,158 @@
+package dns
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_ResolveDNSSECRecords(t *testing.T) {
+	t.Parallel()
+
+	zone := newTestDNSSECZone(t, "k6.test.")
+	nameserver := startTestNameserver(t, testDNSSECHandler(t, map[string]testDNSSECResponse{
+		"k6.test. DNSKEY": {answer: zone.keySet(t)},
+		"k6.test. DS":     {answer: []dns.RR{zone.ds()}},
+		"k6.test. RRSIG":  {answer: zone.keySet(t)[2:]},
+		"k6.test. NSEC": {answer: []dns.RR{
+			mustNewRR(t, "k6.test. 300 IN NSEC www.k6.test. A NS SOA RRSIG NSEC DNSKEY"),
+		}},
+		"k6.test. NSEC3PARAM": {answer: []dns.RR{mustNewRR(t, "k6.test. 0 IN NSEC3PARAM 1 0 10 AABBCCDD")}},
+	}))
+
+	client := NewDNSClient()
+
+	t.Run("DNSKEY records resolve to their keys", func(t *testing.T) {
+		t.Parallel()
+
+		resolution, err := client.ResolveWithOptions(context.Background(), "k6.test", "DNSKEY", nameserver, ClientOptions{})
+		require.NoError(t, err)
+		require.Len(t, resolution.Records, 2)
+		assert.Empty(t, resolution.IPs)
+
+		ksk, ok := resolution.Records[0].(*DNSKEYRecord)
+		require.True(t, ok)
+		assert.Equal(t, "DNSKEY", ksk.Type)
+		assert.True(t, ksk.SecureEntryPoint)
+		assert.Equal(t, zone.ksk.KeyTag(), ksk.KeyTag)
+		assert.Equal(t, "ECDSAP256SHA256", ksk.AlgorithmName)
+
+		zsk, ok := resolution.Records[1].(*DNSKEYRecord)
+		require.True(t, ok)
+		assert.False(t, zsk.SecureEntryPoint)
+	})
+
+	t.Run("DS records resolve to their digests", func(t *testing.T) {
+		t.Parallel()
+
+		resolution, err := client.ResolveWithOptions(context.Background(), "k6.test", "DS", nameserver, ClientOptions{})
+		require.NoError(t, err)
+		require.Len(t, resolution.Records, 1)
+
+		ds, ok := resolution.Records[0].(*DSRecord)
+		require.True(t, ok)
+		assert.Equal(t, zone.ksk.KeyTag(), ds.KeyTag)
+		assert.Equal(t, uint8(dns.SHA256), ds.DigestType)
+		assert.Equal(t, strings.ToUpper(zone.ds().Digest), ds.Digest)
+	})
+
+	t.Run("RRSIG records resolve to their validity period", func(t *testing.T) {
+		t.Parallel()
+
+		resolution, err := client.ResolveWithOptions(context.Background(), "k6.test", "RRSIG", nameserver, ClientOptions{})
+		require.NoError(t, err)
+		require.Len(t, resolution.Records, 1)
+
+		rrsig, ok := resolution.Records[0].(*RRSIGRecord)
+		require.True(t, ok)
+		assert.Equal(t, "DNSKEY", rrsig.TypeCovered)
+		assert.Equal(t, "k6.test.", rrsig.SignerName)
+		assert.Less(t, rrsig.Inception, rrsig.Expiration)
+		assert.InDelta(t, 1, rrsig.DaysUntilExpiration(time.Now()), 0.01)
+	})
+
+	t.Run("NSEC records resolve to their type bit maps", func(t *testing.T) {
+		t.Parallel()
+
+		resolution, err := client.ResolveWithOptions(context.Background(), "k6.test", "NSEC", nameserver, ClientOptions{})
+		require.NoError(t, err)
+		require.Len(t, resolution.Records, 1)
+
+		nsec, ok := resolution.Records[0].(*NSECRecord)
+		require.True(t, ok)
+		assert.Equal(t, "www.k6.test.", nsec.NextDomain)
+		assert.Equal(t, []string{"A", "NS", "SOA", "RRSIG", "NSEC", "DNSKEY"}, nsec.Types)
+	})
+
+	t.Run("NSEC3PARAM records resolve to their hash parameters", func(t *testing.T) {
+		t.Parallel()
+
+		resolution, err := client.ResolveWithOptions(context.Background(), "k6.test", "NSEC3PARAM", nameserver, ClientOptions{})
+		require.NoError(t, err)
+		require.Len(t, resolution.Records, 1)
+
+		param, ok := resolution.Records[0].(*NSEC3PARAMRecord)
+		require.True(t, ok)
+		assert.Equal(t, uint16(10), param.Iterations)
+		assert.Equal(t, "AABBCCDD", param.Salt)
+	})
+
+	t.Run("DNSSEC records resolve to their presentation format", func(t *testing.T) {
+		t.Parallel()
+
+		records, err := client.Resolve(context.Background(), "k6.test", "DS", nameserver)
+		require.NoError(t, err)
+		assert.Equal(t, []string{zone.ds().String()}, records)
+	})
+}
+
+func Test_newRecord(t *testing.T) {
+	t.Parallel()
+
+	t.Run("NSEC3 records report their hash parameters and opt-out flag", func(t *testing.T) {
+		t.Parallel()
+
+		record := newRecord(mustNewRR(t,
+			"2vptu5timamqttgl4luu9kg21e0aor3s.k6.test. 300 IN NSEC3 1 1 5 - 2VPTU5TIMAMQTTGL4LUU9KG21E0AOR3T A RRSIG",
+		))
+
+		nsec3, ok := record.(*NSEC3Record)
+		require.True(t, ok)
+		assert.True(t, nsec3.OptOut)
+		assert.Equal(t, uint16(5), nsec3.Iterations)
+		assert.Empty(t, nsec3.Salt)
+		assert.Equal(t, []string{"A", "RRSIG"}, nsec3.Types)
+	})
+
+	t.Run("CDS records are reported as such", func(t *testing.T) {
+		t.Parallel()
+
+		record := newRecord(mustNewRR(t, "k6.test. 300 IN CDS 12345 13 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D"))
+
+		ds, ok := record.(*DSRecord)
+		require.True(t, ok)
+		assert.Equal(t, "CDS", ds.Type)
+		assert.Equal(t, "ECDSAP256SHA256", ds.AlgorithmName)
+	})
+
+	t.Run("other records are not converted", func(t *testing.T) {
+		t.Parallel()
+
+		assert.Nil(t, newRecord(mustNewRR(t, "k6.test. 300 IN A "+primaryTestIPv4)))
+	})
+}
+
+func TestRRSIGRecord_DaysUntilExpiration(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	record := RRSIGRecord{Expiration: now.Add(36 * time.Hour).Unix()}
+
+	assert.InDelta(t, 1.5, record.DaysUntilExpiration(now), 0.0001)
+	assert.InDelta(t, -0.5, record.DaysUntilExpiration(now.Add(48*time.Hour)), 0.0001)
+}
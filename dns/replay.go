@@ -0,0 +1,361 @@
+package dns
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/grafana/sobek"
+	"go.k6.io/k6/js/common"
+	"go.k6.io/k6/js/promises"
+	"go.k6.io/k6/lib/fsext"
+)
+
+// jsWorkload is the JS representation of a Workload, shared by all VUs.
+type jsWorkload struct {
+	workload *Workload
+
+	// Length holds the number of queries of the workload.
+	Length int `js:"length"`
+
+	// Queries holds the queries of the workload, as a read-only array.
+	Queries sobek.Value `js:"queries"`
+}
+
+// Next returns the next query in the order of the query file, shared by all VUs.
+func (w *jsWorkload) Next() Question {
+	return w.workload.Next()
+}
+
+// Random returns one of the distinct queries of the workload, picked uniformly.
+func (w *jsWorkload) Random() Question {
+	return w.workload.Random()
+}
+
+// Weighted returns one of the distinct queries of the workload, picked according to
+// their weight.
+func (w *jsWorkload) Weighted() Question {
+	return w.workload.Weighted()
+}
+
+// workloadQueries exposes the queries of a workload as a read-only JS array, without
+// copying them in every VU, as SharedArray does.
+type workloadQueries struct {
+	rt       *sobek.Runtime
+	workload *Workload
+}
+
+var _ sobek.DynamicArray = workloadQueries{}
+
+// Len returns the number of queries.
+func (q workloadQueries) Len() int {
+	return q.workload.Len()
+}
+
+// Get returns the query at the index.
+func (q workloadQueries) Get(index int) sobek.Value {
+	if index < 0 || index >= q.workload.Len() {
+		return sobek.Undefined()
+	}
+
+	return q.rt.ToValue(q.workload.Query(index))
+}
+
+// Set panics, as the queries are read-only.
+func (q workloadQueries) Set(int, sobek.Value) bool {
+	panic(q.rt.NewTypeError("the queries of a workload are read-only"))
+}
+
+// SetLen panics, as the queries are read-only.
+func (q workloadQueries) SetLen(int) bool {
+	panic(q.rt.NewTypeError("the queries of a workload are read-only"))
+}
+
+// LoadQueryFile loads the queries of a dnsperf query file, such as "www.k6.io A" per
+// line. It can only be called in the init context, and the file is loaded once, its
+// queries being shared by all VUs.
+//
+// It returns a workload, holding the queries, which picks them in order, at random,
+// or according to their weight, and can be replayed using dns.replay.
+func (mi *ModuleInstance) LoadQueryFile(path sobek.Value) (*jsWorkload, error) {
+	initEnv := mi.vu.InitEnv()
+	if initEnv == nil || mi.vu.State() != nil {
+		return nil, errors.New("loadQueryFile must be called in the init context")
+	}
+
+	var pathStr string
+	if common.IsNullish(path) || mi.vu.Runtime().ExportTo(path, &pathStr) != nil || pathStr == "" {
+		return nil, fmt.Errorf("path must be a non-empty string; got %v instead", path)
+	}
+
+	absPath := initEnv.GetAbsFilePath(pathStr)
+
+	loaded, err := mi.root.loadFile("queries:"+absPath, func() (any, error) {
+		data, err := fsext.ReadFile(initEnv.FileSystems["file"], absPath)
+		if err != nil {
+			return nil, fmt.Errorf("reading query file %s failed: %w", pathStr, err)
+		}
+
+		workload, err := ParseQueryFile(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("parsing query file %s failed: %w", pathStr, err)
+		}
+
+		return workload, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	workload, _ := loaded.(*Workload)
+	rt := mi.vu.Runtime()
+
+	return &jsWorkload{
+		workload: workload,
+		Length:   workload.Len(),
+		Queries:  rt.NewDynamicArray(workloadQueries{rt: rt, workload: workload}),
+	}, nil
+}
+
+// jsCapture is the JS representation of a Capture, shared by all VUs.
+type jsCapture struct {
+	rt      *sobek.Runtime
+	capture *Capture
+
+	// Length holds the number of queries of the capture.
+	Length int `js:"length"`
+
+	// Duration holds the milliseconds elapsed between the first and the last query.
+	Duration float64 `js:"duration"`
+
+	// Queries holds the queries of the capture, as a read-only array.
+	Queries sobek.Value `js:"queries"`
+}
+
+// capturedQueryResult is the JS representation of a CapturedQuery.
+type capturedQueryResult struct {
+	Name      string            `js:"name"`
+	Type      string            `js:"type"`
+	Class     string            `js:"class"`
+	Message   Message           `js:"message"`
+	Bytes     sobek.ArrayBuffer `js:"bytes"`
+	Transport Transport         `js:"transport"`
+	Client    string            `js:"client"`
+	Server    string            `js:"server"`
+	Offset    float64           `js:"offset"`
+	Delay     float64           `js:"delay"`
+	Reply     *Message          `js:"reply"`
+	RTT       float64           `js:"rtt"`
+}
+
+// Verify compares the response, either a message as returned by dns.exchange and
+// dns.unpack, or an ArrayBuffer holding it in wire format, to the reply captured for
+// the query at the index. It returns the differences found, if any.
+func (c *jsCapture) Verify(index int, response sobek.Value) ([]string, error) {
+	if index < 0 || index >= c.capture.Len() {
+		return nil, fmt.Errorf("index must be between 0 and %d; got %d", c.capture.Len()-1, index)
+	}
+
+	if common.IsNullish(response) {
+		return nil, errors.New("response must be provided")
+	}
+
+	var message Message
+	if packed, err := exportBytes(response); err == nil {
+		if message, err = UnpackMessage(packed); err != nil {
+			return nil, err
+		}
+	} else if err := c.rt.ExportTo(response, &message); err != nil {
+		return nil, fmt.Errorf("response must be a message or an ArrayBuffer; got %v instead", response)
+	}
+
+	return c.capture.Query(index).Verify(message)
+}
+
+// capturedQueries exposes the queries of a capture as a read-only JS array, without
+// copying them in every VU, as SharedArray does.
+type capturedQueries struct {
+	rt      *sobek.Runtime
+	capture *Capture
+}
+
+var _ sobek.DynamicArray = capturedQueries{}
+
+// Len returns the number of queries.
+func (q capturedQueries) Len() int {
+	return q.capture.Len()
+}
+
+// Get returns the query at the index.
+func (q capturedQueries) Get(index int) sobek.Value {
+	if index < 0 || index >= q.capture.Len() {
+		return sobek.Undefined()
+	}
+
+	query := q.capture.Query(index)
+	result := capturedQueryResult{
+		Message: query.Message,
+		// The bytes are copied, for scripts not to alter the ones shared by all VUs.
+		Bytes:     q.rt.NewArrayBuffer(bytes.Clone(query.Packed)),
+		Transport: query.Transport,
+		Client:    query.Client.String(),
+		Server:    query.Server.String(),
+		Offset:    durationMillis(query.Offset),
+		Delay:     durationMillis(query.Delay),
+		Reply:     query.Reply,
+		RTT:       durationMillis(query.RTT),
+	}
+
+	if len(query.Message.Questions) > 0 {
+		question := query.Message.Questions[0]
+		result.Name = strings.TrimSuffix(question.Name, ".")
+		result.Type, result.Class = question.Type, question.Class
+
+		if result.Name == "" {
+			result.Name = "."
+		}
+	}
+
+	return q.rt.ToValue(result)
+}
+
+// Set panics, as the queries are read-only.
+func (q capturedQueries) Set(int, sobek.Value) bool {
+	panic(q.rt.NewTypeError("the queries of a capture are read-only"))
+}
+
+// SetLen panics, as the queries are read-only.
+func (q capturedQueries) SetLen(int) bool {
+	panic(q.rt.NewTypeError("the queries of a capture are read-only"))
+}
+
+// LoadCapture loads the DNS queries of a pcap or pcapng capture, such as one of
+// production traffic, along with their timing and captured replies. It can only be
+// called in the init context, and the file is loaded once, its queries being shared by
+// all VUs.
+//
+// It returns a capture, holding the queries, which can be sent using dns.resolve or
+// dns.exchange, and whose replies responses can be verified against.
+func (mi *ModuleInstance) LoadCapture(path, options sobek.Value) (*jsCapture, error) {
+	initEnv := mi.vu.InitEnv()
+	if initEnv == nil || mi.vu.State() != nil {
+		return nil, errors.New("loadCapture must be called in the init context")
+	}
+
+	rt := mi.vu.Runtime()
+
+	var pathStr string
+	if common.IsNullish(path) || rt.ExportTo(path, &pathStr) != nil || pathStr == "" {
+		return nil, fmt.Errorf("path must be a non-empty string; got %v instead", path)
+	}
+
+	var captureOptions CaptureOptions
+	if !common.IsNullish(options) {
+		if err := rt.ExportTo(options, &captureOptions); err != nil {
+			return nil, fmt.Errorf("options must be an object; got %v instead", options)
+		}
+	}
+
+	absPath := initEnv.GetAbsFilePath(pathStr)
+	key := fmt.Sprintf("capture:%d:%s", captureOptions.Port, absPath)
+
+	loaded, err := mi.root.loadFile(key, func() (any, error) {
+		data, err := fsext.ReadFile(initEnv.FileSystems["file"], absPath)
+		if err != nil {
+			return nil, fmt.Errorf("reading capture %s failed: %w", pathStr, err)
+		}
+
+		capture, err := ParseCapture(bytes.NewReader(data), captureOptions)
+		if err != nil {
+			return nil, fmt.Errorf("parsing capture %s failed: %w", pathStr, err)
+		}
+
+		return capture, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	capture, _ := loaded.(*Capture)
+
+	return &jsCapture{
+		rt:       rt,
+		capture:  capture,
+		Length:   capture.Len(),
+		Duration: durationMillis(capture.Duration()),
+		Queries:  rt.NewDynamicArray(capturedQueries{rt: rt, capture: capture}),
+	}, nil
+}
+
+// Replay sends the queries of the workload, loaded using dns.loadQueryFile, to the
+// nameserver at the rate defined by the options, using the query engine shared by all
+// VUs, as dns.fire does.
+//
+// Queries are picked in the order of the options, sequential by default, starting from
+// the first query. Unless a count or duration is set, every query is sent once.
+//
+// It returns a promise resolving to a summary of the queries sent, once they have all
+// been answered or have timed out.
+func (mi *ModuleInstance) Replay(workload, nameserverAddr, options sobek.Value) *sobek.Promise {
+	promise, resolve, reject := promises.New(mi.vu)
+
+	if mi.vu.State() == nil {
+		reject(errors.New("replay can not be used in the init context"))
+		return promise
+	}
+
+	if common.IsNullish(workload) {
+		reject(errors.New("workload must be provided"))
+		return promise
+	}
+
+	w, ok := workload.Export().(*jsWorkload)
+	if !ok {
+		reject(fmt.Errorf("workload must be loaded using dns.loadQueryFile; got %v instead", workload))
+		return promise
+	}
+
+	var nameserverAddrStr string
+	if common.IsNullish(nameserverAddr) || mi.vu.Runtime().ExportTo(nameserverAddr, &nameserverAddrStr) != nil {
+		reject(fmt.Errorf("nameserver must be a string; got %v instead", nameserverAddr))
+		return promise
+	}
+
+	nameserver, err := parseNameserverAddr(nameserverAddrStr)
+	if err != nil {
+		reject(fmt.Errorf("parsing nameserver address failed: %w", err))
+		return promise
+	}
+
+	fireOptions, err := parseFireOptions(mi.vu.Runtime(), options, int64(w.workload.Len()))
+	if err != nil {
+		reject(err)
+		return promise
+	}
+
+	var order WorkloadOrder
+	if value := options.ToObject(mi.vu.Runtime()).Get("order"); !common.IsNullish(value) {
+		order = WorkloadOrder(value.String())
+	}
+
+	if err := order.Validate(); err != nil {
+		reject(fmt.Errorf("invalid options: %w", err))
+		return promise
+	}
+
+	next := w.workload.picker(order)
+	engine := mi.root.queryEngine()
+
+	go func() {
+		summary, err := mi.fire(mi.vu.Context(), engine, next, nameserver, fireOptions)
+		if err != nil {
+			reject(err)
+			return
+		}
+
+		resolve(summary)
+	}()
+
+	return promise
+}
@@ -0,0 +1,255 @@
+package dns
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// defaultFuzzCount is the default number of corrupted messages sent by a robustness test.
+const defaultFuzzCount = 100
+
+// fuzzStream is the PCG stream robustness test seeds select, to derive the seeds of
+// their cases.
+const fuzzStream = 0x66757a7a
+
+// FuzzOutcome represents how a nameserver handled a corrupted message.
+type FuzzOutcome string
+
+const (
+	// FuzzResponded means the nameserver responded to the message with a response
+	// code other than FORMERR.
+	FuzzResponded FuzzOutcome = "responded"
+
+	// FuzzFormErr means the nameserver rejected the message with a FORMERR response.
+	FuzzFormErr FuzzOutcome = "formerr"
+
+	// FuzzDropped means the nameserver didn't respond to the message in time, or
+	// closed the connection it was sent over.
+	FuzzDropped FuzzOutcome = "dropped"
+)
+
+// FuzzOptions holds the options of a robustness test.
+type FuzzOptions struct {
+	// Seed holds the seed the cases' seeds are derived from, for the test to be
+	// replayed. It must be lower than 2^53, and is picked at random if not set.
+	Seed uint64 `js:"seed"`
+
+	// Count holds the number of corrupted messages to send. It defaults to 100.
+	Count int `js:"count"`
+
+	// Mutations holds the mutations the corrupted messages are made with. It defaults
+	// to every supported mutation.
+	Mutations []Mutation `js:"mutations"`
+
+	// Transport holds the transport protocol messages are sent over, either
+	// TransportUDP or TransportTCP. It defaults to TransportUDP.
+	Transport Transport `js:"transport"`
+
+	// Timeout holds the time we wait for the response to a message before deeming it
+	// dropped. It defaults to 2 seconds.
+	Timeout time.Duration `js:"-"`
+
+	// StopOnUnhealthy stops the test as soon as the nameserver fails a health probe.
+	StopOnUnhealthy bool `js:"stopOnUnhealthy"`
+}
+
+// Validate checks that the options are consistent, and returns an error describing
+// the first problem found otherwise.
+func (o FuzzOptions) Validate() error {
+	switch o.Transport {
+	case "", TransportUDP, TransportTCP:
+	default:
+		return fmt.Errorf(
+			"invalid fuzz transport %q; expected one of %q or %q",
+			o.Transport, TransportUDP, TransportTCP,
+		)
+	}
+
+	if o.Seed > maxSeed {
+		return fmt.Errorf("seed must be lower than 2^53; got %d", o.Seed)
+	}
+
+	if o.Count < 0 || o.Timeout < 0 {
+		return errors.New("count and timeout must not be negative")
+	}
+
+	for _, mutation := range o.Mutations {
+		if err := mutation.Validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// FuzzCase holds the outcome of a single corrupted message of a robustness test.
+type FuzzCase struct {
+	// Index holds the position of the case in the test, starting from 0.
+	Index int
+
+	// Seed holds the seed the corrupted message was made with. Passed to Mutate along
+	// with the test's message and mutations, it reproduces the message.
+	Seed uint64
+
+	// Mutation holds the mutation the corrupted message was made with.
+	Mutation Mutation
+
+	// Outcome holds how the nameserver handled the corrupted message.
+	Outcome FuzzOutcome
+
+	// Rcode holds the mnemonic of the response code of the nameserver's response, if
+	// it responded.
+	Rcode string
+
+	// Duration holds the time elapsed from sending the corrupted message to receiving
+	// its response, or giving up on it.
+	Duration time.Duration
+
+	// Healthy is true if the nameserver answered the well-formed probe query sent
+	// after the corrupted message.
+	Healthy bool
+}
+
+// FuzzSummary holds the outcome of a robustness test.
+type FuzzSummary struct {
+	// Seed holds the seed the test's cases were derived from.
+	Seed uint64
+
+	// Cases holds the outcome of every corrupted message sent, in order.
+	Cases []FuzzCase
+
+	// Responded, FormErr and Dropped hold the number of cases of each outcome.
+	Responded, FormErr, Dropped int
+
+	// Unhealthy holds the number of health probes the nameserver failed.
+	Unhealthy int
+
+	// RecordingErr holds the first error opening the recording, or recording the
+	// exchanges of the cases and probes to it, failed with, when recording exchanges.
+	// It doesn't fail the test.
+	RecordingErr error
+}
+
+// Fuzz tests the robustness of the nameserver, by sending it corrupted versions of the
+// packed message, a well-formed query, made using the options' mutations. It records
+// whether the nameserver rejects each of them with a FORMERR response, drops it, or
+// responds otherwise, and probes the nameserver with the well-formed message after each
+// of them, to detect it no longer answering.
+//
+// Tests are reproducible: the same message, options and seed produce the same corrupted
+// messages, and each corrupted message can be reproduced on its own using its case's seed.
+func (r *Client) Fuzz(
+	ctx context.Context,
+	packed []byte,
+	nameserver Nameserver,
+	options FuzzOptions,
+) (FuzzSummary, error) {
+	var summary FuzzSummary
+	if err := options.Validate(); err != nil {
+		return summary, err
+	}
+
+	if _, err := UnpackMessage(packed); err != nil {
+		return summary, fmt.Errorf("the message to mutate must be well-formed: %w", err)
+	}
+
+	count := options.Count
+	if count == 0 {
+		count = defaultFuzzCount
+	}
+
+	summary.Seed = options.Seed
+	for summary.Seed == 0 {
+		summary.Seed = rand.Uint64() & maxSeed //nolint:gosec // the seed doesn't need to be cryptographically random
+	}
+
+	seeds := rand.New(rand.NewPCG(summary.Seed, fuzzStream)) //nolint:gosec // seeds must be reproducible
+	exchangeOptions := ExchangeOptions{Transport: options.Transport, Timeout: options.Timeout}
+
+	for i := 0; i < count; i++ {
+		fuzzCase := FuzzCase{Index: i, Seed: seeds.Uint64() & maxSeed}
+
+		mutated, mutation, err := Mutate(packed, fuzzCase.Seed, options.Mutations)
+		if err != nil {
+			return summary, err
+		}
+
+		fuzzCase.Mutation = mutation
+
+		exchanged, err := r.Exchange(ctx, mutated, nameserver, exchangeOptions)
+		summary.RecordingErr = cmp.Or(summary.RecordingErr, exchanged.RecordingErr)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return summary, ctxErr
+		}
+
+		fuzzCase.Duration = exchanged.Duration
+
+		switch {
+		case err != nil:
+			fuzzCase.Outcome = FuzzDropped
+			summary.Dropped++
+		case len(exchanged.Response) >= 4 && int(exchanged.Response[3]&0x0F) == dns.RcodeFormatError:
+			fuzzCase.Outcome = FuzzFormErr
+			fuzzCase.Rcode = dns.RcodeToString[dns.RcodeFormatError]
+			summary.FormErr++
+		default:
+			fuzzCase.Outcome = FuzzResponded
+			if len(exchanged.Response) >= 4 {
+				fuzzCase.Rcode = codeString(int(exchanged.Response[3]&0x0F), dns.RcodeToString)
+			}
+			summary.Responded++
+		}
+
+		var recordingErr error
+		fuzzCase.Healthy, recordingErr = r.probe(ctx, packed, nameserver, exchangeOptions)
+		summary.RecordingErr = cmp.Or(summary.RecordingErr, recordingErr)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return summary, ctxErr
+		}
+
+		summary.Cases = append(summary.Cases, fuzzCase)
+
+		if !fuzzCase.Healthy {
+			summary.Unhealthy++
+
+			if options.StopOnUnhealthy {
+				break
+			}
+		}
+	}
+
+	return summary, nil
+}
+
+// probe sends the well-formed packed query to the nameserver, and returns true if it
+// answers it with a well-formed response matching the query. It also returns the error
+// recording the probe's exchange failed with, if any.
+func (r *Client) probe(
+	ctx context.Context,
+	packed []byte,
+	nameserver Nameserver,
+	options ExchangeOptions,
+) (bool, error) {
+	exchanged, err := r.Exchange(ctx, packed, nameserver, options)
+	if err != nil {
+		return false, exchanged.RecordingErr
+	}
+
+	response := new(dns.Msg)
+	if err := response.Unpack(exchanged.Response); err != nil {
+		return false, exchanged.RecordingErr
+	}
+
+	query := new(dns.Msg)
+	if err := query.Unpack(packed); err != nil {
+		return false, exchanged.RecordingErr
+	}
+
+	return response.Response && response.Id == query.Id, exchanged.RecordingErr
+}
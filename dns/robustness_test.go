@@ -0,0 +1,111 @@
+package dns
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_FuzzNameserver(t *testing.T) {
+	t.Parallel()
+
+	query := new(dns.Msg)
+	query.SetQuestion("www.k6.test.", dns.TypeA)
+
+	packed, err := query.Pack()
+	require.NoError(t, err)
+
+	t.Run("corrupted messages are rejected, or dropped, by healthy nameservers", func(t *testing.T) {
+		t.Parallel()
+
+		nameserver := startTestNameserver(t, writeTestAnswerHandler(t))
+
+		options := FuzzOptions{Seed: 42, Count: 30, Timeout: 50 * time.Millisecond}
+
+		summary, err := NewDNSClient().Fuzz(context.Background(), packed, nameserver, options)
+		require.NoError(t, err)
+
+		assert.Equal(t, uint64(42), summary.Seed)
+		assert.Len(t, summary.Cases, 30)
+		assert.Equal(t, 30, summary.Responded+summary.FormErr+summary.Dropped)
+		assert.Positive(t, summary.FormErr)
+		assert.Positive(t, summary.Dropped)
+		assert.Zero(t, summary.Unhealthy)
+
+		mutations := make(map[Mutation]bool)
+		for i, fuzzCase := range summary.Cases {
+			assert.Equal(t, i, fuzzCase.Index)
+			assert.True(t, fuzzCase.Healthy)
+			mutations[fuzzCase.Mutation] = true
+
+			if fuzzCase.Outcome == FuzzFormErr {
+				assert.Equal(t, "FORMERR", fuzzCase.Rcode)
+			}
+		}
+		assert.Len(t, mutations, len(Mutations))
+
+		// Replaying the test, or one of its cases, produces the same messages.
+		replayed, err := NewDNSClient().Fuzz(context.Background(), packed, nameserver, options)
+		require.NoError(t, err)
+
+		for i, fuzzCase := range summary.Cases {
+			assert.Equal(t, fuzzCase.Seed, replayed.Cases[i].Seed)
+			assert.Equal(t, fuzzCase.Mutation, replayed.Cases[i].Mutation)
+		}
+
+		_, mutation, err := Mutate(packed, summary.Cases[7].Seed, nil)
+		require.NoError(t, err)
+		assert.Equal(t, summary.Cases[7].Mutation, mutation)
+	})
+
+	t.Run("nameservers no longer answering probes are reported unhealthy", func(t *testing.T) {
+		t.Parallel()
+
+		var answered atomic.Bool
+		nameserver := startTestNameserver(t, func(w dns.ResponseWriter, r *dns.Msg) {
+			if !answered.Swap(true) {
+				writeTestAnswer(t, w, r)
+			}
+		})
+
+		summary, err := NewDNSClient().Fuzz(context.Background(), packed, nameserver, FuzzOptions{
+			Count:           10,
+			Mutations:       []Mutation{MutationTruncatedHeader},
+			Timeout:         50 * time.Millisecond,
+			StopOnUnhealthy: true,
+		})
+		require.NoError(t, err)
+
+		assert.NotZero(t, summary.Seed)
+		require.Len(t, summary.Cases, 2)
+		assert.True(t, summary.Cases[0].Healthy)
+		assert.False(t, summary.Cases[1].Healthy)
+		assert.Equal(t, FuzzDropped, summary.Cases[1].Outcome)
+		assert.Equal(t, 1, summary.Unhealthy)
+	})
+
+	t.Run("invalid messages and options are rejected", func(t *testing.T) {
+		t.Parallel()
+
+		nameserver := Nameserver{IP: net.IPv4(127, 0, 0, 1), Port: 53}
+
+		_, err := NewDNSClient().Fuzz(context.Background(), packed[:10], nameserver, FuzzOptions{})
+		assert.Error(t, err)
+
+		for _, options := range []FuzzOptions{
+			{Transport: TransportTLS},
+			{Seed: 1 << 60},
+			{Count: -1},
+			{Mutations: []Mutation{"shuffle"}},
+		} {
+			_, err := NewDNSClient().Fuzz(context.Background(), packed, nameserver, options)
+			assert.Error(t, err)
+		}
+	})
+}
@@ -0,0 +1,435 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/grafana/sobek"
+	"github.com/miekg/dns"
+	"go.k6.io/k6/js/common"
+	"go.k6.io/k6/js/modules"
+	"go.k6.io/k6/lib/types"
+	"go.k6.io/k6/metrics"
+)
+
+// jsServer is the JS representation of a Server.
+type jsServer struct {
+	mi      *ModuleInstance
+	server  *Server
+	handler *serverHandler
+
+	// mu guards the fields below, set once the server is started.
+	mu     sync.Mutex
+	addr   string
+	ctx    context.Context
+	cancel context.CancelFunc
+	tags   *metrics.TagSet
+	out    chan<- metrics.SampleContainer
+
+	// stopWithVU stops the server from being stopped along with the VU that
+	// started it, for handlers' servers started outside of setup().
+	stopWithVU func() bool
+}
+
+// NewServer is the constructor of the dns.Server class, an in-process authoritative DNS
+// server answering queries either from a zone object, or using a JS handler function.
+func (mi *ModuleInstance) NewServer(call sobek.ConstructorCall) *sobek.Object {
+	rt := mi.vu.Runtime()
+
+	options, callback, err := parseServerOptions(rt, call.Argument(0))
+	if err != nil {
+		common.Throw(rt, err)
+	}
+
+	s := &jsServer{mi: mi}
+	options.OnQuery = s.emitServerMetrics
+
+	var handler ServerHandler
+	if callback != nil {
+		s.handler = &serverHandler{
+			vu:        mi.vu,
+			callback:  callback,
+			requests:  make(chan serverRequest),
+			runtimeMu: &mi.detachedHandlersMu,
+		}
+		handler = s.handler.handle
+	}
+
+	if s.server, err = NewServer(options, handler); err != nil {
+		common.Throw(rt, fmt.Errorf("invalid options: %w", err))
+	}
+
+	obj := rt.NewObject()
+	for name, method := range map[string]any{
+		"start": s.start,
+		"stop":  s.stop,
+	} {
+		if err := obj.Set(name, method); err != nil {
+			common.Throw(rt, err)
+		}
+	}
+
+	err = obj.DefineAccessorProperty("address", rt.ToValue(func() string {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		return s.addr
+	}), nil, sobek.FLAG_FALSE, sobek.FLAG_TRUE)
+	if err != nil {
+		common.Throw(rt, err)
+	}
+
+	return obj
+}
+
+// StopServer stops the server started, by any VU, on the address, such as a server
+// started in setup() and stopped in teardown().
+func (mi *ModuleInstance) StopServer(address sobek.Value) error {
+	var addressStr string
+	if common.IsNullish(address) || mi.vu.Runtime().ExportTo(address, &addressStr) != nil {
+		return fmt.Errorf("address must be a string; got %v instead", address)
+	}
+
+	server, ok := mi.root.servers.Load(addressStr)
+	if !ok {
+		return fmt.Errorf("no server is started on %s", addressStr)
+	}
+
+	server.(*jsServer).stop() //nolint:forcetypeassert
+
+	return nil
+}
+
+// start starts the server, and returns the address it listens on.
+func (s *jsServer) start() (string, error) {
+	state := s.mi.vu.State()
+	if state == nil {
+		return "", errors.New("servers can not be started in the init context")
+	}
+
+	addr, err := s.server.Start()
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.addr = addr.Addr()
+	s.tags = state.Tags.GetCurrentValues().Tags.With("server", s.addr)
+	s.out = state.Samples
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+
+	switch {
+	case s.handler == nil:
+	case state.VUID == 0:
+		// setup() and teardown() run in a VU of their own, with ID 0, whose event
+		// loop stops once they return, and whose runtime is left unused afterward.
+		// Handlers then run on that runtime, once they returned.
+		go s.handler.dispatchDetached(s.ctx)
+	default:
+		// Handlers run on the event loop of the VU starting the server, thus the
+		// server can't outlive it, and keeps it running until it's stopped.
+		go s.handler.dispatch(s.ctx, s.mi.vu.RegisterCallback())
+		s.stopWithVU = context.AfterFunc(s.mi.vu.Context(), s.stop)
+	}
+
+	s.mi.root.servers.Store(s.addr, s)
+
+	return s.addr, nil
+}
+
+// stop stops the server. It can be started again afterward.
+func (s *jsServer) stop() {
+	s.mu.Lock()
+	cancel, stopWithVU, addr := s.cancel, s.stopWithVU, s.addr
+	s.cancel, s.stopWithVU = nil, nil
+	s.mu.Unlock()
+
+	if cancel == nil {
+		return
+	}
+
+	if stopWithVU != nil {
+		stopWithVU()
+	}
+
+	s.server.Stop()
+	cancel()
+
+	s.mi.root.servers.CompareAndDelete(addr, s)
+}
+
+// serverHandler answers the queries received by a server using a JS handler function,
+// called on the event loop of the VU that started the server.
+type serverHandler struct {
+	vu       modules.VU
+	callback sobek.Callable
+
+	// requests holds the queries waiting to be handed over to the event loop.
+	requests chan serverRequest
+
+	// runtimeMu serializes the calls of the VU's handlers running outside of its
+	// event loop.
+	runtimeMu *sync.Mutex
+}
+
+// serverRequest is a query waiting for the JS handler to answer it.
+type serverRequest struct {
+	query     *dns.Msg
+	transport Transport
+	response  chan serverResponse
+}
+
+// serverResponse is the JS handler's answer to a query.
+type serverResponse struct {
+	response *dns.Msg
+	err      error
+}
+
+// handle hands the query over to the JS handler, and waits for its answer.
+func (h *serverHandler) handle(ctx context.Context, query *dns.Msg, transport Transport) (*dns.Msg, error) {
+	request := serverRequest{query: query, transport: transport, response: make(chan serverResponse, 1)}
+
+	select {
+	case h.requests <- request:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	select {
+	case answered := <-request.response:
+		return answered.response, answered.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// dispatch hands the queries over to the JS handler, one at a time, until the context
+// is done, using enqueue to run the handler on the event loop.
+//
+// As event loop callbacks can only be registered from the event loop, the callback
+// of the next query is registered while running the current one.
+func (h *serverHandler) dispatch(ctx context.Context, enqueue func(func() error)) {
+	for {
+		var request serverRequest
+		select {
+		case request = <-h.requests:
+		case <-ctx.Done():
+			// Releasing the registered callback lets the event loop complete.
+			enqueue(func() error { return nil })
+			return
+		}
+
+		next := make(chan func(func() error), 1)
+		enqueue(func() error {
+			next <- h.vu.RegisterCallback()
+
+			if ctx.Err() == nil {
+				response, err := h.call(request)
+				request.response <- serverResponse{response: response, err: err}
+			}
+
+			return nil
+		})
+
+		select {
+		case enqueue = <-next:
+		case <-h.vu.Context().Done():
+			// The event loop stops along with the VU's context, and won't run the
+			// callback, nor expect the next one to be released.
+			return
+		}
+	}
+}
+
+// dispatchDetached hands the queries over to the JS handler, one at a time, from the
+// time the VU's context is done until the context is done. It is used by servers
+// started in setup(), whose VU's event loop stops once setup() returns, but whose
+// runtime is left unused by k6 afterward: the handler is then called on the runtime
+// directly, serialized with the VU's other handlers.
+func (h *serverHandler) dispatchDetached(ctx context.Context) {
+	select {
+	case <-h.vu.Context().Done():
+	case <-ctx.Done():
+		return
+	}
+
+	for {
+		var request serverRequest
+		select {
+		case request = <-h.requests:
+		case <-ctx.Done():
+			return
+		}
+
+		h.runtimeMu.Lock()
+		response, err := h.callDetached(request)
+		h.runtimeMu.Unlock()
+
+		request.response <- serverResponse{response: response, err: err}
+	}
+}
+
+// callDetached calls the JS handler with the query, outside of the event loop. k6
+// interrupts the runtime once the VU's context is done, possibly after the handler is
+// first called, thus the interruption is cleared before calling it, and an interrupted
+// call is retried once.
+func (h *serverHandler) callDetached(request serverRequest) (*dns.Msg, error) {
+	h.vu.Runtime().ClearInterrupt()
+
+	response, err := h.call(request)
+
+	var interrupted *sobek.InterruptedError
+	if errors.As(err, &interrupted) {
+		h.vu.Runtime().ClearInterrupt()
+		response, err = h.call(request)
+	}
+
+	return response, err
+}
+
+// call calls the JS handler with the query, and returns its answer. The handler is
+// expected to return a message object, whose unset ID, opcode and questions default
+// to the query's, or null to drop the query.
+func (h *serverHandler) call(request serverRequest) (*dns.Msg, error) {
+	rt := h.vu.Runtime()
+
+	query, err := newMessage(request.query)
+	if err != nil {
+		return nil, err
+	}
+
+	info := map[string]any{"transport": string(request.transport)}
+
+	value, err := h.callback(sobek.Undefined(), rt.ToValue(query), rt.ToValue(info))
+	if err != nil {
+		// Interruptions are caused by the VU stopping, rather than by the handler.
+		var interrupted *sobek.InterruptedError
+		if state := h.vu.State(); state != nil && !errors.As(err, &interrupted) {
+			state.Logger.WithError(err).Warn("the dns.Server handler threw an exception; answering with SERVFAIL")
+		}
+
+		return nil, err
+	}
+
+	if common.IsNullish(value) {
+		return nil, nil //nolint:nilnil // a nil response drops the query
+	}
+
+	var reply Message
+	if err := rt.ExportTo(value, &reply); err != nil {
+		return nil, fmt.Errorf("the handler must return a message object; got %v instead", value)
+	}
+
+	response, err := reply.msg()
+	if err != nil {
+		return nil, err
+	}
+
+	response.Response = true
+	response.RecursionDesired = request.query.RecursionDesired
+
+	if reply.ID == 0 {
+		response.Id = request.query.Id
+	}
+
+	if reply.Opcode == "" {
+		response.Opcode = request.query.Opcode
+	}
+
+	if len(reply.Questions) == 0 {
+		response.Question = request.query.Question
+	}
+
+	return response, nil
+}
+
+// parseServerOptions parses the options of the dns.Server constructor, and returns the
+// JS handler function, if any.
+func parseServerOptions(rt *sobek.Runtime, options sobek.Value) (ServerOptions, sobek.Callable, error) {
+	var serverOptions ServerOptions
+	if common.IsNullish(options) {
+		return serverOptions, nil, errors.New("options must be provided, with either a zone or a handler")
+	}
+
+	if err := rt.ExportTo(options, &serverOptions); err != nil {
+		return ServerOptions{}, nil, fmt.Errorf("options must be an object; got %v instead", options)
+	}
+
+	optionsObj := options.ToObject(rt)
+	for name, dst := range map[string]*time.Duration{
+		"latency": &serverOptions.Latency,
+		"jitter":  &serverOptions.Jitter,
+	} {
+		value := optionsObj.Get(name)
+		if common.IsNullish(value) {
+			continue
+		}
+
+		duration, err := types.GetDurationValue(value.Export())
+		if err != nil {
+			return ServerOptions{}, nil, fmt.Errorf("invalid %s option: %w", name, err)
+		}
+
+		*dst = duration
+	}
+
+	var callback sobek.Callable
+	if value := optionsObj.Get("handler"); !common.IsNullish(value) {
+		var ok bool
+		if callback, ok = sobek.AssertFunction(value); !ok {
+			return ServerOptions{}, nil, fmt.Errorf("handler must be a function; got %v instead", value)
+		}
+	}
+
+	return serverOptions, callback, nil
+}
+
+// emitServerMetrics emits the metrics of a query answered, or dropped, by a server.
+func (s *jsServer) emitServerMetrics(served ServedQuery) {
+	s.mu.Lock()
+	ctx, tags, out := s.ctx, s.tags, s.out
+	s.mu.Unlock()
+
+	if ctx == nil {
+		return
+	}
+
+	tags = tags.With("transport", string(served.Transport))
+	tags = tags.With("recordType", served.Type)
+	if served.Rcode != "" {
+		tags = tags.With("rcode", served.Rcode)
+	}
+
+	if served.Injected {
+		tags = tags.With("injected", "true")
+	}
+
+	now := time.Now()
+
+	// Increment the served queries counter
+	metrics.PushIfNotDone(ctx, out, metrics.Sample{
+		TimeSeries: metrics.TimeSeries{
+			Metric: s.mi.metrics.DNSServerQueries,
+			Tags:   tags,
+		},
+		Time:     now,
+		Value:    float64(1),
+		Metadata: nil,
+	})
+
+	// Emit the time taken to respond, artificial latency included
+	metrics.PushIfNotDone(ctx, out, metrics.Sample{
+		TimeSeries: metrics.TimeSeries{
+			Metric: s.mi.metrics.DNSServerDuration,
+			Tags:   tags,
+		},
+		Time:     now,
+		Value:    durationMillis(served.Duration),
+		Metadata: nil,
+	})
+}
@@ -0,0 +1,325 @@
+package dns
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// SIG0Options holds the key used to sign messages with SIG(0), as per [RFC2931].
+//
+// Both parts of the key are expected as generated by `dnssec-keygen -T KEY`, and can
+// thus be read from the key's files in the init context of k6 scripts.
+//
+// [RFC2931]: https://www.iana.org/go/rfc2931
+type SIG0Options struct {
+	// Key holds the public KEY record of the key, in presentation format, as found in
+	// its .key file. Its owner name is the signer name of the signatures.
+	Key string `js:"key"`
+
+	// PrivateKey holds the private part of the key, either in the BIND private key
+	// format of its .private file, or PEM encoded, in the PKCS #8, PKCS #1 or SEC 1
+	// format. RSA, ECDSA and Ed25519 keys are supported.
+	PrivateKey string `js:"privateKey"`
+
+	// ServerKey holds the public KEY record, in presentation format, of the key the
+	// nameserver signs its responses with, if any. Responses are then required to be
+	// signed with it.
+	ServerKey string `js:"serverKey"`
+}
+
+// sig0Validity is the validity period of SIG(0) signatures, as recommended by [RFC2931].
+// Their inception is backdated by the same period, to tolerate clock skew.
+//
+// [RFC2931]: https://www.iana.org/go/rfc2931#section-3.1
+const sig0Validity = 5 * time.Minute
+
+// sig0Key is a parsed SIG(0) key.
+type sig0Key struct {
+	key       *dns.KEY
+	signer    crypto.Signer
+	serverKey *dns.KEY
+}
+
+// IsZero returns true if no key is set.
+func (o SIG0Options) IsZero() bool {
+	return o == SIG0Options{}
+}
+
+// Validate validates that both parts of the key are set. The key itself is parsed, and
+// validated, by the Client using it.
+func (o SIG0Options) Validate() error {
+	if o.IsZero() {
+		return nil
+	}
+
+	if strings.TrimSpace(o.Key) == "" {
+		return errors.New("invalid sig0 key: a KEY record must be provided")
+	}
+
+	if strings.TrimSpace(o.PrivateKey) == "" {
+		return errors.New("invalid sig0 private key: a private key must be provided")
+	}
+
+	return nil
+}
+
+// digest returns the SHA-256 digest of the key's material, identifying it in caches
+// without holding on to its private part.
+func (o SIG0Options) digest() [sha256.Size]byte {
+	h := sha256.New()
+	for _, part := range []string{o.Key, o.PrivateKey, o.ServerKey} {
+		_, _ = h.Write([]byte(part))
+		_, _ = h.Write([]byte{0})
+	}
+
+	var digest [sha256.Size]byte
+	h.Sum(digest[:0])
+
+	return digest
+}
+
+// parse parses the key.
+func (o SIG0Options) parse() (*sig0Key, error) {
+	key, err := parseKEY(o.Key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sig0 key: %w", err)
+	}
+
+	signer, err := parsePrivateKey(key, o.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sig0 private key: %w", err)
+	}
+
+	parsed := &sig0Key{key: key, signer: signer}
+	if o.ServerKey != "" {
+		if parsed.serverKey, err = parseKEY(o.ServerKey); err != nil {
+			return nil, fmt.Errorf("invalid sig0 server key: %w", err)
+		}
+	}
+
+	return parsed, nil
+}
+
+// sig0KeyCache caches parsed SIG(0) keys, so that the cost of parsing a key is only
+// paid once, rather than by every signed message. Keys are identified by the digest of
+// their material. It is safe for concurrent use.
+type sig0KeyCache struct {
+	mu   sync.Mutex
+	keys map[[sha256.Size]byte]*sig0Key
+}
+
+// newSIG0KeyCache creates a new, empty, sig0KeyCache.
+func newSIG0KeyCache() *sig0KeyCache {
+	return &sig0KeyCache{keys: make(map[[sha256.Size]byte]*sig0Key)}
+}
+
+// get returns the parsed key of the options, parsing and caching it if it isn't cached.
+func (c *sig0KeyCache) get(options SIG0Options) (*sig0Key, error) {
+	digest := options.digest()
+
+	c.mu.Lock()
+	cached, ok := c.keys[digest]
+	c.mu.Unlock()
+
+	if ok {
+		return cached, nil
+	}
+
+	parsed, err := options.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.keys[digest] = parsed
+	c.mu.Unlock()
+
+	return parsed, nil
+}
+
+// clear evicts the cached keys. The cache remains usable.
+func (c *sig0KeyCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	clear(c.keys)
+}
+
+// parseKEY parses a KEY record in presentation format.
+func parseKEY(record string) (*dns.KEY, error) {
+	if strings.TrimSpace(record) == "" {
+		return nil, errors.New("a KEY record must be provided")
+	}
+
+	rr, err := dns.NewRR(record)
+	if err != nil {
+		return nil, err
+	}
+
+	key, ok := rr.(*dns.KEY)
+	if !ok {
+		return nil, fmt.Errorf("expected a KEY record; got %s instead", dns.TypeToString[rr.Header().Rrtype])
+	}
+
+	return key, nil
+}
+
+// parsePrivateKey parses the private part of the key, in the BIND private key format,
+// or PEM encoded, and checks that it is of the type the key's algorithm expects.
+func parsePrivateKey(key *dns.KEY, privateKey string) (crypto.Signer, error) {
+	var (
+		parsed crypto.PrivateKey
+		err    error
+	)
+
+	if block, _ := pem.Decode([]byte(privateKey)); block != nil {
+		parsed, err = parsePEMPrivateKey(block)
+	} else {
+		parsed, err = key.NewPrivateKey(privateKey)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", parsed)
+	}
+
+	var matches bool
+	switch public := signer.Public().(type) {
+	case *rsa.PublicKey:
+		matches = key.Algorithm == dns.RSASHA1 || key.Algorithm == dns.RSASHA256 || key.Algorithm == dns.RSASHA512
+	case *ecdsa.PublicKey:
+		matches = (key.Algorithm == dns.ECDSAP256SHA256 && public.Curve == elliptic.P256()) ||
+			(key.Algorithm == dns.ECDSAP384SHA384 && public.Curve == elliptic.P384())
+	case ed25519.PublicKey:
+		matches = key.Algorithm == dns.ED25519
+	}
+
+	if !matches {
+		return nil, fmt.Errorf(
+			"the private key doesn't match the key's %s algorithm",
+			dns.AlgorithmToString[key.Algorithm],
+		)
+	}
+
+	return signer, nil
+}
+
+// parsePEMPrivateKey parses a PEM encoded private key, in the PKCS #8, PKCS #1 or
+// SEC 1 format.
+func parsePEMPrivateKey(block *pem.Block) (crypto.PrivateKey, error) {
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+}
+
+// sign packs the message, with a SIG(0) signature made with the key appended.
+func (k *sig0Key) sign(message *dns.Msg) ([]byte, error) {
+	now := time.Now()
+
+	sig := &dns.SIG{RRSIG: dns.RRSIG{
+		Algorithm:  k.key.Algorithm,
+		Inception:  uint32(now.Add(-sig0Validity).Unix()), //nolint:gosec
+		Expiration: uint32(now.Add(sig0Validity).Unix()),  //nolint:gosec
+		KeyTag:     k.key.KeyTag(),
+		SignerName: dns.CanonicalName(k.key.Hdr.Name),
+	}}
+
+	return sig.Sign(k.signer, message)
+}
+
+// verify checks that the packed response is signed with the server key, if any, and
+// returns an *Error of the BadSig, BadKey or BadTime kind otherwise.
+func (k *sig0Key) verify(response *dns.Msg, packed []byte) error {
+	if k.serverKey == nil {
+		return nil
+	}
+
+	var sig *dns.SIG
+	if len(response.Extra) > 0 {
+		sig, _ = response.Extra[len(response.Extra)-1].(*dns.SIG)
+	}
+
+	if sig == nil {
+		return newSignatureError(dns.RcodeBadSig, "the response is not signed")
+	}
+
+	if !strings.EqualFold(sig.SignerName, k.serverKey.Hdr.Name) || sig.KeyTag != k.serverKey.KeyTag() {
+		return newSignatureError(dns.RcodeBadKey, "the response is signed with an unknown key")
+	}
+
+	switch err := sig.Verify(k.serverKey, packed); {
+	case err == nil:
+		return nil
+	case errors.Is(err, dns.ErrTime):
+		return newSignatureError(dns.RcodeBadTime, "the response was signed outside of the signature's validity period")
+	case errors.Is(err, dns.ErrKey), errors.Is(err, dns.ErrKeyAlg), errors.Is(err, dns.ErrAlg):
+		return newSignatureError(dns.RcodeBadKey, "the response is signed with an unknown key")
+	default:
+		return newSignatureError(dns.RcodeBadSig, "the response's signature failed to verify")
+	}
+}
+
+// exchangeSIG0 sends the message to the nameserver, signed with the SIG(0) key, over
+// a connection dialed using the client, and returns the verified response. The signed
+// message, and its response, are recorded in the trace in wire format.
+//
+// The exchange is handled here rather than by miekg/dns, as verifying the response's
+// signature requires the response as it was received, before it is unpacked.
+func exchangeSIG0(
+	ctx context.Context,
+	client dns.Client,
+	message *dns.Msg,
+	nameserver Nameserver,
+	key *sig0Key,
+	trace *exchangeTrace,
+) (*dns.Msg, error) {
+	signed, err := key.sign(message)
+	if err != nil {
+		return nil, fmt.Errorf("signing the message failed: %w", err)
+	}
+
+	packed, err := exchangeRaw(ctx, client, signed, nameserver, defaultExchangeTimeout, trace)
+	if err != nil {
+		return nil, err
+	}
+
+	response := new(dns.Msg)
+	if err := response.Unpack(packed); err != nil {
+		return nil, err
+	}
+
+	if response.Id != message.Id {
+		return nil, dns.ErrId
+	}
+
+	if err := key.verify(response, packed); err != nil {
+		return response, err
+	}
+
+	return response, nil
+}
@@ -0,0 +1,247 @@
+package dns
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_UpdateWithSIG0(t *testing.T) {
+	t.Parallel()
+
+	serverKey, serverSigner := newTestSIG0Key(t, "ns.k6.test.", dns.ED25519, 256)
+
+	for _, tt := range []struct {
+		name      string
+		algorithm uint8
+		bits      int
+		pem       bool
+	}{
+		{name: "RSA keys in the BIND format", algorithm: dns.RSASHA256, bits: 2048},
+		{name: "ECDSA keys in the PEM format", algorithm: dns.ECDSAP256SHA256, bits: 256, pem: true},
+		{name: "Ed25519 keys in the BIND format", algorithm: dns.ED25519, bits: 256},
+	} {
+		tt := tt
+
+		t.Run(tt.name+" sign updates", func(t *testing.T) {
+			t.Parallel()
+
+			key, signer := newTestSIG0Key(t, "update.k6.test.", tt.algorithm, tt.bits)
+			nameserver := startTestSIG0Server(t, key, serverKey, serverSigner)
+
+			privateKey := key.PrivateKeyString(signer)
+			if tt.pem {
+				der, err := x509.MarshalPKCS8PrivateKey(signer)
+				require.NoError(t, err)
+
+				privateKey = string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+			}
+
+			_, err := NewDNSClient().Update(context.Background(), "k6.test", nameserver, UpdateOptions{
+				Add: []string{"www.k6.test. 60 IN A " + primaryTestIPv4},
+				SIG0: SIG0Options{
+					Key:        key.String(),
+					PrivateKey: privateKey,
+					ServerKey:  serverKey.String(),
+				},
+			})
+			require.NoError(t, err)
+		})
+	}
+
+	t.Run("responses failing to verify are rejected", func(t *testing.T) {
+		t.Parallel()
+
+		key, signer := newTestSIG0Key(t, "update.k6.test.", dns.ED25519, 256)
+		otherKey, otherSigner := newTestSIG0Key(t, "other.k6.test.", dns.ED25519, 256)
+		_, forgedSigner := newTestSIG0Key(t, "ns.k6.test.", dns.ED25519, 256)
+
+		for _, tc := range []struct {
+			signer   crypto.Signer
+			key      *dns.KEY
+			wantKind errorKind
+		}{
+			{signer: nil, key: nil, wantKind: BadSig},
+			{signer: otherSigner, key: otherKey, wantKind: BadKey},
+			{signer: forgedSigner, key: serverKey, wantKind: BadSig},
+		} {
+			nameserver := startTestSIG0Server(t, key, tc.key, tc.signer)
+
+			_, err := NewDNSClient().Update(context.Background(), "k6.test", nameserver, UpdateOptions{
+				Add: []string{"www.k6.test. 60 IN A " + primaryTestIPv4},
+				SIG0: SIG0Options{
+					Key:        key.String(),
+					PrivateKey: key.PrivateKeyString(signer),
+					ServerKey:  serverKey.String(),
+				},
+			})
+
+			var dnsErr *Error
+			require.ErrorAs(t, err, &dnsErr)
+			assert.Equal(t, tc.wantKind, dnsErr.Kind)
+		}
+	})
+
+	t.Run("updates signed with an unknown key are rejected by the nameserver", func(t *testing.T) {
+		t.Parallel()
+
+		key, _ := newTestSIG0Key(t, "update.k6.test.", dns.ED25519, 256)
+		_, otherSigner := newTestSIG0Key(t, "update.k6.test.", dns.ED25519, 256)
+		nameserver := startTestSIG0Server(t, key, nil, nil)
+
+		_, err := NewDNSClient().Update(context.Background(), "k6.test", nameserver, UpdateOptions{
+			Add:  []string{"www.k6.test. 60 IN A " + primaryTestIPv4},
+			SIG0: SIG0Options{Key: key.String(), PrivateKey: key.PrivateKeyString(otherSigner)},
+		})
+
+		var dnsErr *Error
+		require.ErrorAs(t, err, &dnsErr)
+		assert.Equal(t, NotAuth, dnsErr.Kind)
+	})
+
+	t.Run("invalid keys are rejected", func(t *testing.T) {
+		t.Parallel()
+
+		key, signer := newTestSIG0Key(t, "update.k6.test.", dns.ED25519, 256)
+		ecdsaKey, ecdsaSigner := newTestSIG0Key(t, "update.k6.test.", dns.ECDSAP256SHA256, 256)
+
+		for _, options := range []UpdateOptions{
+			{SIG0: SIG0Options{PrivateKey: key.PrivateKeyString(signer)}},
+			{SIG0: SIG0Options{Key: key.String()}},
+			{SIG0: SIG0Options{Key: "update.k6.test. 60 IN A " + primaryTestIPv4, PrivateKey: key.PrivateKeyString(signer)}},
+			{SIG0: SIG0Options{Key: key.String(), PrivateKey: ecdsaKey.PrivateKeyString(ecdsaSigner)}},
+			{SIG0: SIG0Options{Key: key.String(), PrivateKey: "-----BEGIN CERTIFICATE-----\nAAAA\n-----END CERTIFICATE-----\n"}},
+			{
+				SIG0: SIG0Options{Key: key.String(), PrivateKey: key.PrivateKeyString(signer)},
+				TSIG: TSIGOptions{Name: "transfer.k6.test", Secret: testTSIGSecret},
+			},
+		} {
+			_, err := NewDNSClient().Update(
+				context.Background(), "k6.test", Nameserver{IP: net.IPv4(127, 0, 0, 1), Port: 53}, options,
+			)
+
+			assert.Error(t, err)
+		}
+	})
+}
+
+func Test_sig0KeyCache(t *testing.T) {
+	t.Parallel()
+
+	key, signer := newTestSIG0Key(t, "update.k6.test.", dns.ED25519, 256)
+	options := SIG0Options{Key: key.String(), PrivateKey: key.PrivateKeyString(signer)}
+
+	cache := newSIG0KeyCache()
+
+	parsed, err := cache.get(options)
+	require.NoError(t, err)
+
+	cached, err := cache.get(options)
+	require.NoError(t, err)
+	assert.Same(t, parsed, cached)
+
+	// Keys differing by their server key are cached apart.
+	serverKey, _ := newTestSIG0Key(t, "ns.k6.test.", dns.ED25519, 256)
+	options.ServerKey = serverKey.String()
+
+	cached, err = cache.get(options)
+	require.NoError(t, err)
+	assert.NotSame(t, parsed, cached)
+	assert.Len(t, cache.keys, 2)
+
+	cache.clear()
+	assert.Empty(t, cache.keys)
+}
+
+// newTestSIG0Key generates a new SIG(0) key of the given algorithm, owned by name.
+func newTestSIG0Key(t *testing.T, name string, algorithm uint8, bits int) (*dns.KEY, crypto.Signer) {
+	t.Helper()
+
+	key := &dns.KEY{DNSKEY: dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: name, Rrtype: dns.TypeKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     dns.ZONE,
+		Protocol:  3,
+		Algorithm: algorithm,
+	}}
+
+	privateKey, err := key.Generate(bits)
+	require.NoError(t, err)
+
+	signer, ok := privateKey.(crypto.Signer)
+	require.True(t, ok)
+
+	return key, signer
+}
+
+// startTestSIG0Server starts an in-process UDP nameserver on the loopback interface,
+// accepting the updates signed with clientKey, and refusing the other ones with a
+// NOTAUTH response. Responses are signed with serverSigner, described by serverKey,
+// if provided. The nameserver is shut down when the test completes.
+func startTestSIG0Server(t *testing.T, clientKey, serverKey *dns.KEY, serverSigner crypto.Signer) Nameserver {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	t.Cleanup(func() { _ = conn.Close() })
+
+	go func() {
+		buf := make([]byte, dns.MaxMsgSize)
+		for {
+			n, from, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+
+			request := new(dns.Msg)
+			if err := request.Unpack(buf[:n]); err != nil {
+				continue
+			}
+
+			response := new(dns.Msg)
+			response.SetReply(request)
+
+			sig, ok := request.Extra[len(request.Extra)-1].(*dns.SIG)
+			if !ok || sig.Verify(clientKey, buf[:n]) != nil {
+				response.Rcode = dns.RcodeNotAuth
+			}
+
+			packed, err := response.Pack()
+			if serverSigner != nil {
+				now := time.Now()
+				responseSig := &dns.SIG{RRSIG: dns.RRSIG{
+					Algorithm:  serverKey.Algorithm,
+					Inception:  uint32(now.Add(-time.Minute).Unix()), //nolint:gosec
+					Expiration: uint32(now.Add(time.Minute).Unix()),  //nolint:gosec
+					KeyTag:     serverKey.KeyTag(),
+					SignerName: serverKey.Hdr.Name,
+				}}
+
+				packed, err = responseSig.Sign(serverSigner, response)
+			}
+
+			if err != nil {
+				t.Error(err)
+				return
+			}
+
+			if _, err := conn.WriteTo(packed, from); err != nil && !errors.Is(err, net.ErrClosed) {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	addr := conn.LocalAddr().(*net.UDPAddr) //nolint:forcetypeassert
+
+	return Nameserver{IP: addr.IP, Port: uint16(addr.Port)} //nolint:gosec
+}
@@ -0,0 +1,230 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/grafana/sobek"
+	"go.k6.io/k6/js/common"
+	"go.k6.io/k6/js/promises"
+	"go.k6.io/k6/metrics"
+)
+
+// TraceOptions holds the options of a dns.trace call.
+type TraceOptions struct {
+	// Roots holds the addresses of the root nameservers to start from, in the `ip[:port]`
+	// format. It defaults to the IANA root nameservers.
+	Roots []string `js:"roots"`
+
+	// Port holds the port the nameservers learned from referrals are queried on. It
+	// defaults to 53.
+	Port uint16 `js:"port"`
+
+	// MaxQueries holds the maximum number of queries the resolution can send. It
+	// defaults to 64.
+	MaxQueries int `js:"maxQueries"`
+
+	// QnameMinimisation enables QNAME minimisation, as per RFC 9156.
+	QnameMinimisation bool `js:"qnameMinimisation"`
+}
+
+// traceResult is the JS representation of a Trace.
+type traceResult struct {
+	IPs      []string   `js:"ips"`
+	Answer   []string   `js:"answer"`
+	Hops     []traceHop `js:"hops"`
+	Duration float64    `js:"duration"`
+}
+
+// traceHop is the JS representation of a Hop.
+type traceHop struct {
+	Name          string         `js:"name"`
+	Type          string         `js:"type"`
+	Minimised     bool           `js:"minimised"`
+	Zone          string         `js:"zone"`
+	Server        string         `js:"server"`
+	Rcode         string         `js:"rcode"`
+	Authoritative bool           `js:"authoritative"`
+	Referral      *traceReferral `js:"referral"`
+	Answer        []string       `js:"answer"`
+	Latency       float64        `js:"latency"`
+	Error         string         `js:"error"`
+}
+
+// traceReferral is the JS representation of a Referral.
+type traceReferral struct {
+	Zone        string   `js:"zone"`
+	Nameservers []string `js:"nameservers"`
+	Glue        []string `js:"glue"`
+}
+
+// Trace resolves a domain name iteratively, starting from the root nameservers, and
+// following referrals down to the authoritative nameservers, as `dig +trace` does.
+//
+// It returns a promise resolving to the resolution's IP addresses, authoritative
+// answer, and every query it took, along with their latency in milliseconds.
+func (mi *ModuleInstance) Trace(query, recordType, options sobek.Value) *sobek.Promise {
+	promise, resolve, reject := promises.New(mi.vu)
+
+	if mi.vu.State() == nil {
+		reject(errors.New("trace can not be used in the init context"))
+		return promise
+	}
+
+	var queryStr string
+	if err := mi.vu.Runtime().ExportTo(query, &queryStr); err != nil {
+		reject(fmt.Errorf("query must be a string; got %v instead", query))
+		return promise
+	}
+
+	var recordTypeStr string
+	if err := mi.vu.Runtime().ExportTo(recordType, &recordTypeStr); err != nil {
+		reject(fmt.Errorf("recordType must be a string; got %v instead", recordType))
+		return promise
+	}
+
+	var traceOptions TraceOptions
+	if !common.IsNullish(options) {
+		if err := mi.vu.Runtime().ExportTo(options, &traceOptions); err != nil {
+			reject(fmt.Errorf("options must be an object; got %v instead", options))
+			return promise
+		}
+	}
+
+	iterativeOptions := IterativeOptions{
+		Port:              traceOptions.Port,
+		MaxQueries:        traceOptions.MaxQueries,
+		QnameMinimisation: traceOptions.QnameMinimisation,
+		Client:            mi.dnsClient.Options(),
+	}
+	iterativeOptions.Client.ConnectionReuse = mi.connectionReuseMode(iterativeOptions.Client.ConnectionReuse)
+
+	for _, root := range traceOptions.Roots {
+		nameserver, err := parseNameserverAddr(root)
+		if err != nil {
+			reject(fmt.Errorf("parsing root nameserver address failed: %w", err))
+			return promise
+		}
+
+		iterativeOptions.Roots = append(iterativeOptions.Roots, nameserver)
+	}
+
+	resolver := NewIterativeResolver(mi.dnsClient, iterativeOptions)
+
+	go func() {
+		trace, traceErr := resolver.Trace(mi.vu.Context(), queryStr, recordTypeStr)
+
+		// Recording failures don't fail the trace
+		mi.logRecordingFailure(trace.RecordingErr)
+
+		mi.emitTraceMetrics(mi.vu.Context(), queryStr, recordTypeStr, trace, traceErr)
+
+		if traceErr != nil {
+			reject(traceErr)
+			return
+		}
+
+		resolve(newTraceResult(trace))
+	}()
+
+	return promise
+}
+
+// newTraceResult converts the trace to its JS representation.
+func newTraceResult(trace Trace) traceResult {
+	result := traceResult{
+		IPs:      trace.IPs,
+		Answer:   trace.Answer,
+		Hops:     make([]traceHop, 0, len(trace.Hops)),
+		Duration: durationMillis(trace.Duration),
+	}
+
+	for _, hop := range trace.Hops {
+		jsHop := traceHop{
+			Name:          hop.Name,
+			Type:          hop.Type,
+			Minimised:     hop.Minimised,
+			Zone:          hop.Zone,
+			Server:        hop.Server,
+			Rcode:         hop.Rcode,
+			Authoritative: hop.Authoritative,
+			Answer:        hop.Answer,
+			Latency:       durationMillis(hop.Latency),
+			Error:         hop.Error,
+		}
+
+		if hop.Referral != nil {
+			jsHop.Referral = &traceReferral{
+				Zone:        hop.Referral.Zone,
+				Nameservers: hop.Referral.Nameservers,
+				Glue:        hop.Referral.Glue,
+			}
+		}
+
+		result.Hops = append(result.Hops, jsHop)
+	}
+
+	return result
+}
+
+// durationMillis returns the duration in milliseconds, with sub-millisecond precision.
+func durationMillis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// emitTraceMetrics emits the metrics specific to dns.trace operations.
+func (mi *ModuleInstance) emitTraceMetrics(
+	ctx context.Context,
+	query,
+	recordType string,
+	trace Trace,
+	traceErr error,
+) {
+	state := mi.vu.State()
+
+	tags := state.Tags.GetCurrentValues().Tags
+	tags = tags.With("query", query)
+	tags = tags.With("recordType", recordType)
+
+	now := time.Now()
+
+	// Emit the full resolution duration
+	metrics.PushIfNotDone(ctx, state.Samples, metrics.Sample{
+		TimeSeries: metrics.TimeSeries{
+			Metric: mi.metrics.DNSTraceDuration,
+			Tags:   tags,
+		},
+		Time:     now,
+		Value:    durationMillis(trace.Duration),
+		Metadata: nil,
+	})
+
+	// Emit the number of queries the resolution took
+	metrics.PushIfNotDone(ctx, state.Samples, metrics.Sample{
+		TimeSeries: metrics.TimeSeries{
+			Metric: mi.metrics.DNSTraceQueries,
+			Tags:   tags,
+		},
+		Time:     now,
+		Value:    float64(len(trace.Hops)),
+		Metadata: nil,
+	})
+
+	var failed float64
+	if traceErr != nil {
+		failed = 1
+	}
+
+	// Emit the DNS trace failed rate
+	metrics.PushIfNotDone(ctx, state.Samples, metrics.Sample{
+		TimeSeries: metrics.TimeSeries{
+			Metric: mi.metrics.DNSTraceFailed,
+			Tags:   tags,
+		},
+		Time:     now,
+		Value:    failed,
+		Metadata: nil,
+	})
+}
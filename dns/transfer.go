@@ -0,0 +1,301 @@
+package dns
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/grafana/sobek"
+	"github.com/miekg/dns"
+	"go.k6.io/k6/js/common"
+	"go.k6.io/k6/js/modules"
+	"go.k6.io/k6/js/promises"
+	"go.k6.io/k6/metrics"
+)
+
+// transferResult is the JS representation of a ZoneTransfer.
+type transferResult struct {
+	Type     string   `js:"type"`
+	Serial   uint32   `js:"serial"`
+	Records  []string `js:"records"`
+	Messages int      `js:"messages"`
+	Bytes    int64    `js:"bytes"`
+	Duration float64  `js:"duration"`
+}
+
+// Transfer transfers a zone from the nameserver, using an AXFR or IXFR transfer over
+// TCP, or TLS.
+//
+// It returns a promise resolving to the transferred records, in presentation format,
+// along with the zone's serial, and the number of messages, bytes and milliseconds
+// the transfer took.
+func (mi *ModuleInstance) Transfer(zone, nameserverAddr, options sobek.Value) *sobek.Promise {
+	promise, resolve, reject := promises.New(mi.vu)
+
+	if mi.vu.State() == nil {
+		reject(errors.New("transfer can not be used in the init context"))
+		return promise
+	}
+
+	zoneStr, nameserver, transferOptions, err := mi.parseTransferArguments(zone, nameserverAddr, options)
+	if err != nil {
+		reject(err)
+		return promise
+	}
+
+	go func() {
+		transfer, transferErr := mi.dnsClient.Transfer(mi.vu.Context(), zoneStr, nameserver, transferOptions)
+
+		// Recording failures don't fail the transfer
+		mi.logRecordingFailure(transfer.RecordingErr)
+
+		mi.emitTransferMetrics(mi.vu.Context(), zoneStr, nameserver, transfer.TransferSummary, transferErr)
+
+		if transferErr != nil {
+			reject(transferErr)
+			return
+		}
+
+		records := make([]string, 0, len(transfer.Records))
+		for _, rr := range transfer.Records {
+			records = append(records, rr.String())
+		}
+
+		resolve(transferResult{
+			Type:     string(transfer.Type),
+			Serial:   transfer.Serial,
+			Records:  records,
+			Messages: transfer.Messages,
+			Bytes:    transfer.Bytes,
+			Duration: durationMillis(transfer.Duration),
+		})
+	}()
+
+	return promise
+}
+
+// transferSummary is the JS representation of a TransferSummary.
+type transferSummary struct {
+	Type        string  `js:"type"`
+	Serial      uint32  `js:"serial"`
+	RecordCount int     `js:"recordCount"`
+	Messages    int     `js:"messages"`
+	Bytes       int64   `js:"bytes"`
+	Duration    float64 `js:"duration"`
+}
+
+// StreamTransfer transfers a zone from the nameserver, like Transfer does, calling the
+// onMessage callback with the records of each message, in presentation format, as they
+// are received. The transfer waits for the callback to return before delivering the
+// next message, so that large zones can be processed incrementally, with bounded memory.
+//
+// It returns a promise resolving to a summary of the transfer, holding the zone's serial,
+// and the number of records, messages, bytes and milliseconds the transfer took. The
+// transfer is aborted, and the promise rejected, if the callback throws.
+func (mi *ModuleInstance) StreamTransfer(zone, nameserverAddr, onMessage, options sobek.Value) *sobek.Promise {
+	promise, resolve, reject := promises.New(mi.vu)
+
+	if mi.vu.State() == nil {
+		reject(errors.New("streamTransfer can not be used in the init context"))
+		return promise
+	}
+
+	callback, ok := sobek.AssertFunction(onMessage)
+	if !ok {
+		reject(fmt.Errorf("onMessage must be a function; got %v instead", onMessage))
+		return promise
+	}
+
+	zoneStr, nameserver, transferOptions, err := mi.parseTransferArguments(zone, nameserverAddr, options)
+	if err != nil {
+		reject(err)
+		return promise
+	}
+
+	stream := &transferStream{vu: mi.vu, callback: callback, enqueue: mi.vu.RegisterCallback()}
+
+	go func() {
+		ctx := mi.vu.Context()
+		deliver := func(records []dns.RR) error { return stream.deliver(ctx, records) }
+
+		summary, transferErr := mi.dnsClient.StreamTransfer(ctx, zoneStr, nameserver, transferOptions, deliver)
+		stream.close()
+
+		// Recording failures don't fail the transfer
+		mi.logRecordingFailure(summary.RecordingErr)
+
+		mi.emitTransferMetrics(ctx, zoneStr, nameserver, summary, transferErr)
+
+		if transferErr != nil {
+			reject(transferErr)
+			return
+		}
+
+		resolve(transferSummary{
+			Type:        string(summary.Type),
+			Serial:      summary.Serial,
+			RecordCount: summary.Records,
+			Messages:    summary.Messages,
+			Bytes:       summary.Bytes,
+			Duration:    durationMillis(summary.Duration),
+		})
+	}()
+
+	return promise
+}
+
+// transferStream delivers the records of a streamed zone transfer to a JS callback,
+// one message at a time, on the VU's event loop.
+type transferStream struct {
+	vu       modules.VU
+	callback sobek.Callable
+
+	// enqueue holds the event loop callback registered for the next delivery, or
+	// nil once the stream is closed.
+	enqueue func(func() error)
+}
+
+// deliver calls the JS callback with the records on the event loop, and waits for
+// it to return. It returns the exception the callback threw, if any.
+//
+// As event loop callbacks can only be registered from the event loop, the callback
+// of the next delivery is registered while running the current one.
+func (s *transferStream) deliver(ctx context.Context, records []dns.RR) error {
+	presented := make([]string, 0, len(records))
+	for _, rr := range records {
+		presented = append(presented, rr.String())
+	}
+
+	next := make(chan func(func() error), 1)
+	result := make(chan error, 1)
+
+	s.enqueue(func() error {
+		next <- s.vu.RegisterCallback()
+
+		_, err := s.callback(sobek.Undefined(), s.vu.Runtime().ToValue(presented))
+		result <- err
+
+		return nil
+	})
+
+	select {
+	case err := <-result:
+		s.enqueue = <-next
+		return err
+	case <-ctx.Done():
+		// The event loop stops along with the VU's context, and won't run the
+		// callback, nor expect the next one to be enqueued.
+		s.enqueue = nil
+		return ctx.Err()
+	}
+}
+
+// close releases the event loop callback registered for the next delivery.
+func (s *transferStream) close() {
+	if s.enqueue != nil {
+		s.enqueue(func() error { return nil })
+		s.enqueue = nil
+	}
+}
+
+// parseTransferArguments parses the zone, nameserver and options arguments of the
+// transfer operations.
+func (mi *ModuleInstance) parseTransferArguments(
+	zone, nameserverAddr, options sobek.Value,
+) (string, Nameserver, TransferOptions, error) {
+	var zoneStr string
+	if err := mi.vu.Runtime().ExportTo(zone, &zoneStr); err != nil || zoneStr == "" {
+		return "", Nameserver{}, TransferOptions{}, fmt.Errorf("zone must be a non-empty string; got %v instead", zone)
+	}
+
+	var nameserverAddrStr string
+	if common.IsNullish(nameserverAddr) || mi.vu.Runtime().ExportTo(nameserverAddr, &nameserverAddrStr) != nil {
+		return "", Nameserver{}, TransferOptions{}, fmt.Errorf("nameserver must be a string; got %v instead", nameserverAddr)
+	}
+
+	nameserver, err := parseNameserverAddr(nameserverAddrStr)
+	if err != nil {
+		return "", Nameserver{}, TransferOptions{}, fmt.Errorf("parsing nameserver address failed: %w", err)
+	}
+
+	var transferOptions TransferOptions
+	if !common.IsNullish(options) {
+		if err := mi.vu.Runtime().ExportTo(options, &transferOptions); err != nil {
+			return "", Nameserver{}, TransferOptions{}, fmt.Errorf("options must be an object; got %v instead", options)
+		}
+	}
+
+	if err := transferOptions.Validate(); err != nil {
+		return "", Nameserver{}, TransferOptions{}, fmt.Errorf("invalid options: %w", err)
+	}
+
+	return zoneStr, nameserver, transferOptions, nil
+}
+
+// emitTransferMetrics emits the metrics specific to dns.transfer operations.
+func (mi *ModuleInstance) emitTransferMetrics(
+	ctx context.Context,
+	zone string,
+	nameserver Nameserver,
+	summary TransferSummary,
+	transferErr error,
+) {
+	state := mi.vu.State()
+
+	tags := state.Tags.GetCurrentValues().Tags
+	tags = tags.With("zone", zone)
+	tags = tags.With("type", string(summary.Type))
+	tags = tags.With("nameserver", nameserver.Addr())
+
+	now := time.Now()
+
+	// Emit the transfer duration
+	metrics.PushIfNotDone(ctx, state.Samples, metrics.Sample{
+		TimeSeries: metrics.TimeSeries{
+			Metric: mi.metrics.DNSTransferDuration,
+			Tags:   tags,
+		},
+		Time:     now,
+		Value:    durationMillis(summary.Duration),
+		Metadata: nil,
+	})
+
+	// Emit the number of messages received
+	metrics.PushIfNotDone(ctx, state.Samples, metrics.Sample{
+		TimeSeries: metrics.TimeSeries{
+			Metric: mi.metrics.DNSTransferMessages,
+			Tags:   tags,
+		},
+		Time:     now,
+		Value:    float64(summary.Messages),
+		Metadata: nil,
+	})
+
+	// Emit the number of bytes received
+	metrics.PushIfNotDone(ctx, state.Samples, metrics.Sample{
+		TimeSeries: metrics.TimeSeries{
+			Metric: mi.metrics.DNSTransferBytes,
+			Tags:   tags,
+		},
+		Time:     now,
+		Value:    float64(summary.Bytes),
+		Metadata: nil,
+	})
+
+	var failed float64
+	if transferErr != nil {
+		failed = 1
+	}
+
+	// Emit the DNS transfer failed rate
+	metrics.PushIfNotDone(ctx, state.Samples, metrics.Sample{
+		TimeSeries: metrics.TimeSeries{
+			Metric: mi.metrics.DNSTransferFailed,
+			Tags:   tags,
+		},
+		Time:     now,
+		Value:    failed,
+		Metadata: nil,
+	})
+}
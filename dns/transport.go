@@ -0,0 +1,379 @@
+package dns
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Transport represents the transport protocol queries are sent over.
+type Transport string
+
+const (
+	// TransportUDP sends queries over UDP. It is the default.
+	TransportUDP Transport = "udp"
+
+	// TransportTCP sends queries over TCP.
+	TransportTCP Transport = "tcp"
+
+	// TransportTLS sends queries over TLS, as per [RFC7858].
+	//
+	// [RFC7858]: https://www.iana.org/go/rfc7858
+	TransportTLS Transport = "tls"
+)
+
+// network returns the name of the network matching the transport, as expected
+// by the miekg/dns Client.
+func (t Transport) network() string {
+	switch t {
+	case TransportTCP:
+		return "tcp"
+	case TransportTLS:
+		return "tcp-tls"
+	default:
+		return "udp"
+	}
+}
+
+// localAddr returns the local address matching the transport for the given IP and port.
+func (t Transport) localAddr(ip net.IP, port int) net.Addr {
+	if t == TransportTCP || t == TransportTLS {
+		return &net.TCPAddr{IP: ip, Port: port}
+	}
+
+	return &net.UDPAddr{IP: ip, Port: port}
+}
+
+// TLSOptions holds the options used when sending queries over TLS.
+type TLSOptions struct {
+	// ServerName holds the name used to verify the nameserver's certificate. It
+	// defaults to the nameserver's IP address.
+	ServerName string `js:"serverName"`
+
+	// InsecureSkipVerify disables the verification of the nameserver's certificate.
+	InsecureSkipVerify bool `js:"insecureSkipVerify"`
+}
+
+// config returns the TLS configuration matching the options.
+func (o TLSOptions) config() *tls.Config {
+	return &tls.Config{
+		ServerName:         o.ServerName,
+		InsecureSkipVerify: o.InsecureSkipVerify, //nolint:gosec // explicitly requested by the user
+		MinVersion:         tls.VersionTLS12,
+	}
+}
+
+// exchangeTrace holds what was observed while exchanging a message with a nameserver,
+// beyond its response.
+type exchangeTrace struct {
+	// mismatches holds the number of responses received for the message whose ID
+	// didn't match the message's, and were thus skipped while waiting for its response.
+	mismatches int
+
+	// start holds the time the exchange started at.
+	start time.Time
+
+	// query and response hold the message, and its response, as exchanged with the
+	// nameserver in wire format. They are nil if the message wasn't sent, or if no
+	// response was received, even one failing to unpack.
+	query, response []byte
+
+	// more holds the messages received after the response, in wire format, when the
+	// query is answered with several messages, as zone transfers are.
+	more [][]byte
+}
+
+// exchange sends the message to the nameserver, and returns its response. The
+// exchange is added to the log, to be recorded with the operation it is part of.
+//
+// The message is sent over the transport, and from the local address and source
+// port range, defined by the options. Depending on the options' connection reuse
+// mode, it is sent over a pooled connection, or a connection dialed for it.
+func (r *Client) exchange(
+	ctx context.Context,
+	message *dns.Msg,
+	nameserver Nameserver,
+	options ClientOptions,
+	log *exchangeLog,
+) (*dns.Msg, error) {
+	var trace exchangeTrace
+
+	response, err := r.tracedExchange(ctx, message, nameserver, options, &trace)
+	log.add(trace, nameserver, options)
+
+	return response, err
+}
+
+// tracedExchange sends the message to the nameserver like exchange does, and records
+// what was observed during the exchange in the trace.
+func (r *Client) tracedExchange(
+	ctx context.Context,
+	message *dns.Msg,
+	nameserver Nameserver,
+	options ClientOptions,
+	trace *exchangeTrace,
+) (*dns.Msg, error) {
+	trace.start = time.Now()
+
+	client := r.client
+	client.Net = options.Transport.network()
+	if options.Transport == TransportTLS {
+		client.TLSConfig = options.TLS.config()
+	}
+
+	localIP, err := options.localIP(nameserver)
+	if err != nil {
+		return nil, err
+	}
+
+	if !options.TSIG.IsZero() {
+		client.TsigSecret = options.TSIG.secrets()
+		options.TSIG.sign(message)
+
+		response, err := exchangeOverDedicatedConn(ctx, client, message, nameserver, options, localIP, trace)
+		return response, verifyTSIG(response, err)
+	}
+
+	if pool := r.connPool(options.ConnectionReuse); pool != nil {
+		response, err := pool.exchange(ctx, client, message, nameserver, options, localIP, trace)
+		if !errors.Is(err, errIDInFlight) {
+			return response, err
+		}
+
+		// A query with the same ID is already in flight over the pooled connection,
+		// thus we fall back to a dedicated connection to avoid ambiguous responses.
+	}
+
+	return exchangeOverDedicatedConn(ctx, client, message, nameserver, options, localIP, trace)
+}
+
+// exchangeOverDedicatedConn sends the message to the nameserver over a connection
+// dialed for it, and returns its response.
+//
+// The message and its response are recorded in the trace, as exchanged in wire format.
+// Over UDP, responses whose ID doesn't match the message's are skipped, and counted in
+// the trace, while waiting for its response.
+func exchangeOverDedicatedConn(
+	ctx context.Context,
+	client dns.Client,
+	message *dns.Msg,
+	nameserver Nameserver,
+	options ClientOptions,
+	localIP net.IP,
+	trace *exchangeTrace,
+) (*dns.Msg, error) {
+	var (
+		conn *dns.Conn
+		err  error
+	)
+
+	if options.SourcePort.IsZero() {
+		if localIP != nil {
+			client.Dialer = options.dialer(localIP, 0)
+		}
+
+		conn, err = client.DialContext(ctx, nameserver.Addr())
+	} else {
+		conn, err = dialFromPortRange(ctx, client, nameserver, options, localIP)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = conn.Close() }()
+
+	if udpConn, ok := conn.Conn.(*net.UDPConn); ok {
+		conn.Conn = &tracingPacketConn{UDPConn: udpConn, id: message.Id, trace: trace}
+	} else {
+		conn.Conn = &tracingStreamConn{Conn: conn.Conn, trace: trace}
+	}
+
+	response, _, err := client.ExchangeWithConnContext(ctx, message, conn)
+	return response, err
+}
+
+// tracingPacketConn is a UDP connection tracing the query sent over it, and its
+// response. Responses whose ID doesn't match the query's are counted as mismatches.
+type tracingPacketConn struct {
+	*net.UDPConn
+
+	id    uint16
+	trace *exchangeTrace
+}
+
+// Write sends the query, and records it in the trace.
+func (c *tracingPacketConn) Write(p []byte) (int, error) {
+	n, err := c.UDPConn.Write(p)
+	if err == nil {
+		c.trace.query = bytes.Clone(p)
+	}
+
+	return n, err
+}
+
+// Read reads a response from the connection, and records it in the trace, unless its
+// ID isn't the query's, in which case it is counted as a mismatch.
+func (c *tracingPacketConn) Read(p []byte) (int, error) {
+	n, err := c.UDPConn.Read(p)
+	switch {
+	case err != nil || n < 2:
+	case binary.BigEndian.Uint16(p) != c.id:
+		c.trace.mismatches++
+	default:
+		c.trace.response = bytes.Clone(p[:n])
+	}
+
+	return n, err
+}
+
+// tracingStreamConn is a TCP or TLS connection tracing the query sent over it, and its
+// response, whose length prefix is stripped.
+type tracingStreamConn struct {
+	net.Conn
+
+	trace *exchangeTrace
+
+	// read holds the bytes read from the connection, the response's length prefix
+	// and the part of the response read so far.
+	read []byte
+}
+
+// Write sends the length prefixed query, and records it in the trace.
+func (c *tracingStreamConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if err == nil && len(p) >= 2 {
+		c.trace.query = bytes.Clone(p[2:])
+	}
+
+	return n, err
+}
+
+// Read reads from the connection, and records the response in the trace once it has
+// been read in full.
+func (c *tracingStreamConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.read = append(c.read, p[:n]...)
+
+	if len(c.read) >= 2 {
+		if length := int(binary.BigEndian.Uint16(c.read)); len(c.read) >= 2+length {
+			c.trace.response = c.read[2 : 2+length]
+		}
+	}
+
+	return n, err
+}
+
+// maxSourcePortAttempts is the maximum number of ports of a source port range
+// we attempt to bind before giving up.
+const maxSourcePortAttempts = 16
+
+// dialFromPortRange dials the nameserver from the local IP, and a local port picked
+// at random within the options' source port range. Ports that are already in use
+// are skipped.
+func dialFromPortRange(
+	ctx context.Context,
+	client dns.Client,
+	nameserver Nameserver,
+	options ClientOptions,
+	localIP net.IP,
+) (*dns.Conn, error) {
+	ports := options.SourcePort
+	attempts := min(ports.Size(), maxSourcePortAttempts)
+	offset := rand.IntN(ports.Size()) //nolint:gosec // the source port doesn't need to be cryptographically random
+
+	var lastErr error
+	for i := 0; i < attempts; i++ {
+		port := int(ports.Min) + (offset+i)%ports.Size()
+
+		client.Dialer = options.dialer(localIP, port)
+
+		conn, err := client.DialContext(ctx, nameserver.Addr())
+		if err == nil {
+			return conn, nil
+		}
+
+		if !errors.Is(err, syscall.EADDRINUSE) {
+			return nil, fmt.Errorf("dialing the DNS nameserver from source port %d failed: %w", port, err)
+		}
+
+		lastErr = err
+	}
+
+	return nil, fmt.Errorf(
+		"no available source port in range %d-%d: %w",
+		ports.Min, ports.Max, lastErr,
+	)
+}
+
+// dialer returns a dialer sending queries from the local IP and port. When the options
+// define a network interface, the dialed sockets are bound to it too, on platforms
+// supporting it.
+func (o ClientOptions) dialer(localIP net.IP, port int) *net.Dialer {
+	dialer := &net.Dialer{LocalAddr: o.Transport.localAddr(localIP, port)}
+	if o.Interface != "" {
+		dialer.Control = bindToInterface(o.Interface)
+	}
+
+	return dialer
+}
+
+// sourceOptions returns the options sending messages over the transport from the local
+// address, or network interface, of the client's default options, if any.
+func (r *Client) sourceOptions(transport Transport) ClientOptions {
+	return ClientOptions{
+		Transport:    transport,
+		LocalAddress: r.options.LocalAddress,
+		Interface:    r.options.Interface,
+	}
+}
+
+// localIP returns the IP address queries to the nameserver should be sent from, or
+// nil if the choice should be left to the kernel.
+//
+// When the options define a network interface, the first address of the interface
+// belonging to the same IP family as the nameserver is used.
+func (o ClientOptions) localIP(nameserver Nameserver) (net.IP, error) {
+	if o.LocalAddress != "" {
+		return net.ParseIP(o.LocalAddress), nil
+	}
+
+	if o.Interface == "" {
+		return nil, nil //nolint:nilnil // no local IP means the kernel picks it
+	}
+
+	iface, err := net.InterfaceByName(o.Interface)
+	if err != nil {
+		return nil, fmt.Errorf("looking up network interface %s failed: %w", o.Interface, err)
+	}
+
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("listing network interface %s addresses failed: %w", o.Interface, err)
+	}
+
+	wantIPv4 := nameserver.IP.To4() != nil
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+
+		if (ipNet.IP.To4() != nil) == wantIPv4 {
+			return ipNet.IP, nil
+		}
+	}
+
+	return nil, fmt.Errorf(
+		"network interface %s has no address of the same IP family as nameserver %s",
+		o.Interface, nameserver.IP,
+	)
+}
@@ -0,0 +1,27 @@
+//go:build linux
+
+package dns
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// bindToInterface returns a dialer control function binding sockets to the network
+// interface with the given name, using the SO_BINDTODEVICE socket option.
+func bindToInterface(name string) func(network, address string, conn syscall.RawConn) error {
+	return func(_, _ string, conn syscall.RawConn) error {
+		var bindErr error
+		if err := conn.Control(func(fd uintptr) {
+			bindErr = syscall.BindToDevice(int(fd), name)
+		}); err != nil {
+			return err
+		}
+
+		if bindErr != nil {
+			return fmt.Errorf("binding to network interface %s failed: %w", name, bindErr)
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package dns
+
+import "syscall"
+
+// bindToInterface returns nil, as binding sockets to a network interface is only
+// supported on Linux. Elsewhere, queries are only sent from the interface's address.
+func bindToInterface(string) func(network, address string, conn syscall.RawConn) error {
+	return nil
+}
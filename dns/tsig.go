@@ -0,0 +1,151 @@
+package dns
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// TSIGOptions holds the key used to sign messages with TSIG, as per [RFC8945].
+//
+// [RFC8945]: https://www.iana.org/go/rfc8945
+type TSIGOptions struct {
+	// Name holds the name of the key, as configured on the nameserver.
+	Name string `js:"name"`
+
+	// Algorithm holds the HMAC algorithm of the key, one of hmac-sha256 or
+	// hmac-sha512. It defaults to hmac-sha256.
+	Algorithm string `js:"algorithm"`
+
+	// Secret holds the base64 encoded secret of the key.
+	Secret string `js:"secret"`
+}
+
+// tsigFudge is the number of seconds of clock skew tolerated between the signer
+// and the verifier of a message, as recommended by [RFC8945].
+//
+// [RFC8945]: https://www.iana.org/go/rfc8945#section-10
+const tsigFudge = 300
+
+// tsigAlgorithms maps the supported TSIG algorithm names to their identifiers.
+var tsigAlgorithms = map[string]string{ //nolint:gochecknoglobals
+	"hmac-sha256": dns.HmacSHA256,
+	"hmac-sha512": dns.HmacSHA512,
+}
+
+// tsigMACSizes maps the supported TSIG algorithm identifiers to the size, in bytes,
+// of their untruncated MAC.
+var tsigMACSizes = map[string]int{ //nolint:gochecknoglobals
+	dns.HmacSHA256: 32,
+	dns.HmacSHA512: 64,
+}
+
+// IsZero returns true if no key is set.
+func (o TSIGOptions) IsZero() bool {
+	return o == TSIGOptions{}
+}
+
+// Validate validates the key.
+func (o TSIGOptions) Validate() error {
+	if o.IsZero() {
+		return nil
+	}
+
+	if o.Name == "" {
+		return errors.New("tsig key name must be provided")
+	}
+
+	if _, ok := dns.IsDomainName(o.Name); !ok {
+		return fmt.Errorf("invalid tsig key name %q", o.Name)
+	}
+
+	if o.algorithm() == "" {
+		return fmt.Errorf("unsupported tsig algorithm %q; expected one of hmac-sha256 or hmac-sha512", o.Algorithm)
+	}
+
+	if secret, err := base64.StdEncoding.DecodeString(o.Secret); err != nil || len(secret) == 0 {
+		return errors.New("tsig secret must be a non-empty base64 encoded string")
+	}
+
+	return nil
+}
+
+// keyName returns the key name in canonical form, as used to look up its secret.
+func (o TSIGOptions) keyName() string {
+	return dns.CanonicalName(o.Name)
+}
+
+// algorithm returns the identifier of the key's algorithm, or an empty string if
+// it is not supported.
+func (o TSIGOptions) algorithm() string {
+	if o.Algorithm == "" {
+		return dns.HmacSHA256
+	}
+
+	return tsigAlgorithms[strings.ToLower(strings.TrimSuffix(o.Algorithm, "."))]
+}
+
+// or returns the key, or the fallback key if no key is set.
+func (o TSIGOptions) or(fallback TSIGOptions) TSIGOptions {
+	if o.IsZero() {
+		return fallback
+	}
+
+	return o
+}
+
+// secrets returns the key's secret, keyed by its name, as expected by miekg/dns.
+func (o TSIGOptions) secrets() map[string]string {
+	return map[string]string{o.keyName(): o.Secret}
+}
+
+// sign adds a TSIG record to the message, to be signed using the key once packed.
+// Messages that already hold one, such as retried queries, have their signing time
+// refreshed instead.
+func (o TSIGOptions) sign(message *dns.Msg) {
+	if tsig := message.IsTsig(); tsig != nil {
+		tsig.TimeSigned = uint64(time.Now().Unix()) //nolint:gosec
+		return
+	}
+
+	message.SetTsig(o.keyName(), o.algorithm(), tsigFudge, time.Now().Unix())
+}
+
+// verifyTSIG checks the outcome of the exchange of a TSIG signed message, and returns
+// an *Error of the BadSig, BadKey, BadTime or BadTrunc kind if the nameserver failed to
+// verify the message, or the response failed to verify. Other errors are returned as is.
+func verifyTSIG(response *dns.Msg, err error) error {
+	var tsig *dns.TSIG
+	if response != nil {
+		tsig = response.IsTsig()
+	}
+
+	// Nameservers failing to verify a message report why in the TSIG record of
+	// their response, which is left unsigned.
+	if tsig != nil && tsig.Error != dns.RcodeSuccess {
+		return newSignatureError(tsig.Error, "the nameserver failed to verify the message's signature")
+	}
+
+	switch {
+	case errors.Is(err, dns.ErrSig):
+		if tsig != nil && int(tsig.MACSize) < tsigMACSizes[strings.ToLower(tsig.Algorithm)] {
+			return newSignatureError(dns.RcodeBadTrunc, "the response's signature is truncated")
+		}
+
+		return newSignatureError(dns.RcodeBadSig, "the response's signature failed to verify")
+	case errors.Is(err, dns.ErrTime):
+		return newSignatureError(dns.RcodeBadTime, "the response was signed outside of the allowed time window")
+	case errors.Is(err, dns.ErrSecret), errors.Is(err, dns.ErrKeyAlg):
+		return newSignatureError(dns.RcodeBadKey, "the response is signed with an unknown key")
+	case err != nil:
+		return err
+	case tsig == nil:
+		return newSignatureError(dns.RcodeBadSig, "the response to the signed message is not signed")
+	}
+
+	return nil
+}
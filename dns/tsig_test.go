@@ -0,0 +1,201 @@
+package dns
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_ResolveWithTSIG(t *testing.T) {
+	t.Parallel()
+
+	key := TSIGOptions{Name: "transfer.k6.test", Algorithm: "hmac-sha512", Secret: testTSIGSecret}
+
+	// signedAnswer answers the query with a single A record, signed with the key
+	// the query was signed with, at the given time.
+	signedAnswer := func(t *testing.T, timeSigned time.Time) dns.HandlerFunc {
+		t.Helper()
+
+		return func(w dns.ResponseWriter, r *dns.Msg) {
+			response := new(dns.Msg)
+			response.SetReply(r)
+			response.Answer = []dns.RR{mustNewRR(t, r.Question[0].Name+" 60 IN A "+primaryTestIPv4)}
+
+			if tsig := r.IsTsig(); tsig != nil {
+				response.SetTsig(tsig.Hdr.Name, tsig.Algorithm, tsigFudge, timeSigned.Unix())
+			}
+
+			assert.NoError(t, w.WriteMsg(response))
+		}
+	}
+
+	// reportedError answers the query with an unsigned NOTAUTH response, whose TSIG
+	// record holds the error code, as nameservers failing to verify a query do.
+	reportedError := func(t *testing.T, code uint16) dns.HandlerFunc {
+		t.Helper()
+
+		return func(w dns.ResponseWriter, r *dns.Msg) {
+			response := new(dns.Msg)
+			response.SetRcode(r, dns.RcodeNotAuth)
+
+			tsig := r.IsTsig()
+			response.Extra = []dns.RR{&dns.TSIG{
+				Hdr:        dns.RR_Header{Name: tsig.Hdr.Name, Rrtype: dns.TypeTSIG, Class: dns.ClassANY},
+				Algorithm:  tsig.Algorithm,
+				TimeSigned: tsig.TimeSigned,
+				Fudge:      tsig.Fudge,
+				OrigId:     r.Id,
+				Error:      code,
+			}}
+
+			packed, err := response.Pack()
+			require.NoError(t, err)
+
+			_, err = w.Write(packed)
+			assert.NoError(t, err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		handler  func(t *testing.T) dns.HandlerFunc
+		key      TSIGOptions
+		wantKind errorKind
+		wantName string
+	}{
+		{
+			name:    "signed responses are verified",
+			handler: func(t *testing.T) dns.HandlerFunc { return signedAnswer(t, time.Now()) },
+			key:     key,
+		},
+		{
+			name:     "responses signed with another secret fail with BadSig",
+			handler:  func(t *testing.T) dns.HandlerFunc { return signedAnswer(t, time.Now()) },
+			key:      TSIGOptions{Name: key.Name, Algorithm: key.Algorithm, Secret: "b3RoZXItc2VjcmV0"},
+			wantKind: BadSig,
+			wantName: "BadSig",
+		},
+		{
+			name:     "responses signed outside of the time window fail with BadTime",
+			handler:  func(t *testing.T) dns.HandlerFunc { return signedAnswer(t, time.Now().Add(-time.Hour)) },
+			key:      key,
+			wantKind: BadTime,
+			wantName: "BadTime",
+		},
+		{
+			name: "unsigned responses fail with BadSig",
+			handler: func(t *testing.T) dns.HandlerFunc {
+				return func(w dns.ResponseWriter, r *dns.Msg) { writeTestAnswer(t, w, r) }
+			},
+			key:      key,
+			wantKind: BadSig,
+			wantName: "BadSig",
+		},
+		{
+			name:     "signatures the nameserver failed to verify fail with BadSig",
+			handler:  func(t *testing.T) dns.HandlerFunc { return reportedError(t, dns.RcodeBadSig) },
+			key:      key,
+			wantKind: BadSig,
+			wantName: "BadSig",
+		},
+		{
+			name:     "keys unknown to the nameserver fail with BadKey",
+			handler:  func(t *testing.T) dns.HandlerFunc { return reportedError(t, dns.RcodeBadKey) },
+			key:      key,
+			wantKind: BadKey,
+			wantName: "BadKey",
+		},
+		{
+			name:     "signatures the nameserver found out of time fail with BadTime",
+			handler:  func(t *testing.T) dns.HandlerFunc { return reportedError(t, dns.RcodeBadTime) },
+			key:      key,
+			wantKind: BadTime,
+			wantName: "BadTime",
+		},
+		{
+			name:     "signatures the nameserver found truncated fail with BadTrunc",
+			handler:  func(t *testing.T) dns.HandlerFunc { return reportedError(t, dns.RcodeBadTrunc) },
+			key:      key,
+			wantKind: BadTrunc,
+			wantName: "BadTrunc",
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			nameserver := startTestTransferServer(t, nil, tt.handler(t))
+
+			resolution, err := NewDNSClient().ResolveWithOptions(
+				context.Background(), "www.k6.test", "A", nameserver,
+				ClientOptions{Transport: TransportTCP, TSIG: tt.key},
+			)
+
+			if tt.wantKind == 0 {
+				require.NoError(t, err)
+				assert.Equal(t, []string{primaryTestIPv4}, resolution.IPs)
+
+				return
+			}
+
+			var dnsErr *Error
+			require.ErrorAs(t, err, &dnsErr)
+			assert.Equal(t, tt.wantKind, dnsErr.Kind)
+			assert.Equal(t, tt.wantName, dnsErr.Name)
+			assert.Contains(t, dnsErr.Error(), tt.wantName+": ")
+		})
+	}
+
+	t.Run("signed queries bypass pooled connections", func(t *testing.T) {
+		t.Parallel()
+
+		nameserver := startTestTransferServer(t, nil, signedAnswer(t, time.Now()))
+		client := NewDNSClientWithOptions(ClientOptions{
+			Transport:       TransportTCP,
+			ConnectionReuse: ConnectionReuseVU,
+			TSIG:            key,
+		})
+		t.Cleanup(client.CloseConnections)
+
+		for i := 0; i < 3; i++ {
+			ips, err := client.Resolve(context.Background(), "www.k6.test", "A", nameserver)
+			require.NoError(t, err)
+			assert.Equal(t, []string{primaryTestIPv4}, ips)
+		}
+	})
+
+	t.Run("the client's key signs zone transfers and updates by default", func(t *testing.T) {
+		t.Parallel()
+
+		client := NewDNSClientWithOptions(ClientOptions{TSIG: key})
+
+		nameserver := startTestTransferServer(t, nil, testTransferHandler(t, testZoneEnvelopes(t), true))
+		transfer, err := client.Transfer(context.Background(), "k6.test", nameserver, TransferOptions{})
+		require.NoError(t, err)
+		assert.Len(t, transfer.Records, 5)
+
+		nameserver = startTestTransferServer(t, nil, signedAnswer(t, time.Now()))
+		_, err = client.Update(context.Background(), "k6.test", nameserver, UpdateOptions{
+			Add:       []string{"www.k6.test. 60 IN A " + primaryTestIPv4},
+			Transport: TransportTCP,
+		})
+		require.NoError(t, err)
+	})
+
+	t.Run("invalid keys are rejected", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := NewDNSClient().ResolveWithOptions(
+			context.Background(), "www.k6.test", "A", Nameserver{},
+			ClientOptions{TSIG: TSIGOptions{Name: key.Name, Algorithm: "hmac-md5", Secret: testTSIGSecret}},
+		)
+		assert.Error(t, err)
+	})
+}
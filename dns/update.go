@@ -0,0 +1,150 @@
+package dns
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/grafana/sobek"
+	"go.k6.io/k6/js/common"
+	"go.k6.io/k6/js/promises"
+	"go.k6.io/k6/metrics"
+)
+
+// updateResult is the JS representation of an UpdateSummary.
+type updateResult struct {
+	Added         int     `js:"added"`
+	Removed       int     `js:"removed"`
+	Prerequisites int     `js:"prerequisites"`
+	Duration      float64 `js:"duration"`
+}
+
+// Update sends a dynamic update of the zone to the nameserver, adding and removing the
+// records provided in the options, provided the zone meets the update's prerequisites.
+//
+// It returns a promise resolving to the number of records added and removed, and the
+// milliseconds the update took, once the nameserver applied it. The promise is rejected
+// with the nameserver's response code, such as YXDomain or NotAuth, if it rejected it.
+func (mi *ModuleInstance) Update(zone, nameserverAddr, options sobek.Value) *sobek.Promise {
+	promise, resolve, reject := promises.New(mi.vu)
+
+	if mi.vu.State() == nil {
+		reject(errors.New("update can not be used in the init context"))
+		return promise
+	}
+
+	var zoneStr string
+	if err := mi.vu.Runtime().ExportTo(zone, &zoneStr); err != nil || zoneStr == "" {
+		reject(fmt.Errorf("zone must be a non-empty string; got %v instead", zone))
+		return promise
+	}
+
+	var nameserverAddrStr string
+	if common.IsNullish(nameserverAddr) || mi.vu.Runtime().ExportTo(nameserverAddr, &nameserverAddrStr) != nil {
+		reject(fmt.Errorf("nameserver must be a string; got %v instead", nameserverAddr))
+		return promise
+	}
+
+	nameserver, err := parseNameserverAddr(nameserverAddrStr)
+	if err != nil {
+		reject(fmt.Errorf("parsing nameserver address failed: %w", err))
+		return promise
+	}
+
+	var updateOptions UpdateOptions
+	if !common.IsNullish(options) {
+		if err := mi.vu.Runtime().ExportTo(options, &updateOptions); err != nil {
+			reject(fmt.Errorf("options must be an object; got %v instead", options))
+			return promise
+		}
+	}
+
+	if err := updateOptions.Validate(); err != nil {
+		reject(fmt.Errorf("invalid options: %w", err))
+		return promise
+	}
+
+	updateOptions.ConnectionReuse = mi.connectionReuseMode(
+		cmp.Or(updateOptions.ConnectionReuse, mi.dnsClient.Options().ConnectionReuse),
+	)
+
+	go func() {
+		summary, updateErr := mi.dnsClient.Update(mi.vu.Context(), zoneStr, nameserver, updateOptions)
+
+		// Recording failures don't fail the update
+		mi.logRecordingFailure(summary.RecordingErr)
+
+		mi.emitUpdateMetrics(mi.vu.Context(), zoneStr, nameserver, summary, updateErr)
+
+		if updateErr != nil {
+			reject(updateErr)
+			return
+		}
+
+		resolve(updateResult{
+			Added:         summary.Added,
+			Removed:       summary.Removed,
+			Prerequisites: summary.Prerequisites,
+			Duration:      durationMillis(summary.Duration),
+		})
+	}()
+
+	return promise
+}
+
+// emitUpdateMetrics emits the metrics specific to dns.update operations.
+func (mi *ModuleInstance) emitUpdateMetrics(
+	ctx context.Context,
+	zone string,
+	nameserver Nameserver,
+	summary UpdateSummary,
+	updateErr error,
+) {
+	state := mi.vu.State()
+
+	tags := state.Tags.GetCurrentValues().Tags
+	tags = tags.With("zone", zone)
+	tags = tags.With("nameserver", nameserver.Addr())
+
+	now := time.Now()
+
+	// Emit the update counter
+	metrics.PushIfNotDone(ctx, state.Samples, metrics.Sample{
+		TimeSeries: metrics.TimeSeries{
+			Metric: mi.metrics.DNSUpdates,
+			Tags:   tags,
+		},
+		Time:     now,
+		Value:    1,
+		Metadata: nil,
+	})
+
+	// Emit the update duration
+	metrics.PushIfNotDone(ctx, state.Samples, metrics.Sample{
+		TimeSeries: metrics.TimeSeries{
+			Metric: mi.metrics.DNSUpdateDuration,
+			Tags:   tags,
+		},
+		Time:     now,
+		Value:    durationMillis(summary.Duration),
+		Metadata: nil,
+	})
+
+	var failed float64
+	if updateErr != nil {
+		failed = 1
+	}
+
+	// Emit the DNS update failed rate
+	metrics.PushIfNotDone(ctx, state.Samples, metrics.Sample{
+		TimeSeries: metrics.TimeSeries{
+			Metric: mi.metrics.DNSUpdateFailed,
+			Tags:   tags,
+		},
+		Time:     now,
+		Value:    failed,
+		Metadata: nil,
+	})
+}
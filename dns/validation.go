@@ -0,0 +1,255 @@
+package dns
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// ResponseValidationMode represents how strictly the Client validates responses
+// against the query they answer.
+type ResponseValidationMode string
+
+const (
+	// ResponseValidationNone disables response validation. It is the default.
+	ResponseValidationNone ResponseValidationMode = "none"
+
+	// ResponseValidationLenient validates responses, and reports the violations
+	// found without failing the resolution.
+	ResponseValidationLenient ResponseValidationMode = "lenient"
+
+	// ResponseValidationStrict validates responses, and rejects those presenting
+	// violations with a MalformedResponse error.
+	ResponseValidationStrict ResponseValidationMode = "strict"
+)
+
+// enabled returns true if the mode requires responses to be validated.
+func (m ResponseValidationMode) enabled() bool {
+	return m == ResponseValidationLenient || m == ResponseValidationStrict
+}
+
+// validateResponse checks that the response is a sane answer to the query, and
+// returns a description of each violation found.
+//
+// It verifies that the response has its QR bit set, uses the same opcode as the
+// query, echoes the query's question, holds sane section counts, and only holds
+// answer records relevant to that question. When the response is provided in wire
+// format too, the section counts of its header are checked against the records
+// it holds.
+func validateResponse(query, response *dns.Msg, raw []byte) []string {
+	var violations []string
+
+	if !response.Response {
+		violations = append(violations, "response does not have its QR bit set")
+	}
+
+	if response.Opcode != query.Opcode {
+		violations = append(violations, fmt.Sprintf(
+			"response opcode %s does not match query opcode %s",
+			dns.OpcodeToString[response.Opcode],
+			dns.OpcodeToString[query.Opcode],
+		))
+	}
+
+	if len(response.Question) != len(query.Question) {
+		violations = append(violations, fmt.Sprintf(
+			"response holds %d questions, expected %d",
+			len(response.Question),
+			len(query.Question),
+		))
+
+		return violations
+	}
+
+	for i, question := range query.Question {
+		got := response.Question[i]
+
+		if !strings.EqualFold(got.Name, question.Name) {
+			violations = append(violations, fmt.Sprintf(
+				"response question name %s does not match query name %s",
+				got.Name, question.Name,
+			))
+		}
+
+		if got.Qtype != question.Qtype {
+			violations = append(violations, fmt.Sprintf(
+				"response question type %s does not match query type %s",
+				dns.TypeToString[got.Qtype], dns.TypeToString[question.Qtype],
+			))
+		}
+
+		if got.Qclass != question.Qclass {
+			violations = append(violations, fmt.Sprintf(
+				"response question class %s does not match query class %s",
+				dns.ClassToString[got.Qclass], dns.ClassToString[question.Qclass],
+			))
+		}
+	}
+
+	violations = append(violations, validateHeaderCounts(response, raw)...)
+	violations = append(violations, validateSectionCounts(response)...)
+
+	if len(query.Question) == 1 {
+		violations = append(violations, validateAnswerChain(query.Question[0], response.Answer)...)
+	}
+
+	return violations
+}
+
+// validateHeaderCounts checks that the section counts of the header of the response,
+// in wire format, match the number of records parsed from each of its sections.
+//
+// The response is parsed up to its last record, thus a header announcing more records
+// than the response holds can only be told apart from the raw response. The OPT
+// pseudo-record is counted in the additional section, as it is sent. Truncated
+// responses, which may legitimately end before their last announced record, aren't
+// checked.
+func validateHeaderCounts(response *dns.Msg, raw []byte) []string {
+	if len(raw) < dnsHeaderLen || response.Truncated {
+		return nil
+	}
+
+	var violations []string
+
+	for i, section := range []struct {
+		name  string
+		count int
+	}{
+		{name: "question", count: len(response.Question)},
+		{name: "answer", count: len(response.Answer)},
+		{name: "authority", count: len(response.Ns)},
+		{name: "additional", count: len(response.Extra)},
+	} {
+		announced := int(binary.BigEndian.Uint16(raw[4+2*i:]))
+		if announced != section.count {
+			violations = append(violations, fmt.Sprintf(
+				"response header announces %d %s records, but the response holds %d",
+				announced, section.name, section.count,
+			))
+		}
+	}
+
+	return violations
+}
+
+// validateSectionCounts checks that the records of the response are held by the
+// sections, and in the numbers, the protocol allows.
+//
+// Answers are only expected in successful and NXDOMAIN responses, at most one OPT
+// record is expected, in the additional section, as per [RFC6891], and TSIG and
+// SIG(0) records are expected last in the additional section, as per [RFC8945]
+// and [RFC2931].
+//
+// [RFC6891]: https://www.iana.org/go/rfc6891
+// [RFC8945]: https://www.iana.org/go/rfc8945
+// [RFC2931]: https://www.iana.org/go/rfc2931
+func validateSectionCounts(response *dns.Msg) []string {
+	var violations []string
+
+	if len(response.Answer) > 0 && response.Rcode != dns.RcodeSuccess && response.Rcode != dns.RcodeNameError {
+		violations = append(violations, fmt.Sprintf(
+			"%s response holds %d answer records, expected none",
+			dns.RcodeToString[response.Rcode], len(response.Answer),
+		))
+	}
+
+	for _, section := range []struct {
+		name    string
+		records []dns.RR
+	}{
+		{name: "answer", records: response.Answer},
+		{name: "authority", records: response.Ns},
+	} {
+		for _, rr := range section.records {
+			if rrtype := rr.Header().Rrtype; rrtype == dns.TypeOPT || rrtype == dns.TypeTSIG || rrtype == dns.TypeSIG {
+				violations = append(violations, fmt.Sprintf(
+					"%s section holds a %s record, expected in the additional section",
+					section.name, dns.TypeToString[rrtype],
+				))
+			}
+		}
+	}
+
+	var opts int
+	for i, rr := range response.Extra {
+		switch rr.Header().Rrtype {
+		case dns.TypeOPT:
+			opts++
+		case dns.TypeTSIG, dns.TypeSIG:
+			if i != len(response.Extra)-1 {
+				violations = append(violations, fmt.Sprintf(
+					"additional section holds a %s record before other records, expected last",
+					dns.TypeToString[rr.Header().Rrtype],
+				))
+			}
+		}
+	}
+
+	if opts > 1 {
+		violations = append(violations, fmt.Sprintf("response holds %d OPT records, expected at most one", opts))
+	}
+
+	return violations
+}
+
+// validateAnswerChain checks that each answer record is owned either by the
+// question name, or by a name reached by following the CNAME and DNAME records
+// preceding it in the answer section.
+func validateAnswerChain(question dns.Question, answers []dns.RR) []string {
+	var violations []string
+
+	names := map[string]bool{strings.ToLower(question.Name): true}
+	for _, rr := range answers {
+		owner := strings.ToLower(rr.Header().Name)
+
+		switch record := rr.(type) {
+		case *dns.DNAME:
+			// A DNAME record is owned by an ancestor of the names it redirects
+			// and is followed by the CNAME record synthesized from it.
+			if !hasSubdomain(names, owner) {
+				violations = append(violations, fmt.Sprintf(
+					"answer DNAME record owned by %s is unrelated to the question %s",
+					rr.Header().Name, question.Name,
+				))
+			}
+
+			continue
+		case *dns.CNAME:
+			if names[owner] {
+				names[strings.ToLower(record.Target)] = true
+			}
+		}
+
+		if !names[owner] {
+			violations = append(violations, fmt.Sprintf(
+				"answer %s record owned by %s is unrelated to the question %s",
+				dns.TypeToString[rr.Header().Rrtype], rr.Header().Name, question.Name,
+			))
+		}
+	}
+
+	return violations
+}
+
+// hasSubdomain returns true if any of names is a subdomain of parent.
+func hasSubdomain(names map[string]bool, parent string) bool {
+	for name := range names {
+		if dns.IsSubDomain(parent, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newMalformedResponseError creates a new MalformedResponse Error describing
+// the provided violations.
+func newMalformedResponseError(violations []string) *Error {
+	return &Error{
+		Name:    MalformedResponse.String(),
+		Message: "response failed validation: " + strings.Join(violations, "; "),
+		Kind:    MalformedResponse,
+	}
+}
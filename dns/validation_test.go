@@ -0,0 +1,210 @@
+package dns
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/grafana/xk6-dns/dnstest"
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_validateResponse(t *testing.T) {
+	t.Parallel()
+
+	query := new(dns.Msg)
+	query.SetQuestion("k6.test.", dns.TypeA)
+
+	tests := []struct {
+		name           string
+		alter          func(response *dns.Msg)
+		wantViolations int
+	}{
+		{
+			name:           "valid response",
+			alter:          func(*dns.Msg) {},
+			wantViolations: 0,
+		},
+		{
+			name:           "question name differing only by case",
+			alter:          func(response *dns.Msg) { response.Question[0].Name = "K6.TeSt." },
+			wantViolations: 0,
+		},
+		{
+			name:           "QR bit not set",
+			alter:          func(response *dns.Msg) { response.Response = false },
+			wantViolations: 1,
+		},
+		{
+			name:           "mismatching opcode",
+			alter:          func(response *dns.Msg) { response.Opcode = dns.OpcodeStatus },
+			wantViolations: 1,
+		},
+		{
+			name:           "mismatching question name",
+			alter:          func(response *dns.Msg) { response.Question[0].Name = "other.test." },
+			wantViolations: 1,
+		},
+		{
+			name: "mismatching question type and class",
+			alter: func(response *dns.Msg) {
+				response.Question[0].Qtype, response.Question[0].Qclass = dns.TypeAAAA, dns.ClassCHAOS
+			},
+			wantViolations: 2,
+		},
+		{
+			name:           "missing question",
+			alter:          func(response *dns.Msg) { response.Question = nil },
+			wantViolations: 1,
+		},
+		{
+			name: "answers in a failed response",
+			alter: func(response *dns.Msg) {
+				response.Rcode = dns.RcodeServerFailure
+			},
+			wantViolations: 1,
+		},
+		{
+			name: "OPT records outside the additional section, or repeated",
+			alter: func(response *dns.Msg) {
+				response.Ns = append(response.Ns, &dns.OPT{Hdr: dns.RR_Header{Name: ".", Rrtype: dns.TypeOPT}})
+				response.SetEdns0(dns.DefaultMsgSize, false)
+				response.Extra = append(response.Extra, &dns.OPT{Hdr: dns.RR_Header{Name: ".", Rrtype: dns.TypeOPT}})
+			},
+			wantViolations: 2,
+		},
+		{
+			name: "TSIG record before other additional records",
+			alter: func(response *dns.Msg) {
+				response.Extra = append(response.Extra,
+					&dns.TSIG{Hdr: dns.RR_Header{Name: "key.", Rrtype: dns.TypeTSIG, Class: dns.ClassANY}},
+					mustNewRR(t, "ns.k6.test. 60 IN A 203.0.113.53"),
+				)
+			},
+			wantViolations: 1,
+		},
+		{
+			name: "answer following a CNAME chain",
+			alter: func(response *dns.Msg) {
+				response.Answer = []dns.RR{
+					mustNewRR(t, "k6.test. 60 IN CNAME alias.k6.test."),
+					mustNewRR(t, "alias.k6.test. 60 IN A 203.0.113.1"),
+				}
+			},
+			wantViolations: 0,
+		},
+		{
+			name: "answer unrelated to the question",
+			alter: func(response *dns.Msg) {
+				response.Answer = append(response.Answer, mustNewRR(t, "unrelated.test. 60 IN A 203.0.113.1"))
+			},
+			wantViolations: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			response := new(dns.Msg)
+			response.SetReply(query)
+			response.Answer = []dns.RR{mustNewRR(t, "k6.test. 60 IN A 203.0.113.1")}
+			tt.alter(response)
+
+			assert.Len(t, validateResponse(query, response, nil), tt.wantViolations)
+		})
+	}
+}
+
+func TestClient_ResolveWithResponseValidation(t *testing.T) {
+	t.Parallel()
+
+	nameserver := startTestNameserver(t, func(w dns.ResponseWriter, r *dns.Msg) {
+		r.Question[0].Qtype = dns.TypeAAAA
+		writeTestAnswer(t, w, r)
+	})
+
+	t.Run("strict validation rejects invalid responses", func(t *testing.T) {
+		t.Parallel()
+
+		options := ClientOptions{ResponseValidation: ResponseValidationStrict}
+		_, err := NewDNSClient().ResolveWithOptions(context.Background(), testDomain, "A", nameserver, options)
+
+		var dnsErr *Error
+		require.True(t, errors.As(err, &dnsErr))
+		assert.Equal(t, MalformedResponse, dnsErr.Kind)
+	})
+
+	t.Run("lenient validation reports violations of invalid responses", func(t *testing.T) {
+		t.Parallel()
+
+		options := ClientOptions{ResponseValidation: ResponseValidationLenient}
+		resolution, err := NewDNSClient().ResolveWithOptions(context.Background(), testDomain, "A", nameserver, options)
+		require.NoError(t, err)
+
+		assert.True(t, resolution.Validated)
+		assert.Len(t, resolution.Violations, 1)
+		assert.Equal(t, []string{primaryTestIPv4}, resolution.IPs)
+	})
+}
+
+func TestClient_ResolveWithResponseValidationOfHeaderCounts(t *testing.T) {
+	t.Parallel()
+
+	// The response announces two answers, but only holds one.
+	server := dnstest.NewServer(dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		response := new(dns.Msg)
+		response.SetReply(r)
+		response.Answer = []dns.RR{mustNewRR(t, r.Question[0].Name+" 60 IN A "+primaryTestIPv4)}
+
+		packed, err := response.Pack()
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		binary.BigEndian.PutUint16(packed[6:], 2)
+		_, err = w.Write(packed)
+		assert.NoError(t, err)
+	}))
+	t.Cleanup(server.Close)
+
+	nameserver, err := parseNameserverAddr(server.Addr)
+	require.NoError(t, err)
+
+	t.Run("strict validation rejects responses announcing more records than they hold", func(t *testing.T) {
+		t.Parallel()
+
+		options := ClientOptions{ResponseValidation: ResponseValidationStrict}
+		_, err := NewDNSClient().ResolveWithOptions(context.Background(), testDomain, "A", nameserver, options)
+
+		var dnsErr *Error
+		require.True(t, errors.As(err, &dnsErr))
+		assert.Equal(t, MalformedResponse, dnsErr.Kind)
+	})
+
+	t.Run("lenient validation reports the mismatching header counts", func(t *testing.T) {
+		t.Parallel()
+
+		options := ClientOptions{ResponseValidation: ResponseValidationLenient}
+		resolution, err := NewDNSClient().ResolveWithOptions(context.Background(), testDomain, "A", nameserver, options)
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"response header announces 2 answer records, but the response holds 1"}, resolution.Violations)
+		assert.Equal(t, []string{primaryTestIPv4}, resolution.IPs)
+	})
+}
+
+// mustNewRR parses the provided resource record string, and fails the test if it is invalid.
+func mustNewRR(t *testing.T, s string) dns.RR {
+	t.Helper()
+
+	rr, err := dns.NewRR(s)
+	require.NoError(t, err)
+
+	return rr
+}
@@ -0,0 +1,220 @@
+package dns
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/miekg/dns"
+)
+
+// WorkloadOrder represents the order queries are picked from a Workload in.
+type WorkloadOrder string
+
+const (
+	// WorkloadSequential picks the queries in the order of the query file, starting
+	// over once they have all been picked.
+	WorkloadSequential WorkloadOrder = "sequential"
+
+	// WorkloadRandom picks the distinct queries of the workload uniformly at random.
+	WorkloadRandom WorkloadOrder = "random"
+
+	// WorkloadWeighted picks the distinct queries of the workload at random, weighted
+	// by the number of times they appear in the query file, times their weight.
+	WorkloadWeighted WorkloadOrder = "weighted"
+)
+
+// Validate checks that the order is supported.
+func (o WorkloadOrder) Validate() error {
+	switch o {
+	case "", WorkloadSequential, WorkloadRandom, WorkloadWeighted:
+		return nil
+	default:
+		return fmt.Errorf(
+			"invalid workload order %q; expected one of %q, %q or %q",
+			o, WorkloadSequential, WorkloadRandom, WorkloadWeighted,
+		)
+	}
+}
+
+// Workload holds the queries of a dnsperf query file. It is read-only once parsed,
+// and safe to share between VUs.
+type Workload struct {
+	// queries holds the queries in the order of the query file.
+	queries []Question
+
+	// qtypes holds the type of each query, in the same order.
+	qtypes []uint16
+
+	// distinct holds the index of the first occurrence of each distinct query, and
+	// weights their cumulative weight, in the same order.
+	distinct []int
+	weights  []uint64
+
+	// cursor holds the number of queries picked in order, by all VUs.
+	cursor atomic.Uint64
+}
+
+// ParseQueryFile parses a query file in the format of dnsperf and resperf: one query
+// per line, made of a name and a record type, such as "www.k6.io A". Empty lines, and
+// lines starting with a ';' or a '#', are ignored.
+//
+// Lines may hold a third field, the positive integer weight of the query, which
+// defaults to 1. Queries appearing several times add up their weights.
+func ParseQueryFile(r io.Reader) (*Workload, error) {
+	w := &Workload{}
+	distinct := make(map[Question]int)
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], ";") || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("line %d: expected a name, a record type and an optional weight", line)
+		}
+
+		weight := uint64(1)
+		if len(fields) == 3 {
+			var err error
+			if weight, err = strconv.ParseUint(fields[2], 10, 32); err != nil || weight == 0 {
+				return nil, fmt.Errorf("line %d: invalid weight %q; expected a positive integer", line, fields[2])
+			}
+		}
+
+		question, qtype, err := parseWorkloadQuery(fields[0], fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		w.queries = append(w.queries, question)
+		w.qtypes = append(w.qtypes, qtype)
+
+		i, seen := distinct[question]
+		if !seen {
+			i = len(w.distinct)
+			distinct[question] = i
+			w.distinct = append(w.distinct, len(w.queries)-1)
+			w.weights = append(w.weights, 0)
+		}
+
+		w.weights[i] += weight
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading the query file failed: %w", err)
+	}
+
+	if len(w.queries) == 0 {
+		return nil, errors.New("the query file holds no queries")
+	}
+
+	// Turn the distinct queries' weights into cumulative weights, to pick them
+	// using a binary search.
+	for i := 1; i < len(w.weights); i++ {
+		w.weights[i] += w.weights[i-1]
+	}
+
+	return w, nil
+}
+
+// parseWorkloadQuery parses the name and record type of a query file's line.
+func parseWorkloadQuery(name, recordType string) (Question, uint16, error) {
+	if _, ok := dns.IsDomainName(name); !ok {
+		return Question{}, 0, fmt.Errorf("invalid name %q", name)
+	}
+
+	// Names are stored without their trailing dot, as dns.resolve expects them.
+	if name != "." {
+		name = strings.TrimSuffix(name, ".")
+	}
+
+	question := Question{Name: name, Type: strings.ToUpper(recordType)}
+
+	q, err := question.question()
+	if err != nil {
+		return Question{}, 0, err
+	}
+
+	question.Type = dns.Type(q.Qtype).String()
+
+	return question, q.Qtype, nil
+}
+
+// Len returns the number of queries of the workload, including repeated ones.
+func (w *Workload) Len() int {
+	return len(w.queries)
+}
+
+// Query returns the i-th query of the query file.
+func (w *Workload) Query(i int) Question {
+	return w.queries[i]
+}
+
+// Next returns the next query in the order of the query file, starting over once
+// they have all been returned. The order is shared by every caller, such as VUs.
+func (w *Workload) Next() Question {
+	return w.queries[w.nextIndex()]
+}
+
+// Random returns one of the distinct queries of the workload, picked uniformly.
+func (w *Workload) Random() Question {
+	return w.queries[w.randomIndex()]
+}
+
+// Weighted returns one of the distinct queries of the workload, picked according to
+// their weight.
+func (w *Workload) Weighted() Question {
+	return w.queries[w.weightedIndex()]
+}
+
+// picker returns a function picking the workload's queries, along with their type, in
+// the order. Sequential pickers start from the first query, regardless of Next, and
+// are not safe for concurrent use.
+func (w *Workload) picker(order WorkloadOrder) func() (Question, uint16) {
+	var pickIndex func() int
+	switch order {
+	case WorkloadRandom:
+		pickIndex = w.randomIndex
+	case WorkloadWeighted:
+		pickIndex = w.weightedIndex
+	default:
+		var picked int
+		pickIndex = func() int {
+			i := picked % len(w.queries)
+			picked++
+
+			return i
+		}
+	}
+
+	return func() (Question, uint16) {
+		i := pickIndex()
+		return w.queries[i], w.qtypes[i]
+	}
+}
+
+// nextIndex returns the index of the next query in the order of the query file.
+func (w *Workload) nextIndex() int {
+	return int((w.cursor.Add(1) - 1) % uint64(len(w.queries)))
+}
+
+// randomIndex returns the index of a distinct query, picked uniformly.
+func (w *Workload) randomIndex() int {
+	return w.distinct[rand.N(len(w.distinct))] //nolint:gosec // picks don't need to be cryptographically random
+}
+
+// weightedIndex returns the index of a distinct query, picked according to their weight.
+func (w *Workload) weightedIndex() int {
+	pick := rand.N(w.weights[len(w.weights)-1]) //nolint:gosec // picks don't need to be cryptographically random
+
+	return w.distinct[sort.Search(len(w.weights), func(i int) bool { return w.weights[i] > pick })]
+}
@@ -0,0 +1,140 @@
+package dns
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseQueryFile(t *testing.T) {
+	t.Parallel()
+
+	t.Run("queries are parsed in order", func(t *testing.T) {
+		t.Parallel()
+
+		workload, err := ParseQueryFile(strings.NewReader(
+			"; captured on the resolvers\n\n# web\nwww.k6.test. a\nk6.test MX 3\n.  NS\n",
+		))
+		require.NoError(t, err)
+
+		require.Equal(t, 3, workload.Len())
+		assert.Equal(t, Question{Name: "www.k6.test", Type: "A"}, workload.Query(0))
+		assert.Equal(t, Question{Name: "k6.test", Type: "MX"}, workload.Query(1))
+		assert.Equal(t, Question{Name: ".", Type: "NS"}, workload.Query(2))
+		assert.Equal(t, []uint16{dns.TypeA, dns.TypeMX, dns.TypeNS}, workload.qtypes)
+	})
+
+	t.Run("repeated queries add up their weights", func(t *testing.T) {
+		t.Parallel()
+
+		workload, err := ParseQueryFile(strings.NewReader("k6.test A\napi.k6.test A 2\nk6.test A 4\n"))
+		require.NoError(t, err)
+
+		assert.Equal(t, 3, workload.Len())
+		assert.Equal(t, []int{0, 1}, workload.distinct)
+		assert.Equal(t, []uint64{5, 7}, workload.weights)
+	})
+
+	t.Run("invalid query files are rejected", func(t *testing.T) {
+		t.Parallel()
+
+		for input, message := range map[string]string{
+			"":                       "no queries",
+			"; only comments\n":      "no queries",
+			"k6.test\n":              "line 1",
+			"k6.test A 1 extra\n":    "line 1",
+			"k6.test A\nk6.test B\n": "line 2",
+			"k6.test A 0\n":          "invalid weight",
+			"k6.test A heavy\n":      "invalid weight",
+			"k6..test A\n":           "invalid name",
+		} {
+			_, err := ParseQueryFile(strings.NewReader(input))
+			require.Error(t, err, input)
+			assert.Contains(t, err.Error(), message, input)
+		}
+	})
+}
+
+func TestWorkload(t *testing.T) {
+	t.Parallel()
+
+	newWorkload := func(t *testing.T, queries string) *Workload {
+		t.Helper()
+
+		workload, err := ParseQueryFile(strings.NewReader(queries))
+		require.NoError(t, err)
+
+		return workload
+	}
+
+	t.Run("Next starts over once every query was returned", func(t *testing.T) {
+		t.Parallel()
+
+		workload := newWorkload(t, "a.k6.test A\nb.k6.test A\n")
+
+		var names []string
+		for i := 0; i < 5; i++ {
+			names = append(names, workload.Next().Name)
+		}
+
+		assert.Equal(t, []string{"a.k6.test", "b.k6.test", "a.k6.test", "b.k6.test", "a.k6.test"}, names)
+	})
+
+	t.Run("Random picks distinct queries uniformly", func(t *testing.T) {
+		t.Parallel()
+
+		workload := newWorkload(t, "a.k6.test A\na.k6.test A\na.k6.test A\nb.k6.test A\n")
+
+		picks := make(map[string]int)
+		for i := 0; i < 2000; i++ {
+			picks[workload.Random().Name]++
+		}
+
+		assert.InDelta(t, 1000, picks["a.k6.test"], 150)
+		assert.InDelta(t, 1000, picks["b.k6.test"], 150)
+	})
+
+	t.Run("Weighted picks queries according to their weight", func(t *testing.T) {
+		t.Parallel()
+
+		workload := newWorkload(t, "a.k6.test A 3\nb.k6.test A\n")
+
+		picks := make(map[string]int)
+		for i := 0; i < 2000; i++ {
+			picks[workload.Weighted().Name]++
+		}
+
+		assert.InDelta(t, 1500, picks["a.k6.test"], 150)
+		assert.InDelta(t, 500, picks["b.k6.test"], 150)
+	})
+
+	t.Run("sequential pickers start from the first query", func(t *testing.T) {
+		t.Parallel()
+
+		workload := newWorkload(t, "a.k6.test A\nb.k6.test AAAA\n")
+		workload.Next()
+
+		pick := workload.picker(WorkloadSequential)
+
+		question, qtype := pick()
+		assert.Equal(t, Question{Name: "a.k6.test", Type: "A"}, question)
+		assert.Equal(t, dns.TypeA, qtype)
+
+		question, qtype = pick()
+		assert.Equal(t, Question{Name: "b.k6.test", Type: "AAAA"}, question)
+		assert.Equal(t, dns.TypeAAAA, qtype)
+
+		question, _ = pick()
+		assert.Equal(t, "a.k6.test", question.Name)
+	})
+
+	t.Run("invalid orders are rejected", func(t *testing.T) {
+		t.Parallel()
+
+		assert.NoError(t, WorkloadOrder("").Validate())
+		assert.Error(t, WorkloadOrder("reverse").Validate())
+	})
+}
@@ -0,0 +1,402 @@
+package dns
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// TransferType represents the type of a zone transfer.
+type TransferType string
+
+const (
+	// TransferAXFR transfers the full zone, as per [RFC5936]. It is the default.
+	//
+	// [RFC5936]: https://www.iana.org/go/rfc5936
+	TransferAXFR TransferType = "AXFR"
+
+	// TransferIXFR transfers the changes made to the zone since a given serial,
+	// as per [RFC1995].
+	//
+	// [RFC1995]: https://www.iana.org/go/rfc1995
+	TransferIXFR TransferType = "IXFR"
+)
+
+// TransferOptions holds the options of a zone transfer.
+type TransferOptions struct {
+	// Type holds the type of the transfer. It defaults to TransferAXFR.
+	Type TransferType `js:"type"`
+
+	// Serial holds the serial of the zone version the changes of an IXFR transfer
+	// are requested from.
+	Serial uint32 `js:"serial"`
+
+	// TSIG holds the key the transfer request is signed with, if any. The transfer's
+	// messages are then verified using the same key. It defaults to the TSIG key of the
+	// Client's options, set in scripts with configure.
+	TSIG TSIGOptions `js:"tsig"`
+
+	// Transport holds the transport protocol the transfer happens over, either
+	// TransportTCP or TransportTLS, for zone transfers over TLS as per [RFC9103].
+	// It defaults to TransportTCP.
+	//
+	// [RFC9103]: https://www.iana.org/go/rfc9103
+	Transport Transport `js:"transport"`
+
+	// TLS holds the options used when Transport is TransportTLS.
+	TLS TLSOptions `js:"tls"`
+}
+
+// Validate checks that the options are consistent, and returns an error describing
+// the first problem found otherwise.
+func (o TransferOptions) Validate() error {
+	switch o.Type {
+	case "", TransferAXFR, TransferIXFR:
+	default:
+		return fmt.Errorf("invalid transfer type %q; expected one of %q or %q", o.Type, TransferAXFR, TransferIXFR)
+	}
+
+	switch o.Transport {
+	case "", TransportTCP, TransportTLS:
+	default:
+		return fmt.Errorf(
+			"invalid transfer transport %q; expected one of %q or %q",
+			o.Transport, TransportTCP, TransportTLS,
+		)
+	}
+
+	if err := o.TSIG.Validate(); err != nil {
+		return fmt.Errorf("invalid tsig key: %w", err)
+	}
+
+	return nil
+}
+
+// transport returns the transport of the transfer, defaulting to TransportTCP.
+func (o TransferOptions) transport() Transport {
+	if o.Transport == "" {
+		return TransportTCP
+	}
+
+	return o.Transport
+}
+
+// transferType returns the type of the transfer, defaulting to TransferAXFR.
+func (o TransferOptions) transferType() TransferType {
+	if o.Type == "" {
+		return TransferAXFR
+	}
+
+	return o.Type
+}
+
+// TransferSummary holds the outcome of a zone transfer.
+type TransferSummary struct {
+	// Type holds the type of the transfer.
+	Type TransferType
+
+	// Serial holds the serial of the transferred zone version, as found in the
+	// SOA record starting the transfer.
+	Serial uint32
+
+	// Records holds the number of records transferred, including the SOA records
+	// delimiting the transfer.
+	Records int
+
+	// Messages holds the number of messages the transfer took.
+	Messages int
+
+	// Bytes holds the number of bytes received from the nameserver.
+	Bytes int64
+
+	// Duration holds the time elapsed from dialing the nameserver to receiving
+	// the transfer's last message.
+	Duration time.Duration
+
+	// RecordingErr holds the error opening the recording, or recording the transfer's
+	// exchange to it, failed with, when recording exchanges. It doesn't fail the
+	// transfer.
+	RecordingErr error
+}
+
+// ZoneTransfer holds the outcome of a zone transfer, along with its records.
+type ZoneTransfer struct {
+	TransferSummary
+
+	// Records holds the transferred records, in order of reception.
+	Records []dns.RR
+}
+
+// Transfer transfers the zone from the nameserver, over TCP or TLS, and returns
+// the transferred records.
+//
+// Transfers failing because of the nameserver's response code, such as a refused
+// transfer, return an *Error of the matching kind. Large zones are better transferred
+// using StreamTransfer, which doesn't hold all of their records in memory.
+func (r *Client) Transfer(
+	ctx context.Context,
+	zone string,
+	nameserver Nameserver,
+	options TransferOptions,
+) (ZoneTransfer, error) {
+	var records []dns.RR
+	summary, err := r.StreamTransfer(ctx, zone, nameserver, options, func(envelope []dns.RR) error {
+		records = append(records, envelope...)
+		return nil
+	})
+
+	return ZoneTransfer{TransferSummary: summary, Records: records}, err
+}
+
+// StreamTransfer transfers the zone from the nameserver, like Transfer does, calling
+// handle with the records of each message as they are received, rather than returning
+// them. No more than one message is read ahead while handle runs, which keeps the memory
+// used bounded by the size of a few messages, regardless of the size of the zone.
+//
+// The transfer is aborted if handle returns an error, which is then returned.
+func (r *Client) StreamTransfer(
+	ctx context.Context,
+	zone string,
+	nameserver Nameserver,
+	options TransferOptions,
+	handle func(records []dns.RR) error,
+) (TransferSummary, error) {
+	summary := TransferSummary{Type: options.transferType()}
+	if err := options.Validate(); err != nil {
+		return summary, err
+	}
+
+	start := time.Now()
+	zone = dns.Fqdn(zone)
+
+	message := new(dns.Msg)
+	if summary.Type == TransferIXFR {
+		message.SetIxfr(zone, options.Serial, ".", ".")
+	} else {
+		message.SetAxfr(zone)
+	}
+
+	message.Id = r.nextQueryID(r.options.QueryID)
+
+	conn, err := r.dialTransfer(ctx, nameserver, options)
+	if err != nil {
+		summary.Duration = time.Since(start)
+		return summary, fmt.Errorf("dialing the DNS nameserver failed: %w", err)
+	}
+
+	// Closing the connection once the context is done unblocks the transfer's reads.
+	// Recorded transfers keep every message received, to record them once the transfer
+	// ends.
+	counter := &countingConn{Conn: conn, received: messageStream{all: r.options.Record.Enabled()}}
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+
+	xfr := &dns.Transfer{Conn: &dns.Conn{Conn: counter}}
+	if tsig := options.TSIG.or(r.options.TSIG); !tsig.IsZero() {
+		xfr.TsigSecret = tsig.secrets()
+		tsig.sign(message)
+	}
+
+	queryStart := time.Now()
+	envelopes, err := xfr.In(message, nameserver.Addr())
+	if err != nil {
+		_ = conn.Close()
+		summary.Duration = time.Since(start)
+
+		return summary, fmt.Errorf("requesting the transfer of zone %s failed: %w", zone, err)
+	}
+
+	// The envelopes are drained until the transfer ends, even once it failed, for
+	// the goroutine receiving them not to block forever.
+	var transferErr, envelopeErr error
+	for envelope := range envelopes {
+		if transferErr != nil || envelopeErr != nil {
+			continue
+		}
+
+		if envelope.Error != nil {
+			envelopeErr = envelope.Error
+			continue
+		}
+
+		if summary.Messages == 0 && len(envelope.RR) > 0 {
+			if soa, ok := envelope.RR[0].(*dns.SOA); ok {
+				summary.Serial = soa.Serial
+			}
+		}
+
+		summary.Messages++
+		summary.Records += len(envelope.RR)
+
+		if err := handle(envelope.RR); err != nil {
+			transferErr = err
+			_ = conn.Close()
+		}
+	}
+
+	summary.Bytes = counter.read
+	summary.Duration = time.Since(start)
+
+	if envelopeErr != nil {
+		transferErr = transferError(zone, counter.firstMessage(), envelopeErr)
+	}
+
+	if ctxErr := ctx.Err(); ctxErr != nil && transferErr != nil {
+		transferErr = fmt.Errorf("transfer of zone %s aborted: %w", zone, ctxErr)
+	}
+
+	var log exchangeLog
+
+	exchangeOptions := r.sourceOptions(options.transport())
+	exchangeOptions.Record = r.options.Record
+	log.add(counter.trace(queryStart), nameserver, exchangeOptions)
+	summary.RecordingErr = r.recordExchanges(&log, exchangeOptions.Record, transferErr != nil)
+
+	return summary, transferErr
+}
+
+// transferError converts an error of a miekg/dns zone transfer, given the first message
+// of the transfer, if it was read. Failures of the first message's response code, or of
+// the verification of a message's TSIG signature, are converted to an *Error of the
+// matching kind.
+func transferError(zone string, first *dns.Msg, err error) error {
+	if first != nil && first.Rcode != dns.RcodeSuccess {
+		return newDNSError(first.Rcode, "transfer of zone "+zone+" failed")
+	}
+
+	if errors.Is(err, dns.ErrSig) || errors.Is(err, dns.ErrTime) || errors.Is(err, dns.ErrSecret) {
+		return verifyTSIG(nil, err)
+	}
+
+	if errors.Is(err, dns.ErrSoa) {
+		return fmt.Errorf("transfer of zone %s failed: the response doesn't start with a SOA record", zone)
+	}
+
+	return fmt.Errorf("transfer of zone %s failed: %w", zone, err)
+}
+
+// dialTransfer dials the nameserver over the transport of the transfer, from the local
+// address or network interface of the client's options, if any.
+func (r *Client) dialTransfer(ctx context.Context, nameserver Nameserver, options TransferOptions) (net.Conn, error) {
+	source := r.sourceOptions(TransportTCP)
+
+	localIP, err := source.localIP(nameserver)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := source.dialer(localIP, 0)
+
+	if options.Transport == TransportTLS {
+		// Zone transfers over TLS are identified by the "dot" ALPN token, as
+		// per RFC 9103.
+		config := options.TLS.config()
+		config.NextProtos = []string{"dot"}
+
+		return (&tls.Dialer{NetDialer: dialer, Config: config}).DialContext(ctx, "tcp", nameserver.Addr())
+	}
+
+	return dialer.DialContext(ctx, "tcp", nameserver.Addr())
+}
+
+// countingConn is a net.Conn counting the bytes read from it, and keeping the DNS
+// messages written to it and read from it, as split by messageStream.
+//
+// It is only read, and written, by a single goroutine at a time, and its count and
+// messages must only be accessed once reads and writes are done.
+type countingConn struct {
+	net.Conn
+	read int64
+
+	// written and received hold the messages written to the connection, and read
+	// from it.
+	written, received messageStream
+}
+
+// Read reads from the connection, counting the bytes read, and keeping the messages
+// they hold.
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.read += int64(n)
+	c.received.write(b[:n])
+
+	return n, err
+}
+
+// Write writes to the connection, keeping the messages written.
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.written.write(b[:n])
+
+	return n, err
+}
+
+// trace returns the trace of the exchange, started at start, of the first message
+// written to the connection, and of the messages read from it.
+func (c *countingConn) trace(start time.Time) exchangeTrace {
+	trace := exchangeTrace{start: start}
+	if len(c.written.messages) > 0 {
+		trace.query = c.written.messages[0]
+	}
+
+	if len(c.received.messages) > 0 {
+		trace.response, trace.more = c.received.messages[0], c.received.messages[1:]
+	}
+
+	return trace
+}
+
+// firstMessage returns the first message read from the connection, or nil if it
+// wasn't read in full, or fails to unpack.
+func (c *countingConn) firstMessage() *dns.Msg {
+	if len(c.received.messages) == 0 {
+		return nil
+	}
+
+	message := new(dns.Msg)
+	if err := message.Unpack(c.received.messages[0]); err != nil {
+		return nil
+	}
+
+	return message
+}
+
+// messageStream splits the bytes of a TCP or TLS stream into the length-prefixed DNS
+// messages it holds. Only the first message is kept, unless all is true, for streams
+// of large transfers not to be held in memory when they aren't recorded.
+type messageStream struct {
+	all      bool
+	pending  []byte
+	messages [][]byte
+}
+
+// write appends the bytes of the stream to the message being split, keeping the
+// messages it completes.
+func (s *messageStream) write(b []byte) {
+	for len(b) > 0 && (s.all || len(s.messages) == 0) {
+		kept := min(len(b), s.pendingLen()-len(s.pending))
+		s.pending = append(s.pending, b[:kept]...)
+		b = b[kept:]
+
+		if len(s.pending) >= 2 && len(s.pending) == s.pendingLen() {
+			s.messages = append(s.messages, s.pending[2:])
+			s.pending = nil
+		}
+	}
+}
+
+// pendingLen returns the length of the message being split, including its length
+// prefix, or the length of the prefix alone as long as it wasn't written.
+func (s *messageStream) pendingLen() int {
+	if len(s.pending) < 2 {
+		return 2
+	}
+
+	return 2 + int(binary.BigEndian.Uint16(s.pending))
+}
@@ -0,0 +1,330 @@
+package dns
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testTSIGSecret is the base64 encoded secret of the TSIG key used in tests.
+const testTSIGSecret = "c2VjcmV0LWtleS1mb3ItdGVzdGluZy1vbmx5IQ=="
+
+func TestClient_ZoneTransfer(t *testing.T) {
+	t.Parallel()
+
+	envelopes := testZoneEnvelopes(t)
+
+	t.Run("AXFR transfers return every record of the zone", func(t *testing.T) {
+		t.Parallel()
+
+		nameserver := startTestTransferServer(t, nil, testTransferHandler(t, envelopes, false))
+
+		transfer, err := NewDNSClient().Transfer(context.Background(), "k6.test", nameserver, TransferOptions{})
+		require.NoError(t, err)
+
+		assert.Equal(t, TransferAXFR, transfer.Type)
+		assert.Equal(t, uint32(2024010101), transfer.Serial)
+		assert.Len(t, transfer.Records, 5)
+		assert.Equal(t, 5, transfer.TransferSummary.Records)
+		assert.Equal(t, 2, transfer.Messages)
+		assert.Positive(t, transfer.Bytes)
+		assert.Positive(t, transfer.Duration)
+	})
+
+	t.Run("AXFR transfers happen over TLS", func(t *testing.T) {
+		t.Parallel()
+
+		nameserver := startTestTransferServer(t, testTLSConfig(t), testTransferHandler(t, envelopes, false))
+
+		transfer, err := NewDNSClient().Transfer(context.Background(), "k6.test", nameserver, TransferOptions{
+			Transport: TransportTLS,
+			TLS:       TLSOptions{InsecureSkipVerify: true},
+		})
+		require.NoError(t, err)
+		assert.Len(t, transfer.Records, 5)
+	})
+
+	t.Run("IXFR transfers send the serial of the current zone version", func(t *testing.T) {
+		t.Parallel()
+
+		var gotSerial atomic.Uint32
+		nameserver := startTestTransferServer(t, nil, func(w dns.ResponseWriter, r *dns.Msg) {
+			gotSerial.Store(r.Ns[0].(*dns.SOA).Serial) //nolint:forcetypeassert
+
+			response := new(dns.Msg)
+			response.SetReply(r)
+			response.Answer = envelopes[0][:1]
+			assert.NoError(t, w.WriteMsg(response))
+		})
+
+		transfer, err := NewDNSClient().Transfer(context.Background(), "k6.test", nameserver, TransferOptions{
+			Type:   TransferIXFR,
+			Serial: 2024010101,
+		})
+		require.NoError(t, err)
+
+		assert.Equal(t, uint32(2024010101), gotSerial.Load())
+		assert.Equal(t, TransferIXFR, transfer.Type)
+		assert.Equal(t, uint32(2024010101), transfer.Serial)
+		assert.Len(t, transfer.Records, 1)
+	})
+
+	t.Run("TSIG signed transfers are verified", func(t *testing.T) {
+		t.Parallel()
+
+		nameserver := startTestTransferServer(t, nil, testTransferHandler(t, envelopes, true))
+
+		transfer, err := NewDNSClient().Transfer(context.Background(), "k6.test", nameserver, TransferOptions{
+			TSIG: TSIGOptions{Name: "transfer.k6.test", Algorithm: "hmac-sha512", Secret: testTSIGSecret},
+		})
+		require.NoError(t, err)
+		assert.Len(t, transfer.Records, 5)
+
+		_, err = NewDNSClient().Transfer(context.Background(), "k6.test", nameserver, TransferOptions{})
+		assert.Error(t, err)
+	})
+
+	t.Run("refused transfers fail with the matching error kind", func(t *testing.T) {
+		t.Parallel()
+
+		nameserver := startTestTransferServer(t, nil, testTransferHandler(t, envelopes, false))
+
+		_, err := NewDNSClient().Transfer(context.Background(), "other.test", nameserver, TransferOptions{})
+
+		var dnsErr *Error
+		require.ErrorAs(t, err, &dnsErr)
+		assert.Equal(t, Refused, dnsErr.Kind)
+
+		tlsNameserver := startTestTransferServer(t, testTLSConfig(t), testTransferHandler(t, envelopes, false))
+		options := TransferOptions{Transport: TransportTLS, TLS: TLSOptions{InsecureSkipVerify: true}}
+
+		_, err = NewDNSClient().Transfer(context.Background(), "other.test", tlsNameserver, options)
+		require.ErrorAs(t, err, &dnsErr)
+		assert.Equal(t, Refused, dnsErr.Kind)
+	})
+
+	t.Run("streamed transfers deliver the records of each message", func(t *testing.T) {
+		t.Parallel()
+
+		soa := mustNewRR(t, "k6.test. 3600 IN SOA ns.k6.test. admin.k6.test. 7 7200 3600 1209600 300")
+		large := [][]dns.RR{{soa}}
+		for i := 0; i < 100; i++ {
+			envelope := make([]dns.RR, 0, 100)
+			for j := 0; j < 100; j++ {
+				envelope = append(envelope, mustNewRR(t, fmt.Sprintf("host-%d-%d.k6.test. 60 IN A %s", i, j, primaryTestIPv4)))
+			}
+
+			large = append(large, envelope)
+		}
+		large = append(large, []dns.RR{soa})
+
+		nameserver := startTestTransferServer(t, nil, testTransferHandler(t, large, false))
+
+		var messages, records int
+		summary, err := NewDNSClient().StreamTransfer(
+			context.Background(), "k6.test", nameserver, TransferOptions{},
+			func(envelope []dns.RR) error {
+				messages++
+				records += len(envelope)
+
+				return nil
+			},
+		)
+		require.NoError(t, err)
+
+		assert.Equal(t, 102, messages)
+		assert.Equal(t, 10002, records)
+		assert.Equal(t, records, summary.Records)
+		assert.Equal(t, messages, summary.Messages)
+		assert.Equal(t, uint32(7), summary.Serial)
+	})
+
+	t.Run("streamed transfers are aborted when the handler fails", func(t *testing.T) {
+		t.Parallel()
+
+		nameserver := startTestTransferServer(t, nil, testTransferHandler(t, envelopes, false))
+
+		errAbort := errors.New("abort")
+		summary, err := NewDNSClient().StreamTransfer(
+			context.Background(), "k6.test", nameserver, TransferOptions{},
+			func([]dns.RR) error { return errAbort },
+		)
+
+		assert.ErrorIs(t, err, errAbort)
+		assert.Equal(t, 1, summary.Messages)
+	})
+
+	t.Run("invalid options are rejected", func(t *testing.T) {
+		t.Parallel()
+
+		for _, options := range []TransferOptions{
+			{Type: "SOA"},
+			{Transport: TransportUDP},
+			{TSIG: TSIGOptions{Name: "transfer.k6.test", Secret: "not base64!"}},
+			{TSIG: TSIGOptions{Name: "transfer.k6.test", Algorithm: "hmac-md5", Secret: testTSIGSecret}},
+			{TSIG: TSIGOptions{Secret: testTSIGSecret}},
+		} {
+			_, err := NewDNSClient().Transfer(
+				context.Background(), "k6.test", Nameserver{IP: net.IPv4(127, 0, 0, 1), Port: 53}, options,
+			)
+
+			assert.Error(t, err)
+		}
+	})
+}
+
+// testZoneEnvelopes returns the records of the k6.test. zone, as sent in the two
+// messages of a zone transfer.
+func testZoneEnvelopes(t *testing.T) [][]dns.RR {
+	t.Helper()
+
+	soa := mustNewRR(t, "k6.test. 3600 IN SOA ns.k6.test. admin.k6.test. 2024010101 7200 3600 1209600 300")
+
+	return [][]dns.RR{
+		{soa, mustNewRR(t, "k6.test. 3600 IN NS ns.k6.test."), mustNewRR(t, "ns.k6.test. 3600 IN A 127.0.0.1")},
+		{mustNewRR(t, "www.k6.test. 60 IN A "+primaryTestIPv4), soa},
+	}
+}
+
+// testTransferHandler returns a handler transferring the k6.test. zone, sending each
+// envelope in its own message. Transfers of other zones are refused, as are unsigned
+// transfers when requireTSIG is set.
+func testTransferHandler(t *testing.T, envelopes [][]dns.RR, requireTSIG bool) dns.HandlerFunc {
+	t.Helper()
+
+	return func(w dns.ResponseWriter, r *dns.Msg) {
+		signed := r.IsTsig() != nil && w.TsigStatus() == nil
+		if r.Question[0].Name != "k6.test." || (requireTSIG && !signed) {
+			response := new(dns.Msg)
+			response.SetRcode(r, dns.RcodeRefused)
+			assert.NoError(t, w.WriteMsg(response))
+
+			return
+		}
+
+		transfers := make(chan *dns.Envelope)
+		go func() {
+			defer close(transfers)
+
+			for _, envelope := range envelopes {
+				transfers <- &dns.Envelope{RR: envelope}
+			}
+		}()
+
+		// The client may abort the transfer midway, failing the remaining writes.
+		_ = new(dns.Transfer).Out(w, r, transfers)
+	}
+}
+
+// startTestTransferServer starts an in-process TCP nameserver on the loopback interface,
+// serving queries using the provided handler, over TLS if a configuration is provided.
+// The nameserver verifies messages signed with the testTSIGSecret key, and is shut down
+// when the test completes.
+func startTestTransferServer(t *testing.T, config *tls.Config, handler dns.HandlerFunc) Nameserver {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	addr := listener.Addr().(*net.TCPAddr) //nolint:forcetypeassert
+	if config != nil {
+		listener = tls.NewListener(listener, config)
+	}
+
+	server := &dns.Server{
+		Listener:      listener,
+		Handler:       handler,
+		TsigSecret:    map[string]string{"transfer.k6.test.": testTSIGSecret},
+		MsgAcceptFunc: acceptTestMessage,
+	}
+
+	started := make(chan struct{})
+	server.NotifyStartedFunc = func() { close(started) }
+
+	go func() { _ = server.ActivateAndServe() }()
+	<-started
+
+	t.Cleanup(func() { _ = server.Shutdown() })
+
+	return Nameserver{IP: addr.IP, Port: uint16(addr.Port)} //nolint:gosec
+}
+
+// testTLSConfig returns a TLS configuration holding a self-signed certificate valid
+// for the loopback address.
+func testTLSConfig(t *testing.T) *tls.Config {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "k6.test"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	certificate, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{certificate}, PrivateKey: key}},
+		MinVersion:   tls.VersionTLS12,
+	}
+}
+
+func Test_countingConn(t *testing.T) {
+	t.Parallel()
+
+	message := new(dns.Msg)
+	message.SetRcode(new(dns.Msg).SetAxfr("k6.test."), dns.RcodeNotAuth)
+
+	packed, err := message.Pack()
+	require.NoError(t, err)
+
+	// The message is followed by another one, and read a byte at a time.
+	stream := append([]byte{byte(len(packed) >> 8), byte(len(packed))}, packed...)
+	stream = append(stream, stream...)
+
+	client, server := net.Pipe()
+	t.Cleanup(func() { _ = client.Close() })
+
+	go func() {
+		_, _ = server.Write(stream)
+		_ = server.Close()
+	}()
+
+	counter := &countingConn{Conn: client}
+	assert.Nil(t, counter.firstMessage())
+
+	b := make([]byte, 1)
+	for {
+		if _, err := counter.Read(b); err != nil {
+			break
+		}
+	}
+
+	assert.Equal(t, int64(len(stream)), counter.read)
+	assert.Len(t, counter.received.messages, 1, "only the first message is kept unless recording")
+
+	first := counter.firstMessage()
+	require.NotNil(t, first)
+	assert.Equal(t, dns.RcodeNotAuth, first.Rcode)
+	assert.Equal(t, message.Id, first.Id)
+}
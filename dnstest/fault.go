@@ -0,0 +1,103 @@
+package dnstest
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Fault describes the failure a FaultHandler injects in the answers to the queries
+// it matches.
+type Fault struct {
+	// Delay holds the time waited before answering, or dropping, the queries.
+	Delay time.Duration
+
+	// Drop drops the queries, leaving them unanswered.
+	Drop bool
+
+	// Truncate answers the queries received over UDP with an empty response with
+	// the TC bit set, for clients to retry over TCP, where queries are answered.
+	Truncate bool
+
+	// Rcode holds the response code, such as dns.RcodeServerFailure, the queries are
+	// answered with, in an empty response. Zero leaves the answers untouched.
+	Rcode int
+
+	// Match selects the queries the fault is injected in. It defaults to every query.
+	Match func(query *dns.Msg) bool
+}
+
+// FaultHandler is a [dns.Handler] injecting a fault in the answers of the handler it
+// wraps, to test how clients cope with misbehaving nameservers.
+type FaultHandler struct {
+	handler dns.Handler
+
+	mu    sync.Mutex
+	fault Fault
+
+	injected atomic.Int64
+}
+
+// NewFaultHandler creates a new FaultHandler injecting the fault in the answers of the
+// handler.
+func NewFaultHandler(handler dns.Handler, fault Fault) *FaultHandler {
+	return &FaultHandler{handler: handler, fault: fault}
+}
+
+// SetFault replaces the fault injected in the answers to the queries received from
+// now on. The zero Fault stops injecting faults.
+func (h *FaultHandler) SetFault(fault Fault) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.fault = fault
+}
+
+// Injected returns the number of queries the fault was injected in.
+func (h *FaultHandler) Injected() int {
+	return int(h.injected.Load())
+}
+
+// ServeDNS answers the query using the wrapped handler, unless the fault is injected
+// in its answer.
+func (h *FaultHandler) ServeDNS(w dns.ResponseWriter, query *dns.Msg) {
+	h.mu.Lock()
+	fault := h.fault
+	h.mu.Unlock()
+
+	if fault.Match != nil && !fault.Match(query) {
+		h.handler.ServeDNS(w, query)
+		return
+	}
+
+	truncate := fault.Truncate && IsUDP(w)
+	if fault.Delay > 0 || fault.Drop || truncate || fault.Rcode != 0 {
+		h.injected.Add(1)
+	}
+
+	time.Sleep(fault.Delay)
+
+	response := new(dns.Msg)
+
+	switch {
+	case fault.Drop:
+		return
+	case fault.Rcode != 0:
+		response.SetRcode(query, fault.Rcode)
+
+		// Extended response codes are carried by an OPT record.
+		if fault.Rcode > 0xF {
+			response.SetEdns0(dns.DefaultMsgSize, false)
+		}
+	case truncate:
+		response.SetReply(query)
+		response.Truncated = true
+	default:
+		h.handler.ServeDNS(w, query)
+		return
+	}
+
+	_ = w.WriteMsg(response)
+}
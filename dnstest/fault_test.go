@@ -0,0 +1,113 @@
+package dnstest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFaultHandler(t *testing.T) {
+	t.Parallel()
+
+	zone, err := NewZone("k6.test", "www 60 IN A "+testIPv4, "api 60 IN A "+testIPv4)
+	require.NoError(t, err)
+
+	exchange := func(t *testing.T, handler dns.Handler, network, name string) (*dns.Msg, time.Duration, error) {
+		t.Helper()
+
+		server := NewServer(handler)
+		t.Cleanup(server.Close)
+
+		query := new(dns.Msg)
+		query.SetQuestion(name, dns.TypeA)
+
+		client := &dns.Client{Net: network, Timeout: 500 * time.Millisecond}
+		return client.Exchange(query, server.Addr)
+	}
+
+	t.Run("delayed queries are answered late", func(t *testing.T) {
+		t.Parallel()
+
+		handler := NewFaultHandler(zone, Fault{Delay: 100 * time.Millisecond})
+
+		response, rtt, err := exchange(t, handler, "udp", "www.k6.test.")
+		require.NoError(t, err)
+
+		assert.Len(t, response.Answer, 1)
+		assert.GreaterOrEqual(t, rtt, 100*time.Millisecond)
+		assert.Equal(t, 1, handler.Injected())
+	})
+
+	t.Run("dropped queries are left unanswered", func(t *testing.T) {
+		t.Parallel()
+
+		handler := NewFaultHandler(zone, Fault{Drop: true})
+
+		_, _, err := exchange(t, handler, "udp", "www.k6.test.")
+		assert.Error(t, err)
+		assert.Equal(t, 1, handler.Injected())
+	})
+
+	t.Run("truncated queries are answered over TCP", func(t *testing.T) {
+		t.Parallel()
+
+		handler := NewFaultHandler(zone, Fault{Truncate: true})
+
+		response, _, err := exchange(t, handler, "udp", "www.k6.test.")
+		require.NoError(t, err)
+		assert.True(t, response.Truncated)
+		assert.Empty(t, response.Answer)
+
+		response, _, err = exchange(t, handler, "tcp", "www.k6.test.")
+		require.NoError(t, err)
+		assert.False(t, response.Truncated)
+		assert.Len(t, response.Answer, 1)
+
+		assert.Equal(t, 1, handler.Injected())
+	})
+
+	t.Run("response codes are injected", func(t *testing.T) {
+		t.Parallel()
+
+		handler := NewFaultHandler(zone, Fault{Rcode: dns.RcodeServerFailure})
+
+		response, _, err := exchange(t, handler, "tcp", "www.k6.test.")
+		require.NoError(t, err)
+		assert.Equal(t, dns.RcodeServerFailure, response.Rcode)
+		assert.Empty(t, response.Answer)
+	})
+
+	t.Run("faults are only injected in matching queries", func(t *testing.T) {
+		t.Parallel()
+
+		handler := NewFaultHandler(zone, Fault{
+			Rcode: dns.RcodeRefused,
+			Match: func(query *dns.Msg) bool { return query.Question[0].Name == "api.k6.test." },
+		})
+
+		response, _, err := exchange(t, handler, "udp", "www.k6.test.")
+		require.NoError(t, err)
+		assert.Equal(t, dns.RcodeSuccess, response.Rcode)
+
+		response, _, err = exchange(t, handler, "udp", "api.k6.test.")
+		require.NoError(t, err)
+		assert.Equal(t, dns.RcodeRefused, response.Rcode)
+
+		assert.Equal(t, 1, handler.Injected())
+	})
+
+	t.Run("replaced faults apply to the next queries", func(t *testing.T) {
+		t.Parallel()
+
+		handler := NewFaultHandler(zone, Fault{Drop: true})
+		handler.SetFault(Fault{})
+
+		response, _, err := exchange(t, handler, "udp", "www.k6.test.")
+		require.NoError(t, err)
+		assert.Len(t, response.Answer, 1)
+		assert.Zero(t, handler.Injected())
+	})
+}
@@ -0,0 +1,143 @@
+// Package dnstest provides in-process DNS servers for testing DNS clients, such as
+// extensions built on top of the k6/x/dns module, without network access.
+//
+// A Server answers the queries it receives over UDP and TCP using a [dns.Handler],
+// such as a Zone answering authoritatively from a set of records, or a FaultHandler
+// delaying, dropping, truncating or failing the answers of another handler:
+//
+//	zone, err := dnstest.NewZone("k6.test", "www 60 IN A 203.0.113.1")
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//
+//	server := dnstest.NewServer(dnstest.NewFaultHandler(zone, dnstest.Fault{Delay: 100 * time.Millisecond}))
+//	defer server.Close()
+package dnstest
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/miekg/dns"
+)
+
+// listenAttempts is the number of ports tried for the listeners of a server to share
+// one, as the port picked for the first listener may be taken over another network.
+const listenAttempts = 10
+
+// Server is an in-process DNS server, listening on the same port over UDP, TCP, or both.
+type Server struct {
+	// Addr holds the address the server listens on, in the ip:port format.
+	Addr string
+
+	servers []*dns.Server
+}
+
+// NewServer starts a new Server answering queries using the handler, listening on a
+// port of the loopback interface picked by the kernel, over both UDP and TCP. The
+// caller is expected to call Close once done with it.
+//
+// As with httptest.NewServer, it panics if the server can't listen.
+func NewServer(handler dns.Handler) *Server {
+	server, err := Start("127.0.0.1:0", handler)
+	if err != nil {
+		panic(fmt.Sprintf("dnstest: failed to listen on the loopback interface: %v", err))
+	}
+
+	return server
+}
+
+// Start starts a new Server answering queries using the handler, listening on the
+// address, in the ip:port format, over the networks, "udp" and "tcp", or over both if
+// none is given. The caller is expected to call Close once done with it.
+//
+// Every network listens on the same port. When the address' port is 0, the port picked
+// by the kernel for the first network is used by the others, and other ports are tried
+// if it's already taken over them.
+func Start(addr string, handler dns.Handler, networks ...string) (*Server, error) {
+	if len(networks) == 0 {
+		networks = []string{"udp", "tcp"}
+	}
+
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid address %q: %w", addr, err)
+	}
+
+	attempts := 1
+	if port == "0" && len(networks) > 1 {
+		attempts = listenAttempts
+	}
+
+	for attempt := 0; attempt < attempts; attempt++ {
+		var server *Server
+		if server, err = startServer(addr, handler, networks); err == nil {
+			return server, nil
+		}
+	}
+
+	return nil, err
+}
+
+// startServer starts a server listening on the address over the networks, using the
+// port picked for the first network for the others.
+func startServer(addr string, handler dns.Handler, networks []string) (*Server, error) {
+	s := &Server{Addr: addr}
+	for _, network := range networks {
+		server := &dns.Server{Handler: handler}
+
+		var err error
+		switch network {
+		case "udp":
+			if server.PacketConn, err = net.ListenPacket("udp", s.Addr); err == nil {
+				s.Addr = server.PacketConn.LocalAddr().String()
+			}
+		case "tcp":
+			if server.Listener, err = net.Listen("tcp", s.Addr); err == nil {
+				s.Addr = server.Listener.Addr().String()
+			}
+		default:
+			err = fmt.Errorf("unsupported network %q", network)
+		}
+
+		if err != nil {
+			s.Close()
+			return nil, fmt.Errorf("listening on %s over %s failed: %w", s.Addr, network, err)
+		}
+
+		started := make(chan struct{})
+		server.NotifyStartedFunc = func() { close(started) }
+
+		go func() { _ = server.ActivateAndServe() }()
+		<-started
+
+		s.servers = append(s.servers, server)
+	}
+
+	return s, nil
+}
+
+// Close stops the server.
+func (s *Server) Close() {
+	for _, server := range s.servers {
+		_ = server.Shutdown()
+	}
+
+	s.servers = nil
+}
+
+// IsUDP returns true if the query being answered using the writer was received over UDP.
+func IsUDP(w dns.ResponseWriter) bool {
+	_, ok := w.LocalAddr().(*net.UDPAddr)
+	return ok
+}
+
+// UDPSize returns the maximum size of the UDP responses to the query, as advertised
+// by its OPT record, or the 512 bytes of RFC 1035 otherwise.
+func UDPSize(query *dns.Msg) int {
+	if opt := query.IsEdns0(); opt != nil {
+		return max(int(opt.UDPSize()), dns.MinMsgSize)
+	}
+
+	return dns.MinMsgSize
+}
@@ -0,0 +1,71 @@
+package dnstest
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testIPv4 is the IPv4 address test zones resolve names to, from the TEST-NET-3 range
+// of [RFC 5737] to avoid any conflict with real-world addresses.
+//
+// [RFC 5737]: https://datatracker.ietf.org/doc/html/rfc5737
+const testIPv4 = "203.0.113.1"
+
+func TestServer(t *testing.T) {
+	t.Parallel()
+
+	records := []string{"@ 3600 IN SOA ns.k6.test. admin.k6.test. 7 3600 600 86400 300"}
+	for i := 0; i < 64; i++ {
+		records = append(records, fmt.Sprintf("www 60 IN A 203.0.113.%d", i+1))
+	}
+
+	zone, err := NewZone("k6.test", records...)
+	require.NoError(t, err)
+
+	server := NewServer(zone)
+	t.Cleanup(server.Close)
+
+	for _, tc := range []struct {
+		network       string
+		wantTruncated bool
+	}{
+		{network: "udp", wantTruncated: true},
+		{network: "tcp", wantTruncated: false},
+	} {
+		t.Run("answers over "+tc.network, func(t *testing.T) {
+			t.Parallel()
+
+			query := new(dns.Msg)
+			query.SetQuestion("www.k6.test.", dns.TypeA)
+
+			client := &dns.Client{Net: tc.network}
+			response, _, err := client.Exchange(query, server.Addr)
+			require.NoError(t, err)
+
+			assert.Equal(t, dns.RcodeSuccess, response.Rcode)
+			assert.True(t, response.Authoritative)
+			assert.Equal(t, tc.wantTruncated, response.Truncated)
+
+			if !tc.wantTruncated {
+				assert.Len(t, response.Answer, 64)
+			}
+		})
+	}
+
+	t.Run("closed servers don't answer", func(t *testing.T) {
+		t.Parallel()
+
+		closed := NewServer(zone)
+		closed.Close()
+
+		query := new(dns.Msg)
+		query.SetQuestion("www.k6.test.", dns.TypeA)
+
+		_, _, err := (&dns.Client{Net: "tcp"}).Exchange(query, closed.Addr)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,252 @@
+package dnstest
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// maxCNAMEChain is the maximum number of CNAME records followed when answering a query
+// from a zone, to break CNAME loops.
+const maxCNAMEChain = 8
+
+// Zone is a DNS zone answering queries authoritatively from its records. It implements
+// [dns.Handler], to be served by a Server.
+type Zone struct {
+	origin string
+	soa    *dns.SOA
+
+	// records holds the zone's records, by lower-cased owner name.
+	records map[string][]dns.RR
+}
+
+// NewZone parses the records of the zone whose apex is origin. Records are expected in
+// presentation format, and names relative to the zone's apex are accepted. Wildcard
+// records, such as *.k6.test., are supported. A SOA record is expected for negative
+// answers to hold one.
+func NewZone(origin string, records ...string) (*Zone, error) {
+	if origin == "" {
+		return nil, errors.New("a zone name must be provided")
+	}
+
+	z := &Zone{
+		origin:  dns.CanonicalName(origin),
+		records: make(map[string][]dns.RR),
+	}
+
+	parser := dns.NewZoneParser(strings.NewReader(strings.Join(records, "\n")), z.origin, "")
+	for rr, ok := parser.Next(); ok; rr, ok = parser.Next() {
+		name := dns.CanonicalName(rr.Header().Name)
+		if !dns.IsSubDomain(z.origin, name) {
+			return nil, fmt.Errorf("record %q is out of zone %s", rr.String(), z.origin)
+		}
+
+		if soa, isSOA := rr.(*dns.SOA); isSOA && name == z.origin {
+			z.soa = soa
+		}
+
+		z.records[name] = append(z.records[name], rr)
+	}
+
+	if err := parser.Err(); err != nil {
+		return nil, fmt.Errorf("invalid records of zone %s: %w", z.origin, err)
+	}
+
+	return z, nil
+}
+
+// ServeDNS answers the query from the zone's records. Responses sent over UDP are
+// truncated to the size the query advertises.
+func (z *Zone) ServeDNS(w dns.ResponseWriter, query *dns.Msg) {
+	response := new(dns.Msg)
+	if len(query.Question) != 1 {
+		response.SetRcode(query, dns.RcodeFormatError)
+	} else {
+		response = z.Answer(query)
+	}
+
+	if IsUDP(w) {
+		response.Truncate(UDPSize(query))
+	}
+
+	_ = w.WriteMsg(response)
+}
+
+// Answer answers the query, expected to hold a single question, from the zone's records.
+//
+// CNAME records are followed within the zone. Names the zone doesn't hold records for
+// are answered from the matching wildcard records, if any, and denied otherwise, along
+// with the zone's SOA record. Queries for names at, or below, a delegation of the zone,
+// an NS record set below its apex, are answered with a referral holding the glue records
+// of the delegation's nameservers. Queries for names out of the zone are refused.
+func (z *Zone) Answer(query *dns.Msg) *dns.Msg {
+	response := new(dns.Msg)
+	response.SetReply(query)
+
+	question := query.Question[0]
+	name := dns.CanonicalName(question.Name)
+
+	if !dns.IsSubDomain(z.origin, name) {
+		response.Rcode = dns.RcodeRefused
+		return response
+	}
+
+	if delegation := z.delegation(name, question.Qtype); delegation != nil {
+		z.appendReferral(response, delegation)
+		return response
+	}
+
+	response.Authoritative = true
+
+	for i := 0; i <= maxCNAMEChain; i++ {
+		// Names below delegations are answered by the delegated zones.
+		if i > 0 && z.delegation(name, question.Qtype) != nil {
+			return response
+		}
+
+		records, exists := z.lookup(name)
+		if !exists {
+			response.Rcode = dns.RcodeNameError
+			z.appendSOA(response)
+
+			return response
+		}
+
+		var cname *dns.CNAME
+		for _, rr := range records {
+			rrtype := rr.Header().Rrtype
+
+			switch {
+			case rrtype == question.Qtype, question.Qtype == dns.TypeANY:
+				response.Answer = append(response.Answer, rr)
+			case rrtype == dns.TypeCNAME:
+				cname, _ = rr.(*dns.CNAME)
+			}
+		}
+
+		if cname == nil {
+			break
+		}
+
+		response.Answer = append(response.Answer, cname)
+
+		name = dns.CanonicalName(cname.Target)
+		if !dns.IsSubDomain(z.origin, name) {
+			return response
+		}
+	}
+
+	if len(response.Answer) == 0 {
+		z.appendSOA(response)
+	}
+
+	return response
+}
+
+// delegation returns the NS records of the topmost delegation the name is at, or below,
+// or nil if the zone is authoritative for the name. DS records are answered by the
+// parent side of a delegation, and so DS queries for a delegation's name aren't referred.
+func (z *Zone) delegation(name string, qtype uint16) []dns.RR {
+	var delegation []dns.RR
+	for cut := name; cut != z.origin; {
+		if qtype != dns.TypeDS || cut != name {
+			var nameservers []dns.RR
+			for _, rr := range z.records[cut] {
+				if rr.Header().Rrtype == dns.TypeNS {
+					nameservers = append(nameservers, rr)
+				}
+			}
+
+			if nameservers != nil {
+				delegation = nameservers
+			}
+		}
+
+		labels := dns.SplitDomainName(cut)
+		cut = dns.Fqdn(strings.Join(labels[1:], "."))
+	}
+
+	return delegation
+}
+
+// appendReferral appends the delegation's NS records to the response's authority
+// section, and the addresses the zone holds for their nameservers, the glue records, to
+// its additional section.
+func (z *Zone) appendReferral(response *dns.Msg, delegation []dns.RR) {
+	response.Ns = append(response.Ns, delegation...)
+
+	for _, rr := range delegation {
+		ns, _ := rr.(*dns.NS)
+		for _, glue := range z.records[dns.CanonicalName(ns.Ns)] {
+			if rrtype := glue.Header().Rrtype; rrtype == dns.TypeA || rrtype == dns.TypeAAAA {
+				response.Extra = append(response.Extra, glue)
+			}
+		}
+	}
+}
+
+// lookup returns the records the zone holds for the name, renamed after the name when
+// they are synthesized from a wildcard record. It returns false if the name doesn't
+// exist in the zone.
+func (z *Zone) lookup(name string) ([]dns.RR, bool) {
+	if z.exists(name) {
+		return z.records[name], true
+	}
+
+	// The closest encloser's wildcard, if any, answers for the name, as per RFC 4592.
+	for encloser := name; encloser != z.origin; {
+		labels := dns.SplitDomainName(encloser)
+		encloser = dns.Fqdn(strings.Join(labels[1:], "."))
+
+		if !z.exists(encloser) {
+			continue
+		}
+
+		wildcards, ok := z.records["*."+encloser]
+		if !ok {
+			return nil, false
+		}
+
+		synthesized := make([]dns.RR, 0, len(wildcards))
+		for _, rr := range wildcards {
+			rr = dns.Copy(rr)
+			rr.Header().Name = name
+			synthesized = append(synthesized, rr)
+		}
+
+		return synthesized, true
+	}
+
+	return nil, false
+}
+
+// exists returns true if the zone holds records for the name, or for names below it,
+// in which case the name is an empty non-terminal.
+func (z *Zone) exists(name string) bool {
+	if _, ok := z.records[name]; ok {
+		return true
+	}
+
+	for owner := range z.records {
+		if dns.IsSubDomain(name, owner) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// appendSOA appends the zone's SOA record to the response's authority section, as
+// negative answers expect, with its TTL capped to the negative caching TTL.
+func (z *Zone) appendSOA(response *dns.Msg) {
+	if z.soa == nil {
+		return
+	}
+
+	soa := dns.Copy(z.soa).(*dns.SOA) //nolint:forcetypeassert
+	soa.Hdr.Ttl = min(soa.Hdr.Ttl, soa.Minttl)
+
+	response.Ns = append(response.Ns, soa)
+}
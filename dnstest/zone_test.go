@@ -0,0 +1,135 @@
+package dnstest
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestZone_Answer(t *testing.T) {
+	t.Parallel()
+
+	z, err := NewZone(
+		"k6.test",
+		"@ 3600 IN SOA ns.k6.test. admin.k6.test. 7 3600 600 86400 300",
+		"www 60 IN A "+testIPv4,
+		"alias 60 IN CNAME www",
+		"external 60 IN CNAME www.example.com.",
+		"*.apps 60 IN A "+testIPv4,
+		"deep.empty 60 IN TXT \"below an empty non-terminal\"",
+		"delegated 3600 IN NS ns.delegated",
+		"ns.delegated 3600 IN A "+testIPv4,
+		"referred 60 IN CNAME www.delegated",
+	)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name        string
+		qname       string
+		qtype       uint16
+		wantRcode   int
+		wantAnswers int
+		wantSOA     bool
+	}{
+		{name: "existing records are answered", qname: "www.k6.test.", qtype: dns.TypeA, wantAnswers: 1},
+		{name: "names are matched case insensitively", qname: "WWW.k6.Test.", qtype: dns.TypeA, wantAnswers: 1},
+		{name: "CNAME records are followed", qname: "alias.k6.test.", qtype: dns.TypeA, wantAnswers: 2},
+		{name: "CNAME records out of the zone are not followed", qname: "external.k6.test.", qtype: dns.TypeA, wantAnswers: 1},
+		{name: "CNAME records are answered as such", qname: "alias.k6.test.", qtype: dns.TypeCNAME, wantAnswers: 1},
+		{name: "wildcards answer for names below them", qname: "a.b.apps.k6.test.", qtype: dns.TypeA, wantAnswers: 1},
+		{name: "missing types are denied", qname: "www.k6.test.", qtype: dns.TypeAAAA, wantSOA: true},
+		{name: "empty non-terminals exist", qname: "empty.k6.test.", qtype: dns.TypeA, wantSOA: true},
+		{name: "ANY queries return every record", qname: "k6.test.", qtype: dns.TypeANY, wantAnswers: 1},
+		{
+			name: "missing names are denied", qname: "missing.k6.test.", qtype: dns.TypeA,
+			wantRcode: dns.RcodeNameError, wantSOA: true,
+		},
+		{
+			name: "names out of the zone are refused", qname: "www.example.com.", qtype: dns.TypeA,
+			wantRcode: dns.RcodeRefused,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			query := new(dns.Msg)
+			query.SetQuestion(tc.qname, tc.qtype)
+
+			response := z.Answer(query)
+
+			assert.Equal(t, tc.wantRcode, response.Rcode)
+			assert.Len(t, response.Answer, tc.wantAnswers)
+			assert.Equal(t, tc.wantRcode != dns.RcodeRefused, response.Authoritative)
+
+			if tc.wantSOA {
+				require.Len(t, response.Ns, 1)
+				assert.Equal(t, uint32(300), response.Ns[0].Header().Ttl)
+			} else {
+				assert.Empty(t, response.Ns)
+			}
+		})
+	}
+
+	t.Run("wildcard answers are renamed after the queried name", func(t *testing.T) {
+		t.Parallel()
+
+		query := new(dns.Msg)
+		query.SetQuestion("api.apps.k6.test.", dns.TypeA)
+
+		response := z.Answer(query)
+		require.Len(t, response.Answer, 1)
+		assert.Equal(t, "api.apps.k6.test.", response.Answer[0].Header().Name)
+	})
+
+	t.Run("names at or below delegations are referred to their nameservers", func(t *testing.T) {
+		t.Parallel()
+
+		for _, qname := range []string{"delegated.k6.test.", "www.delegated.k6.test."} {
+			query := new(dns.Msg)
+			query.SetQuestion(qname, dns.TypeA)
+
+			response := z.Answer(query)
+			assert.Equal(t, dns.RcodeSuccess, response.Rcode)
+			assert.False(t, response.Authoritative)
+			assert.Empty(t, response.Answer)
+
+			require.Len(t, response.Ns, 1)
+			assert.Equal(t, "ns.delegated.k6.test.", response.Ns[0].(*dns.NS).Ns) //nolint:forcetypeassert
+			require.Len(t, response.Extra, 1)
+			assert.Equal(t, "ns.delegated.k6.test.", response.Extra[0].Header().Name)
+		}
+	})
+
+	t.Run("delegations are answered authoritatively for DS queries and CNAME targets", func(t *testing.T) {
+		t.Parallel()
+
+		query := new(dns.Msg)
+		query.SetQuestion("delegated.k6.test.", dns.TypeDS)
+
+		response := z.Answer(query)
+		assert.True(t, response.Authoritative)
+		assert.Empty(t, response.Answer)
+
+		query.SetQuestion("referred.k6.test.", dns.TypeA)
+
+		response = z.Answer(query)
+		assert.True(t, response.Authoritative)
+		require.Len(t, response.Answer, 1)
+		assert.Equal(t, dns.TypeCNAME, response.Answer[0].Header().Rrtype)
+	})
+
+	t.Run("invalid zones are rejected", func(t *testing.T) {
+		t.Parallel()
+
+		for _, records := range [][]string{
+			{"", "www.k6.test. 60 IN A " + testIPv4},
+			{"k6.test", "www.example.com. 60 IN A " + testIPv4},
+			{"k6.test", "www 60 IN A not-an-ip"},
+		} {
+			_, err := NewZone(records[0], records[1:]...)
+			assert.Error(t, err)
+		}
+	})
+}